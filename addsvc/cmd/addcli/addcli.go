@@ -22,6 +22,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 
+	"github.com/go-kit/examples/addsvc/pkg/addendpoint"
 	"github.com/go-kit/examples/addsvc/pkg/addservice"
 	"github.com/go-kit/examples/addsvc/pkg/addtransport"
 	addthrift "github.com/go-kit/examples/addsvc/thrift/gen-go/addsvc"
@@ -40,7 +41,7 @@ func main() {
 		grpcAddr       = fs.String("grpc-addr", "", "gRPC address of addsvc")
 		thriftAddr     = fs.String("thrift-addr", "", "Thrift address of addsvc")
 		jsonRPCAddr    = fs.String("jsonrpc-addr", "", "JSON RPC address of addsvc")
-		thriftProtocol = fs.String("thrift-protocol", "binary", "binary, compact, json, simplejson")
+		thriftProtocol = fs.String("thrift-protocol", "binary", "binary, compact, json, simplejson, header")
 		thriftBuffer   = fs.Int("thrift-buffer", 0, "0 for unbuffered")
 		thriftFramed   = fs.Bool("thrift-framed", false, "true to enable framing")
 		zipkinURL      = fs.String("zipkin-url", "", "Enable Zipkin tracing via HTTP reporter URL e.g. http://localhost:9411/api/v2/spans")
@@ -48,6 +49,8 @@ func main() {
 		lightstepToken = fs.String("lightstep-token", "", "Enable LightStep tracing via a LightStep access token")
 		appdashAddr    = fs.String("appdash-addr", "", "Enable Appdash tracing via an Appdash server host:port")
 		method         = fs.String("method", "sum", "sum, concat")
+		token          = fs.String("token", "", "JWT to authenticate with")
+		apiKey         = fs.String("api-key", "", "API key to authenticate with")
 	)
 	fs.Usage = usageFor(fs, os.Args[0]+" [flags] <a> <b>")
 	fs.Parse(os.Args[1:])
@@ -128,6 +131,8 @@ func main() {
 			protocolFactory = thrift.NewTJSONProtocolFactory()
 		case "binary", "":
 			protocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
+		case "header":
+			protocolFactory = thrift.NewTHeaderProtocolFactoryConf(nil)
 		default:
 			fmt.Fprintf(os.Stderr, "error: invalid protocol %q\n", *thriftProtocol)
 			os.Exit(1)
@@ -167,11 +172,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The credentials are sent by every transport, except for Thrift, which
+	// only sends them with the header protocol.
+	ctx := context.Background()
+	switch {
+	case *token != "":
+		ctx = addendpoint.ContextWithAuthorization(ctx, "Bearer "+*token)
+	case *apiKey != "":
+		ctx = addendpoint.ContextWithAuthorization(ctx, "ApiKey "+*apiKey)
+	}
+
 	switch *method {
 	case "sum":
 		a, _ := strconv.ParseInt(fs.Args()[0], 10, 64)
 		b, _ := strconv.ParseInt(fs.Args()[1], 10, 64)
-		v, err := svc.Sum(context.Background(), int(a), int(b))
+		v, err := svc.Sum(ctx, int(a), int(b))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
@@ -181,7 +196,7 @@ func main() {
 	case "concat":
 		a := fs.Args()[0]
 		b := fs.Args()[1]
-		v, err := svc.Concat(context.Background(), a, b)
+		v, err := svc.Concat(ctx, a, b)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
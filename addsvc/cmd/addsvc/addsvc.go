@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
 	lightstep "github.com/lightstep/lightstep-tracer-go"
@@ -20,6 +27,8 @@ import (
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"sigs.k8s.io/yaml"
 	"sourcegraph.com/sourcegraph/appdash"
 	appdashot "sourcegraph.com/sourcegraph/appdash/opentracing"
 
@@ -33,6 +42,7 @@ import (
 	"github.com/go-kit/examples/addsvc/pkg/addservice"
 	"github.com/go-kit/examples/addsvc/pkg/addtransport"
 	addthrift "github.com/go-kit/examples/addsvc/thrift/gen-go/addsvc"
+	"github.com/go-kit/examples/health"
 )
 
 func main() {
@@ -46,14 +56,21 @@ func main() {
 		grpcAddr       = fs.String("grpc-addr", ":8082", "gRPC listen address")
 		thriftAddr     = fs.String("thrift-addr", ":8083", "Thrift listen address")
 		jsonRPCAddr    = fs.String("jsonrpc-addr", ":8084", "JSON RPC listen address")
-		thriftProtocol = fs.String("thrift-protocol", "binary", "binary, compact, json, simplejson")
+		thriftProtocol = fs.String("thrift-protocol", "binary", "binary, compact, json, simplejson, header")
 		thriftBuffer   = fs.Int("thrift-buffer", 0, "0 for unbuffered")
 		thriftFramed   = fs.Bool("thrift-framed", false, "true to enable framing")
 		zipkinURL      = fs.String("zipkin-url", "", "Enable Zipkin tracing via HTTP reporter URL e.g. http://localhost:9411/api/v2/spans")
 		zipkinBridge   = fs.Bool("zipkin-ot-bridge", false, "Use Zipkin OpenTracing bridge instead of native implementation")
 		lightstepToken = fs.String("lightstep-token", "", "Enable LightStep tracing via a LightStep access token")
 		appdashAddr    = fs.String("appdash-addr", "", "Enable Appdash tracing via an Appdash server host:port")
+		policyFile     = fs.String("policy-file", "", "JSON or YAML file with the resilience policy of each method; reloaded on SIGHUP")
+		drainDelay     = fs.Duration("drain-delay", 5*time.Second, "Time to go on accepting requests on shutdown, after readiness flips to not ready, for load balancers to notice")
+		drainTimeout   = fs.Duration("drain-timeout", 10*time.Second, "Time allowed for in-flight requests to finish on shutdown")
+		jwksFile       = fs.String("jwks-file", "", "JSON Web Key Set file with the HS256 and RS256 keys that JWTs may be signed with")
+		apiKeysFile    = fs.String("api-keys-file", "", "JSON file with the static API keys, as an object of names to keys")
 	)
+	defaultPolicy := addendpoint.DefaultPolicy()
+	policyFlags(fs, &defaultPolicy)
 	fs.Usage = usageFor(fs, os.Args[0]+" [flags]")
 	fs.Parse(os.Args[1:])
 
@@ -65,6 +82,10 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
+	// The tracers report spans to collectors, by the name of the tracer.
+	// Readiness checks that they're reachable.
+	collectors := map[string]string{}
+
 	var zipkinTracer *zipkin.Tracer
 	{
 		if *zipkinURL != "" {
@@ -75,6 +96,10 @@ func main() {
 				reporter    = zipkinhttp.NewReporter(*zipkinURL)
 			)
 			defer reporter.Close()
+			if collectors["zipkin"], err = urlHostPort(*zipkinURL); err != nil {
+				logger.Log("zipkin-url", *zipkinURL, "err", err)
+				os.Exit(1)
+			}
 			zEP, _ := zipkin.NewEndpoint(serviceName, hostPort)
 			zipkinTracer, err = zipkin.NewTracer(reporter, zipkin.WithLocalEndpoint(zEP))
 			if err != nil {
@@ -101,9 +126,11 @@ func main() {
 				AccessToken: *lightstepToken,
 			})
 			defer lightstep.FlushLightStepTracer(tracer)
+			collectors["lightstep"] = net.JoinHostPort(lightstep.DefaultGRPCCollectorHost, strconv.Itoa(lightstep.DefaultSecurePort))
 		} else if *appdashAddr != "" {
 			logger.Log("tracer", "Appdash", "addr", *appdashAddr)
 			tracer = appdashot.NewTracer(appdash.NewRemoteCollector(*appdashAddr))
+			collectors["appdash"] = *appdashAddr
 		} else {
 			tracer = stdopentracing.GlobalTracer() // no-op
 		}
@@ -139,6 +166,30 @@ func main() {
 	}
 	http.DefaultServeMux.Handle("/metrics", promhttp.Handler())
 
+	// The resilience policy comes from the policy file, if any, with the
+	// policy flags taking precedence. It's loaded again on SIGHUP, below.
+	var policy *addendpoint.LivePolicy
+	{
+		p, err := loadPolicy(fs, *policyFile)
+		if err != nil {
+			logger.Log("policy", *policyFile, "err", err)
+			os.Exit(1)
+		}
+		policy = addendpoint.NewLivePolicy(p)
+	}
+
+	// Callers must authenticate with a JWT or an API key as soon as either is
+	// configured. Without them, authentication is disabled.
+	var auth *addendpoint.Authenticator
+	if *jwksFile != "" || *apiKeysFile != "" {
+		a, err := loadAuthenticator(*jwksFile, *apiKeysFile)
+		if err != nil {
+			logger.Log("auth", "load", "err", err)
+			os.Exit(1)
+		}
+		auth = a
+	}
+
 	// Build the layers of the service "onion" from the inside out. First, the
 	// business logic service; then, the set of endpoints that wrap the service;
 	// and finally, a series of concrete transport adapters. The adapters, like
@@ -147,13 +198,30 @@ func main() {
 	// them to ports or anything yet; we'll do that next.
 	var (
 		service        = addservice.New(logger, ints, chars)
-		endpoints      = addendpoint.New(service, logger, duration, tracer, zipkinTracer)
+		endpoints      = addendpoint.New(service, policy, auth, logger, duration, tracer, zipkinTracer)
 		httpHandler    = addtransport.NewHTTPHandler(endpoints, tracer, zipkinTracer, logger)
 		grpcServer     = addtransport.NewGRPCServer(endpoints, tracer, zipkinTracer, logger)
 		thriftServer   = addtransport.NewThriftServer(endpoints)
 		jsonrpcHandler = addtransport.NewJSONRPCHandler(endpoints, logger)
 	)
 
+	// Liveness only tells whether the process is up and serving the debug
+	// listener. Readiness also checks the dependencies of the endpoints, and
+	// is what the gRPC health service reports.
+	var liveness, readiness *health.Checker
+	{
+		liveness = health.NewChecker()
+		readiness = health.NewChecker()
+		for name, check := range endpoints.Checks() {
+			readiness.Register(name, check)
+		}
+		for name, addr := range collectors {
+			readiness.Register(name+"_tracer", reachable(addr))
+		}
+		http.DefaultServeMux.Handle("/healthz", health.Handler(liveness))
+		http.DefaultServeMux.Handle("/readyz", health.Handler(readiness))
+	}
+
 	// Now we're to the part of the func main where we want to start actually
 	// running things, like servers bound to listeners to receive connections.
 	//
@@ -166,6 +234,19 @@ func main() {
 	//
 	// Putting each component into its own block is mostly for aesthetics: it
 	// clearly demarcates the scope in which each listener/socket may be used.
+	//
+	// On shutdown, readiness flips to not ready at once, but the servers go
+	// on accepting new requests for the drain delay, while load balancers
+	// notice. Then they stop accepting them, and drain the in-flight ones
+	// until the drain deadline. The debug listener, which serves readiness,
+	// stays up until all of the other servers are done.
+	drainer := newDrainer(*drainDelay, *drainTimeout, logger)
+	readiness.Register("draining", func(context.Context) error {
+		if !drainer.ready() {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
 	var g group.Group
 	{
 		// The debug listener mounts the http.DefaultServeMux, and serves up
@@ -176,11 +257,15 @@ func main() {
 			logger.Log("transport", "debug/HTTP", "during", "Listen", "err", err)
 			os.Exit(1)
 		}
+		debugServer := &http.Server{Handler: http.DefaultServeMux}
 		g.Add(func() error {
 			logger.Log("transport", "debug/HTTP", "addr", *debugAddr)
-			return http.Serve(debugListener, http.DefaultServeMux)
+			return debugServer.Serve(debugListener)
 		}, func(error) {
-			debugListener.Close()
+			go func() {
+				drainer.wait()
+				debugServer.Close()
+			}()
 		})
 	}
 	{
@@ -190,12 +275,11 @@ func main() {
 			logger.Log("transport", "HTTP", "during", "Listen", "err", err)
 			os.Exit(1)
 		}
-		g.Add(func() error {
+		httpServer := &http.Server{Handler: httpHandler}
+		g.Add(drainer.actor("HTTP", func() error {
 			logger.Log("transport", "HTTP", "addr", *httpAddr)
-			return http.Serve(httpListener, httpHandler)
-		}, func(error) {
-			httpListener.Close()
-		})
+			return httpServer.Serve(httpListener)
+		}, shutdownHTTP(httpServer)))
 	}
 	{
 		// The gRPC listener mounts the Go kit gRPC server we created.
@@ -204,16 +288,15 @@ func main() {
 			logger.Log("transport", "gRPC", "during", "Listen", "err", err)
 			os.Exit(1)
 		}
-		g.Add(func() error {
+		// we add the Go Kit gRPC Interceptor to our gRPC service as it is used by
+		// the here demonstrated zipkin tracing middleware.
+		baseServer := grpc.NewServer(grpc.UnaryInterceptor(kitgrpc.Interceptor))
+		addpb.RegisterAddServer(baseServer, grpcServer)
+		healthpb.RegisterHealthServer(baseServer, health.NewGRPCServer(readiness, "pb.Add"))
+		g.Add(drainer.actor("gRPC", func() error {
 			logger.Log("transport", "gRPC", "addr", *grpcAddr)
-			// we add the Go Kit gRPC Interceptor to our gRPC service as it is used by
-			// the here demonstrated zipkin tracing middleware.
-			baseServer := grpc.NewServer(grpc.UnaryInterceptor(kitgrpc.Interceptor))
-			addpb.RegisterAddServer(baseServer, grpcServer)
 			return baseServer.Serve(grpcListener)
-		}, func(error) {
-			grpcListener.Close()
-		})
+		}, shutdownGRPC(baseServer)))
 	}
 	{
 		// The Thrift socket mounts the Go kit Thrift server we created earlier.
@@ -224,39 +307,41 @@ func main() {
 			logger.Log("transport", "Thrift", "during", "Listen", "err", err)
 			os.Exit(1)
 		}
-		g.Add(func() error {
+		var protocolFactory thrift.TProtocolFactory
+		switch *thriftProtocol {
+		case "binary":
+			protocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
+		case "compact":
+			protocolFactory = thrift.NewTCompactProtocolFactory()
+		case "json":
+			protocolFactory = thrift.NewTJSONProtocolFactory()
+		case "simplejson":
+			protocolFactory = thrift.NewTSimpleJSONProtocolFactory()
+		case "header":
+			protocolFactory = thrift.NewTHeaderProtocolFactoryConf(nil)
+		default:
+			logger.Log("transport", "Thrift", "err", fmt.Errorf("invalid Thrift protocol %q", *thriftProtocol))
+			os.Exit(1)
+		}
+		var transportFactory thrift.TTransportFactory
+		if *thriftBuffer > 0 {
+			transportFactory = thrift.NewTBufferedTransportFactory(*thriftBuffer)
+		} else {
+			transportFactory = thrift.NewTTransportFactory()
+		}
+		if *thriftFramed {
+			transportFactory = thrift.NewTFramedTransportFactory(transportFactory)
+		}
+		baseServer := thrift.NewTSimpleServer4(
+			addthrift.NewAddServiceProcessor(thriftServer),
+			thriftSocket,
+			transportFactory,
+			protocolFactory,
+		)
+		g.Add(drainer.actor("Thrift", func() error {
 			logger.Log("transport", "Thrift", "addr", *thriftAddr)
-			var protocolFactory thrift.TProtocolFactory
-			switch *thriftProtocol {
-			case "binary":
-				protocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
-			case "compact":
-				protocolFactory = thrift.NewTCompactProtocolFactory()
-			case "json":
-				protocolFactory = thrift.NewTJSONProtocolFactory()
-			case "simplejson":
-				protocolFactory = thrift.NewTSimpleJSONProtocolFactory()
-			default:
-				return fmt.Errorf("invalid Thrift protocol %q", *thriftProtocol)
-			}
-			var transportFactory thrift.TTransportFactory
-			if *thriftBuffer > 0 {
-				transportFactory = thrift.NewTBufferedTransportFactory(*thriftBuffer)
-			} else {
-				transportFactory = thrift.NewTTransportFactory()
-			}
-			if *thriftFramed {
-				transportFactory = thrift.NewTFramedTransportFactory(transportFactory)
-			}
-			return thrift.NewTSimpleServer4(
-				addthrift.NewAddServiceProcessor(thriftServer),
-				thriftSocket,
-				transportFactory,
-				protocolFactory,
-			).Serve()
-		}, func(error) {
-			thriftSocket.Close()
-		})
+			return baseServer.Serve()
+		}, shutdownThrift(baseServer)))
 	}
 	{
 		httpListener, err := net.Listen("tcp", *jsonRPCAddr)
@@ -264,11 +349,36 @@ func main() {
 			logger.Log("transport", "JSONRPC over HTTP", "during", "Listen", "err", err)
 			os.Exit(1)
 		}
-		g.Add(func() error {
+		httpServer := &http.Server{Handler: jsonrpcHandler}
+		g.Add(drainer.actor("JSONRPC over HTTP", func() error {
 			logger.Log("transport", "JSONRPC over HTTP", "addr", *jsonRPCAddr)
-			return http.Serve(httpListener, jsonrpcHandler)
+			return httpServer.Serve(httpListener)
+		}, shutdownHTTP(httpServer)))
+	}
+	{
+		// This function reloads the resilience policy on SIGHUP. A policy
+		// that fails to load is logged, and the current one stays in place.
+		cancelReload := make(chan struct{})
+		g.Add(func() error {
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, syscall.SIGHUP)
+			defer signal.Stop(c)
+			for {
+				select {
+				case <-c:
+					p, err := loadPolicy(fs, *policyFile)
+					if err != nil {
+						logger.Log("policy", *policyFile, "during", "reload", "err", err)
+						continue
+					}
+					policy.Store(p)
+					logger.Log("policy", *policyFile, "reloaded", true)
+				case <-cancelReload:
+					return nil
+				}
+			}
 		}, func(error) {
-			httpListener.Close()
+			close(cancelReload)
 		})
 	}
 	{
@@ -290,6 +400,41 @@ func main() {
 	logger.Log("exit", g.Run())
 }
 
+// reachable returns a check that addr accepts TCP connections, as the
+// collector of a tracer must for the spans to get anywhere.
+func reachable(addr string) health.Check {
+	return func(ctx context.Context) error {
+		conn, err := (&net.Dialer{Timeout: time.Second}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// urlHostPort returns the host:port that rawurl points to, with the default
+// port of its scheme if it has none.
+func urlHostPort(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("no host in %q", rawurl)
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	switch u.Scheme {
+	case "http":
+		return net.JoinHostPort(u.Hostname(), "80"), nil
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443"), nil
+	default:
+		return "", fmt.Errorf("no port in %q", rawurl)
+	}
+}
+
 func usageFor(fs *flag.FlagSet, short string) func() {
 	return func() {
 		fmt.Fprintf(os.Stderr, "USAGE\n")
@@ -304,3 +449,121 @@ func usageFor(fs *flag.FlagSet, short string) func() {
 		fmt.Fprintf(os.Stderr, "\n")
 	}
 }
+
+// loadPolicy returns the default policy, overridden by the policy file if
+// there is one, and then by the policy flags that were set on fs. Files named
+// *.yaml or *.yml are YAML, with the same fields as the JSON ones.
+func loadPolicy(fs *flag.FlagSet, filename string) (addendpoint.Policy, error) {
+	p := addendpoint.DefaultPolicy()
+	if filename != "" {
+		buf, err := os.ReadFile(filename)
+		if err != nil {
+			return p, err
+		}
+		switch filepath.Ext(filename) {
+		case ".yaml", ".yml":
+			if buf, err = yaml.YAMLToJSON(buf); err != nil {
+				return p, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+		if err := json.Unmarshal(buf, &p); err != nil {
+			return p, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	overrides := flag.NewFlagSet("policy", flag.ContinueOnError)
+	policyFlags(overrides, &p)
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if overrides.Lookup(f.Name) != nil && err == nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return p, err
+	}
+	return p, p.Validate()
+}
+
+// loadAuthenticator returns an Authenticator with the keys of the JWKS file
+// and the API keys of the API keys file. Either file name may be empty.
+func loadAuthenticator(jwksFile, apiKeysFile string) (*addendpoint.Authenticator, error) {
+	var keys addendpoint.KeySet
+	if jwksFile != "" {
+		buf, err := os.ReadFile(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		if keys, err = addendpoint.ParseKeySet(buf); err != nil {
+			return nil, fmt.Errorf("%s: %w", jwksFile, err)
+		}
+	}
+	var apiKeys map[string]string
+	if apiKeysFile != "" {
+		buf, err := os.ReadFile(apiKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buf, &apiKeys); err != nil {
+			return nil, fmt.Errorf("%s: %w", apiKeysFile, err)
+		}
+	}
+	return addendpoint.NewAuthenticator(keys, apiKeys), nil
+}
+
+// policyFlags defines the flags that configure each field of the policy p.
+func policyFlags(fs *flag.FlagSet, p *addendpoint.Policy) {
+	for _, m := range []struct {
+		prefix string
+		policy *addendpoint.MethodPolicy
+	}{
+		{"sum", &p.Sum},
+		{"concat", &p.Concat},
+	} {
+		fs.Var(durationValue{&m.policy.RateLimit.Every}, m.prefix+".rate-every", "Interval between requests allowed by the rate limiter, 0 for unlimited")
+		fs.IntVar(&m.policy.RateLimit.Burst, m.prefix+".rate-burst", m.policy.RateLimit.Burst, "Burst of requests allowed by the rate limiter")
+		fs.Var(uint32Value{&m.policy.CircuitBreaker.MaxRequests}, m.prefix+".breaker-max-requests", "Requests allowed through the half-open circuit breaker")
+		fs.Var(durationValue{&m.policy.CircuitBreaker.Interval}, m.prefix+".breaker-interval", "Interval at which the closed circuit breaker clears its counts")
+		fs.Var(durationValue{&m.policy.CircuitBreaker.Timeout}, m.prefix+".breaker-timeout", "Time the circuit breaker stays open")
+		fs.Var(uint32Value{&m.policy.CircuitBreaker.ConsecutiveFailures}, m.prefix+".breaker-failures", "Consecutive failures that open the circuit breaker")
+		fs.Var(durationValue{&m.policy.Timeout}, m.prefix+".timeout", "Timeout of each attempt, 0 for none")
+		fs.IntVar(&m.policy.MaxConcurrent, m.prefix+".max-concurrent", m.policy.MaxConcurrent, "Concurrent requests allowed by the bulkhead, 0 for unlimited")
+		fs.IntVar(&m.policy.Retry.Max, m.prefix+".retry-max", m.policy.Retry.Max, "Retries of requests that fail with a timeout or other transient error")
+		fs.Var(durationValue{&m.policy.Retry.Backoff}, m.prefix+".retry-backoff", "Wait before each retry")
+	}
+}
+
+type durationValue struct{ d *addendpoint.Duration }
+
+func (v durationValue) String() string {
+	if v.d == nil {
+		return "0s"
+	}
+	return time.Duration(*v.d).String()
+}
+
+func (v durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v.d = addendpoint.Duration(d)
+	return nil
+}
+
+type uint32Value struct{ n *uint32 }
+
+func (v uint32Value) String() string {
+	if v.n == nil {
+		return "0"
+	}
+	return strconv.FormatUint(uint64(*v.n), 10)
+}
+
+func (v uint32Value) Set(s string) error {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return err
+	}
+	*v.n = uint32(n)
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"google.golang.org/grpc"
+
+	"github.com/go-kit/kit/log"
+)
+
+// drainer coordinates the graceful shutdown of the servers run by main. The
+// first server to be interrupted flips readiness to not ready. The servers go
+// on accepting new requests for the delay, so that load balancers notice and
+// stop sending them, and then drain concurrently, until a deadline the
+// timeout after that.
+type drainer struct {
+	delay   time.Duration
+	timeout time.Duration
+	logger  log.Logger
+
+	draining int32 // atomic
+	once     sync.Once
+	delayed  chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func newDrainer(delay, timeout time.Duration, logger log.Logger) *drainer {
+	return &drainer{
+		delay:   delay,
+		timeout: timeout,
+		logger:  logger,
+		delayed: make(chan struct{}),
+	}
+}
+
+// ready reports whether the servers still accept new requests.
+func (d *drainer) ready() bool {
+	return atomic.LoadInt32(&d.draining) == 0
+}
+
+// start flips readiness to not ready on its first call, and returns the
+// context that expires at the drain deadline. The delayed channel is closed
+// once the delay is over.
+func (d *drainer) start() context.Context {
+	d.once.Do(func() {
+		atomic.StoreInt32(&d.draining, 1)
+		time.AfterFunc(d.delay, func() { close(d.delayed) })
+		d.ctx, d.cancel = context.WithTimeout(context.Background(), d.delay+d.timeout)
+	})
+	return d.ctx
+}
+
+// wait blocks until every server returned by actor has drained, or given up
+// at the deadline.
+func (d *drainer) wait() {
+	d.wg.Wait()
+	d.start()
+	d.cancel()
+}
+
+// actor returns an execute and interrupt function pair for a run group. The
+// execute function runs serve. The interrupt function calls stop with the
+// drain deadline in the background, after the delay, so that it doesn't hold
+// up the other servers, and execute only returns once stop does. Stop should return
+// after the in-flight requests are done, or when the context expires.
+func (d *drainer) actor(name string, serve func() error, stop func(context.Context) error) (func() error, func(error)) {
+	d.wg.Add(1)
+	stopping := make(chan struct{})
+	stopped := make(chan error, 1)
+	execute := func() error {
+		err := serve()
+		select {
+		case <-stopping:
+			return <-stopped
+		default:
+			return err
+		}
+	}
+	interrupt := func(error) {
+		close(stopping)
+		ctx := d.start()
+		go func() {
+			defer d.wg.Done()
+			<-d.delayed
+			begin := time.Now()
+			err := stop(ctx)
+			d.logger.Log("transport", name, "during", "Drain", "took", time.Since(begin), "err", err)
+			stopped <- err
+		}()
+	}
+	return execute, interrupt
+}
+
+// shutdownHTTP returns a stop function for drainer.actor that shuts the server
+// down gracefully, and closes the remaining connections at the deadline.
+func shutdownHTTP(server *http.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			server.Close()
+		}
+		return err
+	}
+}
+
+// shutdownGRPC returns a stop function for drainer.actor that stops the
+// server gracefully, and stops it forcibly at the deadline.
+func shutdownGRPC(server *grpc.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			server.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// shutdownThrift returns a stop function for drainer.actor that stops the
+// server. Thrift only returns from Stop once the clients have closed their
+// connections, so at the deadline the server is left to the process exit.
+func shutdownThrift(server *thrift.TSimpleServer) func(context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			server.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -1,27 +1,49 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/golang-jwt/jwt"
 	"github.com/opentracing/opentracing-go"
 	zipkin "github.com/openzipkin/zipkin-go"
+	"github.com/sony/gobreaker"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/ratelimit"
 
+	"github.com/go-kit/examples/addsvc/pb"
 	"github.com/go-kit/examples/addsvc/pkg/addendpoint"
 	"github.com/go-kit/examples/addsvc/pkg/addservice"
 	"github.com/go-kit/examples/addsvc/pkg/addtransport"
+	addthrift "github.com/go-kit/examples/addsvc/thrift/gen-go/addsvc"
+	"github.com/go-kit/examples/health"
 )
 
 func TestHTTP(t *testing.T) {
 	zkt, _ := zipkin.NewTracer(nil, zipkin.WithNoopTracer(true))
 	svc := addservice.New(log.NewNopLogger(), discard.NewCounter(), discard.NewCounter())
-	eps := addendpoint.New(svc, log.NewNopLogger(), discard.NewHistogram(), opentracing.GlobalTracer(), zkt)
+	eps := addendpoint.New(svc, addendpoint.NewLivePolicy(addendpoint.DefaultPolicy()), nil, log.NewNopLogger(), discard.NewHistogram(), opentracing.GlobalTracer(), zkt)
 	mux := addtransport.NewHTTPHandler(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger())
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
@@ -40,3 +62,684 @@ func TestHTTP(t *testing.T) {
 		}
 	}
 }
+
+func TestGRPCStream(t *testing.T) {
+	zkt, _ := zipkin.NewTracer(nil, zipkin.WithNoopTracer(true))
+	svc := addservice.New(log.NewNopLogger(), discard.NewCounter(), discard.NewCounter())
+	eps := addendpoint.New(svc, addendpoint.NewLivePolicy(addendpoint.DefaultPolicy()), nil, log.NewNopLogger(), discard.NewHistogram(), opentracing.GlobalTracer(), zkt)
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, addtransport.NewGRPCServer(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger()))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := addtransport.NewGRPCClient(conn, opentracing.GlobalTracer(), zkt, log.NewNopLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("SumStream", func(t *testing.T) {
+		testcases := []struct {
+			a, b int
+			want int
+			err  error
+		}{
+			{1, 2, 3, nil},
+			{0, 0, 0, addservice.ErrTwoZeroes},
+			{1<<31 - 1, 1, 0, addservice.ErrIntOverflow},
+			{3, 4, 7, nil},
+		}
+		pairs := make(chan addservice.IntPair)
+		go func() {
+			defer close(pairs)
+			for _, tc := range testcases {
+				pairs <- addservice.IntPair{A: tc.a, B: tc.b}
+			}
+		}()
+		var n int
+		for result := range client.SumStream(ctx, pairs) {
+			if n >= len(testcases) {
+				t.Fatalf("unexpected result %+v", result)
+			}
+			tc := testcases[n]
+			if want, have := tc.err, result.Err; !errors.Is(have, want) {
+				t.Errorf("%d+%d: want error %v, have %v", tc.a, tc.b, want, have)
+			}
+			if want, have := tc.want, result.V; want != have {
+				t.Errorf("%d+%d: want %d, have %d", tc.a, tc.b, want, have)
+			}
+			n++
+		}
+		if want, have := len(testcases), n; want != have {
+			t.Errorf("want %d results, have %d", want, have)
+		}
+	})
+
+	t.Run("ConcatStream", func(t *testing.T) {
+		testcases := []struct {
+			a, b string
+			want string
+			err  error
+		}{
+			{"1", "2", "12", nil},
+			{"abcdef", "ghijkl", "", addservice.ErrMaxSizeExceeded},
+			{"", "x", "x", nil},
+		}
+		pairs := make(chan addservice.StringPair)
+		go func() {
+			defer close(pairs)
+			for _, tc := range testcases {
+				pairs <- addservice.StringPair{A: tc.a, B: tc.b}
+			}
+		}()
+		var n int
+		for result := range client.ConcatStream(ctx, pairs) {
+			if n >= len(testcases) {
+				t.Fatalf("unexpected result %+v", result)
+			}
+			tc := testcases[n]
+			if want, have := tc.err, result.Err; !errors.Is(have, want) {
+				t.Errorf("%q+%q: want error %v, have %v", tc.a, tc.b, want, have)
+			}
+			if want, have := tc.want, result.V; want != have {
+				t.Errorf("%q+%q: want %q, have %q", tc.a, tc.b, want, have)
+			}
+			n++
+		}
+		if want, have := len(testcases), n; want != have {
+			t.Errorf("want %d results, have %d", want, have)
+		}
+	})
+}
+
+func TestErrors(t *testing.T) {
+	zkt, _ := zipkin.NewTracer(nil, zipkin.WithNoopTracer(true))
+	svc := addservice.New(log.NewNopLogger(), discard.NewCounter(), discard.NewCounter())
+	// The endpoints are built without the rate limiters of addendpoint.New,
+	// which would reject most of the calls below.
+	eps := addendpoint.Set{
+		SumEndpoint:    addendpoint.MakeSumEndpoint(svc),
+		ConcatEndpoint: addendpoint.MakeConcatEndpoint(svc),
+	}
+
+	httpServer := httptest.NewServer(addtransport.NewHTTPHandler(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger()))
+	defer httpServer.Close()
+	httpClient, err := addtransport.NewHTTPClient(httpServer.URL, opentracing.GlobalTracer(), zkt, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonrpcServer := httptest.NewServer(addtransport.NewJSONRPCHandler(eps, log.NewNopLogger()))
+	defer jsonrpcServer.Close()
+	jsonrpcClient, err := addtransport.NewJSONRPCClient(jsonrpcServer.URL, opentracing.GlobalTracer(), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	pb.RegisterAddServer(grpcServer, addtransport.NewGRPCServer(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger()))
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	grpcClient := addtransport.NewGRPCClient(conn, opentracing.GlobalTracer(), zkt, log.NewNopLogger())
+
+	protocolFactory := thrift.NewTBinaryProtocolFactoryDefault()
+	thriftSocket, err := thrift.NewTServerSocket("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := thriftSocket.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	thriftServer := thrift.NewTSimpleServer4(
+		addthrift.NewAddServiceProcessor(addtransport.NewThriftServer(eps)),
+		thriftSocket,
+		thrift.NewTTransportFactory(),
+		protocolFactory,
+	)
+	go thriftServer.Serve()
+	defer thriftServer.Stop()
+	thriftTransport, err := thrift.NewTSocket(thriftSocket.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := thriftTransport.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer thriftTransport.Close()
+	thriftClient := addtransport.NewThriftClient(addthrift.NewAddServiceClientFactory(thriftTransport, protocolFactory))
+
+	for _, transport := range []struct {
+		name   string
+		client addservice.Service
+	}{
+		{"HTTP", httpClient},
+		{"JSONRPC", jsonrpcClient},
+		{"gRPC", grpcClient},
+		{"Thrift", thriftClient},
+	} {
+		client := transport.client
+		t.Run(transport.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := client.Sum(ctx, 0, 0); !errors.Is(err, addservice.ErrTwoZeroes) {
+				t.Errorf("Sum(0, 0): want %v, have %v", addservice.ErrTwoZeroes, err)
+			}
+			if _, err := client.Sum(ctx, 1<<31-1, 1); !errors.Is(err, addservice.ErrIntOverflow) {
+				t.Errorf("Sum(overflow): want %v, have %v", addservice.ErrIntOverflow, err)
+			}
+			_, err := client.Concat(ctx, "abcdef", "ghijkl")
+			if !errors.Is(err, addservice.ErrMaxSizeExceeded) {
+				t.Fatalf("Concat: want %v, have %v", addservice.ErrMaxSizeExceeded, err)
+			}
+			var e *addservice.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Concat: want *addservice.Error, have %T", err)
+			}
+			if want, have := "10", e.Details["max_size"]; want != have {
+				t.Errorf("Concat: want max_size detail %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	zkt, _ := zipkin.NewTracer(nil, zipkin.WithNoopTracer(true))
+	svc := addservice.New(log.NewNopLogger(), discard.NewCounter(), discard.NewCounter())
+	policy := addendpoint.NewLivePolicy(addendpoint.DefaultPolicy())
+	eps := addendpoint.New(svc, policy, nil, log.NewNopLogger(), discard.NewHistogram(), opentracing.GlobalTracer(), zkt)
+
+	ctx := context.Background()
+	if _, err := eps.Sum(ctx, 1, 2); err != nil {
+		t.Fatalf("first Sum: %v", err)
+	}
+	if _, err := eps.Sum(ctx, 1, 2); !errors.Is(err, ratelimit.ErrLimited) {
+		t.Fatalf("second Sum: want %v, have %v", ratelimit.ErrLimited, err)
+	}
+
+	p := policy.Load()
+	p.Sum.RateLimit = addendpoint.RateLimitPolicy{}
+	policy.Store(p)
+	for i := 0; i < 10; i++ {
+		if _, err := eps.Sum(ctx, 1, 2); err != nil {
+			t.Fatalf("Sum %d after reload: %v", i, err)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	load := func(filename string, args ...string) (addendpoint.Policy, error) {
+		fs := flag.NewFlagSet("addsvc", flag.ContinueOnError)
+		defaultPolicy := addendpoint.DefaultPolicy()
+		policyFlags(fs, &defaultPolicy)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return loadPolicy(fs, filename)
+	}
+
+	// YAML files have the same fields as JSON ones.
+	want := addendpoint.DefaultPolicy()
+	want.Sum.RateLimit = addendpoint.RateLimitPolicy{Every: addendpoint.Duration(100 * time.Millisecond), Burst: 5}
+	want.Concat.Timeout = addendpoint.Duration(time.Second)
+	for _, filename := range []string{
+		write("policy.json", `{"sum": {"rate_limit": {"every": "100ms", "burst": 5}}, "concat": {"timeout": "1s"}}`),
+		write("policy.yaml", "sum:\n  rate_limit:\n    every: 100ms\n    burst: 5\nconcat:\n  timeout: 1s\n"),
+	} {
+		if have, err := load(filename); err != nil || have != want {
+			t.Errorf("%s: want %+v, have %+v (%v)", filename, want, have, err)
+		}
+	}
+
+	// A rate limit without a burst would reject every request.
+	for _, tc := range []struct {
+		filename string
+		args     []string
+	}{
+		{write("burst.yml", "sum:\n  rate_limit:\n    every: 1s\n    burst: 0\n"), nil},
+		{"", []string{"-concat.rate-burst", "0"}},
+	} {
+		if _, err := load(tc.filename, tc.args...); err == nil || !strings.Contains(err.Error(), "burst") {
+			t.Errorf("%s %v: want an error about the burst, have %v", tc.filename, tc.args, err)
+		}
+	}
+	if _, err := load("", "-sum.rate-every", "0", "-sum.rate-burst", "0"); err != nil {
+		t.Errorf("no rate limit: %v", err)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	zkt, _ := zipkin.NewTracer(nil, zipkin.WithNoopTracer(true))
+	svc := &blockingService{
+		Service: addservice.NewBasicService(),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	eps := addendpoint.Set{
+		SumEndpoint:    addendpoint.MakeSumEndpoint(svc),
+		ConcatEndpoint: addendpoint.MakeConcatEndpoint(svc),
+	}
+
+	// Each transport serves eps, and returns a function that connects a new
+	// client, and closes it.
+	for _, testcase := range []struct {
+		name  string
+		serve func(t *testing.T, d *drainer) (connect func() (addservice.Service, func()), execute func() error, interrupt func(error))
+	}{
+		{"HTTP", func(t *testing.T, d *drainer) (func() (addservice.Service, func()), func() error, func(error)) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &http.Server{Handler: addtransport.NewHTTPHandler(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger())}
+			execute, interrupt := d.actor("HTTP", func() error { return server.Serve(lis) }, shutdownHTTP(server))
+			return func() (addservice.Service, func()) {
+				client, err := addtransport.NewHTTPClient(lis.Addr().String(), opentracing.GlobalTracer(), zkt, log.NewNopLogger())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return client, func() {}
+			}, execute, interrupt
+		}},
+		{"gRPC", func(t *testing.T, d *drainer) (func() (addservice.Service, func()), func() error, func(error)) {
+			lis := bufconn.Listen(1 << 20)
+			server := grpc.NewServer()
+			pb.RegisterAddServer(server, addtransport.NewGRPCServer(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger()))
+			execute, interrupt := d.actor("gRPC", func() error { return server.Serve(lis) }, shutdownGRPC(server))
+			return func() (addservice.Service, func()) {
+				conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+					return lis.Dial()
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return addtransport.NewGRPCClient(conn, opentracing.GlobalTracer(), zkt, log.NewNopLogger()), func() { conn.Close() }
+			}, execute, interrupt
+		}},
+		{"Thrift", func(t *testing.T, d *drainer) (func() (addservice.Service, func()), func() error, func(error)) {
+			protocolFactory := thrift.NewTBinaryProtocolFactoryDefault()
+			socket, err := thrift.NewTServerSocket("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := socket.Listen(); err != nil {
+				t.Fatal(err)
+			}
+			addr := socket.Addr().String() // Addr races with Stop
+			server := thrift.NewTSimpleServer4(
+				addthrift.NewAddServiceProcessor(addtransport.NewThriftServer(eps)),
+				socket,
+				thrift.NewTTransportFactory(),
+				protocolFactory,
+			)
+			execute, interrupt := d.actor("Thrift", server.Serve, shutdownThrift(server))
+			return func() (addservice.Service, func()) {
+				transport, err := thrift.NewTSocket(addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := transport.Open(); err != nil {
+					t.Fatal(err)
+				}
+				// Thrift only stops once its clients are gone.
+				return addtransport.NewThriftClient(addthrift.NewAddServiceClientFactory(transport, protocolFactory)), func() { transport.Close() }
+			}, execute, interrupt
+		}},
+		{"JSONRPC", func(t *testing.T, d *drainer) (func() (addservice.Service, func()), func() error, func(error)) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &http.Server{Handler: addtransport.NewJSONRPCHandler(eps, log.NewNopLogger())}
+			execute, interrupt := d.actor("JSONRPC over HTTP", func() error { return server.Serve(lis) }, shutdownHTTP(server))
+			return func() (addservice.Service, func()) {
+				client, err := addtransport.NewJSONRPCClient("http://"+lis.Addr().String(), opentracing.GlobalTracer(), log.NewNopLogger())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return client, func() {}
+			}, execute, interrupt
+		}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			d := newDrainer(time.Second, 5*time.Second, log.NewNopLogger())
+			connect, execute, interrupt := testcase.serve(t, d)
+			served := make(chan error, 1)
+			go func() { served <- execute() }()
+
+			type result struct {
+				v   int
+				err error
+			}
+			summed := make(chan result, 1)
+			go func() {
+				client, done := connect()
+				defer done()
+				v, err := client.Sum(context.Background(), 1, 2)
+				summed <- result{v, err}
+			}()
+
+			// Shut down while Sum is in flight.
+			<-svc.started
+			interrupt(nil)
+			if d.ready() {
+				t.Error("still ready after shutdown started")
+			}
+
+			// New requests are still served during the delay.
+			client, done := connect()
+			if v, err := client.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+				t.Errorf("Concat during the delay: want ab, have %q (err %v)", v, err)
+			}
+			done()
+
+			// Let Sum finish once the servers are draining.
+			time.Sleep(d.delay)
+			svc.release <- struct{}{}
+
+			if r := <-summed; r.err != nil || r.v != 3 {
+				t.Errorf("in-flight Sum: want 3, have %d (err %v)", r.v, r.err)
+			}
+			if err := <-served; err != nil {
+				t.Errorf("drain: %v", err)
+			}
+			d.wait()
+		})
+	}
+}
+
+// blockingService blocks each Sum until it's released, so that tests can
+// act while a request is in flight.
+type blockingService struct {
+	addservice.Service
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingService) Sum(ctx context.Context, a, b int) (int, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return s.Service.Sum(ctx, a, b)
+}
+
+func TestReadiness(t *testing.T) {
+	zkt, _ := zipkin.NewTracer(nil, zipkin.WithNoopTracer(true))
+	svc := addservice.New(log.NewNopLogger(), discard.NewCounter(), discard.NewCounter())
+	p := addendpoint.DefaultPolicy()
+	p.Sum.CircuitBreaker.ConsecutiveFailures = 1
+	eps := addendpoint.New(svc, addendpoint.NewLivePolicy(p), nil, log.NewNopLogger(), discard.NewHistogram(), opentracing.GlobalTracer(), zkt)
+	readiness := health.NewChecker()
+	for name, check := range eps.Checks() {
+		readiness.Register(name, check)
+	}
+
+	srv := httptest.NewServer(health.Handler(readiness))
+	defer srv.Close()
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, health.NewGRPCServer(readiness, "pb.Add"))
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	check := func(wantCode int, wantStatus healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := wantCode, resp.StatusCode; want != have {
+			t.Errorf("HTTP: want %d, have %d", want, have)
+		}
+		reply, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "pb.Add"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := wantStatus, reply.Status; want != have {
+			t.Errorf("gRPC: want %s, have %s", want, have)
+		}
+	}
+
+	check(http.StatusOK, healthpb.HealthCheckResponse_SERVING)
+
+	// The second Sum is rate limited, which opens the circuit breaker.
+	eps.Sum(context.Background(), 1, 2)
+	eps.Sum(context.Background(), 1, 2)
+	check(http.StatusServiceUnavailable, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+func TestRetry(t *testing.T) {
+	retry := addendpoint.RetryMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](2, time.Millisecond)
+	for _, testcase := range []struct {
+		err       error
+		wantCalls int
+	}{
+		{context.DeadlineExceeded, 3},
+		{fmt.Errorf("calling: %w", context.DeadlineExceeded), 3},
+		{ratelimit.ErrLimited, 1},
+		{addendpoint.ErrBulkheadFull, 1},
+		{gobreaker.ErrOpenState, 1},
+		{gobreaker.ErrTooManyRequests, 1},
+		{errors.New("failed"), 1},
+	} {
+		var calls int
+		_, err := retry(func(context.Context, addendpoint.SumRequest) (addendpoint.SumResponse, error) {
+			calls++
+			return addendpoint.SumResponse{}, testcase.err
+		})(context.Background(), addendpoint.SumRequest{A: 1, B: 2})
+		if err != testcase.err || calls != testcase.wantCalls {
+			t.Errorf("%v: want %d calls, have %d (err %v)", testcase.err, testcase.wantCalls, calls, err)
+		}
+	}
+}
+
+func TestTracerReadiness(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := reachable(lis.Addr().String())
+	if err := check(context.Background()); err != nil {
+		t.Errorf("collector listening: want no error, have %v", err)
+	}
+	lis.Close()
+	if err := check(context.Background()); err == nil {
+		t.Errorf("collector gone: want an error, have none")
+	}
+
+	for rawurl, want := range map[string]string{
+		"http://localhost:9411/api/v2/spans": "localhost:9411",
+		"http://zipkin/api/v2/spans":         "zipkin:80",
+		"https://zipkin/api/v2/spans":        "zipkin:443",
+	} {
+		if have, err := urlHostPort(rawurl); err != nil || want != have {
+			t.Errorf("urlHostPort(%q): want %q, have %q (%v)", rawurl, want, have, err)
+		}
+	}
+	if _, err := urlHostPort("/api/v2/spans"); err == nil {
+		t.Errorf("urlHostPort without a host: want an error, have none")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	keys, err := addendpoint.ParseKeySet([]byte(fmt.Sprintf(
+		`{"keys":[{"kty":"oct","kid":"hs","k":%q},{"kty":"RSA","kid":"rs","n":%q,"e":%q}]}`,
+		b64(secret), b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := addendpoint.NewAuthenticator(keys, map[string]string{"ci": "s3cr3t"})
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, exp time.Time) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "alice", "exp": exp.Unix()})
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	zkt, _ := zipkin.NewTracer(nil, zipkin.WithNoopTracer(true))
+	svc := addservice.New(log.NewNopLogger(), discard.NewCounter(), discard.NewCounter())
+	// The zero policy has no rate limiters, which would reject most of the
+	// calls below.
+	eps := addendpoint.New(svc, addendpoint.NewLivePolicy(addendpoint.Policy{}), auth, log.NewNopLogger(), discard.NewHistogram(), opentracing.GlobalTracer(), zkt)
+
+	httpServer := httptest.NewServer(addtransport.NewHTTPHandler(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger()))
+	defer httpServer.Close()
+	httpClient, err := addtransport.NewHTTPClient(httpServer.URL, opentracing.GlobalTracer(), zkt, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonrpcServer := httptest.NewServer(addtransport.NewJSONRPCHandler(eps, log.NewNopLogger()))
+	defer jsonrpcServer.Close()
+	jsonrpcClient, err := addtransport.NewJSONRPCClient(jsonrpcServer.URL, opentracing.GlobalTracer(), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	pb.RegisterAddServer(grpcServer, addtransport.NewGRPCServer(eps, opentracing.GlobalTracer(), zkt, log.NewNopLogger()))
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	grpcClient := addtransport.NewGRPCClient(conn, opentracing.GlobalTracer(), zkt, log.NewNopLogger())
+
+	// Thrift only carries the credentials with the THeader protocol.
+	protocolFactory := thrift.NewTHeaderProtocolFactoryConf(nil)
+	thriftSocket, err := thrift.NewTServerSocket("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := thriftSocket.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	thriftServer := thrift.NewTSimpleServer4(
+		addthrift.NewAddServiceProcessor(addtransport.NewThriftServer(eps)),
+		thriftSocket,
+		thrift.NewTTransportFactory(),
+		protocolFactory,
+	)
+	go thriftServer.Serve()
+	defer thriftServer.Stop()
+	thriftTransport, err := thrift.NewTSocket(thriftSocket.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := thriftTransport.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer thriftTransport.Close()
+	thriftClient := addtransport.NewThriftClient(addthrift.NewAddServiceClientFactory(thriftTransport, protocolFactory))
+
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	testcases := []struct {
+		name          string
+		authorization string
+		err           error
+	}{
+		{"HS256", "Bearer " + sign(jwt.SigningMethodHS256, "hs", secret, future), nil},
+		{"RS256", "Bearer " + sign(jwt.SigningMethodRS256, "rs", rsaKey, future), nil},
+		{"APIKey", "ApiKey s3cr3t", nil},
+		{"NoCredentials", "", addendpoint.ErrUnauthenticated},
+		{"Expired", "Bearer " + sign(jwt.SigningMethodHS256, "hs", secret, past), addendpoint.ErrUnauthenticated},
+		{"WrongAlgorithm", "Bearer " + sign(jwt.SigningMethodHS256, "rs", secret, future), addendpoint.ErrUnauthenticated},
+		{"UnknownAPIKey", "ApiKey guess", addendpoint.ErrUnauthenticated},
+	}
+	for _, transport := range []struct {
+		name   string
+		client addservice.Service
+	}{
+		{"HTTP", httpClient},
+		{"JSONRPC", jsonrpcClient},
+		{"gRPC", grpcClient},
+		{"Thrift", thriftClient},
+	} {
+		client := transport.client
+		t.Run(transport.name, func(t *testing.T) {
+			for _, tc := range testcases {
+				ctx := context.Background()
+				if tc.authorization != "" {
+					ctx = addendpoint.ContextWithAuthorization(ctx, tc.authorization)
+				}
+				v, err := client.Sum(ctx, 1, 2)
+				if !errors.Is(err, tc.err) {
+					t.Errorf("%s: want %v, have %v", tc.name, tc.err, err)
+				}
+				// Callers aren't told why their credentials aren't valid.
+				if e := (*addservice.Error)(nil); errors.As(err, &e) && len(e.Details) != 0 {
+					t.Errorf("%s: want no details, have %v", tc.name, e.Details)
+				}
+				if err == nil && v != 3 {
+					t.Errorf("%s: want 3, have %d", tc.name, v)
+				}
+			}
+		})
+	}
+
+	t.Run("gRPCStream", func(t *testing.T) {
+		for _, tc := range testcases {
+			ctx := context.Background()
+			if tc.authorization != "" {
+				ctx = addendpoint.ContextWithAuthorization(ctx, tc.authorization)
+			}
+			pairs := make(chan addservice.IntPair, 1)
+			pairs <- addservice.IntPair{A: 1, B: 2}
+			close(pairs)
+			var n int
+			for r := range grpcClient.SumStream(ctx, pairs) {
+				n++
+				if !errors.Is(r.Err, tc.err) {
+					t.Errorf("%s: want %v, have %v", tc.name, tc.err, r.Err)
+				}
+			}
+			if n != 1 {
+				t.Errorf("%s: want 1 result, have %d", tc.name, n)
+			}
+		}
+	})
+}
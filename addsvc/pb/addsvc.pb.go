@@ -74,6 +74,7 @@ func (m *SumRequest) GetB() int64 {
 type SumReply struct {
 	V                    int64    `protobuf:"varint,1,opt,name=v,proto3" json:"v,omitempty"`
 	Err                  string   `protobuf:"bytes,2,opt,name=err,proto3" json:"err,omitempty"`
+	Error                *Error   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -118,6 +119,13 @@ func (m *SumReply) GetErr() string {
 	return ""
 }
 
+func (m *SumReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
 // The Concat request contains two parameters.
 type ConcatRequest struct {
 	A                    string   `protobuf:"bytes,1,opt,name=a,proto3" json:"a,omitempty"`
@@ -170,6 +178,7 @@ func (m *ConcatRequest) GetB() string {
 type ConcatReply struct {
 	V                    string   `protobuf:"bytes,1,opt,name=v,proto3" json:"v,omitempty"`
 	Err                  string   `protobuf:"bytes,2,opt,name=err,proto3" json:"err,omitempty"`
+	Error                *Error   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -214,29 +223,112 @@ func (m *ConcatReply) GetErr() string {
 	return ""
 }
 
+func (m *ConcatReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Error is a structured service error. Unary RPCs return it as a detail of
+// the gRPC status, streaming RPCs in the error field of each reply.
+type Error struct {
+	Code                 string            `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message              string            `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Retryable            bool              `protobuf:"varint,3,opt,name=retryable,proto3" json:"retryable,omitempty"`
+	Details              map[string]string `protobuf:"bytes,4,rep,name=details,proto3" json:"details,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *Error) Reset()         { *m = Error{} }
+func (m *Error) String() string { return proto.CompactTextString(m) }
+func (*Error) ProtoMessage()    {}
+func (*Error) Descriptor() ([]byte, []int) {
+	return fileDescriptor_174367f558d60c26, []int{4}
+}
+
+func (m *Error) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Error.Unmarshal(m, b)
+}
+func (m *Error) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Error.Marshal(b, m, deterministic)
+}
+func (m *Error) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Error.Merge(m, src)
+}
+func (m *Error) XXX_Size() int {
+	return xxx_messageInfo_Error.Size(m)
+}
+func (m *Error) XXX_DiscardUnknown() {
+	xxx_messageInfo_Error.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Error proto.InternalMessageInfo
+
+func (m *Error) GetCode() string {
+	if m != nil {
+		return m.Code
+	}
+	return ""
+}
+
+func (m *Error) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Error) GetRetryable() bool {
+	if m != nil {
+		return m.Retryable
+	}
+	return false
+}
+
+func (m *Error) GetDetails() map[string]string {
+	if m != nil {
+		return m.Details
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*SumRequest)(nil), "pb.SumRequest")
 	proto.RegisterType((*SumReply)(nil), "pb.SumReply")
 	proto.RegisterType((*ConcatRequest)(nil), "pb.ConcatRequest")
 	proto.RegisterType((*ConcatReply)(nil), "pb.ConcatReply")
+	proto.RegisterType((*Error)(nil), "pb.Error")
+	proto.RegisterMapType((map[string]string)(nil), "pb.Error.DetailsEntry")
 }
 
 func init() { proto.RegisterFile("addsvc.proto", fileDescriptor_174367f558d60c26) }
 
 var fileDescriptor_174367f558d60c26 = []byte{
-	// 189 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x49, 0x4c, 0x49, 0x29,
-	0x2e, 0x4b, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x52, 0xd2, 0xe0, 0xe2,
-	0x0a, 0x2e, 0xcd, 0x0d, 0x4a, 0x2d, 0x2c, 0x4d, 0x2d, 0x2e, 0x11, 0xe2, 0xe1, 0x62, 0x4c, 0x94,
-	0x60, 0x54, 0x60, 0xd4, 0x60, 0x0e, 0x62, 0x4c, 0x04, 0xf1, 0x92, 0x24, 0x98, 0x20, 0xbc, 0x24,
-	0x25, 0x2d, 0x2e, 0x0e, 0xb0, 0xca, 0x82, 0x9c, 0x4a, 0x90, 0x4c, 0x19, 0x4c, 0x5d, 0x99, 0x90,
-	0x00, 0x17, 0x73, 0x6a, 0x51, 0x11, 0x58, 0x25, 0x67, 0x10, 0x88, 0xa9, 0xa4, 0xcd, 0xc5, 0xeb,
-	0x9c, 0x9f, 0x97, 0x9c, 0x58, 0x82, 0x61, 0x30, 0x27, 0x8a, 0xc1, 0x9c, 0x20, 0x83, 0x75, 0xb9,
-	0xb8, 0x61, 0x8a, 0x51, 0xcc, 0xe6, 0xc4, 0x6a, 0xb6, 0x51, 0x0c, 0x17, 0xb3, 0x63, 0x4a, 0x8a,
-	0x90, 0x2a, 0x17, 0x73, 0x70, 0x69, 0xae, 0x10, 0x9f, 0x5e, 0x41, 0x92, 0x1e, 0xc2, 0x07, 0x52,
-	0x3c, 0x70, 0x7e, 0x41, 0x4e, 0xa5, 0x12, 0x83, 0x90, 0x1e, 0x17, 0x1b, 0xc4, 0x70, 0x21, 0x41,
-	0x90, 0x0c, 0x8a, 0xab, 0xa4, 0xf8, 0x91, 0x85, 0xc0, 0xea, 0x93, 0xd8, 0xc0, 0x41, 0x63, 0x0c,
-	0x08, 0x00, 0x00, 0xff, 0xff, 0xdc, 0x37, 0x81, 0x99, 0x2a, 0x01, 0x00, 0x00,
+	// 336 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x52, 0xcb, 0x4a, 0xc3, 0x40,
+	0x14, 0x75, 0x9a, 0xbe, 0xe6, 0x36, 0xbe, 0x2e, 0x22, 0xa1, 0x08, 0x96, 0x80, 0x10, 0x10, 0x62,
+	0xa9, 0x9b, 0xd2, 0x9d, 0x68, 0x57, 0x82, 0x8b, 0xe4, 0x0b, 0x26, 0xcd, 0x20, 0x62, 0xd2, 0xc4,
+	0xc9, 0x24, 0x90, 0xcf, 0x73, 0xe5, 0x6f, 0xc9, 0xcc, 0x24, 0x6d, 0x83, 0x0b, 0xc5, 0xdd, 0x3d,
+	0x8f, 0x39, 0x67, 0x72, 0x33, 0x60, 0xb3, 0x38, 0x2e, 0xaa, 0x8d, 0x9f, 0x8b, 0x4c, 0x66, 0xd8,
+	0xcb, 0x23, 0xd7, 0x03, 0x08, 0xcb, 0x34, 0xe0, 0x1f, 0x25, 0x2f, 0x24, 0xda, 0x40, 0x98, 0x43,
+	0x66, 0xc4, 0xb3, 0x02, 0xc2, 0x14, 0x8a, 0x9c, 0x9e, 0x41, 0x91, 0xfb, 0x0c, 0x63, 0xed, 0xcc,
+	0x93, 0x5a, 0x29, 0x55, 0xeb, 0xab, 0xf0, 0x0c, 0x2c, 0x2e, 0x84, 0x76, 0xd2, 0x40, 0x8d, 0x78,
+	0x0d, 0x03, 0x2e, 0x44, 0x26, 0x1c, 0x6b, 0x46, 0xbc, 0xc9, 0x82, 0xfa, 0x79, 0xe4, 0xaf, 0x15,
+	0x11, 0x18, 0xde, 0xbd, 0x85, 0xe3, 0xc7, 0x6c, 0xbb, 0x61, 0xf2, 0x47, 0x33, 0xed, 0x34, 0x53,
+	0xd5, 0xfc, 0x02, 0x93, 0xd6, 0xdc, 0x29, 0xa7, 0xff, 0x2c, 0xff, 0x24, 0x30, 0xd0, 0x04, 0x22,
+	0xf4, 0x37, 0x59, 0xcc, 0x9b, 0x34, 0x3d, 0xa3, 0x03, 0xa3, 0x94, 0x17, 0x05, 0x7b, 0xe5, 0x4d,
+	0x68, 0x0b, 0xf1, 0x0a, 0xa8, 0xe0, 0x52, 0xd4, 0x2c, 0x4a, 0xb8, 0x0e, 0x1f, 0x07, 0x7b, 0x02,
+	0xe7, 0x30, 0x8a, 0xb9, 0x64, 0x6f, 0x49, 0xe1, 0xf4, 0x67, 0x96, 0x37, 0x59, 0x5c, 0xee, 0x8a,
+	0xfd, 0x27, 0x23, 0xac, 0xb7, 0x52, 0xd4, 0x41, 0x6b, 0x9b, 0xae, 0xc0, 0x3e, 0x14, 0xd4, 0xa7,
+	0xbc, 0xf3, 0xba, 0xb9, 0x8c, 0x1a, 0xf1, 0x02, 0x06, 0x15, 0x4b, 0xca, 0xf6, 0x26, 0x06, 0xac,
+	0x7a, 0x4b, 0xb2, 0xf8, 0x22, 0x60, 0x3d, 0xc4, 0x31, 0xde, 0x80, 0x15, 0x96, 0x29, 0x9e, 0xa8,
+	0xae, 0xfd, 0x8f, 0x9c, 0xda, 0x3b, 0x9c, 0x27, 0xb5, 0x7b, 0x84, 0x3e, 0x0c, 0xcd, 0x0a, 0xf1,
+	0x5c, 0x29, 0x9d, 0xdd, 0x4f, 0x4f, 0x0f, 0x29, 0xe3, 0xbf, 0x03, 0x1a, 0x96, 0x69, 0x28, 0x05,
+	0x67, 0xbf, 0x86, 0x7b, 0x64, 0x4e, 0x70, 0x09, 0xb6, 0x49, 0x68, 0xce, 0xfc, 0xa9, 0x46, 0x9d,
+	0x8c, 0x86, 0xfa, 0x31, 0xde, 0x7f, 0x0f, 0x00, 0x93, 0x19, 0x8d, 0xa1, 0x9c, 0x02, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -255,6 +347,10 @@ type AddClient interface {
 	Sum(ctx context.Context, in *SumRequest, opts ...grpc.CallOption) (*SumReply, error)
 	// Concatenates two strings
 	Concat(ctx context.Context, in *ConcatRequest, opts ...grpc.CallOption) (*ConcatReply, error)
+	// Sums a stream of integer pairs, replying once per pair.
+	SumStream(ctx context.Context, opts ...grpc.CallOption) (Add_SumStreamClient, error)
+	// Concatenates a stream of string pairs, replying once per pair.
+	ConcatStream(ctx context.Context, opts ...grpc.CallOption) (Add_ConcatStreamClient, error)
 }
 
 type addClient struct {
@@ -283,12 +379,78 @@ func (c *addClient) Concat(ctx context.Context, in *ConcatRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *addClient) SumStream(ctx context.Context, opts ...grpc.CallOption) (Add_SumStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Add_serviceDesc.Streams[0], "/pb.Add/SumStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &addSumStreamClient{stream}
+	return x, nil
+}
+
+type Add_SumStreamClient interface {
+	Send(*SumRequest) error
+	Recv() (*SumReply, error)
+	grpc.ClientStream
+}
+
+type addSumStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *addSumStreamClient) Send(m *SumRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *addSumStreamClient) Recv() (*SumReply, error) {
+	m := new(SumReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *addClient) ConcatStream(ctx context.Context, opts ...grpc.CallOption) (Add_ConcatStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Add_serviceDesc.Streams[1], "/pb.Add/ConcatStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &addConcatStreamClient{stream}
+	return x, nil
+}
+
+type Add_ConcatStreamClient interface {
+	Send(*ConcatRequest) error
+	Recv() (*ConcatReply, error)
+	grpc.ClientStream
+}
+
+type addConcatStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *addConcatStreamClient) Send(m *ConcatRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *addConcatStreamClient) Recv() (*ConcatReply, error) {
+	m := new(ConcatReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // AddServer is the server API for Add service.
 type AddServer interface {
 	// Sums two integers.
 	Sum(context.Context, *SumRequest) (*SumReply, error)
 	// Concatenates two strings
 	Concat(context.Context, *ConcatRequest) (*ConcatReply, error)
+	// Sums a stream of integer pairs, replying once per pair.
+	SumStream(Add_SumStreamServer) error
+	// Concatenates a stream of string pairs, replying once per pair.
+	ConcatStream(Add_ConcatStreamServer) error
 }
 
 func RegisterAddServer(s *grpc.Server, srv AddServer) {
@@ -331,6 +493,58 @@ func _Add_Concat_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Add_SumStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AddServer).SumStream(&addSumStreamServer{stream})
+}
+
+type Add_SumStreamServer interface {
+	Send(*SumReply) error
+	Recv() (*SumRequest, error)
+	grpc.ServerStream
+}
+
+type addSumStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *addSumStreamServer) Send(m *SumReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *addSumStreamServer) Recv() (*SumRequest, error) {
+	m := new(SumRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Add_ConcatStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AddServer).ConcatStream(&addConcatStreamServer{stream})
+}
+
+type Add_ConcatStreamServer interface {
+	Send(*ConcatReply) error
+	Recv() (*ConcatRequest, error)
+	grpc.ServerStream
+}
+
+type addConcatStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *addConcatStreamServer) Send(m *ConcatReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *addConcatStreamServer) Recv() (*ConcatRequest, error) {
+	m := new(ConcatRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Add_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.Add",
 	HandlerType: (*AddServer)(nil),
@@ -344,6 +558,19 @@ var _Add_serviceDesc = grpc.ServiceDesc{
 			Handler:    _Add_Concat_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SumStream",
+			Handler:       _Add_SumStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ConcatStream",
+			Handler:       _Add_ConcatStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "addsvc.proto",
 }
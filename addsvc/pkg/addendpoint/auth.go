@@ -0,0 +1,246 @@
+package addendpoint
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/addsvc/pkg/addservice"
+)
+
+// ErrUnauthenticated is returned by the auth middlewares for requests that
+// don't carry valid credentials. Why they aren't valid is only logged, so as
+// not to help callers guess.
+var ErrUnauthenticated = &addservice.Error{Code: addservice.CodeUnauthenticated, Message: "missing or invalid credentials"}
+
+type contextKey int
+
+const (
+	authorizationContextKey contextKey = iota
+	claimsContextKey
+)
+
+// ContextWithAuthorization returns a copy of ctx carrying the credentials of
+// the caller, in the form of an HTTP Authorization header value: "Bearer"
+// followed by a JWT, or "ApiKey" followed by an API key. Server transports put
+// them there for AuthMiddleware, and client transports send them along.
+func ContextWithAuthorization(ctx context.Context, authorization string) context.Context {
+	return context.WithValue(ctx, authorizationContextKey, authorization)
+}
+
+// AuthorizationFromContext returns the credentials carried by ctx, or the
+// empty string if there are none.
+func AuthorizationFromContext(ctx context.Context) string {
+	authorization, _ := ctx.Value(authorizationContextKey).(string)
+	return authorization
+}
+
+// ClaimsFromContext returns the claims of the caller authenticated by
+// AuthMiddleware.
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(jwt.MapClaims)
+	return claims, ok
+}
+
+// KeySet holds the keys that JWTs may be signed with, by key ID: a []byte
+// secret for HS256, or an *rsa.PublicKey for RS256.
+type KeySet map[string]interface{}
+
+// ParseKeySet parses a JSON Web Key Set, as defined by RFC 7517. Keys of type
+// "oct" verify HS256 signatures, and keys of type "RSA" verify RS256 ones.
+func ParseKeySet(data []byte) (KeySet, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(KeySet, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if _, ok := keys[k.Kid]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", k.Kid)
+		}
+		switch k.Kty {
+		case "oct":
+			secret, err := decodeSegment(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("key %q: invalid secret", k.Kid)
+			}
+			keys[k.Kid] = secret
+		case "RSA":
+			n, err := decodeSegment(k.N)
+			if err != nil || len(n) == 0 {
+				return nil, fmt.Errorf("key %q: invalid modulus", k.Kid)
+			}
+			e, err := decodeSegment(k.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("key %q: invalid exponent", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		default:
+			return nil, fmt.Errorf("key %q: unsupported key type %q", k.Kid, k.Kty)
+		}
+	}
+	return keys, nil
+}
+
+// decodeSegment decodes the unpadded base64url encoding used by JWKs,
+// tolerating padding.
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Authenticator validates the credentials of callers: JWTs signed with one of
+// the keys of its KeySet, or static API keys.
+type Authenticator struct {
+	keys    KeySet
+	apiKeys map[string]string // API key to name
+}
+
+// NewAuthenticator returns an Authenticator accepting JWTs signed with the
+// passed keys, and the passed API keys, which are indexed by name.
+func NewAuthenticator(keys KeySet, apiKeys map[string]string) *Authenticator {
+	a := &Authenticator{
+		keys:    keys,
+		apiKeys: make(map[string]string, len(apiKeys)),
+	}
+	for name, key := range apiKeys {
+		a.apiKeys[key] = name
+	}
+	return a
+}
+
+// Authenticate validates the credentials of an Authorization header value,
+// see ContextWithAuthorization, and returns the claims of the caller. Those of
+// an API key are a single "sub" claim with its name.
+func (a *Authenticator) Authenticate(authorization string) (jwt.MapClaims, error) {
+	if authorization == "" {
+		return nil, errors.New("no credentials")
+	}
+	scheme, credentials := authorization, ""
+	if i := strings.IndexByte(authorization, ' '); i >= 0 {
+		scheme, credentials = authorization[:i], strings.TrimSpace(authorization[i+1:])
+	}
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return a.parseToken(credentials)
+	case strings.EqualFold(scheme, "ApiKey"):
+		return a.checkAPIKey(credentials)
+	default:
+		return nil, fmt.Errorf("unsupported authorization scheme %q", scheme)
+	}
+}
+
+func (a *Authenticator) parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := a.keys[kid]
+		if !ok && kid == "" && len(a.keys) == 1 {
+			for _, only := range a.keys {
+				key, ok = only, true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		var want string
+		switch key.(type) {
+		case []byte:
+			want = jwt.SigningMethodHS256.Alg()
+		case *rsa.PublicKey:
+			want = jwt.SigningMethodRS256.Alg()
+		}
+		if alg := token.Method.Alg(); alg != want {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", alg, kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+func (a *Authenticator) checkAPIKey(key string) (jwt.MapClaims, error) {
+	// Every key is compared in constant time, so the time taken doesn't tell
+	// how close the caller came.
+	var name string
+	for k, n := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			name = n
+		}
+	}
+	if name == "" {
+		return nil, errors.New("unknown API key")
+	}
+	return jwt.MapClaims{"sub": name}, nil
+}
+
+// authenticate validates the credentials carried by ctx, and returns a copy
+// of ctx carrying the claims of the caller. Why they aren't valid, if they
+// aren't, is logged to logger.
+func (a *Authenticator) authenticate(ctx context.Context, logger log.Logger) (context.Context, error) {
+	claims, err := a.Authenticate(AuthorizationFromContext(ctx))
+	if err != nil {
+		logger.Log("auth", "failed", "reason", err)
+		return ctx, ErrUnauthenticated
+	}
+	return context.WithValue(ctx, claimsContextKey, claims), nil
+}
+
+// AuthMiddleware returns an endpoint middleware that rejects requests whose
+// context doesn't carry valid credentials with ErrUnauthenticated, logging
+// why to logger, and puts the claims of the caller in the context of the
+// others. A nil Authenticator disables the middleware.
+func AuthMiddleware[Req, Resp any](a *Authenticator, logger log.Logger) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		if a == nil {
+			return next
+		}
+		return func(ctx context.Context, request Req) (Resp, error) {
+			ctx, err := a.authenticate(ctx, logger)
+			if err != nil {
+				var resp Resp
+				return resp, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// StreamAuthMiddleware is the stream endpoint counterpart of AuthMiddleware.
+// The credentials are checked once per stream; if they aren't valid, every
+// request is answered with a response built by fail from ErrUnauthenticated.
+func StreamAuthMiddleware[Req, Resp any](a *Authenticator, logger log.Logger, fail func(error) Resp) StreamMiddleware[Req, Resp] {
+	return func(next StreamEndpoint[Req, Resp]) StreamEndpoint[Req, Resp] {
+		if a == nil {
+			return next
+		}
+		return func(ctx context.Context, requests <-chan Req) <-chan Resp {
+			ctx, err := a.authenticate(ctx, logger)
+			if err != nil {
+				return pipe(ctx, requests, func(Req) Resp { return fail(err) })
+			}
+			return next(ctx, requests)
+		}
+	}
+}
@@ -2,21 +2,24 @@ package addendpoint
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/go-kit/kit/endpoint"
+	"github.com/sony/gobreaker"
+
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/ratelimit"
 )
 
 // InstrumentingMiddleware returns an endpoint middleware that records
 // the duration of each invocation to the passed histogram. The middleware adds
 // a single field: "success", which is "true" if no error is returned, and
 // "false" otherwise.
-func InstrumentingMiddleware(duration metrics.Histogram) endpoint.Middleware {
-	return func(next endpoint.Endpoint) endpoint.Endpoint {
-		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+func InstrumentingMiddleware[Req, Resp any](duration metrics.Histogram) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		return func(ctx context.Context, request Req) (response Resp, err error) {
 
 			defer func(begin time.Time) {
 				duration.With("success", fmt.Sprint(err == nil)).Observe(time.Since(begin).Seconds())
@@ -29,9 +32,9 @@ func InstrumentingMiddleware(duration metrics.Histogram) endpoint.Middleware {
 
 // LoggingMiddleware returns an endpoint middleware that logs the
 // duration of each invocation, and the resulting error, if any.
-func LoggingMiddleware(logger log.Logger) endpoint.Middleware {
-	return func(next endpoint.Endpoint) endpoint.Endpoint {
-		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+func LoggingMiddleware[Req, Resp any](logger log.Logger) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		return func(ctx context.Context, request Req) (response Resp, err error) {
 
 			defer func(begin time.Time) {
 				logger.Log("transport_error", err, "took", time.Since(begin))
@@ -41,3 +44,147 @@ func LoggingMiddleware(logger log.Logger) endpoint.Middleware {
 		}
 	}
 }
+
+// RateLimitingMiddleware returns an endpoint middleware that rejects requests
+// with ratelimit.ErrLimited whenever the passed limiter disallows them. The
+// Limiter from "golang.org/x/time/rate" can be passed as is.
+func RateLimitingMiddleware[Req, Resp any](limit ratelimit.Allower) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		return func(ctx context.Context, request Req) (Resp, error) {
+			if !limit.Allow() {
+				var resp Resp
+				return resp, ratelimit.ErrLimited
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// CircuitBreakingMiddleware returns an endpoint middleware that implements
+// the circuit breaker pattern using the sony/gobreaker package. Only errors
+// returned by the wrapped endpoint count against the circuit breaker's error
+// count; business errors carried in the response don't.
+func CircuitBreakingMiddleware[Req, Resp any](cb *gobreaker.CircuitBreaker) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		return func(ctx context.Context, request Req) (Resp, error) {
+			var resp Resp
+			_, err := cb.Execute(func() (interface{}, error) {
+				var err error
+				resp, err = next(ctx, request)
+				return nil, err
+			})
+			return resp, err
+		}
+	}
+}
+
+// ErrBulkheadFull is returned by the bulkhead middleware when the maximum
+// number of concurrent requests is already in flight.
+var ErrBulkheadFull = errors.New("too many concurrent requests")
+
+// BulkheadMiddleware returns an endpoint middleware that allows at most max
+// concurrent requests, and rejects the others with ErrBulkheadFull. A max of
+// zero or less disables the bulkhead.
+func BulkheadMiddleware[Req, Resp any](max int) TypedMiddleware[Req, Resp] {
+	if max <= 0 {
+		return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] { return next }
+	}
+	sem := make(chan struct{}, max)
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		return func(ctx context.Context, request Req) (Resp, error) {
+			select {
+			case sem <- struct{}{}:
+			default:
+				var resp Resp
+				return resp, ErrBulkheadFull
+			}
+			defer func() { <-sem }()
+			return next(ctx, request)
+		}
+	}
+}
+
+// TimeoutMiddleware returns an endpoint middleware that sets a deadline of
+// timeout on the context of each request. A timeout of zero or less disables
+// the middleware.
+func TimeoutMiddleware[Req, Resp any](timeout time.Duration) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		if timeout <= 0 {
+			return next
+		}
+		return func(ctx context.Context, request Req) (Resp, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, request)
+		}
+	}
+}
+
+// RetryMiddleware returns an endpoint middleware that retries requests that
+// fail with a transient endpoint error up to max times, waiting backoff before
+// each retry. Business errors carried in the response aren't retried, and
+// neither are requests whose context is done.
+func RetryMiddleware[Req, Resp any](max int, backoff time.Duration) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		if max <= 0 {
+			return next
+		}
+		return func(ctx context.Context, request Req) (Resp, error) {
+			resp, err := next(ctx, request)
+			for i := 0; err != nil && transient(err) && i < max; i++ {
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return resp, err
+				}
+				resp, err = next(ctx, request)
+			}
+			return resp, err
+		}
+	}
+}
+
+// transient reports whether err is worth retrying: a timeout, like the one
+// of TimeoutMiddleware, or an error that says it's temporary. The errors of
+// the middlewares that shed load, ratelimit.ErrLimited, ErrBulkheadFull, and
+// those of an open circuit breaker, aren't; retrying them would only add to
+// the load they shed.
+func transient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// StreamLoggingMiddleware returns a stream endpoint middleware that logs the
+// number of responses and the duration of each stream once it ends.
+func StreamLoggingMiddleware[Req, Resp any](logger log.Logger) StreamMiddleware[Req, Resp] {
+	return func(next StreamEndpoint[Req, Resp]) StreamEndpoint[Req, Resp] {
+		return func(ctx context.Context, requests <-chan Req) <-chan Resp {
+			begin := time.Now()
+			responses := next(ctx, requests)
+			out := make(chan Resp)
+			go func() {
+				var n int
+				defer func() {
+					logger.Log("responses", n, "took", time.Since(begin))
+				}()
+				defer close(out)
+				for resp := range responses {
+					select {
+					case out <- resp:
+						n++
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return out
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package addendpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/sony/gobreaker"
+)
+
+// Policy configures the resilience middlewares of each method of a Set. Its
+// JSON form, or the same in YAML, is what cmd/addsvc loads from its policy
+// file.
+type Policy struct {
+	Sum    MethodPolicy `json:"sum"`
+	Concat MethodPolicy `json:"concat"`
+}
+
+// MethodPolicy configures the resilience middlewares of a single method.
+// Zero values disable the corresponding middleware, except for the circuit
+// breaker, which falls back to the gobreaker defaults.
+type MethodPolicy struct {
+	RateLimit      RateLimitPolicy      `json:"rate_limit"`
+	CircuitBreaker CircuitBreakerPolicy `json:"circuit_breaker"`
+
+	// Timeout bounds each attempt of a request. The wrapped endpoint is
+	// expected to honor the context deadline.
+	Timeout Duration `json:"timeout"`
+
+	// MaxConcurrent is the size of the bulkhead: requests beyond it are
+	// rejected with ErrBulkheadFull.
+	MaxConcurrent int `json:"max_concurrent"`
+
+	Retry RetryPolicy `json:"retry"`
+}
+
+// RateLimitPolicy configures a token bucket that's refilled with one token
+// every Every, and holds at most Burst tokens. Burst must be at least 1 when
+// Every is set, or no request would ever get a token.
+type RateLimitPolicy struct {
+	Every Duration `json:"every"`
+	Burst int      `json:"burst"`
+}
+
+// CircuitBreakerPolicy maps to gobreaker.Settings; see that package for the
+// meaning of each field. ConsecutiveFailures is the number of consecutive
+// failures that trips the breaker.
+type CircuitBreakerPolicy struct {
+	MaxRequests         uint32   `json:"max_requests"`
+	Interval            Duration `json:"interval"`
+	Timeout             Duration `json:"timeout"`
+	ConsecutiveFailures uint32   `json:"consecutive_failures"`
+}
+
+// RetryPolicy configures how many times a request that failed with a
+// transient endpoint error, like a timeout, is retried, and how long to wait
+// before each retry. Requests rejected by the rate limit, circuit breaker or
+// bulkhead, and business errors carried in the response, are never retried.
+type RetryPolicy struct {
+	Max     int      `json:"max"`
+	Backoff Duration `json:"backoff"`
+}
+
+// DefaultPolicy returns the policy that addsvc has always used: Sum is limited
+// to 1 request per second with burst of 1 request, Concat to 1 request per
+// second with burst of 100 requests, and both use the default circuit breaker.
+func DefaultPolicy() Policy {
+	return Policy{
+		Sum: MethodPolicy{
+			RateLimit: RateLimitPolicy{Every: Duration(time.Second), Burst: 1},
+		},
+		Concat: MethodPolicy{
+			RateLimit: RateLimitPolicy{Every: Duration(time.Second), Burst: 100},
+		},
+	}
+}
+
+// Validate returns an error describing the first setting of p that can't
+// work, if any.
+func (p Policy) Validate() error {
+	for _, m := range []struct {
+		name   string
+		policy MethodPolicy
+	}{
+		{"sum", p.Sum},
+		{"concat", p.Concat},
+	} {
+		if rl := m.policy.RateLimit; rl.Every > 0 && rl.Burst < 1 {
+			return fmt.Errorf("%s: rate_limit.burst is %d, but must be at least 1 when rate_limit.every is set", m.name, rl.Burst)
+		}
+	}
+	return nil
+}
+
+// Duration is a time.Duration that's encoded in JSON as a string like "1.5s",
+// so policy files stay readable.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LivePolicy holds the Policy used by the endpoints of one or more Sets.
+// Storing a new Policy applies it to requests that start afterwards, without
+// rebuilding the Sets or the transports that serve them.
+type LivePolicy struct {
+	mtx         sync.Mutex
+	policy      Policy
+	subscribers []func(Policy)
+}
+
+// NewLivePolicy returns a LivePolicy that starts out with the passed Policy.
+func NewLivePolicy(p Policy) *LivePolicy {
+	return &LivePolicy{policy: p}
+}
+
+// Load returns the current Policy.
+func (lp *LivePolicy) Load() Policy {
+	lp.mtx.Lock()
+	defer lp.mtx.Unlock()
+	return lp.policy
+}
+
+// Store replaces the current Policy.
+func (lp *LivePolicy) Store(p Policy) {
+	lp.mtx.Lock()
+	defer lp.mtx.Unlock()
+	lp.policy = p
+	for _, f := range lp.subscribers {
+		f(p)
+	}
+}
+
+// subscribe calls f with the current Policy, and again every time it's
+// replaced.
+func (lp *LivePolicy) subscribe(f func(Policy)) {
+	lp.mtx.Lock()
+	defer lp.mtx.Unlock()
+	lp.subscribers = append(lp.subscribers, f)
+	f(lp.policy)
+}
+
+// resilience is the chain of resilience middlewares of a single method. The
+// rate limiter is adjusted in place when the policy changes, so it keeps its
+// tokens; the circuit breaker and bulkhead are only replaced when their own
+// settings change, so they keep their state across unrelated changes.
+type resilience[Req, Resp any] struct {
+	name    string
+	next    TypedEndpoint[Req, Resp]
+	limiter *rate.Limiter
+	current atomic.Value // TypedEndpoint[Req, Resp]
+
+	mtx      sync.Mutex
+	policy   MethodPolicy
+	breaker  *gobreaker.CircuitBreaker
+	bulkhead TypedMiddleware[Req, Resp]
+}
+
+// ResilienceMiddleware returns an endpoint middleware that applies the rate
+// limiter, circuit breaker, bulkhead, timeout and retry configured by the
+// MethodPolicy that get selects from the live policy. The name identifies the
+// circuit breaker.
+func ResilienceMiddleware[Req, Resp any](name string, lp *LivePolicy, get func(Policy) MethodPolicy) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		return newResilience(name, lp, get, next).endpoint
+	}
+}
+
+func newResilience[Req, Resp any](name string, lp *LivePolicy, get func(Policy) MethodPolicy, next TypedEndpoint[Req, Resp]) *resilience[Req, Resp] {
+	r := &resilience[Req, Resp]{
+		name: name,
+		next: next,
+	}
+	lp.subscribe(func(p Policy) { r.update(get(p)) })
+	return r
+}
+
+func (r *resilience[Req, Resp]) endpoint(ctx context.Context, request Req) (Resp, error) {
+	return r.current.Load().(TypedEndpoint[Req, Resp])(ctx, request)
+}
+
+// breakerState returns the state of the current circuit breaker.
+func (r *resilience[Req, Resp]) breakerState() gobreaker.State {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.breaker.State()
+}
+
+func (r *resilience[Req, Resp]) update(p MethodPolicy) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	limit := rate.Inf
+	if p.RateLimit.Every > 0 {
+		limit = rate.Every(time.Duration(p.RateLimit.Every))
+	}
+	if r.limiter == nil {
+		// A new limiter starts out with a full bucket.
+		r.limiter = rate.NewLimiter(limit, p.RateLimit.Burst)
+	} else {
+		r.limiter.SetLimit(limit)
+		r.limiter.SetBurst(p.RateLimit.Burst)
+	}
+
+	if r.breaker == nil || p.CircuitBreaker != r.policy.CircuitBreaker {
+		r.breaker = gobreaker.NewCircuitBreaker(p.CircuitBreaker.settings(r.name))
+	}
+	if r.bulkhead == nil || p.MaxConcurrent != r.policy.MaxConcurrent {
+		r.bulkhead = BulkheadMiddleware[Req, Resp](p.MaxConcurrent)
+	}
+	r.policy = p
+
+	e := r.next
+	e = RateLimitingMiddleware[Req, Resp](r.limiter)(e)
+	e = CircuitBreakingMiddleware[Req, Resp](r.breaker)(e)
+	e = r.bulkhead(e)
+	e = TimeoutMiddleware[Req, Resp](time.Duration(p.Timeout))(e)
+	e = RetryMiddleware[Req, Resp](p.Retry.Max, time.Duration(p.Retry.Backoff))(e)
+	r.current.Store(e)
+}
+
+func (p CircuitBreakerPolicy) settings(name string) gobreaker.Settings {
+	settings := gobreaker.Settings{
+		Name:        name,
+		MaxRequests: p.MaxRequests,
+		Interval:    time.Duration(p.Interval),
+		Timeout:     time.Duration(p.Timeout),
+	}
+	if n := p.ConsecutiveFailures; n > 0 {
+		settings.ReadyToTrip = func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= n
+		}
+	}
+	return settings
+}
@@ -2,110 +2,209 @@ package addendpoint
 
 import (
 	"context"
-	"time"
-
-	"golang.org/x/time/rate"
+	"fmt"
 
 	stdopentracing "github.com/opentracing/opentracing-go"
 	stdzipkin "github.com/openzipkin/zipkin-go"
 	"github.com/sony/gobreaker"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
-	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/tracing/opentracing"
 	"github.com/go-kit/kit/tracing/zipkin"
 
 	"github.com/go-kit/examples/addsvc/pkg/addservice"
+	"github.com/go-kit/examples/health"
 )
 
 // Set collects all of the endpoints that compose an add service. It's meant to
 // be used as a helper struct, to collect all of the endpoints into a single
 // parameter.
 type Set struct {
-	SumEndpoint    endpoint.Endpoint
-	ConcatEndpoint endpoint.Endpoint
+	SumEndpoint    TypedEndpoint[SumRequest, SumResponse]
+	ConcatEndpoint TypedEndpoint[ConcatRequest, ConcatResponse]
+
+	// The streaming endpoints are optional. When they're nil, SumStream and
+	// ConcatStream fall back to calling SumEndpoint and ConcatEndpoint once
+	// per pair.
+	SumStreamEndpoint    StreamEndpoint[SumRequest, SumResponse]
+	ConcatStreamEndpoint StreamEndpoint[ConcatRequest, ConcatResponse]
+
+	// breakers returns the state of the circuit breaker of each method, for
+	// the Sets built by New.
+	breakers map[string]func() gobreaker.State
 }
 
 // New returns a Set that wraps the provided server, and wires in all of the
-// expected endpoint middlewares via the various parameters.
-func New(svc addservice.Service, logger log.Logger, duration metrics.Histogram, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer) Set {
-	var sumEndpoint endpoint.Endpoint
+// expected endpoint middlewares via the various parameters. The resilience
+// middlewares of each method follow the live policy; see DefaultPolicy for
+// what addsvc uses when it isn't configured. Callers are authenticated by the
+// passed Authenticator, unless it's nil.
+func New(svc addservice.Service, policy *LivePolicy, auth *Authenticator, logger log.Logger, duration metrics.Histogram, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer) Set {
+	sumResilience := newResilience("Sum", policy, func(p Policy) MethodPolicy { return p.Sum }, MakeSumEndpoint(svc))
+	var sumEndpoint TypedEndpoint[SumRequest, SumResponse]
 	{
-		sumEndpoint = MakeSumEndpoint(svc)
-		// Sum is limited to 1 request per second with burst of 1 request.
-		// Note, rate is defined as a time interval between requests.
-		sumEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 1))(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(sumEndpoint)
-		sumEndpoint = opentracing.TraceServer(otTracer, "Sum")(sumEndpoint)
+		sumEndpoint = sumResilience.endpoint
+		sumEndpoint = AuthMiddleware[SumRequest, SumResponse](auth, log.With(logger, "method", "Sum"))(sumEndpoint)
+		sumEndpoint = FromMiddleware[SumRequest, SumResponse](opentracing.TraceServer(otTracer, "Sum"))(sumEndpoint)
 		if zipkinTracer != nil {
-			sumEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Sum")(sumEndpoint)
+			sumEndpoint = FromMiddleware[SumRequest, SumResponse](zipkin.TraceEndpoint(zipkinTracer, "Sum"))(sumEndpoint)
 		}
-		sumEndpoint = LoggingMiddleware(log.With(logger, "method", "Sum"))(sumEndpoint)
-		sumEndpoint = InstrumentingMiddleware(duration.With("method", "Sum"))(sumEndpoint)
+		sumEndpoint = LoggingMiddleware[SumRequest, SumResponse](log.With(logger, "method", "Sum"))(sumEndpoint)
+		sumEndpoint = InstrumentingMiddleware[SumRequest, SumResponse](duration.With("method", "Sum"))(sumEndpoint)
 	}
-	var concatEndpoint endpoint.Endpoint
+	concatResilience := newResilience("Concat", policy, func(p Policy) MethodPolicy { return p.Concat }, MakeConcatEndpoint(svc))
+	var concatEndpoint TypedEndpoint[ConcatRequest, ConcatResponse]
 	{
-		concatEndpoint = MakeConcatEndpoint(svc)
-		// Concat is limited to 1 request per second with burst of 100 requests.
-		// Note, rate is defined as a number of requests per second.
-		concatEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Limit(1), 100))(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(concatEndpoint)
-		concatEndpoint = opentracing.TraceServer(otTracer, "Concat")(concatEndpoint)
+		concatEndpoint = concatResilience.endpoint
+		concatEndpoint = AuthMiddleware[ConcatRequest, ConcatResponse](auth, log.With(logger, "method", "Concat"))(concatEndpoint)
+		concatEndpoint = FromMiddleware[ConcatRequest, ConcatResponse](opentracing.TraceServer(otTracer, "Concat"))(concatEndpoint)
 		if zipkinTracer != nil {
-			concatEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Concat")(concatEndpoint)
+			concatEndpoint = FromMiddleware[ConcatRequest, ConcatResponse](zipkin.TraceEndpoint(zipkinTracer, "Concat"))(concatEndpoint)
 		}
-		concatEndpoint = LoggingMiddleware(log.With(logger, "method", "Concat"))(concatEndpoint)
-		concatEndpoint = InstrumentingMiddleware(duration.With("method", "Concat"))(concatEndpoint)
+		concatEndpoint = LoggingMiddleware[ConcatRequest, ConcatResponse](log.With(logger, "method", "Concat"))(concatEndpoint)
+		concatEndpoint = InstrumentingMiddleware[ConcatRequest, ConcatResponse](duration.With("method", "Concat"))(concatEndpoint)
+	}
+	// The streaming endpoints aren't rate limited or circuit broken per
+	// request: a stream is a single batch, and a failing pair is reported in
+	// its own response rather than ending the stream.
+	var sumStreamEndpoint StreamEndpoint[SumRequest, SumResponse]
+	{
+		sumStreamEndpoint = MakeSumStreamEndpoint(svc)
+		sumStreamEndpoint = StreamAuthMiddleware[SumRequest, SumResponse](auth, log.With(logger, "method", "SumStream"), func(err error) SumResponse { return SumResponse{Err: err} })(sumStreamEndpoint)
+		sumStreamEndpoint = StreamLoggingMiddleware[SumRequest, SumResponse](log.With(logger, "method", "SumStream"))(sumStreamEndpoint)
+	}
+	var concatStreamEndpoint StreamEndpoint[ConcatRequest, ConcatResponse]
+	{
+		concatStreamEndpoint = MakeConcatStreamEndpoint(svc)
+		concatStreamEndpoint = StreamAuthMiddleware[ConcatRequest, ConcatResponse](auth, log.With(logger, "method", "ConcatStream"), func(err error) ConcatResponse { return ConcatResponse{Err: err} })(concatStreamEndpoint)
+		concatStreamEndpoint = StreamLoggingMiddleware[ConcatRequest, ConcatResponse](log.With(logger, "method", "ConcatStream"))(concatStreamEndpoint)
 	}
 	return Set{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+		SumEndpoint:          sumEndpoint,
+		ConcatEndpoint:       concatEndpoint,
+		SumStreamEndpoint:    sumStreamEndpoint,
+		ConcatStreamEndpoint: concatStreamEndpoint,
+		breakers: map[string]func() gobreaker.State{
+			"sum":    sumResilience.breakerState,
+			"concat": concatResilience.breakerState,
+		},
+	}
+}
+
+// Checks returns a health check for the circuit breaker of each method, which
+// fails while the breaker is open. They're meant to be registered as
+// readiness checks. Sets that weren't built by New have no checks.
+func (s Set) Checks() map[string]health.Check {
+	checks := make(map[string]health.Check, len(s.breakers))
+	for name, state := range s.breakers {
+		state := state
+		checks[name+"_breaker"] = func(context.Context) error {
+			if st := state(); st == gobreaker.StateOpen {
+				return fmt.Errorf("circuit breaker is %s", st)
+			}
+			return nil
+		}
 	}
+	return checks
 }
 
 // Sum implements the service interface, so Set may be used as a service.
 // This is primarily useful in the context of a client library.
 func (s Set) Sum(ctx context.Context, a, b int) (int, error) {
-	resp, err := s.SumEndpoint(ctx, SumRequest{A: a, B: b})
+	response, err := s.SumEndpoint(ctx, SumRequest{A: a, B: b})
 	if err != nil {
 		return 0, err
 	}
-	response := resp.(SumResponse)
 	return response.V, response.Err
 }
 
 // Concat implements the service interface, so Set may be used as a
 // service. This is primarily useful in the context of a client library.
 func (s Set) Concat(ctx context.Context, a, b string) (string, error) {
-	resp, err := s.ConcatEndpoint(ctx, ConcatRequest{A: a, B: b})
+	response, err := s.ConcatEndpoint(ctx, ConcatRequest{A: a, B: b})
 	if err != nil {
 		return "", err
 	}
-	response := resp.(ConcatResponse)
 	return response.V, response.Err
 }
 
+// SumStream implements the service interface, so Set may be used as a
+// service. This is primarily useful in the context of a client library.
+func (s Set) SumStream(ctx context.Context, pairs <-chan addservice.IntPair) <-chan addservice.IntResult {
+	if s.SumStreamEndpoint == nil {
+		return pipe(ctx, pairs, func(p addservice.IntPair) addservice.IntResult {
+			v, err := s.Sum(ctx, p.A, p.B)
+			return addservice.IntResult{V: v, Err: err}
+		})
+	}
+	requests := pipe(ctx, pairs, func(p addservice.IntPair) SumRequest {
+		return SumRequest{A: p.A, B: p.B}
+	})
+	return pipe(ctx, s.SumStreamEndpoint(ctx, requests), func(r SumResponse) addservice.IntResult {
+		return addservice.IntResult{V: r.V, Err: r.Err}
+	})
+}
+
+// ConcatStream implements the service interface, so Set may be used as a
+// service. This is primarily useful in the context of a client library.
+func (s Set) ConcatStream(ctx context.Context, pairs <-chan addservice.StringPair) <-chan addservice.StringResult {
+	if s.ConcatStreamEndpoint == nil {
+		return pipe(ctx, pairs, func(p addservice.StringPair) addservice.StringResult {
+			v, err := s.Concat(ctx, p.A, p.B)
+			return addservice.StringResult{V: v, Err: err}
+		})
+	}
+	requests := pipe(ctx, pairs, func(p addservice.StringPair) ConcatRequest {
+		return ConcatRequest{A: p.A, B: p.B}
+	})
+	return pipe(ctx, s.ConcatStreamEndpoint(ctx, requests), func(r ConcatResponse) addservice.StringResult {
+		return addservice.StringResult{V: r.V, Err: r.Err}
+	})
+}
+
 // MakeSumEndpoint constructs a Sum endpoint wrapping the service.
-func MakeSumEndpoint(s addservice.Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		req := request.(SumRequest)
+func MakeSumEndpoint(s addservice.Service) TypedEndpoint[SumRequest, SumResponse] {
+	return func(ctx context.Context, req SumRequest) (SumResponse, error) {
 		v, err := s.Sum(ctx, req.A, req.B)
 		return SumResponse{V: v, Err: err}, nil
 	}
 }
 
 // MakeConcatEndpoint constructs a Concat endpoint wrapping the service.
-func MakeConcatEndpoint(s addservice.Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		req := request.(ConcatRequest)
+func MakeConcatEndpoint(s addservice.Service) TypedEndpoint[ConcatRequest, ConcatResponse] {
+	return func(ctx context.Context, req ConcatRequest) (ConcatResponse, error) {
 		v, err := s.Concat(ctx, req.A, req.B)
 		return ConcatResponse{V: v, Err: err}, nil
 	}
 }
 
+// MakeSumStreamEndpoint constructs a SumStream endpoint wrapping the service.
+func MakeSumStreamEndpoint(s addservice.Service) StreamEndpoint[SumRequest, SumResponse] {
+	return func(ctx context.Context, requests <-chan SumRequest) <-chan SumResponse {
+		pairs := pipe(ctx, requests, func(req SumRequest) addservice.IntPair {
+			return addservice.IntPair{A: req.A, B: req.B}
+		})
+		return pipe(ctx, s.SumStream(ctx, pairs), func(r addservice.IntResult) SumResponse {
+			return SumResponse{V: r.V, Err: r.Err}
+		})
+	}
+}
+
+// MakeConcatStreamEndpoint constructs a ConcatStream endpoint wrapping the
+// service.
+func MakeConcatStreamEndpoint(s addservice.Service) StreamEndpoint[ConcatRequest, ConcatResponse] {
+	return func(ctx context.Context, requests <-chan ConcatRequest) <-chan ConcatResponse {
+		pairs := pipe(ctx, requests, func(req ConcatRequest) addservice.StringPair {
+			return addservice.StringPair{A: req.A, B: req.B}
+		})
+		return pipe(ctx, s.ConcatStream(ctx, pairs), func(r addservice.StringResult) ConcatResponse {
+			return ConcatResponse{V: r.V, Err: r.Err}
+		})
+	}
+}
+
 // compile time assertions for our response types implementing endpoint.Failer.
 var (
 	_ endpoint.Failer = SumResponse{}
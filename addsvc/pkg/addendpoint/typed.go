@@ -0,0 +1,97 @@
+package addendpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// TypedEndpoint is the statically typed counterpart of Go kit's
+// endpoint.Endpoint. Because the request and response types are part of the
+// endpoint type, wiring an endpoint to a decoder or encoder for a different
+// method is a compile error rather than a failed type assertion at runtime.
+type TypedEndpoint[Req, Resp any] func(ctx context.Context, request Req) (Resp, error)
+
+// TypedMiddleware is a chainable behavior modifier for TypedEndpoints.
+type TypedMiddleware[Req, Resp any] func(TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp]
+
+// StreamEndpoint is the streaming counterpart of TypedEndpoint. It receives
+// requests until the requests channel is closed or the context is canceled,
+// and sends one response per request on the returned channel, which it closes
+// when it's done. Errors for individual requests are carried in the
+// responses, so a single failure doesn't end the stream.
+type StreamEndpoint[Req, Resp any] func(ctx context.Context, requests <-chan Req) <-chan Resp
+
+// StreamMiddleware is a chainable behavior modifier for StreamEndpoints.
+type StreamMiddleware[Req, Resp any] func(StreamEndpoint[Req, Resp]) StreamEndpoint[Req, Resp]
+
+// ErrUnexpectedType is returned when a value crossing the boundary between a
+// TypedEndpoint and an untyped endpoint.Endpoint doesn't have the expected
+// type. It always indicates programmer error.
+var ErrUnexpectedType = errors.New("unexpected type")
+
+// Endpoint adapts the TypedEndpoint to an endpoint.Endpoint, so it can be
+// served by the Go kit transports. A request of the wrong type produces an
+// error wrapping ErrUnexpectedType instead of a panic.
+func (e TypedEndpoint[Req, Resp]) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(Req)
+		if !ok {
+			return nil, fmt.Errorf("%w: request is %T, want %T", ErrUnexpectedType, request, req)
+		}
+		return e(ctx, req)
+	}
+}
+
+// FromEndpoint adapts an endpoint.Endpoint, typically a Go kit transport
+// client or a load balancer, to a TypedEndpoint. A response of the wrong type
+// produces an error wrapping ErrUnexpectedType instead of a panic.
+func FromEndpoint[Req, Resp any](e endpoint.Endpoint) TypedEndpoint[Req, Resp] {
+	return func(ctx context.Context, request Req) (Resp, error) {
+		var resp Resp
+		response, err := e(ctx, request)
+		if err != nil {
+			return resp, err
+		}
+		resp, ok := response.(Resp)
+		if !ok {
+			return resp, fmt.Errorf("%w: response is %T, want %T", ErrUnexpectedType, response, resp)
+		}
+		return resp, nil
+	}
+}
+
+// FromMiddleware adapts an endpoint.Middleware, like the Go kit tracing
+// middlewares, to a TypedMiddleware.
+func FromMiddleware[Req, Resp any](mw endpoint.Middleware) TypedMiddleware[Req, Resp] {
+	return func(next TypedEndpoint[Req, Resp]) TypedEndpoint[Req, Resp] {
+		return FromEndpoint[Req, Resp](mw(next.Endpoint()))
+	}
+}
+
+// pipe applies f to every value received from in, and sends the results on
+// the returned channel, which is closed when in is closed or ctx is canceled.
+func pipe[In, Out any](ctx context.Context, in <-chan In, f func(In) Out) <-chan Out {
+	out := make(chan Out)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- f(v):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
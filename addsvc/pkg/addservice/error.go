@@ -0,0 +1,49 @@
+package addservice
+
+// Code identifies the kind of an Error, independently of the transport that
+// carries it. Each transport maps codes to its own status codes.
+type Code string
+
+// The codes of the errors returned by the service.
+const (
+	CodeTwoZeroes       Code = "two_zeroes"
+	CodeIntOverflow     Code = "int_overflow"
+	CodeMaxSizeExceeded Code = "max_size_exceeded"
+
+	// CodeUnauthenticated is used by the endpoints for requests that don't
+	// carry valid credentials.
+	CodeUnauthenticated Code = "unauthenticated"
+
+	// CodeUnknown is used by transports for errors that didn't originate as
+	// an *Error, like a failure to decode a request.
+	CodeUnknown Code = "unknown"
+)
+
+// Error is the structured error returned by the service. Every transport
+// carries all of its fields, so errors returned by a client can be matched
+// against the Err variables with errors.Is, whichever transport was used.
+type Error struct {
+	Code      Code              `json:"code"`
+	Message   string            `json:"message"`
+	Retryable bool              `json:"retryable,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is an *Error with the same code, so that errors
+// decoded by a transport match the Err variables.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetails returns a copy of the error carrying the passed details.
+func (e *Error) WithDetails(details map[string]string) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
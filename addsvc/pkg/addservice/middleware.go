@@ -37,6 +37,24 @@ func (mw loggingMiddleware) Concat(ctx context.Context, a, b string) (v string,
 	return mw.next.Concat(ctx, a, b)
 }
 
+func (mw loggingMiddleware) SumStream(ctx context.Context, pairs <-chan IntPair) <-chan IntResult {
+	var n int
+	return pipe(ctx, mw.next.SumStream(ctx, pairs), func(r IntResult) IntResult {
+		n++
+		mw.logger.Log("method", "SumStream", "n", n, "v", r.V, "err", r.Err)
+		return r
+	})
+}
+
+func (mw loggingMiddleware) ConcatStream(ctx context.Context, pairs <-chan StringPair) <-chan StringResult {
+	var n int
+	return pipe(ctx, mw.next.ConcatStream(ctx, pairs), func(r StringResult) StringResult {
+		n++
+		mw.logger.Log("method", "ConcatStream", "n", n, "v", r.V, "err", r.Err)
+		return r
+	})
+}
+
 // InstrumentingMiddleware returns a service middleware that instruments
 // the number of integers summed and characters concatenated over the lifetime of
 // the service.
@@ -67,3 +85,17 @@ func (mw instrumentingMiddleware) Concat(ctx context.Context, a, b string) (stri
 	mw.chars.Add(float64(len(v)))
 	return v, err
 }
+
+func (mw instrumentingMiddleware) SumStream(ctx context.Context, pairs <-chan IntPair) <-chan IntResult {
+	return pipe(ctx, mw.next.SumStream(ctx, pairs), func(r IntResult) IntResult {
+		mw.ints.Add(float64(r.V))
+		return r
+	})
+}
+
+func (mw instrumentingMiddleware) ConcatStream(ctx context.Context, pairs <-chan StringPair) <-chan StringResult {
+	return pipe(ctx, mw.next.ConcatStream(ctx, pairs), func(r StringResult) StringResult {
+		mw.chars.Add(float64(len(r.V)))
+		return r
+	})
+}
@@ -2,7 +2,7 @@ package addservice
 
 import (
 	"context"
-	"errors"
+	"strconv"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
@@ -12,6 +12,36 @@ import (
 type Service interface {
 	Sum(ctx context.Context, a, b int) (int, error)
 	Concat(ctx context.Context, a, b string) (string, error)
+
+	// SumStream and ConcatStream apply Sum and Concat to every pair received
+	// on the input channel, and send one result per pair, in order, on the
+	// returned channel. A failing pair doesn't stop the stream: its error is
+	// carried by its result. The returned channel is closed once the input
+	// channel is closed and drained, or the context is canceled.
+	SumStream(ctx context.Context, pairs <-chan IntPair) <-chan IntResult
+	ConcatStream(ctx context.Context, pairs <-chan StringPair) <-chan StringResult
+}
+
+// IntPair is a single pair of operands for SumStream.
+type IntPair struct {
+	A, B int
+}
+
+// IntResult is the outcome of summing a single IntPair.
+type IntResult struct {
+	V   int
+	Err error
+}
+
+// StringPair is a single pair of operands for ConcatStream.
+type StringPair struct {
+	A, B string
+}
+
+// StringResult is the outcome of concatenating a single StringPair.
+type StringResult struct {
+	V   string
+	Err error
 }
 
 // New returns a basic Service with all of the expected middlewares wired in.
@@ -27,16 +57,16 @@ func New(logger log.Logger, ints, chars metrics.Counter) Service {
 
 var (
 	// ErrTwoZeroes is an arbitrary business rule for the Add method.
-	ErrTwoZeroes = errors.New("can't sum two zeroes")
+	ErrTwoZeroes = &Error{Code: CodeTwoZeroes, Message: "can't sum two zeroes"}
 
 	// ErrIntOverflow protects the Add method. We've decided that this error
 	// indicates a misbehaving service and should count against e.g. circuit
 	// breakers. So, we return it directly in endpoints, to illustrate the
 	// difference. In a real service, this probably wouldn't be the case.
-	ErrIntOverflow = errors.New("integer overflow")
+	ErrIntOverflow = &Error{Code: CodeIntOverflow, Message: "integer overflow"}
 
 	// ErrMaxSizeExceeded protects the Concat method.
-	ErrMaxSizeExceeded = errors.New("result exceeds maximum size")
+	ErrMaxSizeExceeded = &Error{Code: CodeMaxSizeExceeded, Message: "result exceeds maximum size"}
 )
 
 // NewBasicService returns a naïve, stateless implementation of Service.
@@ -65,7 +95,50 @@ func (s basicService) Sum(_ context.Context, a, b int) (int, error) {
 // Concat implements Service.
 func (s basicService) Concat(_ context.Context, a, b string) (string, error) {
 	if len(a)+len(b) > maxLen {
-		return "", ErrMaxSizeExceeded
+		return "", ErrMaxSizeExceeded.WithDetails(map[string]string{
+			"max_size": strconv.Itoa(maxLen),
+		})
 	}
 	return a + b, nil
 }
+
+// SumStream implements Service.
+func (s basicService) SumStream(ctx context.Context, pairs <-chan IntPair) <-chan IntResult {
+	return pipe(ctx, pairs, func(p IntPair) IntResult {
+		v, err := s.Sum(ctx, p.A, p.B)
+		return IntResult{V: v, Err: err}
+	})
+}
+
+// ConcatStream implements Service.
+func (s basicService) ConcatStream(ctx context.Context, pairs <-chan StringPair) <-chan StringResult {
+	return pipe(ctx, pairs, func(p StringPair) StringResult {
+		v, err := s.Concat(ctx, p.A, p.B)
+		return StringResult{V: v, Err: err}
+	})
+}
+
+// pipe applies f to every value received from in, and sends the results on
+// the returned channel, which is closed when in is closed or ctx is canceled.
+func pipe[In, Out any](ctx context.Context, in <-chan In, f func(In) Out) <-chan Out {
+	out := make(chan Out)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- f(v):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
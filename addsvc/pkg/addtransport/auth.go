@@ -0,0 +1,86 @@
+package addtransport
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/go-kit/examples/addsvc/pkg/addendpoint"
+)
+
+// The credentials of the caller travel in the Authorization header of HTTP
+// and JSON-RPC requests, and under the same key, lowercased as gRPC requires,
+// in gRPC metadata and Thrift headers. The latter are only sent with the
+// THeader protocol. See addendpoint.ContextWithAuthorization for the format.
+const authorizationKey = "authorization"
+
+// authHTTPToContext moves the credentials of an HTTP request to the context.
+// Primarily useful in a server.
+func authHTTPToContext(ctx context.Context, r *http.Request) context.Context {
+	if authorization := r.Header.Get(authorizationKey); authorization != "" {
+		return addendpoint.ContextWithAuthorization(ctx, authorization)
+	}
+	return ctx
+}
+
+// authContextToHTTP moves the credentials in the context to an HTTP request.
+// Primarily useful in a client.
+func authContextToHTTP(ctx context.Context, r *http.Request) context.Context {
+	if authorization := addendpoint.AuthorizationFromContext(ctx); authorization != "" {
+		r.Header.Set(authorizationKey, authorization)
+	}
+	return ctx
+}
+
+// authGRPCToContext moves the credentials in gRPC metadata to the context.
+// Primarily useful in a server.
+func authGRPCToContext(ctx context.Context, md metadata.MD) context.Context {
+	if values := md.Get(authorizationKey); len(values) > 0 {
+		return addendpoint.ContextWithAuthorization(ctx, values[0])
+	}
+	return ctx
+}
+
+// authContextToGRPC moves the credentials in the context to gRPC metadata.
+// Primarily useful in a client.
+func authContextToGRPC(ctx context.Context, md *metadata.MD) context.Context {
+	if authorization := addendpoint.AuthorizationFromContext(ctx); authorization != "" {
+		md.Set(authorizationKey, authorization)
+	}
+	return ctx
+}
+
+// authContextToGRPCStream adds the credentials in the context to the outgoing
+// metadata of the context, which is sent when a stream is opened with it.
+// Primarily useful in a client.
+func authContextToGRPCStream(ctx context.Context) context.Context {
+	if authorization := addendpoint.AuthorizationFromContext(ctx); authorization != "" {
+		return metadata.AppendToOutgoingContext(ctx, authorizationKey, authorization)
+	}
+	return ctx
+}
+
+// authThriftToContext moves the credentials in the Thrift headers that the
+// server put in the context to where the endpoints look for them. Primarily
+// useful in a server.
+func authThriftToContext(ctx context.Context) context.Context {
+	if authorization, ok := thrift.GetHeader(ctx, authorizationKey); ok && authorization != "" {
+		return addendpoint.ContextWithAuthorization(ctx, authorization)
+	}
+	return ctx
+}
+
+// authContextToThrift sets the credentials in the context as a Thrift header,
+// which the client sends when it uses the THeader protocol. Primarily useful
+// in a client.
+func authContextToThrift(ctx context.Context) context.Context {
+	authorization := addendpoint.AuthorizationFromContext(ctx)
+	if authorization == "" {
+		return ctx
+	}
+	ctx = thrift.SetHeader(ctx, authorizationKey, authorization)
+	keys := thrift.GetWriteHeaderList(ctx)
+	return thrift.SetWriteHeaderList(ctx, append(keys[:len(keys):len(keys)], authorizationKey))
+}
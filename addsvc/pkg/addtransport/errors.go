@@ -0,0 +1,30 @@
+package addtransport
+
+import (
+	"errors"
+
+	"github.com/go-kit/examples/addsvc/pkg/addservice"
+)
+
+// serviceError returns err as an *addservice.Error, so that every transport
+// can encode it with all of its fields. Errors that didn't originate in the
+// service, like decoding failures, get addservice.CodeUnknown.
+func serviceError(err error) *addservice.Error {
+	var e *addservice.Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &addservice.Error{Code: addservice.CodeUnknown, Message: err.Error()}
+}
+
+// isBusinessError reports whether a client should return an error decoded
+// from the transport in the response, like the server endpoints do, rather
+// than as an endpoint error that counts against its circuit breaker. Unknown
+// errors and ErrIntOverflow count against the breaker; see the comment on
+// addservice.ErrIntOverflow.
+func isBusinessError(err error) bool {
+	var e *addservice.Error
+	return errors.As(err, &e) &&
+		e.Code != addservice.CodeUnknown &&
+		!errors.Is(err, addservice.ErrIntOverflow)
+}
@@ -3,19 +3,21 @@ package addtransport
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	stdopentracing "github.com/opentracing/opentracing-go"
 	stdzipkin "github.com/openzipkin/zipkin-go"
 	"github.com/sony/gobreaker"
 	"golang.org/x/time/rate"
 
-	"github.com/go-kit/kit/circuitbreaker"
-	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/tracing/opentracing"
 	"github.com/go-kit/kit/tracing/zipkin"
 	"github.com/go-kit/kit/transport"
@@ -27,14 +29,17 @@ import (
 )
 
 type grpcServer struct {
-	sum    grpctransport.Handler
-	concat grpctransport.Handler
+	sum          grpctransport.Handler
+	concat       grpctransport.Handler
+	sumStream    func(grpcServerStream[*pb.SumRequest, *pb.SumReply]) error
+	concatStream func(grpcServerStream[*pb.ConcatRequest, *pb.ConcatReply]) error
 }
 
 // NewGRPCServer makes a set of endpoints available as a gRPC AddServer.
 func NewGRPCServer(endpoints addendpoint.Set, otTracer stdopentracing.Tracer, zipkinTracer *stdzipkin.Tracer, logger log.Logger) pb.AddServer {
 	options := []grpctransport.ServerOption{
 		grpctransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		grpctransport.ServerBefore(authGRPCToContext),
 	}
 
 	if zipkinTracer != nil {
@@ -51,35 +56,63 @@ func NewGRPCServer(endpoints addendpoint.Set, otTracer stdopentracing.Tracer, zi
 	}
 
 	return &grpcServer{
-		sum: grpctransport.NewServer(
+		sum: newGRPCServer(
 			endpoints.SumEndpoint,
 			decodeGRPCSumRequest,
 			encodeGRPCSumResponse,
 			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "Sum", logger)))...,
 		),
-		concat: grpctransport.NewServer(
+		concat: newGRPCServer(
 			endpoints.ConcatEndpoint,
 			decodeGRPCConcatRequest,
 			encodeGRPCConcatResponse,
 			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "Concat", logger)))...,
 		),
+		sumStream: newGRPCStreamServer(
+			endpoints.SumStreamEndpoint,
+			decodeGRPCSumRequest,
+			encodeGRPCSumResponse,
+			transport.NewLogErrorHandler(logger),
+		),
+		concatStream: newGRPCStreamServer(
+			endpoints.ConcatStreamEndpoint,
+			decodeGRPCConcatRequest,
+			encodeGRPCConcatResponse,
+			transport.NewLogErrorHandler(logger),
+		),
 	}
 }
 
 func (s *grpcServer) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumReply, error) {
 	_, rep, err := s.sum.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, grpcEndpointError(err)
 	}
-	return rep.(*pb.SumReply), nil
+	reply := rep.(*pb.SumReply)
+	if reply.Error != nil {
+		return nil, pb2status(reply.Error).Err()
+	}
+	return reply, nil
 }
 
 func (s *grpcServer) Concat(ctx context.Context, req *pb.ConcatRequest) (*pb.ConcatReply, error) {
 	_, rep, err := s.concat.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, grpcEndpointError(err)
+	}
+	reply := rep.(*pb.ConcatReply)
+	if reply.Error != nil {
+		return nil, pb2status(reply.Error).Err()
 	}
-	return rep.(*pb.ConcatReply), nil
+	return reply, nil
+}
+
+func (s *grpcServer) SumStream(stream pb.Add_SumStreamServer) error {
+	return s.sumStream(stream)
+}
+
+func (s *grpcServer) ConcatStream(stream pb.Add_ConcatStreamServer) error {
+	return s.concatStream(stream)
 }
 
 // NewGRPCClient returns an AddService backed by a gRPC server at the other end
@@ -92,10 +125,12 @@ func NewGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, zipkin
 	// construct per-endpoint circuitbreaker middlewares to demonstrate how
 	// that's done, although they could easily be combined into a single breaker
 	// for the entire remote instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+	limiter := rate.NewLimiter(rate.Every(time.Second), 100)
 
 	// global client middlewares
-	var options []grpctransport.ClientOption
+	options := []grpctransport.ClientOption{
+		grpctransport.ClientBefore(authContextToGRPC),
+	}
 
 	if zipkinTracer != nil {
 		// Zipkin GRPC Client Trace can either be instantiated per gRPC method with a
@@ -109,23 +144,25 @@ func NewGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, zipkin
 
 	}
 	// Each individual endpoint is an grpc/transport.Client (which implements
-	// endpoint.Endpoint) that gets wrapped with various middlewares. If you
-	// made your own client library, you'd do this work there, so your server
-	// could rely on a consistent set of client behavior.
-	var sumEndpoint endpoint.Endpoint
+	// endpoint.Endpoint) adapted to a typed endpoint, that gets wrapped with
+	// various middlewares. If you made your own client library, you'd do this
+	// work there, so your server could rely on a consistent set of client
+	// behavior.
+	var sumEndpoint addendpoint.TypedEndpoint[addendpoint.SumRequest, addendpoint.SumResponse]
 	{
-		sumEndpoint = grpctransport.NewClient(
+		sumEndpoint = newGRPCClient(
 			conn,
 			"pb.Add",
 			"Sum",
 			encodeGRPCSumRequest,
 			decodeGRPCSumResponse,
+			failedSumResponse,
 			pb.SumReply{},
 			append(options, grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)))...,
-		).Endpoint()
-		sumEndpoint = opentracing.TraceClient(otTracer, "Sum")(sumEndpoint)
-		sumEndpoint = limiter(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		)
+		sumEndpoint = addendpoint.FromMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](opentracing.TraceClient(otTracer, "Sum"))(sumEndpoint)
+		sumEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](limiter)(sumEndpoint)
+		sumEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Sum",
 			Timeout: 30 * time.Second,
 		}))(sumEndpoint)
@@ -133,108 +170,431 @@ func NewGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, zipkin
 
 	// The Concat endpoint is the same thing, with slightly different
 	// middlewares to demonstrate how to specialize per-endpoint.
-	var concatEndpoint endpoint.Endpoint
+	var concatEndpoint addendpoint.TypedEndpoint[addendpoint.ConcatRequest, addendpoint.ConcatResponse]
 	{
-		concatEndpoint = grpctransport.NewClient(
+		concatEndpoint = newGRPCClient(
 			conn,
 			"pb.Add",
 			"Concat",
 			encodeGRPCConcatRequest,
 			decodeGRPCConcatResponse,
+			failedConcatResponse,
 			pb.ConcatReply{},
 			append(options, grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)))...,
-		).Endpoint()
-		concatEndpoint = opentracing.TraceClient(otTracer, "Concat")(concatEndpoint)
-		concatEndpoint = limiter(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		)
+		concatEndpoint = addendpoint.FromMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](opentracing.TraceClient(otTracer, "Concat"))(concatEndpoint)
+		concatEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](limiter)(concatEndpoint)
+		concatEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Concat",
 			Timeout: 10 * time.Second,
 		}))(concatEndpoint)
 	}
 
+	// The streaming endpoints hold a single gRPC stream open per call, so
+	// they bypass the per-request rate limiter and circuit breakers above.
+	sumStreamEndpoint := newGRPCStreamClient(
+		func(ctx context.Context) (grpcClientStream[*pb.SumRequest, *pb.SumReply], error) {
+			return pb.NewAddClient(conn).SumStream(ctx)
+		},
+		encodeGRPCSumRequest,
+		decodeGRPCSumResponse,
+		failedSumResponse,
+	)
+	concatStreamEndpoint := newGRPCStreamClient(
+		func(ctx context.Context) (grpcClientStream[*pb.ConcatRequest, *pb.ConcatReply], error) {
+			return pb.NewAddClient(conn).ConcatStream(ctx)
+		},
+		encodeGRPCConcatRequest,
+		decodeGRPCConcatResponse,
+		failedConcatResponse,
+	)
+
 	// Returning the endpoint.Set as a service.Service relies on the
 	// endpoint.Set implementing the Service methods. That's just a simple bit
 	// of glue code.
 	return addendpoint.Set{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+		SumEndpoint:          sumEndpoint,
+		ConcatEndpoint:       concatEndpoint,
+		SumStreamEndpoint:    sumStreamEndpoint,
+		ConcatStreamEndpoint: concatStreamEndpoint,
+	}
+}
+
+// newGRPCServer binds a typed endpoint to a request decoder and a response
+// encoder of matching types, so a mismatched codec doesn't compile.
+func newGRPCServer[PbReq, Req, Resp, PbResp any](
+	e addendpoint.TypedEndpoint[Req, Resp],
+	dec func(context.Context, PbReq) (Req, error),
+	enc func(context.Context, Resp) (PbResp, error),
+	options ...grpctransport.ServerOption,
+) *grpctransport.Server {
+	return grpctransport.NewServer(
+		e.Endpoint(),
+		func(ctx context.Context, grpcReq interface{}) (interface{}, error) {
+			req, ok := grpcReq.(PbReq)
+			if !ok {
+				return nil, fmt.Errorf("%w: gRPC request is %T, want %T", addendpoint.ErrUnexpectedType, grpcReq, req)
+			}
+			return dec(ctx, req)
+		},
+		func(ctx context.Context, response interface{}) (interface{}, error) {
+			resp, ok := response.(Resp)
+			if !ok {
+				return nil, fmt.Errorf("%w: response is %T, want %T", addendpoint.ErrUnexpectedType, response, resp)
+			}
+			return enc(ctx, resp)
+		},
+		options...,
+	)
+}
+
+// newGRPCClient returns a typed endpoint backed by a transport/grpc.Client.
+// Pass a zero-value protobuf message of the RPC response type as grpcReply;
+// it must be the message type the response decoder expects a pointer to.
+// Service errors returned in the gRPC status are decoded, and business errors
+// are moved into a response built by fail.
+func newGRPCClient[Req, PbReq, PbResp, Resp any](
+	conn *grpc.ClientConn,
+	serviceName string,
+	method string,
+	enc func(context.Context, Req) (PbReq, error),
+	dec func(context.Context, PbResp) (Resp, error),
+	fail func(error) Resp,
+	grpcReply interface{},
+	options ...grpctransport.ClientOption,
+) addendpoint.TypedEndpoint[Req, Resp] {
+	e := addendpoint.FromEndpoint[Req, Resp](grpctransport.NewClient(
+		conn,
+		serviceName,
+		method,
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			req, ok := request.(Req)
+			if !ok {
+				return nil, fmt.Errorf("%w: request is %T, want %T", addendpoint.ErrUnexpectedType, request, req)
+			}
+			return enc(ctx, req)
+		},
+		func(ctx context.Context, grpcReply interface{}) (interface{}, error) {
+			reply, ok := grpcReply.(PbResp)
+			if !ok {
+				return nil, fmt.Errorf("%w: gRPC reply is %T, want %T", addendpoint.ErrUnexpectedType, grpcReply, reply)
+			}
+			return dec(ctx, reply)
+		},
+		grpcReply,
+		options...,
+	).Endpoint())
+	return func(ctx context.Context, req Req) (Resp, error) {
+		resp, err := e(ctx, req)
+		if err != nil {
+			err = status2err(err)
+			if isBusinessError(err) {
+				return fail(err), nil
+			}
+		}
+		return resp, err
+	}
+}
+
+// grpcServerStream is the server side of a bidirectional gRPC stream, as
+// implemented by the generated pb.Add_*Server types.
+type grpcServerStream[PbReq, PbResp any] interface {
+	Context() context.Context
+	Recv() (PbReq, error)
+	Send(PbResp) error
+}
+
+// grpcClientStream is the client side of a bidirectional gRPC stream, as
+// implemented by the generated pb.Add_*Client types.
+type grpcClientStream[PbReq, PbResp any] interface {
+	Send(PbReq) error
+	Recv() (PbResp, error)
+	CloseSend() error
+}
+
+// newGRPCStreamServer returns a handler that serves a bidirectional gRPC
+// stream with a stream endpoint. Go kit's gRPC transport only covers unary
+// RPCs, so this plays the part of grpctransport.Server for streams. The
+// handler returns once the client has closed its side of the stream and
+// every response has been sent, or as soon as the stream breaks.
+func newGRPCStreamServer[PbReq, Req, Resp, PbResp any](
+	e addendpoint.StreamEndpoint[Req, Resp],
+	dec func(context.Context, PbReq) (Req, error),
+	enc func(context.Context, Resp) (PbResp, error),
+	errorHandler transport.ErrorHandler,
+) func(grpcServerStream[PbReq, PbResp]) error {
+	return func(stream grpcServerStream[PbReq, PbResp]) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		ctx, cancel := context.WithCancel(authGRPCToContext(stream.Context(), md))
+		defer cancel()
+
+		requests := make(chan Req)
+		recvErr := make(chan error, 1)
+		go func() {
+			defer close(requests)
+			for {
+				grpcReq, err := stream.Recv()
+				if err == io.EOF {
+					recvErr <- nil
+					return
+				}
+				if err == nil {
+					var req Req
+					if req, err = dec(ctx, grpcReq); err == nil {
+						select {
+						case requests <- req:
+							continue
+						case <-ctx.Done():
+							err = ctx.Err()
+						}
+					}
+				}
+				recvErr <- err
+				return
+			}
+		}()
+
+		for resp := range e(ctx, requests) {
+			grpcResp, err := enc(ctx, resp)
+			if err == nil {
+				err = stream.Send(grpcResp)
+			}
+			if err != nil {
+				errorHandler.Handle(ctx, err)
+				return err
+			}
+		}
+
+		// The endpoint only finishes once the requests are drained or the
+		// stream's context is done, so the receiving goroutine is finishing
+		// too.
+		if err := <-recvErr; err != nil {
+			errorHandler.Handle(ctx, err)
+			return err
+		}
+		return nil
 	}
 }
 
-// decodeGRPCSumRequest is a transport/grpc.DecodeRequestFunc that converts a
-// gRPC sum request to a user-domain sum request. Primarily useful in a server.
-func decodeGRPCSumRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
-	req := grpcReq.(*pb.SumRequest)
+// newGRPCStreamClient returns a stream endpoint that opens a bidirectional
+// gRPC stream per call. Requests are sent as they arrive, and replies are
+// decoded as they come back. If the stream breaks, the error is delivered in
+// a final response built by fail, and the responses channel is closed.
+func newGRPCStreamClient[Req, PbReq, PbResp, Resp any](
+	open func(context.Context) (grpcClientStream[PbReq, PbResp], error),
+	enc func(context.Context, Req) (PbReq, error),
+	dec func(context.Context, PbResp) (Resp, error),
+	fail func(error) Resp,
+) addendpoint.StreamEndpoint[Req, Resp] {
+	return func(ctx context.Context, requests <-chan Req) <-chan Resp {
+		responses := make(chan Resp)
+		go func() {
+			defer close(responses)
+			streamCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			sendFailed := func(err error) {
+				select {
+				case responses <- fail(err):
+				case <-ctx.Done():
+				}
+			}
+
+			stream, err := open(authContextToGRPCStream(streamCtx))
+			if err != nil {
+				sendFailed(err)
+				return
+			}
+
+			encErr := make(chan error, 1)
+			go func() {
+				for {
+					select {
+					case req, ok := <-requests:
+						if !ok {
+							stream.CloseSend()
+							return
+						}
+						grpcReq, err := enc(streamCtx, req)
+						if err != nil {
+							// Canceling the context breaks the stream, which
+							// makes the receiving side report encErr.
+							encErr <- err
+							cancel()
+							return
+						}
+						if err := stream.Send(grpcReq); err != nil {
+							// The actual error is returned by Recv.
+							return
+						}
+					case <-streamCtx.Done():
+						return
+					}
+				}
+			}()
+
+			for {
+				grpcResp, err := stream.Recv()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					select {
+					case err = <-encErr:
+					default:
+						err = status2err(err)
+					}
+					sendFailed(err)
+					return
+				}
+				resp, err := dec(ctx, grpcResp)
+				if err != nil {
+					sendFailed(err)
+					return
+				}
+				select {
+				case responses <- resp:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return responses
+	}
+}
+
+// decodeGRPCSumRequest converts a gRPC sum request to a user-domain sum
+// request. Primarily useful in a server.
+func decodeGRPCSumRequest(_ context.Context, req *pb.SumRequest) (addendpoint.SumRequest, error) {
 	return addendpoint.SumRequest{A: int(req.A), B: int(req.B)}, nil
 }
 
-// decodeGRPCConcatRequest is a transport/grpc.DecodeRequestFunc that converts a
-// gRPC concat request to a user-domain concat request. Primarily useful in a
-// server.
-func decodeGRPCConcatRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
-	req := grpcReq.(*pb.ConcatRequest)
+// decodeGRPCConcatRequest converts a gRPC concat request to a user-domain
+// concat request. Primarily useful in a server.
+func decodeGRPCConcatRequest(_ context.Context, req *pb.ConcatRequest) (addendpoint.ConcatRequest, error) {
 	return addendpoint.ConcatRequest{A: req.A, B: req.B}, nil
 }
 
-// decodeGRPCSumResponse is a transport/grpc.DecodeResponseFunc that converts a
-// gRPC sum reply to a user-domain sum response. Primarily useful in a client.
-func decodeGRPCSumResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
-	reply := grpcReply.(*pb.SumReply)
-	return addendpoint.SumResponse{V: int(reply.V), Err: str2err(reply.Err)}, nil
+// decodeGRPCSumResponse converts a gRPC sum reply to a user-domain sum
+// response. Primarily useful in a client.
+func decodeGRPCSumResponse(_ context.Context, reply *pb.SumReply) (addendpoint.SumResponse, error) {
+	return addendpoint.SumResponse{V: int(reply.V), Err: pb2err(reply.Error)}, nil
 }
 
-// decodeGRPCConcatResponse is a transport/grpc.DecodeResponseFunc that converts
-// a gRPC concat reply to a user-domain concat response. Primarily useful in a
-// client.
-func decodeGRPCConcatResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
-	reply := grpcReply.(*pb.ConcatReply)
-	return addendpoint.ConcatResponse{V: reply.V, Err: str2err(reply.Err)}, nil
+// decodeGRPCConcatResponse converts a gRPC concat reply to a user-domain
+// concat response. Primarily useful in a client.
+func decodeGRPCConcatResponse(_ context.Context, reply *pb.ConcatReply) (addendpoint.ConcatResponse, error) {
+	return addendpoint.ConcatResponse{V: reply.V, Err: pb2err(reply.Error)}, nil
 }
 
-// encodeGRPCSumResponse is a transport/grpc.EncodeResponseFunc that converts a
-// user-domain sum response to a gRPC sum reply. Primarily useful in a server.
-func encodeGRPCSumResponse(_ context.Context, response interface{}) (interface{}, error) {
-	resp := response.(addendpoint.SumResponse)
-	return &pb.SumReply{V: int64(resp.V), Err: err2str(resp.Err)}, nil
+// encodeGRPCSumResponse converts a user-domain sum response to a gRPC sum
+// reply. Primarily useful in a server.
+func encodeGRPCSumResponse(_ context.Context, resp addendpoint.SumResponse) (*pb.SumReply, error) {
+	return &pb.SumReply{V: int64(resp.V), Error: err2pb(resp.Err)}, nil
 }
 
-// encodeGRPCConcatResponse is a transport/grpc.EncodeResponseFunc that converts
-// a user-domain concat response to a gRPC concat reply. Primarily useful in a
-// server.
-func encodeGRPCConcatResponse(_ context.Context, response interface{}) (interface{}, error) {
-	resp := response.(addendpoint.ConcatResponse)
-	return &pb.ConcatReply{V: resp.V, Err: err2str(resp.Err)}, nil
+// encodeGRPCConcatResponse converts a user-domain concat response to a gRPC
+// concat reply. Primarily useful in a server.
+func encodeGRPCConcatResponse(_ context.Context, resp addendpoint.ConcatResponse) (*pb.ConcatReply, error) {
+	return &pb.ConcatReply{V: resp.V, Error: err2pb(resp.Err)}, nil
 }
 
-// encodeGRPCSumRequest is a transport/grpc.EncodeRequestFunc that converts a
-// user-domain sum request to a gRPC sum request. Primarily useful in a client.
-func encodeGRPCSumRequest(_ context.Context, request interface{}) (interface{}, error) {
-	req := request.(addendpoint.SumRequest)
+// encodeGRPCSumRequest converts a user-domain sum request to a gRPC sum
+// request. Primarily useful in a client.
+func encodeGRPCSumRequest(_ context.Context, req addendpoint.SumRequest) (*pb.SumRequest, error) {
 	return &pb.SumRequest{A: int64(req.A), B: int64(req.B)}, nil
 }
 
-// encodeGRPCConcatRequest is a transport/grpc.EncodeRequestFunc that converts a
-// user-domain concat request to a gRPC concat request. Primarily useful in a
-// client.
-func encodeGRPCConcatRequest(_ context.Context, request interface{}) (interface{}, error) {
-	req := request.(addendpoint.ConcatRequest)
+// encodeGRPCConcatRequest converts a user-domain concat request to a gRPC
+// concat request. Primarily useful in a client.
+func encodeGRPCConcatRequest(_ context.Context, req addendpoint.ConcatRequest) (*pb.ConcatRequest, error) {
 	return &pb.ConcatRequest{A: req.A, B: req.B}, nil
 }
 
-// These annoying helper functions are required to translate Go error types to
-// and from strings, which is the type we use in our IDLs to represent errors.
-// There is special casing to treat empty strings as nil errors.
+// failedSumResponse carries an error returned by the transport in a sum
+// response. Primarily useful in a client.
+func failedSumResponse(err error) addendpoint.SumResponse {
+	return addendpoint.SumResponse{Err: err}
+}
 
-func str2err(s string) error {
-	if s == "" {
+// failedConcatResponse carries an error returned by the transport in a concat
+// response. Primarily useful in a client.
+func failedConcatResponse(err error) addendpoint.ConcatResponse {
+	return addendpoint.ConcatResponse{Err: err}
+}
+
+// err2pb and pb2err translate service errors to and from the Error message of
+// our IDL. There is special casing to treat nil messages as nil errors.
+
+func err2pb(err error) *pb.Error {
+	if err == nil {
 		return nil
 	}
-	return errors.New(s)
+	e := serviceError(err)
+	return &pb.Error{
+		Code:      string(e.Code),
+		Message:   e.Message,
+		Retryable: e.Retryable,
+		Details:   e.Details,
+	}
 }
 
-func err2str(err error) string {
-	if err == nil {
-		return ""
+func pb2err(e *pb.Error) error {
+	if e == nil {
+		return nil
+	}
+	return &addservice.Error{
+		Code:      addservice.Code(e.Code),
+		Message:   e.Message,
+		Retryable: e.Retryable,
+		Details:   e.Details,
+	}
+}
+
+// pb2status returns a gRPC status for a service error, with the error itself
+// attached as a detail, so clients can decode it with status2err.
+func pb2status(e *pb.Error) *status.Status {
+	st := status.New(code2grpc(addservice.Code(e.Code)), e.Message)
+	if withDetails, err := st.WithDetails(e); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// grpcEndpointError converts endpoint errors that are service errors, like
+// addendpoint.ErrUnauthenticated, to a gRPC status the same way as business
+// errors. Other errors are returned unchanged.
+func grpcEndpointError(err error) error {
+	var e *addservice.Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	return pb2status(err2pb(e)).Err()
+}
+
+// status2err decodes the service error attached to a gRPC status. Other
+// errors are returned unchanged.
+func status2err(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, detail := range st.Details() {
+		if e, ok := detail.(*pb.Error); ok {
+			return pb2err(e)
+		}
+	}
+	return err
+}
+
+func code2grpc(code addservice.Code) codes.Code {
+	switch code {
+	case addservice.CodeTwoZeroes, addservice.CodeMaxSizeExceeded:
+		return codes.InvalidArgument
+	case addservice.CodeIntOverflow:
+		return codes.OutOfRange
+	case addservice.CodeUnauthenticated:
+		return codes.Unauthenticated
 	}
-	return err.Error()
+	return codes.Unknown
 }
@@ -17,10 +17,8 @@ import (
 	stdzipkin "github.com/openzipkin/zipkin-go"
 	"github.com/sony/gobreaker"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/tracing/opentracing"
 	"github.com/go-kit/kit/tracing/zipkin"
 	"github.com/go-kit/kit/transport"
@@ -36,6 +34,7 @@ func NewHTTPHandler(endpoints addendpoint.Set, otTracer stdopentracing.Tracer, z
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorEncoder(errorEncoder),
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerBefore(authHTTPToContext),
 	}
 
 	if zipkinTracer != nil {
@@ -48,13 +47,13 @@ func NewHTTPHandler(endpoints addendpoint.Set, otTracer stdopentracing.Tracer, z
 	}
 
 	m := http.NewServeMux()
-	m.Handle("/sum", httptransport.NewServer(
+	m.Handle("/sum", newHTTPServer(
 		endpoints.SumEndpoint,
 		decodeHTTPSumRequest,
 		encodeHTTPGenericResponse,
 		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "Sum", logger)))...,
 	))
-	m.Handle("/concat", httptransport.NewServer(
+	m.Handle("/concat", newHTTPServer(
 		endpoints.ConcatEndpoint,
 		decodeHTTPConcatRequest,
 		encodeHTTPGenericResponse,
@@ -82,10 +81,12 @@ func NewHTTPClient(instance string, otTracer stdopentracing.Tracer, zipkinTracer
 	// construct per-endpoint circuitbreaker middlewares to demonstrate how
 	// that's done, although they could easily be combined into a single breaker
 	// for the entire remote instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+	limiter := rate.NewLimiter(rate.Every(time.Second), 100)
 
 	// global client middlewares
-	var options []httptransport.ClientOption
+	options := []httptransport.ClientOption{
+		httptransport.ClientBefore(authContextToHTTP),
+	}
 
 	if zipkinTracer != nil {
 		// Zipkin HTTP Client Trace can either be instantiated per endpoint with a
@@ -96,24 +97,24 @@ func NewHTTPClient(instance string, otTracer stdopentracing.Tracer, zipkinTracer
 	}
 
 	// Each individual endpoint is an http/transport.Client (which implements
-	// endpoint.Endpoint) that gets wrapped with various middlewares. If you
-	// made your own client library, you'd do this work there, so your server
-	// could rely on a consistent set of client behavior.
-	var sumEndpoint endpoint.Endpoint
+	// endpoint.Endpoint) adapted to a typed endpoint, that gets wrapped with
+	// various middlewares. If you made your own client library, you'd do this
+	// work there, so your server could rely on a consistent set of client
+	// behavior.
+	var sumEndpoint addendpoint.TypedEndpoint[addendpoint.SumRequest, addendpoint.SumResponse]
 	{
-		sumEndpoint = httptransport.NewClient(
+		sumEndpoint = newHTTPClient[addendpoint.SumRequest](
 			"POST",
 			copyURL(u, "/sum"),
-			encodeHTTPGenericRequest,
 			decodeHTTPSumResponse,
 			append(options, httptransport.ClientBefore(opentracing.ContextToHTTP(otTracer, logger)))...,
-		).Endpoint()
-		sumEndpoint = opentracing.TraceClient(otTracer, "Sum")(sumEndpoint)
+		)
+		sumEndpoint = addendpoint.FromMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](opentracing.TraceClient(otTracer, "Sum"))(sumEndpoint)
 		if zipkinTracer != nil {
-			sumEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Sum")(sumEndpoint)
+			sumEndpoint = addendpoint.FromMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](zipkin.TraceEndpoint(zipkinTracer, "Sum"))(sumEndpoint)
 		}
-		sumEndpoint = limiter(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		sumEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](limiter)(sumEndpoint)
+		sumEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Sum",
 			Timeout: 30 * time.Second,
 		}))(sumEndpoint)
@@ -121,21 +122,20 @@ func NewHTTPClient(instance string, otTracer stdopentracing.Tracer, zipkinTracer
 
 	// The Concat endpoint is the same thing, with slightly different
 	// middlewares to demonstrate how to specialize per-endpoint.
-	var concatEndpoint endpoint.Endpoint
+	var concatEndpoint addendpoint.TypedEndpoint[addendpoint.ConcatRequest, addendpoint.ConcatResponse]
 	{
-		concatEndpoint = httptransport.NewClient(
+		concatEndpoint = newHTTPClient[addendpoint.ConcatRequest](
 			"POST",
 			copyURL(u, "/concat"),
-			encodeHTTPGenericRequest,
 			decodeHTTPConcatResponse,
 			append(options, httptransport.ClientBefore(opentracing.ContextToHTTP(otTracer, logger)))...,
-		).Endpoint()
-		concatEndpoint = opentracing.TraceClient(otTracer, "Concat")(concatEndpoint)
+		)
+		concatEndpoint = addendpoint.FromMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](opentracing.TraceClient(otTracer, "Concat"))(concatEndpoint)
 		if zipkinTracer != nil {
-			concatEndpoint = zipkin.TraceEndpoint(zipkinTracer, "Concat")(concatEndpoint)
+			concatEndpoint = addendpoint.FromMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](zipkin.TraceEndpoint(zipkinTracer, "Concat"))(concatEndpoint)
 		}
-		concatEndpoint = limiter(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		concatEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](limiter)(concatEndpoint)
+		concatEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Concat",
 			Timeout: 10 * time.Second,
 		}))(concatEndpoint)
@@ -150,6 +150,39 @@ func NewHTTPClient(instance string, otTracer stdopentracing.Tracer, zipkinTracer
 	}, nil
 }
 
+// newHTTPServer binds a typed endpoint to a request decoder producing the
+// same request type, so a mismatched decoder doesn't compile.
+func newHTTPServer[Req, Resp any](
+	e addendpoint.TypedEndpoint[Req, Resp],
+	dec func(context.Context, *http.Request) (Req, error),
+	enc httptransport.EncodeResponseFunc,
+	options ...httptransport.ServerOption,
+) *httptransport.Server {
+	return httptransport.NewServer(
+		e.Endpoint(),
+		func(ctx context.Context, r *http.Request) (interface{}, error) { return dec(ctx, r) },
+		enc,
+		options...,
+	)
+}
+
+// newHTTPClient returns a typed endpoint backed by a transport/http.Client,
+// whose response type is fixed by the passed response decoder.
+func newHTTPClient[Req, Resp any](
+	method string,
+	tgt *url.URL,
+	dec func(context.Context, *http.Response) (Resp, error),
+	options ...httptransport.ClientOption,
+) addendpoint.TypedEndpoint[Req, Resp] {
+	return addendpoint.FromEndpoint[Req, Resp](httptransport.NewClient(
+		method,
+		tgt,
+		encodeHTTPGenericRequest,
+		func(ctx context.Context, r *http.Response) (interface{}, error) { return dec(ctx, r) },
+		options...,
+	).Endpoint())
+}
+
 func copyURL(base *url.URL, path string) *url.URL {
 	next := *base
 	next.Path = path
@@ -157,34 +190,41 @@ func copyURL(base *url.URL, path string) *url.URL {
 }
 
 func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	w.WriteHeader(err2code(err))
-	json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
+	e := serviceError(err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err2code(e))
+	json.NewEncoder(w).Encode(errorWrapper{Error: e})
 }
 
-func err2code(err error) int {
-	switch err {
-	case addservice.ErrTwoZeroes, addservice.ErrMaxSizeExceeded, addservice.ErrIntOverflow:
+func err2code(e *addservice.Error) int {
+	switch e.Code {
+	case addservice.CodeTwoZeroes, addservice.CodeMaxSizeExceeded, addservice.CodeIntOverflow:
 		return http.StatusBadRequest
+	case addservice.CodeUnauthenticated:
+		return http.StatusUnauthorized
 	}
 	return http.StatusInternalServerError
 }
 
+// errorDecoder decodes the service error written by errorEncoder. If the body
+// doesn't hold one, e.g. because a proxy answered the request, the error is
+// the response status.
 func errorDecoder(r *http.Response) error {
 	var w errorWrapper
-	if err := json.NewDecoder(r.Body).Decode(&w); err != nil {
-		return err
+	if err := json.NewDecoder(r.Body).Decode(&w); err != nil || w.Error == nil {
+		return errors.New(r.Status)
 	}
-	return errors.New(w.Error)
+	return w.Error
 }
 
 type errorWrapper struct {
-	Error string `json:"error"`
+	Error *addservice.Error `json:"error"`
 }
 
 // decodeHTTPSumRequest is a transport/http.DecodeRequestFunc that decodes a
 // JSON-encoded sum request from the HTTP request body. Primarily useful in a
 // server.
-func decodeHTTPSumRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeHTTPSumRequest(_ context.Context, r *http.Request) (addendpoint.SumRequest, error) {
 	var req addendpoint.SumRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	return req, err
@@ -193,7 +233,7 @@ func decodeHTTPSumRequest(_ context.Context, r *http.Request) (interface{}, erro
 // decodeHTTPConcatRequest is a transport/http.DecodeRequestFunc that decodes a
 // JSON-encoded concat request from the HTTP request body. Primarily useful in a
 // server.
-func decodeHTTPConcatRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeHTTPConcatRequest(_ context.Context, r *http.Request) (addendpoint.ConcatRequest, error) {
 	var req addendpoint.ConcatRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	return req, err
@@ -202,11 +242,15 @@ func decodeHTTPConcatRequest(_ context.Context, r *http.Request) (interface{}, e
 // decodeHTTPSumResponse is a transport/http.DecodeResponseFunc that decodes a
 // JSON-encoded sum response from the HTTP response body. If the response has a
 // non-200 status code, we will interpret that as an error and attempt to decode
-// the specific error message from the response body. Primarily useful in a
+// the specific service error from the response body. Primarily useful in a
 // client.
-func decodeHTTPSumResponse(_ context.Context, r *http.Response) (interface{}, error) {
+func decodeHTTPSumResponse(_ context.Context, r *http.Response) (addendpoint.SumResponse, error) {
 	if r.StatusCode != http.StatusOK {
-		return nil, errors.New(r.Status)
+		err := errorDecoder(r)
+		if isBusinessError(err) {
+			return addendpoint.SumResponse{Err: err}, nil
+		}
+		return addendpoint.SumResponse{}, err
 	}
 	var resp addendpoint.SumResponse
 	err := json.NewDecoder(r.Body).Decode(&resp)
@@ -216,11 +260,15 @@ func decodeHTTPSumResponse(_ context.Context, r *http.Response) (interface{}, er
 // decodeHTTPConcatResponse is a transport/http.DecodeResponseFunc that decodes
 // a JSON-encoded concat response from the HTTP response body. If the response
 // has a non-200 status code, we will interpret that as an error and attempt to
-// decode the specific error message from the response body. Primarily useful in
+// decode the specific service error from the response body. Primarily useful in
 // a client.
-func decodeHTTPConcatResponse(_ context.Context, r *http.Response) (interface{}, error) {
+func decodeHTTPConcatResponse(_ context.Context, r *http.Response) (addendpoint.ConcatResponse, error) {
 	if r.StatusCode != http.StatusOK {
-		return nil, errors.New(r.Status)
+		err := errorDecoder(r)
+		if isBusinessError(err) {
+			return addendpoint.ConcatResponse{Err: err}, nil
+		}
+		return addendpoint.ConcatResponse{}, err
 	}
 	var resp addendpoint.ConcatResponse
 	err := json.NewDecoder(r.Body).Decode(&resp)
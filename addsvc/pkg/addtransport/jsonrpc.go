@@ -3,7 +3,9 @@ package addtransport
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -12,10 +14,7 @@ import (
 
 	"github.com/go-kit/examples/addsvc/pkg/addendpoint"
 	"github.com/go-kit/examples/addsvc/pkg/addservice"
-	"github.com/go-kit/kit/circuitbreaker"
-	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/tracing/opentracing"
 	"github.com/go-kit/kit/transport/http/jsonrpc"
 	stdopentracing "github.com/opentracing/opentracing-go"
@@ -26,7 +25,9 @@ import (
 func NewJSONRPCHandler(endpoints addendpoint.Set, logger log.Logger) *jsonrpc.Server {
 	handler := jsonrpc.NewServer(
 		makeEndpointCodecMap(endpoints),
+		jsonrpc.ServerErrorEncoder(jsonrpcErrorEncoder),
 		jsonrpc.ServerErrorLogger(logger),
+		jsonrpc.ServerBefore(authHTTPToContext),
 	)
 	return handler
 }
@@ -50,35 +51,25 @@ func NewJSONRPCClient(instance string, tracer stdopentracing.Tracer, logger log.
 	// construct per-endpoint circuitbreaker middlewares to demonstrate how
 	// that's done, although they could easily be combined into a single breaker
 	// for the entire remote instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+	limiter := rate.NewLimiter(rate.Every(time.Second), 100)
 
-	var sumEndpoint endpoint.Endpoint
+	var sumEndpoint addendpoint.TypedEndpoint[addendpoint.SumRequest, addendpoint.SumResponse]
 	{
-		sumEndpoint = jsonrpc.NewClient(
-			u,
-			"sum",
-			jsonrpc.ClientRequestEncoder(encodeSumRequest),
-			jsonrpc.ClientResponseDecoder(decodeSumResponse),
-		).Endpoint()
-		sumEndpoint = opentracing.TraceClient(tracer, "Sum")(sumEndpoint)
-		sumEndpoint = limiter(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		sumEndpoint = newJSONRPCClient(u, "sum", encodeSumRequest, decodeSumResponse)
+		sumEndpoint = addendpoint.FromMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](opentracing.TraceClient(tracer, "Sum"))(sumEndpoint)
+		sumEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](limiter)(sumEndpoint)
+		sumEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Sum",
 			Timeout: 30 * time.Second,
 		}))(sumEndpoint)
 	}
 
-	var concatEndpoint endpoint.Endpoint
+	var concatEndpoint addendpoint.TypedEndpoint[addendpoint.ConcatRequest, addendpoint.ConcatResponse]
 	{
-		concatEndpoint = jsonrpc.NewClient(
-			u,
-			"concat",
-			jsonrpc.ClientRequestEncoder(encodeConcatRequest),
-			jsonrpc.ClientResponseDecoder(decodeConcatResponse),
-		).Endpoint()
-		concatEndpoint = opentracing.TraceClient(tracer, "Concat")(concatEndpoint)
-		concatEndpoint = limiter(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		concatEndpoint = newJSONRPCClient(u, "concat", encodeConcatRequest, decodeConcatResponse)
+		concatEndpoint = addendpoint.FromMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](opentracing.TraceClient(tracer, "Concat"))(concatEndpoint)
+		concatEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](limiter)(concatEndpoint)
+		concatEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Concat",
 			Timeout: 30 * time.Second,
 		}))(concatEndpoint)
@@ -97,24 +88,107 @@ func NewJSONRPCClient(instance string, tracer stdopentracing.Tracer, logger log.
 // makeEndpointCodecMap returns a codec map configured for the addsvc.
 func makeEndpointCodecMap(endpoints addendpoint.Set) jsonrpc.EndpointCodecMap {
 	return jsonrpc.EndpointCodecMap{
-		"sum": jsonrpc.EndpointCodec{
-			Endpoint: endpoints.SumEndpoint,
-			Decode:   decodeSumRequest,
-			Encode:   encodeSumResponse,
+		"sum":    makeEndpointCodec(endpoints.SumEndpoint, decodeSumRequest, encodeSumResponse),
+		"concat": makeEndpointCodec(endpoints.ConcatEndpoint, decodeConcatRequest, encodeConcatResponse),
+	}
+}
+
+// makeEndpointCodec binds a typed endpoint to a request decoder and a
+// response encoder of matching types, so a mismatched codec doesn't compile.
+func makeEndpointCodec[Req, Resp any](
+	e addendpoint.TypedEndpoint[Req, Resp],
+	dec func(context.Context, json.RawMessage) (Req, error),
+	enc func(context.Context, Resp) (json.RawMessage, error),
+) jsonrpc.EndpointCodec {
+	return jsonrpc.EndpointCodec{
+		Endpoint: e.Endpoint(),
+		Decode: func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+			return dec(ctx, msg)
+		},
+		Encode: func(ctx context.Context, obj interface{}) (json.RawMessage, error) {
+			res, ok := obj.(Resp)
+			if !ok {
+				return nil, &jsonrpc.Error{
+					Code:    -32000,
+					Message: fmt.Sprintf("Asserting result to %T failed. Got %T, %+v", res, obj, obj),
+				}
+			}
+			return enc(ctx, res)
 		},
-		"concat": jsonrpc.EndpointCodec{
-			Endpoint: endpoints.ConcatEndpoint,
-			Decode:   decodeConcatRequest,
-			Encode:   encodeConcatResponse,
+	}
+}
+
+// newJSONRPCClient returns a typed endpoint backed by a JSON RPC client
+// invoking the passed method.
+func newJSONRPCClient[Req, Resp any](
+	u *url.URL,
+	method string,
+	enc func(context.Context, Req) (json.RawMessage, error),
+	dec func(context.Context, jsonrpc.Response) (Resp, error),
+) addendpoint.TypedEndpoint[Req, Resp] {
+	return addendpoint.FromEndpoint[Req, Resp](jsonrpc.NewClient(
+		u,
+		method,
+		jsonrpc.ClientRequestEncoder(func(ctx context.Context, obj interface{}) (json.RawMessage, error) {
+			req, ok := obj.(Req)
+			if !ok {
+				return nil, fmt.Errorf("couldn't assert request as %T, got %T", req, obj)
+			}
+			return enc(ctx, req)
+		}),
+		jsonrpc.ClientResponseDecoder(func(ctx context.Context, res jsonrpc.Response) (interface{}, error) {
+			return dec(ctx, res)
+		}),
+		jsonrpc.ClientBefore(authContextToHTTP),
+	).Endpoint())
+}
+
+// jsonrpcServiceError is the JSON-RPC error code for service errors, taken
+// from the range reserved for implementation-defined server errors. The
+// service error itself is carried in the error's data.
+const jsonrpcServiceError = -32000
+
+// jsonrpcErrorEncoder is like jsonrpc.DefaultErrorEncoder, but encodes service
+// errors with all of their fields as the error's data.
+func jsonrpcErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	var e *addservice.Error
+	if !errors.As(err, &e) {
+		jsonrpc.DefaultErrorEncoder(ctx, err, w)
+		return
+	}
+	w.Header().Set("Content-Type", jsonrpc.ContentType)
+	json.NewEncoder(w).Encode(jsonrpc.Response{
+		JSONRPC: jsonrpc.Version,
+		Error: &jsonrpc.Error{
+			Code:    jsonrpcServiceError,
+			Message: e.Message,
+			Data:    e,
 		},
+	})
+}
+
+// jsonrpcError decodes the service error carried in the data of a JSON-RPC
+// error. Other errors are returned as is.
+func jsonrpcError(rpcErr jsonrpc.Error) error {
+	if rpcErr.Code != jsonrpcServiceError || rpcErr.Data == nil {
+		return rpcErr
+	}
+	data, err := json.Marshal(rpcErr.Data)
+	if err != nil {
+		return rpcErr
+	}
+	var e addservice.Error
+	if err := json.Unmarshal(data, &e); err != nil || e.Code == "" {
+		return rpcErr
 	}
+	return &e
 }
 
-func decodeSumRequest(_ context.Context, msg json.RawMessage) (interface{}, error) {
+func decodeSumRequest(_ context.Context, msg json.RawMessage) (addendpoint.SumRequest, error) {
 	var req addendpoint.SumRequest
 	err := json.Unmarshal(msg, &req)
 	if err != nil {
-		return nil, &jsonrpc.Error{
+		return req, &jsonrpc.Error{
 			Code:    -32000,
 			Message: fmt.Sprintf("couldn't unmarshal body to sum request: %s", err),
 		}
@@ -122,13 +196,9 @@ func decodeSumRequest(_ context.Context, msg json.RawMessage) (interface{}, erro
 	return req, nil
 }
 
-func encodeSumResponse(_ context.Context, obj interface{}) (json.RawMessage, error) {
-	res, ok := obj.(addendpoint.SumResponse)
-	if !ok {
-		return nil, &jsonrpc.Error{
-			Code:    -32000,
-			Message: fmt.Sprintf("Asserting result to *SumResponse failed. Got %T, %+v", obj, obj),
-		}
+func encodeSumResponse(_ context.Context, res addendpoint.SumResponse) (json.RawMessage, error) {
+	if res.Err != nil {
+		return nil, res.Err
 	}
 	b, err := json.Marshal(res)
 	if err != nil {
@@ -137,23 +207,23 @@ func encodeSumResponse(_ context.Context, obj interface{}) (json.RawMessage, err
 	return b, nil
 }
 
-func decodeSumResponse(_ context.Context, res jsonrpc.Response) (interface{}, error) {
+func decodeSumResponse(_ context.Context, res jsonrpc.Response) (addendpoint.SumResponse, error) {
+	var sumres addendpoint.SumResponse
 	if res.Error != nil {
-		return nil, *res.Error
+		err := jsonrpcError(*res.Error)
+		if isBusinessError(err) {
+			return addendpoint.SumResponse{Err: err}, nil
+		}
+		return sumres, err
 	}
-	var sumres addendpoint.SumResponse
 	err := json.Unmarshal(res.Result, &sumres)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't unmarshal body to SumResponse: %s", err)
+		return sumres, fmt.Errorf("couldn't unmarshal body to SumResponse: %s", err)
 	}
 	return sumres, nil
 }
 
-func encodeSumRequest(_ context.Context, obj interface{}) (json.RawMessage, error) {
-	req, ok := obj.(addendpoint.SumRequest)
-	if !ok {
-		return nil, fmt.Errorf("couldn't assert request as SumRequest, got %T", obj)
-	}
+func encodeSumRequest(_ context.Context, req addendpoint.SumRequest) (json.RawMessage, error) {
 	b, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't marshal request: %s", err)
@@ -161,11 +231,11 @@ func encodeSumRequest(_ context.Context, obj interface{}) (json.RawMessage, erro
 	return b, nil
 }
 
-func decodeConcatRequest(_ context.Context, msg json.RawMessage) (interface{}, error) {
+func decodeConcatRequest(_ context.Context, msg json.RawMessage) (addendpoint.ConcatRequest, error) {
 	var req addendpoint.ConcatRequest
 	err := json.Unmarshal(msg, &req)
 	if err != nil {
-		return nil, &jsonrpc.Error{
+		return req, &jsonrpc.Error{
 			Code:    -32000,
 			Message: fmt.Sprintf("couldn't unmarshal body to concat request: %s", err),
 		}
@@ -173,13 +243,9 @@ func decodeConcatRequest(_ context.Context, msg json.RawMessage) (interface{}, e
 	return req, nil
 }
 
-func encodeConcatResponse(_ context.Context, obj interface{}) (json.RawMessage, error) {
-	res, ok := obj.(addendpoint.ConcatResponse)
-	if !ok {
-		return nil, &jsonrpc.Error{
-			Code:    -32000,
-			Message: fmt.Sprintf("Asserting result to *ConcatResponse failed. Got %T, %+v", obj, obj),
-		}
+func encodeConcatResponse(_ context.Context, res addendpoint.ConcatResponse) (json.RawMessage, error) {
+	if res.Err != nil {
+		return nil, res.Err
 	}
 	b, err := json.Marshal(res)
 	if err != nil {
@@ -188,23 +254,23 @@ func encodeConcatResponse(_ context.Context, obj interface{}) (json.RawMessage,
 	return b, nil
 }
 
-func decodeConcatResponse(_ context.Context, res jsonrpc.Response) (interface{}, error) {
+func decodeConcatResponse(_ context.Context, res jsonrpc.Response) (addendpoint.ConcatResponse, error) {
+	var concatres addendpoint.ConcatResponse
 	if res.Error != nil {
-		return nil, *res.Error
+		err := jsonrpcError(*res.Error)
+		if isBusinessError(err) {
+			return addendpoint.ConcatResponse{Err: err}, nil
+		}
+		return concatres, err
 	}
-	var concatres addendpoint.ConcatResponse
 	err := json.Unmarshal(res.Result, &concatres)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't unmarshal body to ConcatResponse: %s", err)
+		return concatres, fmt.Errorf("couldn't unmarshal body to ConcatResponse: %s", err)
 	}
 	return concatres, nil
 }
 
-func encodeConcatRequest(_ context.Context, obj interface{}) (json.RawMessage, error) {
-	req, ok := obj.(addendpoint.ConcatRequest)
-	if !ok {
-		return nil, fmt.Errorf("couldn't assert request as ConcatRequest, got %T", obj)
-	}
+func encodeConcatRequest(_ context.Context, req addendpoint.ConcatRequest) (json.RawMessage, error) {
 	b, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't marshal request: %s", err)
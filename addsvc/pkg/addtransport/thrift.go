@@ -2,16 +2,13 @@ package addtransport
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"golang.org/x/time/rate"
 
 	"github.com/sony/gobreaker"
 
-	"github.com/go-kit/kit/circuitbreaker"
-	"github.com/go-kit/kit/endpoint"
-	"github.com/go-kit/kit/ratelimit"
-
 	"github.com/go-kit/examples/addsvc/pkg/addendpoint"
 	"github.com/go-kit/examples/addsvc/pkg/addservice"
 	addthrift "github.com/go-kit/examples/addsvc/thrift/gen-go/addsvc"
@@ -31,22 +28,26 @@ func NewThriftServer(endpoints addendpoint.Set) addthrift.AddService {
 
 func (s *thriftServer) Sum(ctx context.Context, a int64, b int64) (*addthrift.SumReply, error) {
 	request := addendpoint.SumRequest{A: int(a), B: int(b)}
-	response, err := s.endpoints.SumEndpoint(ctx, request)
+	resp, err := s.endpoints.SumEndpoint(authThriftToContext(ctx), request)
 	if err != nil {
-		return nil, err
+		return nil, thriftEndpointError(err)
+	}
+	if resp.Err != nil {
+		return nil, err2thrift(resp.Err)
 	}
-	resp := response.(addendpoint.SumResponse)
-	return &addthrift.SumReply{Value: int64(resp.V), Err: err2str(resp.Err)}, nil
+	return &addthrift.SumReply{Value: int64(resp.V)}, nil
 }
 
 func (s *thriftServer) Concat(ctx context.Context, a string, b string) (*addthrift.ConcatReply, error) {
 	request := addendpoint.ConcatRequest{A: a, B: b}
-	response, err := s.endpoints.ConcatEndpoint(ctx, request)
+	resp, err := s.endpoints.ConcatEndpoint(authThriftToContext(ctx), request)
 	if err != nil {
-		return nil, err
+		return nil, thriftEndpointError(err)
 	}
-	resp := response.(addendpoint.ConcatResponse)
-	return &addthrift.ConcatReply{Value: resp.V, Err: err2str(resp.Err)}, nil
+	if resp.Err != nil {
+		return nil, err2thrift(resp.Err)
+	}
+	return &addthrift.ConcatReply{Value: resp.V}, nil
 }
 
 // NewThriftClient returns an AddService backed by a Thrift server described by
@@ -59,16 +60,16 @@ func NewThriftClient(client *addthrift.AddServiceClient) addservice.Service {
 	// construct per-endpoint circuitbreaker middlewares to demonstrate how
 	// that's done, although they could easily be combined into a single breaker
 	// for the entire remote instance, too.
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+	limiter := rate.NewLimiter(rate.Every(time.Second), 100)
 
 	// Each individual endpoint is an http/transport.Client (which implements
 	// endpoint.Endpoint) that gets wrapped with various middlewares. If you
 	// could rely on a consistent set of client behavior.
-	var sumEndpoint endpoint.Endpoint
+	var sumEndpoint addendpoint.TypedEndpoint[addendpoint.SumRequest, addendpoint.SumResponse]
 	{
 		sumEndpoint = MakeThriftSumEndpoint(client)
-		sumEndpoint = limiter(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		sumEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](limiter)(sumEndpoint)
+		sumEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.SumRequest, addendpoint.SumResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Sum",
 			Timeout: 30 * time.Second,
 		}))(sumEndpoint)
@@ -76,11 +77,11 @@ func NewThriftClient(client *addthrift.AddServiceClient) addservice.Service {
 
 	// The Concat endpoint is the same thing, with slightly different
 	// middlewares to demonstrate how to specialize per-endpoint.
-	var concatEndpoint endpoint.Endpoint
+	var concatEndpoint addendpoint.TypedEndpoint[addendpoint.ConcatRequest, addendpoint.ConcatResponse]
 	{
 		concatEndpoint = MakeThriftConcatEndpoint(client)
-		concatEndpoint = limiter(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		concatEndpoint = addendpoint.RateLimitingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](limiter)(concatEndpoint)
+		concatEndpoint = addendpoint.CircuitBreakingMiddleware[addendpoint.ConcatRequest, addendpoint.ConcatResponse](gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Concat",
 			Timeout: 10 * time.Second,
 		}))(concatEndpoint)
@@ -97,24 +98,71 @@ func NewThriftClient(client *addthrift.AddServiceClient) addservice.Service {
 
 // MakeThriftSumEndpoint returns an endpoint that invokes the passed Thrift client.
 // Useful only in clients, and only until a proper transport/thrift.Client exists.
-func MakeThriftSumEndpoint(client *addthrift.AddServiceClient) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(addendpoint.SumRequest)
-		reply, err := client.Sum(ctx, int64(req.A), int64(req.B))
-		if err == addservice.ErrIntOverflow {
-			return nil, err // special case; see comment on ErrIntOverflow
+func MakeThriftSumEndpoint(client *addthrift.AddServiceClient) addendpoint.TypedEndpoint[addendpoint.SumRequest, addendpoint.SumResponse] {
+	return func(ctx context.Context, req addendpoint.SumRequest) (addendpoint.SumResponse, error) {
+		reply, err := client.Sum(authContextToThrift(ctx), int64(req.A), int64(req.B))
+		if err != nil {
+			err = thrift2err(err)
+			if isBusinessError(err) {
+				return addendpoint.SumResponse{Err: err}, nil
+			}
+			return addendpoint.SumResponse{}, err
 		}
-		return addendpoint.SumResponse{V: int(reply.Value), Err: err}, nil
+		return addendpoint.SumResponse{V: int(reply.Value)}, nil
 	}
 }
 
 // MakeThriftConcatEndpoint returns an endpoint that invokes the passed Thrift
 // client. Useful only in clients, and only until a proper
 // transport/thrift.Client exists.
-func MakeThriftConcatEndpoint(client *addthrift.AddServiceClient) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(addendpoint.ConcatRequest)
-		reply, err := client.Concat(ctx, req.A, req.B)
-		return addendpoint.ConcatResponse{V: reply.Value, Err: err}, nil
+func MakeThriftConcatEndpoint(client *addthrift.AddServiceClient) addendpoint.TypedEndpoint[addendpoint.ConcatRequest, addendpoint.ConcatResponse] {
+	return func(ctx context.Context, req addendpoint.ConcatRequest) (addendpoint.ConcatResponse, error) {
+		reply, err := client.Concat(authContextToThrift(ctx), req.A, req.B)
+		if err != nil {
+			err = thrift2err(err)
+			if isBusinessError(err) {
+				return addendpoint.ConcatResponse{Err: err}, nil
+			}
+			return addendpoint.ConcatResponse{}, err
+		}
+		return addendpoint.ConcatResponse{V: reply.Value}, nil
+	}
+}
+
+// err2thrift converts a service error to the AddError exception declared in
+// addsvc.thrift, so it reaches the client with all of its fields.
+func err2thrift(err error) *addthrift.AddError {
+	e := serviceError(err)
+	return &addthrift.AddError{
+		Code:      string(e.Code),
+		Message:   e.Message,
+		Retryable: e.Retryable,
+		Details:   e.Details,
+	}
+}
+
+// thriftEndpointError converts endpoint errors that are service errors, like
+// addendpoint.ErrUnauthenticated, to AddError exceptions. Other errors are
+// returned unchanged, and reach the client as internal errors.
+func thriftEndpointError(err error) error {
+	var e *addservice.Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	return err2thrift(e)
+}
+
+// thrift2err decodes an AddError exception back into a service error. Other
+// errors, like transport failures, are returned unchanged.
+func thrift2err(err error) error {
+	var e *addthrift.AddError
+	if !errors.As(err, &e) {
+		return err
+	}
+	return &addservice.Error{
+		Code:      addservice.Code(e.Code),
+		Message:   e.Message,
+		Retryable: e.Retryable,
+		Details:   e.Details,
 	}
 }
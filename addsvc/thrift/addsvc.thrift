@@ -8,7 +8,14 @@ struct ConcatReply {
 	2: string err
 }
 
+exception AddError {
+	1: string code
+	2: string message
+	3: bool retryable
+	4: map<string,string> details
+}
+
 service AddService {
-	SumReply Sum(1: i64 a, 2: i64 b)
-	ConcatReply Concat(1: string a, 2: string b)
+	SumReply Sum(1: i64 a, 2: i64 b) throws (1: AddError err)
+	ConcatReply Concat(1: string a, 2: string b) throws (1: AddError err)
 }
@@ -150,14 +150,14 @@ func main() {
 			fmt.Fprintln(os.Stderr, "Sum requires 2 args")
 			flag.Usage()
 		}
-		argvalue0, err8 := (strconv.ParseInt(flag.Arg(1), 10, 64))
-		if err8 != nil {
+		argvalue0, err11 := (strconv.ParseInt(flag.Arg(1), 10, 64))
+		if err11 != nil {
 			Usage()
 			return
 		}
 		value0 := argvalue0
-		argvalue1, err9 := (strconv.ParseInt(flag.Arg(2), 10, 64))
-		if err9 != nil {
+		argvalue1, err12 := (strconv.ParseInt(flag.Arg(2), 10, 64))
+		if err12 != nil {
 			Usage()
 			return
 		}
@@ -327,6 +327,295 @@ func (p *ConcatReply) String() string {
 	return fmt.Sprintf("ConcatReply(%+v)", *p)
 }
 
+// Attributes:
+//  - Code
+//  - Message
+//  - Retryable
+//  - Details
+type AddError struct {
+	Code      string            `thrift:"code,1" db:"code" json:"code"`
+	Message   string            `thrift:"message,2" db:"message" json:"message"`
+	Retryable bool              `thrift:"retryable,3" db:"retryable" json:"retryable"`
+	Details   map[string]string `thrift:"details,4" db:"details" json:"details"`
+}
+
+func NewAddError() *AddError {
+	return &AddError{}
+}
+
+func (p *AddError) GetCode() string {
+	return p.Code
+}
+
+func (p *AddError) GetMessage() string {
+	return p.Message
+}
+
+func (p *AddError) GetRetryable() bool {
+	return p.Retryable
+}
+
+func (p *AddError) GetDetails() map[string]string {
+	return p.Details
+}
+func (p *AddError) Read(ctx context.Context, iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(ctx); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T read error: ", p), err)
+	}
+
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin(ctx)
+		if err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T field %d read error: ", p, fieldId), err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 1:
+			if fieldTypeId == thrift.STRING {
+				if err := p.ReadField1(ctx, iprot); err != nil {
+					return err
+				}
+			} else {
+				if err := iprot.Skip(ctx, fieldTypeId); err != nil {
+					return err
+				}
+			}
+		case 2:
+			if fieldTypeId == thrift.STRING {
+				if err := p.ReadField2(ctx, iprot); err != nil {
+					return err
+				}
+			} else {
+				if err := iprot.Skip(ctx, fieldTypeId); err != nil {
+					return err
+				}
+			}
+		case 3:
+			if fieldTypeId == thrift.BOOL {
+				if err := p.ReadField3(ctx, iprot); err != nil {
+					return err
+				}
+			} else {
+				if err := iprot.Skip(ctx, fieldTypeId); err != nil {
+					return err
+				}
+			}
+		case 4:
+			if fieldTypeId == thrift.MAP {
+				if err := p.ReadField4(ctx, iprot); err != nil {
+					return err
+				}
+			} else {
+				if err := iprot.Skip(ctx, fieldTypeId); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := iprot.Skip(ctx, fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(ctx); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T read struct end error: ", p), err)
+	}
+	return nil
+}
+
+func (p *AddError) ReadField1(ctx context.Context, iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(ctx); err != nil {
+		return thrift.PrependError("error reading field 1: ", err)
+	} else {
+		p.Code = v
+	}
+	return nil
+}
+
+func (p *AddError) ReadField2(ctx context.Context, iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(ctx); err != nil {
+		return thrift.PrependError("error reading field 2: ", err)
+	} else {
+		p.Message = v
+	}
+	return nil
+}
+
+func (p *AddError) ReadField3(ctx context.Context, iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadBool(ctx); err != nil {
+		return thrift.PrependError("error reading field 3: ", err)
+	} else {
+		p.Retryable = v
+	}
+	return nil
+}
+
+func (p *AddError) ReadField4(ctx context.Context, iprot thrift.TProtocol) error {
+	_, _, size, err := iprot.ReadMapBegin(ctx)
+	if err != nil {
+		return thrift.PrependError("error reading map begin: ", err)
+	}
+	tMap := make(map[string]string, size)
+	p.Details = tMap
+	for i := 0; i < size; i++ {
+		var _key0 string
+		if v, err := iprot.ReadString(ctx); err != nil {
+			return thrift.PrependError("error reading field 0: ", err)
+		} else {
+			_key0 = v
+		}
+		var _val1 string
+		if v, err := iprot.ReadString(ctx); err != nil {
+			return thrift.PrependError("error reading field 0: ", err)
+		} else {
+			_val1 = v
+		}
+		p.Details[_key0] = _val1
+	}
+	if err := iprot.ReadMapEnd(ctx); err != nil {
+		return thrift.PrependError("error reading map end: ", err)
+	}
+	return nil
+}
+
+func (p *AddError) Write(ctx context.Context, oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin(ctx, "AddError"); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write struct begin error: ", p), err)
+	}
+	if p != nil {
+		if err := p.writeField1(ctx, oprot); err != nil {
+			return err
+		}
+		if err := p.writeField2(ctx, oprot); err != nil {
+			return err
+		}
+		if err := p.writeField3(ctx, oprot); err != nil {
+			return err
+		}
+		if err := p.writeField4(ctx, oprot); err != nil {
+			return err
+		}
+	}
+	if err := oprot.WriteFieldStop(ctx); err != nil {
+		return thrift.PrependError("write field stop error: ", err)
+	}
+	if err := oprot.WriteStructEnd(ctx); err != nil {
+		return thrift.PrependError("write struct stop error: ", err)
+	}
+	return nil
+}
+
+func (p *AddError) writeField1(ctx context.Context, oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin(ctx, "code", thrift.STRING, 1); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field begin error 1:code: ", p), err)
+	}
+	if err := oprot.WriteString(ctx, string(p.Code)); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T.code (1) field write error: ", p), err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field end error 1:code: ", p), err)
+	}
+	return err
+}
+
+func (p *AddError) writeField2(ctx context.Context, oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin(ctx, "message", thrift.STRING, 2); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field begin error 2:message: ", p), err)
+	}
+	if err := oprot.WriteString(ctx, string(p.Message)); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T.message (2) field write error: ", p), err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field end error 2:message: ", p), err)
+	}
+	return err
+}
+
+func (p *AddError) writeField3(ctx context.Context, oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin(ctx, "retryable", thrift.BOOL, 3); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field begin error 3:retryable: ", p), err)
+	}
+	if err := oprot.WriteBool(ctx, bool(p.Retryable)); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T.retryable (3) field write error: ", p), err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field end error 3:retryable: ", p), err)
+	}
+	return err
+}
+
+func (p *AddError) writeField4(ctx context.Context, oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin(ctx, "details", thrift.MAP, 4); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field begin error 4:details: ", p), err)
+	}
+	if err := oprot.WriteMapBegin(ctx, thrift.STRING, thrift.STRING, len(p.Details)); err != nil {
+		return thrift.PrependError("error writing map begin: ", err)
+	}
+	for k, v := range p.Details {
+		if err := oprot.WriteString(ctx, string(k)); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T. (0) field write error: ", p), err)
+		}
+		if err := oprot.WriteString(ctx, string(v)); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T. (0) field write error: ", p), err)
+		}
+	}
+	if err := oprot.WriteMapEnd(ctx); err != nil {
+		return thrift.PrependError("error writing map end: ", err)
+	}
+	if err := oprot.WriteFieldEnd(ctx); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T write field end error 4:details: ", p), err)
+	}
+	return err
+}
+
+func (p *AddError) Equals(other *AddError) bool {
+	if p == other {
+		return true
+	} else if p == nil || other == nil {
+		return false
+	}
+	if p.Code != other.Code {
+		return false
+	}
+	if p.Message != other.Message {
+		return false
+	}
+	if p.Retryable != other.Retryable {
+		return false
+	}
+	if len(p.Details) != len(other.Details) {
+		return false
+	}
+	for k, _tgt := range p.Details {
+		_src2 := other.Details[k]
+		if _tgt != _src2 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *AddError) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("AddError(%+v)", *p)
+}
+
+func (p *AddError) Error() string {
+	return p.String()
+}
+
+func (AddError) TExceptionType() thrift.TExceptionType {
+	return thrift.TExceptionTypeCompiled
+}
+
+var _ thrift.TException = (*AddError)(nil)
+
 type AddService interface {
 	// Parameters:
 	//  - A
@@ -377,34 +666,44 @@ func (p *AddServiceClient) SetLastResponseMeta_(meta thrift.ResponseMeta) {
 //  - A
 //  - B
 func (p *AddServiceClient) Sum(ctx context.Context, a int64, b int64) (_r *SumReply, _err error) {
-	var _args0 AddServiceSumArgs
-	_args0.A = a
-	_args0.B = b
-	var _result2 AddServiceSumResult
-	var _meta1 thrift.ResponseMeta
-	_meta1, _err = p.Client_().Call(ctx, "Sum", &_args0, &_result2)
-	p.SetLastResponseMeta_(_meta1)
+	var _args3 AddServiceSumArgs
+	_args3.A = a
+	_args3.B = b
+	var _result5 AddServiceSumResult
+	var _meta4 thrift.ResponseMeta
+	_meta4, _err = p.Client_().Call(ctx, "Sum", &_args3, &_result5)
+	p.SetLastResponseMeta_(_meta4)
 	if _err != nil {
 		return
 	}
-	return _result2.GetSuccess(), nil
+	switch {
+	case _result5.Err != nil:
+		return _r, _result5.Err
+	}
+
+	return _result5.GetSuccess(), nil
 }
 
 // Parameters:
 //  - A
 //  - B
 func (p *AddServiceClient) Concat(ctx context.Context, a string, b string) (_r *ConcatReply, _err error) {
-	var _args3 AddServiceConcatArgs
-	_args3.A = a
-	_args3.B = b
-	var _result5 AddServiceConcatResult
-	var _meta4 thrift.ResponseMeta
-	_meta4, _err = p.Client_().Call(ctx, "Concat", &_args3, &_result5)
-	p.SetLastResponseMeta_(_meta4)
+	var _args6 AddServiceConcatArgs
+	_args6.A = a
+	_args6.B = b
+	var _result8 AddServiceConcatResult
+	var _meta7 thrift.ResponseMeta
+	_meta7, _err = p.Client_().Call(ctx, "Concat", &_args6, &_result8)
+	p.SetLastResponseMeta_(_meta7)
 	if _err != nil {
 		return
 	}
-	return _result5.GetSuccess(), nil
+	switch {
+	case _result8.Err != nil:
+		return _r, _result8.Err
+	}
+
+	return _result8.GetSuccess(), nil
 }
 
 type AddServiceProcessor struct {
@@ -427,10 +726,10 @@ func (p *AddServiceProcessor) ProcessorMap() map[string]thrift.TProcessorFunctio
 
 func NewAddServiceProcessor(handler AddService) *AddServiceProcessor {
 
-	self6 := &AddServiceProcessor{handler: handler, processorMap: make(map[string]thrift.TProcessorFunction)}
-	self6.processorMap["Sum"] = &addServiceProcessorSum{handler: handler}
-	self6.processorMap["Concat"] = &addServiceProcessorConcat{handler: handler}
-	return self6
+	self9 := &AddServiceProcessor{handler: handler, processorMap: make(map[string]thrift.TProcessorFunction)}
+	self9.processorMap["Sum"] = &addServiceProcessorSum{handler: handler}
+	self9.processorMap["Concat"] = &addServiceProcessorConcat{handler: handler}
+	return self9
 }
 
 func (p *AddServiceProcessor) Process(ctx context.Context, iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
@@ -443,12 +742,12 @@ func (p *AddServiceProcessor) Process(ctx context.Context, iprot, oprot thrift.T
 	}
 	iprot.Skip(ctx, thrift.STRUCT)
 	iprot.ReadMessageEnd(ctx)
-	x7 := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "Unknown function "+name)
+	x10 := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "Unknown function "+name)
 	oprot.WriteMessageBegin(ctx, name, thrift.EXCEPTION, seqId)
-	x7.Write(ctx, oprot)
+	x10.Write(ctx, oprot)
 	oprot.WriteMessageEnd(ctx)
 	oprot.Flush(ctx)
-	return false, x7
+	return false, x10
 
 }
 
@@ -500,15 +799,20 @@ func (p *addServiceProcessorSum) Process(ctx context.Context, seqId int32, iprot
 	var retval *SumReply
 	if retval, err2 = p.handler.Sum(ctx, args.A, args.B); err2 != nil {
 		tickerCancel()
-		if err2 == thrift.ErrAbandonRequest {
-			return false, thrift.WrapTException(err2)
+		switch v := err2.(type) {
+		case *AddError:
+			result.Err = v
+		default:
+			if err2 == thrift.ErrAbandonRequest {
+				return false, thrift.WrapTException(err2)
+			}
+			x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing Sum: "+err2.Error())
+			oprot.WriteMessageBegin(ctx, "Sum", thrift.EXCEPTION, seqId)
+			x.Write(ctx, oprot)
+			oprot.WriteMessageEnd(ctx)
+			oprot.Flush(ctx)
+			return true, thrift.WrapTException(err2)
 		}
-		x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing Sum: "+err2.Error())
-		oprot.WriteMessageBegin(ctx, "Sum", thrift.EXCEPTION, seqId)
-		x.Write(ctx, oprot)
-		oprot.WriteMessageEnd(ctx)
-		oprot.Flush(ctx)
-		return true, thrift.WrapTException(err2)
 	} else {
 		result.Success = retval
 	}
@@ -579,15 +883,20 @@ func (p *addServiceProcessorConcat) Process(ctx context.Context, seqId int32, ip
 	var retval *ConcatReply
 	if retval, err2 = p.handler.Concat(ctx, args.A, args.B); err2 != nil {
 		tickerCancel()
-		if err2 == thrift.ErrAbandonRequest {
-			return false, thrift.WrapTException(err2)
+		switch v := err2.(type) {
+		case *AddError:
+			result.Err = v
+		default:
+			if err2 == thrift.ErrAbandonRequest {
+				return false, thrift.WrapTException(err2)
+			}
+			x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing Concat: "+err2.Error())
+			oprot.WriteMessageBegin(ctx, "Concat", thrift.EXCEPTION, seqId)
+			x.Write(ctx, oprot)
+			oprot.WriteMessageEnd(ctx)
+			oprot.Flush(ctx)
+			return true, thrift.WrapTException(err2)
 		}
-		x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing Concat: "+err2.Error())
-		oprot.WriteMessageBegin(ctx, "Concat", thrift.EXCEPTION, seqId)
-		x.Write(ctx, oprot)
-		oprot.WriteMessageEnd(ctx)
-		oprot.Flush(ctx)
-		return true, thrift.WrapTException(err2)
 	} else {
 		result.Success = retval
 	}
@@ -754,8 +1063,10 @@ func (p *AddServiceSumArgs) String() string {
 
 // Attributes:
 //  - Success
+//  - Err
 type AddServiceSumResult struct {
 	Success *SumReply `thrift:"success,0" db:"success" json:"success,omitempty"`
+	Err     *AddError `thrift:"err,1" db:"err" json:"err,omitempty"`
 }
 
 func NewAddServiceSumResult() *AddServiceSumResult {
@@ -770,10 +1081,23 @@ func (p *AddServiceSumResult) GetSuccess() *SumReply {
 	}
 	return p.Success
 }
+
+var AddServiceSumResult_Err_DEFAULT *AddError
+
+func (p *AddServiceSumResult) GetErr() *AddError {
+	if !p.IsSetErr() {
+		return AddServiceSumResult_Err_DEFAULT
+	}
+	return p.Err
+}
 func (p *AddServiceSumResult) IsSetSuccess() bool {
 	return p.Success != nil
 }
 
+func (p *AddServiceSumResult) IsSetErr() bool {
+	return p.Err != nil
+}
+
 func (p *AddServiceSumResult) Read(ctx context.Context, iprot thrift.TProtocol) error {
 	if _, err := iprot.ReadStructBegin(ctx); err != nil {
 		return thrift.PrependError(fmt.Sprintf("%T read error: ", p), err)
@@ -798,6 +1122,16 @@ func (p *AddServiceSumResult) Read(ctx context.Context, iprot thrift.TProtocol)
 					return err
 				}
 			}
+		case 1:
+			if fieldTypeId == thrift.STRUCT {
+				if err := p.ReadField1(ctx, iprot); err != nil {
+					return err
+				}
+			} else {
+				if err := iprot.Skip(ctx, fieldTypeId); err != nil {
+					return err
+				}
+			}
 		default:
 			if err := iprot.Skip(ctx, fieldTypeId); err != nil {
 				return err
@@ -821,6 +1155,14 @@ func (p *AddServiceSumResult) ReadField0(ctx context.Context, iprot thrift.TProt
 	return nil
 }
 
+func (p *AddServiceSumResult) ReadField1(ctx context.Context, iprot thrift.TProtocol) error {
+	p.Err = &AddError{}
+	if err := p.Err.Read(ctx, iprot); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T error reading struct: ", p.Err), err)
+	}
+	return nil
+}
+
 func (p *AddServiceSumResult) Write(ctx context.Context, oprot thrift.TProtocol) error {
 	if err := oprot.WriteStructBegin(ctx, "Sum_result"); err != nil {
 		return thrift.PrependError(fmt.Sprintf("%T write struct begin error: ", p), err)
@@ -829,6 +1171,9 @@ func (p *AddServiceSumResult) Write(ctx context.Context, oprot thrift.TProtocol)
 		if err := p.writeField0(ctx, oprot); err != nil {
 			return err
 		}
+		if err := p.writeField1(ctx, oprot); err != nil {
+			return err
+		}
 	}
 	if err := oprot.WriteFieldStop(ctx); err != nil {
 		return thrift.PrependError("write field stop error: ", err)
@@ -854,6 +1199,21 @@ func (p *AddServiceSumResult) writeField0(ctx context.Context, oprot thrift.TPro
 	return err
 }
 
+func (p *AddServiceSumResult) writeField1(ctx context.Context, oprot thrift.TProtocol) (err error) {
+	if p.IsSetErr() {
+		if err := oprot.WriteFieldBegin(ctx, "err", thrift.STRUCT, 1); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T write field begin error 1:err: ", p), err)
+		}
+		if err := p.Err.Write(ctx, oprot); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T error writing struct: ", p.Err), err)
+		}
+		if err := oprot.WriteFieldEnd(ctx); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T write field end error 1:err: ", p), err)
+		}
+	}
+	return err
+}
+
 func (p *AddServiceSumResult) String() string {
 	if p == nil {
 		return "<nil>"
@@ -1003,8 +1363,10 @@ func (p *AddServiceConcatArgs) String() string {
 
 // Attributes:
 //  - Success
+//  - Err
 type AddServiceConcatResult struct {
 	Success *ConcatReply `thrift:"success,0" db:"success" json:"success,omitempty"`
+	Err     *AddError    `thrift:"err,1" db:"err" json:"err,omitempty"`
 }
 
 func NewAddServiceConcatResult() *AddServiceConcatResult {
@@ -1019,10 +1381,23 @@ func (p *AddServiceConcatResult) GetSuccess() *ConcatReply {
 	}
 	return p.Success
 }
+
+var AddServiceConcatResult_Err_DEFAULT *AddError
+
+func (p *AddServiceConcatResult) GetErr() *AddError {
+	if !p.IsSetErr() {
+		return AddServiceConcatResult_Err_DEFAULT
+	}
+	return p.Err
+}
 func (p *AddServiceConcatResult) IsSetSuccess() bool {
 	return p.Success != nil
 }
 
+func (p *AddServiceConcatResult) IsSetErr() bool {
+	return p.Err != nil
+}
+
 func (p *AddServiceConcatResult) Read(ctx context.Context, iprot thrift.TProtocol) error {
 	if _, err := iprot.ReadStructBegin(ctx); err != nil {
 		return thrift.PrependError(fmt.Sprintf("%T read error: ", p), err)
@@ -1047,6 +1422,16 @@ func (p *AddServiceConcatResult) Read(ctx context.Context, iprot thrift.TProtoco
 					return err
 				}
 			}
+		case 1:
+			if fieldTypeId == thrift.STRUCT {
+				if err := p.ReadField1(ctx, iprot); err != nil {
+					return err
+				}
+			} else {
+				if err := iprot.Skip(ctx, fieldTypeId); err != nil {
+					return err
+				}
+			}
 		default:
 			if err := iprot.Skip(ctx, fieldTypeId); err != nil {
 				return err
@@ -1070,6 +1455,14 @@ func (p *AddServiceConcatResult) ReadField0(ctx context.Context, iprot thrift.TP
 	return nil
 }
 
+func (p *AddServiceConcatResult) ReadField1(ctx context.Context, iprot thrift.TProtocol) error {
+	p.Err = &AddError{}
+	if err := p.Err.Read(ctx, iprot); err != nil {
+		return thrift.PrependError(fmt.Sprintf("%T error reading struct: ", p.Err), err)
+	}
+	return nil
+}
+
 func (p *AddServiceConcatResult) Write(ctx context.Context, oprot thrift.TProtocol) error {
 	if err := oprot.WriteStructBegin(ctx, "Concat_result"); err != nil {
 		return thrift.PrependError(fmt.Sprintf("%T write struct begin error: ", p), err)
@@ -1078,6 +1471,9 @@ func (p *AddServiceConcatResult) Write(ctx context.Context, oprot thrift.TProtoc
 		if err := p.writeField0(ctx, oprot); err != nil {
 			return err
 		}
+		if err := p.writeField1(ctx, oprot); err != nil {
+			return err
+		}
 	}
 	if err := oprot.WriteFieldStop(ctx); err != nil {
 		return thrift.PrependError("write field stop error: ", err)
@@ -1103,6 +1499,21 @@ func (p *AddServiceConcatResult) writeField0(ctx context.Context, oprot thrift.T
 	return err
 }
 
+func (p *AddServiceConcatResult) writeField1(ctx context.Context, oprot thrift.TProtocol) (err error) {
+	if p.IsSetErr() {
+		if err := oprot.WriteFieldBegin(ctx, "err", thrift.STRUCT, 1); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T write field begin error 1:err: ", p), err)
+		}
+		if err := p.Err.Write(ctx, oprot); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T error writing struct: ", p.Err), err)
+		}
+		if err := oprot.WriteFieldEnd(ctx); err != nil {
+			return thrift.PrependError(fmt.Sprintf("%T write field end error 1:err: ", p), err)
+		}
+	}
+	return err
+}
+
 func (p *AddServiceConcatResult) String() string {
 	if p == nil {
 		return "<nil>"
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// WatchInterval is how often the gRPC health service runs the checks to find
+// out whether the serving status changed for its Watch calls.
+var WatchInterval = time.Second
+
+type grpcServer struct {
+	healthpb.UnimplementedHealthServer
+	checker  *Checker
+	services map[string]bool
+}
+
+// NewGRPCServer returns an implementation of the standard grpc.health.v1
+// Health service backed by the Checker. The whole server is reported under
+// the empty service name, and the passed service names, like "pb.Add", report
+// the same status. Other service names are unknown.
+func NewGRPCServer(c *Checker, services ...string) healthpb.HealthServer {
+	s := &grpcServer{
+		checker:  c,
+		services: map[string]bool{"": true},
+	}
+	for _, service := range services {
+		s.services[service] = true
+	}
+	return s
+}
+
+func (s *grpcServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if !s.services[req.Service] {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	return &healthpb.HealthCheckResponse{Status: s.servingStatus(ctx)}, nil
+}
+
+func (s *grpcServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if !s.services[req.Service] {
+		// The protocol asks for SERVICE_UNKNOWN to be sent without ending
+		// the call, in case the service becomes known later. Ours don't.
+		if err := stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVICE_UNKNOWN}); err != nil {
+			return err
+		}
+		<-stream.Context().Done()
+		return status.FromContextError(stream.Context().Err()).Err()
+	}
+
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		if current := s.servingStatus(stream.Context()); current != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			last = current
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+func (s *grpcServer) servingStatus(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if !s.checker.Run(ctx).Healthy() {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
@@ -0,0 +1,105 @@
+// Package health provides pluggable liveness and readiness checks, and serves
+// them over HTTP and as the standard gRPC health service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Check reports the health of a single dependency, like a database or a
+// circuit breaker, by returning nil when it's healthy.
+type Check func(ctx context.Context) error
+
+// Checker runs a set of named checks. Checks may be registered at any time,
+// so components can add their own after the Checker is serving.
+type Checker struct {
+	mtx    sync.RWMutex
+	checks map[string]Check
+}
+
+// NewChecker returns a Checker with no checks, which is always healthy.
+func NewChecker() *Checker {
+	return &Checker{
+		checks: map[string]Check{},
+	}
+}
+
+// Register adds the check under the passed name, replacing any check that
+// was already registered under it.
+func (c *Checker) Register(name string, check Check) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.checks[name] = check
+}
+
+// Report is the outcome of running every check of a Checker, keyed by name.
+// Healthy checks have a nil error.
+type Report map[string]error
+
+// Healthy reports whether every check passed.
+func (r Report) Healthy() bool {
+	for _, err := range r {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON implements json.Marshaler, reporting each check as "ok" or as
+// its error message.
+func (r Report) MarshalJSON() ([]byte, error) {
+	m := make(map[string]string, len(r))
+	for name, err := range r {
+		m[name] = "ok"
+		if err != nil {
+			m[name] = err.Error()
+		}
+	}
+	return json.Marshal(m)
+}
+
+// Run runs every check in name order, and returns the report.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mtx.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mtx.RUnlock()
+
+	sort.Strings(names)
+	report := make(Report, len(names))
+	for _, name := range names {
+		report[name] = checks[name](ctx)
+	}
+	return report
+}
+
+// Handler returns an http.Handler that runs the checks on every request. It
+// responds with 200 when they all pass and 503 otherwise, and with the report
+// as a JSON body in both cases. Mount it under /healthz for liveness checks,
+// or /readyz for readiness checks.
+func Handler(c *Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		status, code := "ok", http.StatusOK
+		if !report.Healthy() {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(struct {
+			Status string `json:"status"`
+			Checks Report `json:"checks"`
+		}{status, report})
+	})
+}
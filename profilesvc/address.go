@@ -0,0 +1,130 @@
+package profilesvc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError is returned for profiles and addresses with invalid fields.
+type ValidationError struct {
+	// Fields maps the JSON path of each invalid field, e.g. "city" for an
+	// address, or "addresses[1].city" for a profile, to what's wrong with it.
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, problem := range e.Fields {
+		fields = append(fields, field+": "+problem)
+	}
+	sort.Strings(fields)
+	return "invalid fields: " + strings.Join(fields, "; ")
+}
+
+// The maximum lengths, in characters, of the fields of an address.
+const (
+	maxLocationLength   = 200
+	maxStreetLength     = 100
+	maxCityLength       = 100
+	maxPostalCodeLength = 10
+)
+
+// normalizeAddress validates the fields of a, and returns it in the form the
+// service stores it: with an ID generated if it has none, an upper case
+// country code, and a Location made up of the structured fields if it has
+// none, for clients that only know about Location. The problems with invalid
+// fields are added to problems, under their name prefixed with prefix.
+func normalizeAddress(a Address, prefix string, problems map[string]string) Address {
+	if a.ID == "" {
+		a.ID = newAddressID()
+	}
+	checkLength := func(field, value string, max int) {
+		if utf8.RuneCountInString(value) > max {
+			problems[prefix+field] = fmt.Sprintf("longer than %d characters", max)
+		}
+	}
+	checkLength("location", a.Location, maxLocationLength)
+	checkLength("street", a.Street, maxStreetLength)
+	checkLength("city", a.City, maxCityLength)
+	checkLength("postal_code", a.PostalCode, maxPostalCodeLength)
+
+	if a.Street == "" && a.City == "" && a.PostalCode == "" && a.Country == "" {
+		return a // a free text Location, if any
+	}
+	if a.City == "" {
+		problems[prefix+"city"] = "required"
+	}
+	a.Country = strings.ToUpper(a.Country)
+	if a.Country == "" {
+		problems[prefix+"country"] = "required"
+	} else if len(a.Country) != 2 || !strings.Contains(countryCodes, " "+a.Country+" ") {
+		problems[prefix+"country"] = "not an ISO 3166-1 alpha-2 code"
+	}
+	if strings.Trim(a.PostalCode, "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz -") != "" {
+		problems[prefix+"postal_code"] = "may only contain letters, digits, spaces and hyphens"
+	}
+	if a.Location == "" {
+		var parts []string
+		if a.Street != "" {
+			parts = append(parts, a.Street)
+		}
+		parts = append(parts, strings.TrimSpace(a.PostalCode+" "+a.City), a.Country)
+		a.Location = strings.Join(parts, ", ")
+	}
+	return a
+}
+
+// newAddressID returns a random ID for an address that was added without one.
+func newAddressID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand doesn't fail on the platforms we support
+	}
+	return hex.EncodeToString(b)
+}
+
+// validateAddress returns the normalized form of a, or a *ValidationError.
+func validateAddress(a Address) (Address, error) {
+	problems := map[string]string{}
+	a = normalizeAddress(a, "", problems)
+	if len(problems) > 0 {
+		return Address{}, &ValidationError{Fields: problems}
+	}
+	return a, nil
+}
+
+// validateProfile returns p with its addresses normalized, or a
+// *ValidationError.
+func validateProfile(p Profile) (Profile, error) {
+	if len(p.Addresses) == 0 {
+		return p, nil
+	}
+	problems := map[string]string{}
+	addresses := make([]Address, len(p.Addresses))
+	for i, a := range p.Addresses {
+		addresses[i] = normalizeAddress(a, fmt.Sprintf("addresses[%d].", i), problems)
+	}
+	if len(problems) > 0 {
+		return Profile{}, &ValidationError{Fields: problems}
+	}
+	p.Addresses = addresses
+	return p, nil
+}
+
+// countryCodes are the officially assigned ISO 3166-1 alpha-2 codes.
+const countryCodes = " " +
+	"AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI " +
+	"BJ BL BM BN BO BQ BR BS BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN " +
+	"CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK " +
+	"FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM " +
+	"HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN " +
+	"KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK " +
+	"ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP " +
+	"NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW " +
+	"SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF " +
+	"TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI " +
+	"VN VU WF WS YE YT ZA ZM ZW "
@@ -0,0 +1,107 @@
+package profilesvc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		address  Address
+		want     Address
+		problems map[string]string
+	}{
+		{
+			name:    "free text",
+			address: Address{ID: "home", Location: "Berlin"},
+			want:    Address{ID: "home", Location: "Berlin"},
+		},
+		{
+			name:    "no location",
+			address: Address{ID: "home"},
+			want:    Address{ID: "home"},
+		},
+		{
+			name:    "structured",
+			address: Address{ID: "home", Street: "Unter den Linden 1", City: "Berlin", PostalCode: "10117", Country: "de"},
+			want:    Address{ID: "home", Location: "Unter den Linden 1, 10117 Berlin, DE", Street: "Unter den Linden 1", City: "Berlin", PostalCode: "10117", Country: "DE"},
+		},
+		{
+			name:    "structured without street and postal code",
+			address: Address{ID: "home", City: "London", Country: "GB"},
+			want:    Address{ID: "home", Location: "London, GB", City: "London", Country: "GB"},
+		},
+		{
+			name:    "structured with location",
+			address: Address{ID: "home", Location: "Home", City: "London", PostalCode: "SW1A 1AA", Country: "GB"},
+			want:    Address{ID: "home", Location: "Home", City: "London", PostalCode: "SW1A 1AA", Country: "GB"},
+		},
+		{
+			name:     "no city and country",
+			address:  Address{ID: "home", Street: "Unter den Linden 1"},
+			problems: map[string]string{"city": "required", "country": "required"},
+		},
+		{
+			name:     "unknown country",
+			address:  Address{ID: "home", City: "Atlantis", Country: "XA"},
+			problems: map[string]string{"country": "not an ISO 3166-1 alpha-2 code"},
+		},
+		{
+			name:     "country name",
+			address:  Address{ID: "home", City: "Berlin", Country: "Germany"},
+			problems: map[string]string{"country": "not an ISO 3166-1 alpha-2 code"},
+		},
+		{
+			name:     "postal code characters",
+			address:  Address{ID: "home", City: "Berlin", PostalCode: "10117!", Country: "DE"},
+			problems: map[string]string{"postal_code": "may only contain letters, digits, spaces and hyphens"},
+		},
+		{
+			name:    "too long",
+			address: Address{ID: "home", Location: strings.Repeat("x", 201), City: strings.Repeat("ü", 101), PostalCode: "12345678901", Country: "DE"},
+			problems: map[string]string{
+				"location":    "longer than 200 characters",
+				"city":        "longer than 100 characters",
+				"postal_code": "longer than 10 characters",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			have, err := validateAddress(tc.address)
+			if tc.problems == nil {
+				if err != nil || have != tc.want {
+					t.Errorf("want %+v, have %+v (%v)", tc.want, have, err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !reflect.DeepEqual(tc.problems, verr.Fields) {
+				t.Errorf("want problems %v, have %v", tc.problems, err)
+			}
+		})
+	}
+}
+
+func TestValidateAddressGeneratesID(t *testing.T) {
+	a, err := validateAddress(Address{Location: "Berlin"})
+	if err != nil || a.ID == "" {
+		t.Fatalf("want an ID generated, have %+v (%v)", a, err)
+	}
+	if b, _ := validateAddress(Address{Location: "Berlin"}); b.ID == a.ID {
+		t.Errorf("want another ID than %q, have the same", a.ID)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	_, err := validateProfile(Profile{ID: "1", Addresses: []Address{
+		{ID: "home", Location: "Berlin"},
+		{ID: "work", City: "Hamburg"},
+	}})
+	want := "invalid fields: addresses[1].country: required"
+	if err == nil || err.Error() != want {
+		t.Errorf("want %q, have %v", want, err)
+	}
+}
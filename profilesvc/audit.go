@@ -0,0 +1,341 @@
+package profilesvc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// AuditRecord is an entry of the audit trail: who changed which profile,
+// when, how, and what the profile looked like before and after.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Tenant    string    `json:"tenant"`
+	Actor     string    `json:"actor,omitempty"`
+	Method    string    `json:"method"`
+	ProfileID string    `json:"profile_id"`
+	Before    *Profile  `json:"before,omitempty"` // nil if the change created the profile
+	After     *Profile  `json:"after,omitempty"`  // nil if the change deleted the profile
+
+	// Seq numbers the records of a profile, from 1 for its oldest, across
+	// deletes and recreates, which restart its version. History sets it,
+	// and RestoreProfile takes it; stores don't keep it.
+	Seq int `json:"seq,omitempty"`
+}
+
+// AuditStore keeps the audit trail. Records are only ever appended.
+type AuditStore interface {
+	Append(ctx context.Context, r AuditRecord) error
+
+	// Records returns the records of the profile of tenant with profileID,
+	// oldest first.
+	Records(ctx context.Context, tenant, profileID string) ([]AuditRecord, error)
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx in which changes are attributed to actor in
+// the audit trail. Server transports put the actor of a request there.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor carried by ctx, or "" if it's unknown.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
+
+type auditMethodContextKey struct{}
+
+// AuditMiddleware returns a service middleware that appends a record to store
+// for every successful call that changes a profile. The snapshots are taken
+// with GetProfile around the call, which the middleware serializes with the
+// other changes made through it, so that they're accurate as long as all
+// changes go through the same middleware. Store errors are logged, but don't
+// fail the call, which already happened.
+func AuditMiddleware(store AuditStore, logger log.Logger) Middleware {
+	return func(next Service) Service {
+		return &auditMiddleware{
+			Service: next,
+			store:   store,
+			logger:  logger,
+		}
+	}
+}
+
+type auditMiddleware struct {
+	// The calls that change nothing go straight to the embedded Service.
+	Service
+	store  AuditStore
+	logger log.Logger
+
+	mtx sync.Mutex // serializes changes, for accurate snapshots
+}
+
+// audit calls change, which changes the profile with id, and records it.
+func (mw *auditMiddleware) audit(ctx context.Context, method, id string, change func() error) error {
+	mw.mtx.Lock()
+	defer mw.mtx.Unlock()
+	before := mw.snapshot(ctx, id)
+	if err := change(); err != nil {
+		return err
+	}
+	if m, ok := ctx.Value(auditMethodContextKey{}).(string); ok {
+		method = m
+	}
+	r := AuditRecord{
+		Time:      time.Now().UTC(),
+		Tenant:    TenantFromContext(ctx),
+		Actor:     ActorFromContext(ctx),
+		Method:    method,
+		ProfileID: id,
+		Before:    before,
+		After:     mw.snapshot(ctx, id),
+	}
+	if err := mw.store.Append(ctx, r); err != nil {
+		mw.logger.Log("method", method, "id", id, "err", err)
+	}
+	return nil
+}
+
+func (mw *auditMiddleware) snapshot(ctx context.Context, id string) *Profile {
+	p, err := mw.Service.GetProfile(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return &p
+}
+
+func (mw *auditMiddleware) PostProfile(ctx context.Context, p Profile) error {
+	return mw.audit(ctx, "PostProfile", p.ID, func() error {
+		return mw.Service.PostProfile(ctx, p)
+	})
+}
+
+func (mw *auditMiddleware) PutProfile(ctx context.Context, id string, p Profile) error {
+	return mw.audit(ctx, "PutProfile", id, func() error {
+		return mw.Service.PutProfile(ctx, id, p)
+	})
+}
+
+func (mw *auditMiddleware) PatchProfile(ctx context.Context, id string, patch Patch, version int) error {
+	return mw.audit(ctx, "PatchProfile", id, func() error {
+		return mw.Service.PatchProfile(ctx, id, patch, version)
+	})
+}
+
+func (mw *auditMiddleware) DeleteProfile(ctx context.Context, id string, version int) error {
+	return mw.audit(ctx, "DeleteProfile", id, func() error {
+		return mw.Service.DeleteProfile(ctx, id, version)
+	})
+}
+
+func (mw *auditMiddleware) PostAddress(ctx context.Context, profileID string, a Address) error {
+	return mw.audit(ctx, "PostAddress", profileID, func() error {
+		return mw.Service.PostAddress(ctx, profileID, a)
+	})
+}
+
+func (mw *auditMiddleware) UpdateAddress(ctx context.Context, profileID string, addressID string, a Address) error {
+	return mw.audit(ctx, "UpdateAddress", profileID, func() error {
+		return mw.Service.UpdateAddress(ctx, profileID, addressID, a)
+	})
+}
+
+func (mw *auditMiddleware) DeleteAddress(ctx context.Context, profileID string, addressID string) error {
+	return mw.audit(ctx, "DeleteAddress", profileID, func() error {
+		return mw.Service.DeleteAddress(ctx, profileID, addressID)
+	})
+}
+
+// History gives access to the audit trail of profiles, and restores profiles
+// to the versions in it.
+type History interface {
+	// ProfileHistory returns the audit trail of the profile with id, oldest
+	// first. It's ErrNotFound if there's none.
+	ProfileHistory(ctx context.Context, id string) ([]AuditRecord, error)
+
+	// RestoreProfile puts the profile with id back into the state it had
+	// after the change recorded by the audit record with seq, also if it was
+	// deleted since. The restored profile gets a new version, like any other
+	// change. It's ErrNotFound if the audit trail has no such record, or if
+	// the record is of the profile being deleted.
+	RestoreProfile(ctx context.Context, id string, seq int) error
+}
+
+// NewHistory returns the History of the audit trail in store, which restores
+// profiles through s. For restores to be audited, s should be wrapped with
+// AuditMiddleware for the same store.
+func NewHistory(store AuditStore, s Service) History {
+	return &history{store: store, s: s}
+}
+
+type history struct {
+	store AuditStore
+	s     Service
+}
+
+func (h *history) ProfileHistory(ctx context.Context, id string) ([]AuditRecord, error) {
+	records, err := h.records(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return records, nil
+}
+
+// records returns the audit trail of the profile with id, numbered.
+func (h *history) records(ctx context.Context, id string) ([]AuditRecord, error) {
+	records, err := h.store.Records(ctx, TenantFromContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		records[i].Seq = i + 1
+	}
+	return records, nil
+}
+
+func (h *history) RestoreProfile(ctx context.Context, id string, seq int) error {
+	records, err := h.records(ctx, id)
+	if err != nil {
+		return err
+	}
+	if seq < 1 || seq > len(records) || records[seq-1].After == nil {
+		return ErrNotFound
+	}
+	p := *records[seq-1].After
+
+	// Replace the current version, or recreate the profile if there's none,
+	// failing if it changes, or is recreated, meanwhile.
+	ctx = context.WithValue(ctx, auditMethodContextKey{}, "RestoreProfile")
+	current, err := h.s.GetProfile(ctx, id)
+	switch {
+	case err == ErrNotFound:
+		p.Version = 0
+		return h.s.PostProfile(ctx, p)
+	case err != nil:
+		return err
+	default:
+		p.Version = current.Version
+		return h.s.PutProfile(ctx, id, p)
+	}
+}
+
+// InmemAuditStore is an AuditStore that keeps the audit trail in memory,
+// where it's lost when the process stops.
+type InmemAuditStore struct {
+	mtx     sync.RWMutex
+	records []AuditRecord
+}
+
+// NewInmemAuditStore returns an empty InmemAuditStore.
+func NewInmemAuditStore() *InmemAuditStore {
+	return &InmemAuditStore{}
+}
+
+// Append implements AuditStore.
+func (s *InmemAuditStore) Append(ctx context.Context, r AuditRecord) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.records = append(s.records, r)
+	return nil
+}
+
+// Records implements AuditStore.
+func (s *InmemAuditStore) Records(ctx context.Context, tenant, profileID string) ([]AuditRecord, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var records []AuditRecord
+	for _, r := range s.records {
+		if r.Tenant == tenant && r.ProfileID == profileID {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// JSONLinesAuditStore is an AuditStore that appends the audit trail to a
+// file, one JSON record per line, which other tools can read too. Records
+// reads the whole file, so it gets slower as the file grows.
+type JSONLinesAuditStore struct {
+	path string
+
+	mtx sync.Mutex
+	f   *os.File
+}
+
+// NewJSONLinesAuditStore opens the file at path for appending, creating it
+// if it doesn't exist.
+func NewJSONLinesAuditStore(path string) (*JSONLinesAuditStore, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditStore{path: path, f: f}, nil
+}
+
+// Append implements AuditStore. The record is on disk when it returns.
+func (s *JSONLinesAuditStore) Append(ctx context.Context, r AuditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Records implements AuditStore.
+func (s *JSONLinesAuditStore) Records(ctx context.Context, tenant, profileID string) ([]AuditRecord, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		records []AuditRecord
+		rd      = bufio.NewReader(f)
+	)
+	for n := 1; ; n++ {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			// A record without a newline is one that's still being written.
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var r AuditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", s.path, n, err)
+		}
+		if r.Tenant == tenant && r.ProfileID == profileID {
+			records = append(records, r)
+		}
+	}
+}
+
+// Close closes the file.
+func (s *JSONLinesAuditStore) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,256 @@
+package profilesvc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	store := NewInmemAuditStore()
+	s := AuditMiddleware(store, log.NewNopLogger())(NewInmemService())
+	ctx := WithActor(WithTenant(context.Background(), "acme"), "alice")
+
+	for _, do := range []func() error{
+		func() error { return s.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit"}) },
+		func() error { return s.PostProfile(ctx, Profile{ID: "1"}) }, // fails, isn't recorded
+		func() error { return s.PostAddress(ctx, "1", Address{ID: "home", Location: "Berlin"}) },
+		func() error { return s.PatchProfile(ctx, "1", mergePatch(`{"name":"Gopher"}`), 0) },
+		func() error { return s.DeleteProfile(ctx, "1", 0) },
+		func() error { return s.PostProfile(context.Background(), Profile{ID: "1"}) }, // other tenant
+	} {
+		do()
+	}
+
+	records, err := store.Records(ctx, "acme", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := []Address{{ID: "home", Location: "Berlin"}}
+	want := []AuditRecord{
+		{Method: "PostProfile", After: &Profile{ID: "1", Name: "Go Kit", Version: 1}},
+		{Method: "PostAddress", Before: &Profile{ID: "1", Name: "Go Kit", Version: 1}, After: &Profile{ID: "1", Name: "Go Kit", Addresses: home, Version: 2}},
+		{Method: "PatchProfile", Before: &Profile{ID: "1", Name: "Go Kit", Addresses: home, Version: 2}, After: &Profile{ID: "1", Name: "Gopher", Addresses: home, Version: 3}},
+		{Method: "DeleteProfile", Before: &Profile{ID: "1", Name: "Gopher", Addresses: home, Version: 3}},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("want %d records, have %d: %+v", len(want), len(records), records)
+	}
+	for i, r := range records {
+		if r.Time.IsZero() || r.Tenant != "acme" || r.Actor != "alice" || r.ProfileID != "1" {
+			t.Errorf("record %d: want the time, tenant, actor and profile of the call, have %+v", i, r)
+		}
+		if r.Method != want[i].Method || !reflect.DeepEqual(r.Before, want[i].Before) || !reflect.DeepEqual(r.After, want[i].After) {
+			t.Errorf("record %d: want %s from %+v to %+v, have %s from %+v to %+v", i, want[i].Method, want[i].Before, want[i].After, r.Method, r.Before, r.After)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	store := NewInmemAuditStore()
+	s := AuditMiddleware(store, log.NewNopLogger())(NewInmemService())
+	h := NewHistory(store, s)
+	ctx := context.Background()
+
+	if _, err := h.ProfileHistory(ctx, "1"); err != ErrNotFound {
+		t.Errorf("ProfileHistory(unknown): want %v, have %v", ErrNotFound, err)
+	}
+	s.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit"})
+	s.PutProfile(ctx, "1", Profile{ID: "1", Name: "Gopher"})
+
+	// Restoring replaces the current version.
+	if err := h.RestoreProfile(ctx, "1", 1); err != nil {
+		t.Fatalf("RestoreProfile: %v", err)
+	}
+	want := Profile{ID: "1", Name: "Go Kit", Version: 3}
+	if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile after RestoreProfile: want %+v, have %+v (%v)", want, have, err)
+	}
+
+	// Restoring brings deleted profiles back.
+	s.DeleteProfile(ctx, "1", 0)
+	if err := h.RestoreProfile(ctx, "1", 2); err != nil {
+		t.Fatalf("RestoreProfile(deleted): %v", err)
+	}
+	want = Profile{ID: "1", Name: "Gopher", Version: 1}
+	if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile after RestoreProfile(deleted): want %+v, have %+v (%v)", want, have, err)
+	}
+
+	// Versions restart when a profile is recreated, records don't.
+	s.DeleteProfile(ctx, "1", 0)
+	s.PostProfile(ctx, Profile{ID: "1", Name: "Acme"})
+	if err := h.RestoreProfile(ctx, "1", 1); err != nil {
+		t.Fatalf("RestoreProfile(recreated): %v", err)
+	}
+	want = Profile{ID: "1", Name: "Go Kit", Version: 2}
+	if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile after RestoreProfile(recreated): want %+v, have %+v (%v)", want, have, err)
+	}
+
+	if err := h.RestoreProfile(ctx, "1", 4); err != ErrNotFound {
+		t.Errorf("RestoreProfile(deletion): want %v, have %v", ErrNotFound, err)
+	}
+	if err := h.RestoreProfile(ctx, "1", 20); err != ErrNotFound {
+		t.Errorf("RestoreProfile(unknown record): want %v, have %v", ErrNotFound, err)
+	}
+	if err := h.RestoreProfile(WithTenant(ctx, "acme"), "1", 1); err != ErrNotFound {
+		t.Errorf("RestoreProfile(other tenant): want %v, have %v", ErrNotFound, err)
+	}
+
+	records, err := h.ProfileHistory(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var methods []string
+	for i, r := range records {
+		methods = append(methods, r.Method)
+		if r.Seq != i+1 {
+			t.Errorf("record %d: want seq %d, have %d", i, i+1, r.Seq)
+		}
+	}
+	if want := []string{"PostProfile", "PutProfile", "RestoreProfile", "DeleteProfile", "RestoreProfile", "DeleteProfile", "PostProfile", "RestoreProfile"}; !reflect.DeepEqual(want, methods) {
+		t.Errorf("ProfileHistory: want %v, have %v", want, methods)
+	}
+}
+
+// recreatingService recreates the profile it's asked for when it's missing,
+// as if by a concurrent request, but still says it's missing.
+type recreatingService struct {
+	Service
+}
+
+func (s recreatingService) GetProfile(ctx context.Context, id string) (Profile, error) {
+	p, err := s.Service.GetProfile(ctx, id)
+	if err == ErrNotFound {
+		s.Service.PostProfile(ctx, Profile{ID: id, Name: "Acme"})
+	}
+	return p, err
+}
+
+func TestHistoryRestoreRacingCreate(t *testing.T) {
+	store := NewInmemAuditStore()
+	s := AuditMiddleware(store, log.NewNopLogger())(NewInmemService())
+	h := NewHistory(store, recreatingService{s})
+	ctx := context.Background()
+
+	s.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit"})
+	s.DeleteProfile(ctx, "1", 0)
+	if err := h.RestoreProfile(ctx, "1", 1); err != ErrAlreadyExists {
+		t.Errorf("RestoreProfile: want %v, have %v", ErrAlreadyExists, err)
+	}
+	want := Profile{ID: "1", Name: "Acme", Version: 1}
+	if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile: want %+v, have %+v (%v)", want, have, err)
+	}
+}
+
+func TestJSONLinesAuditStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	ctx := context.Background()
+	store, err := NewJSONLinesAuditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := AuditRecord{Tenant: "acme", Method: "PostProfile", ProfileID: "1", After: &Profile{ID: "1", Version: 1}}
+	for _, r := range []AuditRecord{
+		first,
+		{Tenant: "acme", Method: "PostProfile", ProfileID: "2", After: &Profile{ID: "2", Version: 1}},
+		{Tenant: "initech", Method: "PostProfile", ProfileID: "1", After: &Profile{ID: "1", Version: 1}},
+	} {
+		if err := store.Append(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records survive reopening the file, and are appended to.
+	store, err = NewJSONLinesAuditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	second := AuditRecord{Tenant: "acme", Method: "DeleteProfile", ProfileID: "1", Before: &Profile{ID: "1", Version: 1}}
+	if err := store.Append(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.Records(ctx, "acme", "1")
+	if want := []AuditRecord{first, second}; err != nil || !reflect.DeepEqual(want, records) {
+		t.Errorf("Records: want %+v, have %+v (%v)", want, records, err)
+	}
+}
+
+func TestHTTPHistory(t *testing.T) {
+	store := NewInmemAuditStore()
+	s := AuditMiddleware(store, log.NewNopLogger())(NewInmemService())
+	srv := httptest.NewServer(MakeHTTPHandler(s, nil, log.NewNopLogger(), WithHistory(NewHistory(store, s))))
+	defer srv.Close()
+	client, err := MakeClientEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client sends the actor of its context as ActorHeader.
+	ctx := WithActor(context.Background(), "alice")
+	if err := client.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteProfile(ctx, "1", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, body string) (int, []byte) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, data
+	}
+
+	if code, _ := do("POST", "/profiles/1/restore", `{"seq":1}`); code != http.StatusOK {
+		t.Errorf("POST /profiles/1/restore: want %d, have %d", http.StatusOK, code)
+	}
+	if p, err := client.GetProfile(ctx, "1"); err != nil || p.Name != "Go Kit" {
+		t.Errorf("GetProfile after restore: want Go Kit, have %+v (%v)", p, err)
+	}
+	if code, _ := do("POST", "/profiles/1/restore", `{"seq":9}`); code != http.StatusNotFound {
+		t.Errorf("POST /profiles/1/restore of an unknown record: want %d, have %d", http.StatusNotFound, code)
+	}
+
+	code, body := do("GET", "/profiles/1/history", "")
+	if code != http.StatusOK {
+		t.Fatalf("GET /profiles/1/history: want %d, have %d", http.StatusOK, code)
+	}
+	var resp struct {
+		History []AuditRecord `json:"history"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for _, r := range resp.History {
+		have = append(have, r.Method+" by "+r.Actor)
+	}
+	if want := []string{"PostProfile by alice", "DeleteProfile by alice", "RestoreProfile by "}; !reflect.DeepEqual(want, have) {
+		t.Errorf("GET /profiles/1/history: want %q, have %q", want, have)
+	}
+	if code, _ := do("GET", "/profiles/2/history", ""); code != http.StatusNotFound {
+		t.Errorf("GET /profiles/2/history: want %d, have %d", http.StatusNotFound, code)
+	}
+}
@@ -0,0 +1,390 @@
+package profilesvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket     = []byte("meta")
+	profilesBucket = []byte("profiles")
+	tenantsBucket  = []byte("tenants")
+	versionKey     = []byte("schema_version")
+)
+
+// migrations bring the schema of a BoltDB file from one version to the next:
+// migrations[0] creates version 1 from an empty file, and so on. Migrations
+// are only ever appended, never changed, since files out there already went
+// through them.
+var migrations = []func(tx *bolt.Tx) error{
+	// Version 1 stores each profile, addresses included, as JSON under its ID.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(profilesBucket)
+		return err
+	},
+	// Version 2 scopes profiles to tenants: the tenants bucket has a bucket of
+	// profiles, as in version 1, per tenant. Existing profiles go to the
+	// DefaultTenant.
+	func(tx *bolt.Tx) error {
+		tenants, err := tx.CreateBucketIfNotExists(tenantsBucket)
+		if err != nil {
+			return err
+		}
+		b, err := tenants.CreateBucketIfNotExists([]byte(DefaultTenant))
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(profilesBucket).ForEach(b.Put); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(profilesBucket)
+	},
+}
+
+// BoltService is a Service that persists profiles in a BoltDB file, so they
+// survive restarts. Every method runs in a single transaction.
+type BoltService struct {
+	db      *bolt.DB
+	options serviceOptions
+}
+
+// NewBoltService opens the BoltDB file at path, creating it if it doesn't
+// exist, and migrates it to the current schema. The file is locked until the
+// service is closed.
+func NewBoltService(path string, options ...ServiceOption) (*BoltService, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(migrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltService{db: db, options: newServiceOptions(options)}, nil
+}
+
+// migrate runs the migrations that the file hasn't been through yet.
+func migrate(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	var version int
+	if v := meta.Get(versionKey); v != nil {
+		if version, err = strconv.Atoi(string(v)); err != nil {
+			return fmt.Errorf("invalid schema version %q: %w", v, err)
+		}
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this binary's %d", version, len(migrations))
+	}
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](tx); err != nil {
+			return fmt.Errorf("migrating to schema version %d: %w", version+1, err)
+		}
+	}
+	return meta.Put(versionKey, []byte(strconv.Itoa(version)))
+}
+
+// Close closes the underlying BoltDB file.
+func (s *BoltService) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltService) PostProfile(ctx context.Context, p Profile) error {
+	p, err := validateProfile(p)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(p.ID)) != nil {
+			return ErrAlreadyExists // POST = create, don't overwrite
+		}
+		if err := s.checkQuota(ctx, b, usage{}, usageOf(p)); err != nil {
+			return err
+		}
+		p.Version = 1
+		return putProfile(b, p)
+	})
+}
+
+func (s *BoltService) GetProfile(ctx context.Context, id string) (Profile, error) {
+	var p Profile
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		p, err = getProfile(b, id)
+		return err
+	})
+	return p, err
+}
+
+func (s *BoltService) PutProfile(ctx context.Context, id string, p Profile) error {
+	if id != p.ID {
+		return ErrInconsistentIDs
+	}
+	p, err := validateProfile(p)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		existing, err := getProfile(b, id)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err := checkVersion(existing.Version, p.Version); err != nil {
+			return err
+		}
+		var before usage
+		if err == nil {
+			before = usageOf(existing)
+		}
+		if err := s.checkQuota(ctx, b, before, usageOf(p)); err != nil {
+			return err
+		}
+		p.Version = existing.Version + 1
+		return putProfile(b, p) // PUT = create or update
+	})
+	if err != nil {
+		return err
+	}
+	setWrittenVersion(ctx, p.Version)
+	return nil
+}
+
+func (s *BoltService) PatchProfile(ctx context.Context, id string, patch Patch, version int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		existing, err := getProfile(b, id)
+		if err != nil {
+			return err // PATCH = update existing, don't create
+		}
+		if err := checkVersion(existing.Version, version); err != nil {
+			return err
+		}
+		p, err := applyPatch(existing, patch)
+		if err != nil {
+			return err
+		}
+		if p, err = validateProfile(p); err != nil {
+			return err
+		}
+		if err := s.checkQuota(ctx, b, usageOf(existing), usageOf(p)); err != nil {
+			return err
+		}
+		p.Version++
+		return putProfile(b, p)
+	})
+}
+
+func (s *BoltService) DeleteProfile(ctx context.Context, id string, version int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		p, err := getProfile(b, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(p.Version, version); err != nil {
+			return err
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+func (s *BoltService) ListProfiles(ctx context.Context, opts ListOptions) (ProfilePage, error) {
+	var profiles []Profile
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil || b == nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			p, err := decodeProfile(k, v)
+			profiles = append(profiles, p)
+			return err
+		})
+	})
+	if err != nil {
+		return ProfilePage{}, err
+	}
+	return listProfiles(profiles, opts)
+}
+
+func (s *BoltService) GetAddresses(ctx context.Context, profileID string) ([]Address, error) {
+	p, err := s.GetProfile(ctx, profileID)
+	if err != nil {
+		return []Address{}, err
+	}
+	return p.Addresses, nil
+}
+
+func (s *BoltService) GetAddress(ctx context.Context, profileID string, addressID string) (Address, error) {
+	p, err := s.GetProfile(ctx, profileID)
+	if err != nil {
+		return Address{}, err
+	}
+	for _, address := range p.Addresses {
+		if address.ID == addressID {
+			return address, nil
+		}
+	}
+	return Address{}, ErrNotFound
+}
+
+func (s *BoltService) PostAddress(ctx context.Context, profileID string, a Address) error {
+	a, err := validateAddress(a)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		p, err := getProfile(b, profileID)
+		if err != nil {
+			return err
+		}
+		for _, address := range p.Addresses {
+			if address.ID == a.ID {
+				return ErrAlreadyExists
+			}
+		}
+		if err := s.checkQuota(ctx, b, usage{}, usage{addresses: 1}); err != nil {
+			return err
+		}
+		p.Addresses = append(p.Addresses, a)
+		p.Version++
+		return putProfile(b, p)
+	})
+}
+
+func (s *BoltService) UpdateAddress(ctx context.Context, profileID string, addressID string, a Address) error {
+	if a.ID == "" {
+		a.ID = addressID
+	} else if a.ID != addressID {
+		return ErrInconsistentIDs
+	}
+	a, err := validateAddress(a)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		p, err := getProfile(b, profileID)
+		if err != nil {
+			return err
+		}
+		for i, address := range p.Addresses {
+			if address.ID == addressID {
+				p.Addresses[i] = a // PUT = update existing, don't create
+				p.Version++
+				return putProfile(b, p)
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func (s *BoltService) DeleteAddress(ctx context.Context, profileID string, addressID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := profilesOf(ctx, tx)
+		if err != nil {
+			return err
+		}
+		p, err := getProfile(b, profileID)
+		if err != nil {
+			return err
+		}
+		newAddresses := make([]Address, 0, len(p.Addresses))
+		for _, address := range p.Addresses {
+			if address.ID == addressID {
+				continue // delete
+			}
+			newAddresses = append(newAddresses, address)
+		}
+		if len(newAddresses) == len(p.Addresses) {
+			return ErrNotFound
+		}
+		p.Addresses = newAddresses
+		p.Version++
+		return putProfile(b, p)
+	})
+}
+
+// checkQuota returns ErrQuotaExceeded if a change from usage b to usage a
+// takes the tenant of bucket over its quota.
+func (s *BoltService) checkQuota(ctx context.Context, bucket *bolt.Bucket, b, a usage) error {
+	return s.options.checkQuota(ctx, b, a, func() (usage, error) {
+		var u usage
+		err := bucket.ForEach(func(k, v []byte) error {
+			p, err := decodeProfile(k, v)
+			u.add(usageOf(p))
+			return err
+		})
+		return u, err
+	})
+}
+
+// profilesOf returns the bucket of the profiles of the tenant of ctx. In a
+// read-only transaction, it's nil if the tenant has never had any; otherwise
+// it's created.
+func profilesOf(ctx context.Context, tx *bolt.Tx) (*bolt.Bucket, error) {
+	tenants, tenant := tx.Bucket(tenantsBucket), []byte(TenantFromContext(ctx))
+	if !tx.Writable() {
+		return tenants.Bucket(tenant), nil
+	}
+	return tenants.CreateBucketIfNotExists(tenant)
+}
+
+func getProfile(b *bolt.Bucket, id string) (Profile, error) {
+	if b == nil {
+		return Profile{}, ErrNotFound
+	}
+	v := b.Get([]byte(id))
+	if v == nil {
+		return Profile{}, ErrNotFound
+	}
+	return decodeProfile([]byte(id), v)
+}
+
+func decodeProfile(k, v []byte) (Profile, error) {
+	var p Profile
+	if err := json.Unmarshal(v, &p); err != nil {
+		return Profile{}, fmt.Errorf("decoding profile %q: %w", k, err)
+	}
+	return p, nil
+}
+
+func putProfile(b *bolt.Bucket, p Profile) error {
+	v, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(p.ID), v)
+}
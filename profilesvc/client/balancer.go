@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+)
+
+// Balancer is a load balancing strategy. It's called once per endpoint of
+// the client, with the endpoint's factory, and returns the lb.Balancer that
+// picks an instance for each call.
+type Balancer func(instancer sd.Instancer, factory sd.Factory, logger log.Logger) lb.Balancer
+
+// RoundRobin returns a Balancer that calls the instances in turn.
+func RoundRobin() Balancer {
+	return func(instancer sd.Instancer, factory sd.Factory, logger log.Logger) lb.Balancer {
+		return lb.NewRoundRobin(sd.NewEndpointer(instancer, factory, logger))
+	}
+}
+
+// Random returns a Balancer that calls a random instance, seeded with seed.
+func Random(seed int64) Balancer {
+	return func(instancer sd.Instancer, factory sd.Factory, logger log.Logger) lb.Balancer {
+		return lb.NewRandom(sd.NewEndpointer(instancer, factory, logger), seed)
+	}
+}
+
+// LeastOutstanding returns a Balancer that calls the instance with the
+// fewest calls in flight, so that slow instances get less of the load. The
+// calls in flight are counted per instance across all of the endpoints of
+// the client; ties are broken randomly.
+func LeastOutstanding() Balancer {
+	var (
+		mtx      sync.Mutex
+		inflight = map[string]*int64{}
+	)
+	counter := func(instance string) *int64 {
+		mtx.Lock()
+		defer mtx.Unlock()
+		n, ok := inflight[instance]
+		if !ok {
+			n = new(int64)
+			inflight[instance] = n
+		}
+		return n
+	}
+	return func(instancer sd.Instancer, factory sd.Factory, logger log.Logger) lb.Balancer {
+		b := &leastOutstanding{endpoints: map[string]*countingEndpoint{}}
+		sd.NewEndpointer(instancer, b.factory(factory, counter), logger)
+		return b
+	}
+}
+
+// leastOutstanding doesn't pick from the endpoints of its sd.Endpointer,
+// which can't tell which instance they belong to, but from those its factory
+// made and that haven't been closed since: the same set.
+type leastOutstanding struct {
+	mtx       sync.Mutex
+	endpoints map[string]*countingEndpoint // by instance
+}
+
+type countingEndpoint struct {
+	next     endpoint.Endpoint
+	inflight *int64
+}
+
+func (e *countingEndpoint) endpoint(ctx context.Context, request interface{}) (interface{}, error) {
+	atomic.AddInt64(e.inflight, 1)
+	defer atomic.AddInt64(e.inflight, -1)
+	return e.next(ctx, request)
+}
+
+func (b *leastOutstanding) factory(factory sd.Factory, counter func(instance string) *int64) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		next, closer, err := factory(instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		e := &countingEndpoint{next: next, inflight: counter(instance)}
+		b.mtx.Lock()
+		b.endpoints[instance] = e
+		b.mtx.Unlock()
+		return e.endpoint, closerFunc(func() error {
+			b.mtx.Lock()
+			if b.endpoints[instance] == e {
+				delete(b.endpoints, instance)
+			}
+			b.mtx.Unlock()
+			if closer != nil {
+				return closer.Close()
+			}
+			return nil
+		}), nil
+	}
+}
+
+// Endpoint implements lb.Balancer.
+func (b *leastOutstanding) Endpoint() (endpoint.Endpoint, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	var (
+		least []*countingEndpoint
+		min   int64
+	)
+	for _, e := range b.endpoints {
+		switch n := atomic.LoadInt64(e.inflight); {
+		case len(least) == 0 || n < min:
+			least, min = []*countingEndpoint{e}, n
+		case n == min:
+			least = append(least, e)
+		}
+	}
+	if len(least) == 0 {
+		return nil, lb.ErrNoEndpoints
+	}
+	// Break ties randomly, so that an instance that fails fast, and thus
+	// never has calls in flight, doesn't get all of them.
+	return least[rand.Intn(len(least))].endpoint, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -1,121 +1,89 @@
-// Package client provides a profilesvc client based on a predefined Consul
-// service name and relevant tags. Users must only provide the address of a
-// Consul server.
+// Package client provides a profilesvc client that's load-balanced over the
+// instances of profilesvc, found by any service discovery mechanism: Consul,
+// a static list, DNS SRV records, or a file.
 package client
 
 import (
 	"io"
 	"time"
 
-	consulapi "github.com/hashicorp/consul/api"
-
 	"github.com/go-kit/examples/profilesvc"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/sd"
-	"github.com/go-kit/kit/sd/consul"
 	"github.com/go-kit/kit/sd/lb"
 )
 
-// New returns a service that's load-balanced over instances of profilesvc found
-// in the provided Consul server. The mechanism of looking up profilesvc
-// instances in Consul is hard-coded into the client.
-func New(consulAddr string, logger log.Logger) (profilesvc.Service, error) {
-	apiclient, err := consulapi.NewClient(&consulapi.Config{
-		Address: consulAddr,
-	})
-	if err != nil {
-		return nil, err
-	}
+// Option sets an optional parameter of the client.
+type Option func(*clientOptions)
 
-	// As the implementer of profilesvc, we declare and enforce these
-	// parameters for all of the profilesvc consumers.
-	var (
-		consulService = "profilesvc"
-		consulTags    = []string{"prod"}
-		passingOnly   = true
-		retryMax      = 3
-		retryTimeout  = 500 * time.Millisecond
-	)
+type clientOptions struct {
+	balancer     Balancer
+	retryMax     int
+	retryTimeout time.Duration
+}
 
-	var (
-		sdclient  = consul.NewClient(apiclient)
-		instancer = consul.NewInstancer(sdclient, logger, consulService, consulTags, passingOnly)
-		endpoints profilesvc.Endpoints
-	)
-	{
-		factory := factoryFor(profilesvc.MakePostProfileEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.PostProfileEndpoint = retry
-	}
-	{
-		factory := factoryFor(profilesvc.MakeGetProfileEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.GetProfileEndpoint = retry
-	}
-	{
-		factory := factoryFor(profilesvc.MakePutProfileEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.PutProfileEndpoint = retry
-	}
-	{
-		factory := factoryFor(profilesvc.MakePatchProfileEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.PatchProfileEndpoint = retry
-	}
-	{
-		factory := factoryFor(profilesvc.MakeDeleteProfileEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.DeleteProfileEndpoint = retry
-	}
-	{
-		factory := factoryFor(profilesvc.MakeGetAddressesEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.GetAddressesEndpoint = retry
-	}
-	{
-		factory := factoryFor(profilesvc.MakeGetAddressEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.GetAddressEndpoint = retry
+// LoadBalancer sets the load balancing strategy. By default, it's
+// RoundRobin.
+func LoadBalancer(b Balancer) Option {
+	return func(o *clientOptions) { o.balancer = b }
+}
+
+// RetryMax sets how many times a call is tried, on different instances as
+// the load balancer picks them, before it fails. By default, it's 3. Errors
+// of the service, like profilesvc.ErrNotFound, aren't retried.
+func RetryMax(n int) Option {
+	return func(o *clientOptions) { o.retryMax = n }
+}
+
+// RetryTimeout sets the time a call may take, across all of its tries. By
+// default, it's 500ms.
+func RetryTimeout(d time.Duration) Option {
+	return func(o *clientOptions) { o.retryTimeout = d }
+}
+
+// New returns a service that's load-balanced over the instances of
+// profilesvc yielded by the provided instancer.
+func New(instancer sd.Instancer, logger log.Logger, options ...Option) profilesvc.Service {
+	o := clientOptions{
+		balancer:     RoundRobin(),
+		retryMax:     3,
+		retryTimeout: 500 * time.Millisecond,
 	}
-	{
-		factory := factoryFor(profilesvc.MakePostAddressEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.PostAddressEndpoint = retry
+	for _, option := range options {
+		option(&o)
 	}
-	{
-		factory := factoryFor(profilesvc.MakeDeleteAddressEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.DeleteAddressEndpoint = retry
+
+	balanced := func(endpointOf func(profilesvc.Endpoints) endpoint.Endpoint) endpoint.Endpoint {
+		balancer := o.balancer(instancer, factoryFor(endpointOf), logger)
+		return lb.Retry(o.retryMax, o.retryTimeout, balancer)
 	}
 
-	return endpoints, nil
+	return profilesvc.Endpoints{
+		PostProfileEndpoint:   balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.PostProfileEndpoint }),
+		GetProfileEndpoint:    balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.GetProfileEndpoint }),
+		PutProfileEndpoint:    balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.PutProfileEndpoint }),
+		PatchProfileEndpoint:  balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.PatchProfileEndpoint }),
+		DeleteProfileEndpoint: balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.DeleteProfileEndpoint }),
+		ListProfilesEndpoint:  balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.ListProfilesEndpoint }),
+		GetAddressesEndpoint:  balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.GetAddressesEndpoint }),
+		GetAddressEndpoint:    balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.GetAddressEndpoint }),
+		PostAddressEndpoint:   balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.PostAddressEndpoint }),
+		UpdateAddressEndpoint: balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.UpdateAddressEndpoint }),
+		DeleteAddressEndpoint: balanced(func(e profilesvc.Endpoints) endpoint.Endpoint { return e.DeleteAddressEndpoint }),
+	}
 }
 
-func factoryFor(makeEndpoint func(profilesvc.Service) endpoint.Endpoint) sd.Factory {
+// factoryFor returns a factory of the HTTP client endpoint that endpointOf
+// selects. It's the client endpoint itself, rather than a server endpoint
+// wrapping the client, so that transport errors are endpoint errors, which
+// lb.Retry retries, and errors of the service aren't.
+func factoryFor(endpointOf func(profilesvc.Endpoints) endpoint.Endpoint) sd.Factory {
 	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
-		service, err := profilesvc.MakeClientEndpoints(instance)
+		endpoints, err := profilesvc.MakeClientEndpoints(instance)
 		if err != nil {
 			return nil, nil, err
 		}
-		return makeEndpoint(service), nil, nil
+		return endpointOf(endpoints), nil, nil
 	}
 }
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/examples/profilesvc"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+func TestNew(t *testing.T) {
+	// Two instances sharing the profiles, and one that's down.
+	s := profilesvc.NewInmemService()
+	var instances []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(profilesvc.MakeHTTPHandler(s, nil, log.NewNopLogger()))
+		defer srv.Close()
+		instances = append(instances, srv.URL)
+	}
+	down := httptest.NewServer(nil)
+	down.Close()
+	instances = append(instances, down.URL)
+
+	for name, balancer := range map[string]Balancer{
+		"RoundRobin":       RoundRobin(),
+		"Random":           Random(42),
+		"LeastOutstanding": LeastOutstanding(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			// Random may pick the instance that's down more than once.
+			c := New(NewStaticInstancer(instances...), log.NewNopLogger(), LoadBalancer(balancer), RetryMax(20))
+			waitForEndpoints(t, c)
+
+			// Calls to the instance that's down are retried on the others.
+			id := name
+			for i := 0; i < 2*len(instances); i++ {
+				if _, err := c.GetProfile(ctx, id); err != profilesvc.ErrNotFound {
+					t.Fatalf("GetProfile before PostProfile: want %v, have %v", profilesvc.ErrNotFound, err)
+				}
+			}
+			if err := c.PostProfile(ctx, profilesvc.Profile{ID: id}); err != nil {
+				t.Fatalf("PostProfile: %v", err)
+			}
+			for i := 0; i < 2*len(instances); i++ {
+				if p, err := c.GetProfile(ctx, id); err != nil || p.ID != id {
+					t.Fatalf("GetProfile: want profile %s, have %+v (%v)", id, p, err)
+				}
+			}
+		})
+	}
+}
+
+// waitForEndpoints waits until the endpointers of c have made their
+// endpoints, which they do in the background.
+func waitForEndpoints(t *testing.T, c profilesvc.Service) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		_, err := c.GetProfile(context.Background(), "")
+		if err == nil || err == profilesvc.ErrNotFound {
+			return
+		}
+	}
+	t.Fatal("no endpoints")
+}
+
+func TestRetryTimeout(t *testing.T) {
+	// An instance that doesn't answer.
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	c := New(NewStaticInstancer(srv.URL), log.NewNopLogger(), RetryTimeout(50*time.Millisecond))
+	begin := time.Now()
+	if _, err := c.GetProfile(context.Background(), "1"); err == nil {
+		t.Fatal("GetProfile: want an error, have none")
+	}
+	if took := time.Since(begin); took < 50*time.Millisecond || took > time.Second {
+		t.Errorf("GetProfile: want to give up after 50ms, took %s", took)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	// The endpoint of instance a blocks until release is closed.
+	release := make(chan struct{})
+	called := make(chan string, 10)
+	factory := func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			called <- instance
+			if instance == "a" {
+				<-release
+			}
+			return instance, nil
+		}, nil, nil
+	}
+	balancer := LeastOutstanding()
+	b := balancer(NewStaticInstancer("a", "b"), factory, log.NewNopLogger())
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := b.Endpoint(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no endpoints")
+		}
+	}
+
+	// Keep calling until a call is stuck in a; the following calls must all
+	// go to b, also through another endpoint of the same client.
+	done := make(chan struct{})
+	for {
+		e, _ := b.Endpoint()
+		go func() {
+			e(context.Background(), nil)
+			done <- struct{}{}
+		}()
+		if <-called == "a" {
+			break
+		}
+		<-done
+	}
+	other := balancer(NewStaticInstancer("a", "b"), factory, log.NewNopLogger())
+	time.Sleep(10 * time.Millisecond) // for the endpointer
+	for _, b := range []interface {
+		Endpoint() (endpoint.Endpoint, error)
+	}{b, other, b, other} {
+		e, err := b.Endpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, _ := e(context.Background(), nil); have != "b" {
+			t.Errorf("want b, have %v", have)
+		}
+		<-called
+	}
+	close(release)
+	<-done
+}
+
+func TestFileInstancer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# profilesvc\nhost1:8080\n\n  host2:8080  \n")
+
+	in := NewFileInstancer(path, 10*time.Millisecond, log.NewNopLogger())
+	defer in.Stop()
+	events := make(chan sd.Event, 10)
+	in.Register(events)
+	defer in.Deregister(events)
+
+	next := func() sd.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+			return sd.Event{}
+		}
+	}
+	if want, have := []string{"host1:8080", "host2:8080"}, next().Instances; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	write("host2:8080\nhost1:8080\n") // no change
+	write("host3:8080\n")
+	if want, have := []string{"host3:8080"}, next().Instances; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	os.Remove(path)
+	if e := next(); !errors.Is(e.Err, os.ErrNotExist) {
+		t.Errorf("want an error for the removed file, have %+v", e)
+	}
+
+	write("")
+	if e := next(); e.Err != nil || len(e.Instances) != 0 {
+		t.Errorf("want no instances, have %+v", e)
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/consul"
+	"github.com/go-kit/kit/sd/dnssrv"
+)
+
+// The instances of profilesvc are discovered by an sd.Instancer, which New
+// turns into endpoints. Any Go kit instancer will do; these are the ones we
+// support.
+
+// NewConsulInstancer returns an instancer of the profilesvc instances
+// registered in the provided Consul server. The mechanism of looking up
+// profilesvc instances in Consul is hard-coded into the client.
+func NewConsulInstancer(consulAddr string, logger log.Logger) (sd.Instancer, error) {
+	apiclient, err := consulapi.NewClient(&consulapi.Config{
+		Address: consulAddr,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// As the implementer of profilesvc, we declare and enforce these
+	// parameters for all of the profilesvc consumers.
+	var (
+		consulService = "profilesvc"
+		consulTags    = []string{"prod"}
+		passingOnly   = true
+	)
+
+	sdclient := consul.NewClient(apiclient)
+	return consul.NewInstancer(sdclient, logger, consulService, consulTags, passingOnly), nil
+}
+
+// NewStaticInstancer returns an instancer of a fixed list of instances, each
+// a host:port or a URL. Useful in tests, and where the instances never move.
+func NewStaticInstancer(instances ...string) sd.Instancer {
+	return staticInstancer(instances)
+}
+
+// staticInstancer is sd.FixedInstancer, except that it sends every channel
+// its own copy of the instances: endpointers sort them in place.
+type staticInstancer []string
+
+func (in staticInstancer) Register(c chan<- sd.Event) {
+	c <- sd.Event{Instances: append([]string(nil), in...)}
+}
+
+func (in staticInstancer) Deregister(c chan<- sd.Event) {}
+
+func (in staticInstancer) Stop() {}
+
+// NewDNSSRVInstancer returns an instancer of the instances in the DNS SRV
+// records of name, which are looked up every ttl.
+func NewDNSSRVInstancer(name string, ttl time.Duration, logger log.Logger) sd.Instancer {
+	return dnssrv.NewInstancer(name, ttl, logger)
+}
+
+// FileInstancer yields the instances listed in a file, one per line, which is
+// read again on a fixed schedule, so that the instances can be changed without
+// restarting. Blank lines, and lines starting with #, are ignored.
+type FileInstancer struct {
+	path   string
+	logger log.Logger
+	quit   chan struct{}
+
+	mtx      sync.Mutex
+	state    sd.Event
+	registry map[chan<- sd.Event]struct{}
+}
+
+// NewFileInstancer returns an instancer of the instances listed in the file
+// at path, which is read every interval.
+func NewFileInstancer(path string, interval time.Duration, logger log.Logger) *FileInstancer {
+	in := &FileInstancer{
+		path:     path,
+		logger:   logger,
+		quit:     make(chan struct{}),
+		registry: map[chan<- sd.Event]struct{}{},
+	}
+	in.state = in.read()
+	if in.state.Err == nil {
+		logger.Log("path", path, "instances", len(in.state.Instances))
+	} else {
+		logger.Log("path", path, "err", in.state.Err)
+	}
+	go in.loop(time.NewTicker(interval))
+	return in
+}
+
+func (in *FileInstancer) loop(t *time.Ticker) {
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			in.update(in.read())
+		case <-in.quit:
+			return
+		}
+	}
+}
+
+// read returns the instances in the file, sorted, so that a file that's only
+// reordered isn't a change.
+func (in *FileInstancer) read() sd.Event {
+	data, err := ioutil.ReadFile(in.path)
+	if err != nil {
+		return sd.Event{Err: err}
+	}
+	instances := []string{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		instances = append(instances, line)
+	}
+	sort.Strings(instances)
+	return sd.Event{Instances: instances}
+}
+
+// update notifies the registered channels of event, if it's a change.
+func (in *FileInstancer) update(event sd.Event) {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+	if reflect.DeepEqual(in.state, event) {
+		return
+	}
+	if event.Err != nil {
+		in.logger.Log("path", in.path, "err", event.Err)
+	}
+	in.state = event
+	for c := range in.registry {
+		c <- copyEvent(event)
+	}
+}
+
+// Register implements sd.Instancer.
+func (in *FileInstancer) Register(c chan<- sd.Event) {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+	in.registry[c] = struct{}{}
+	c <- copyEvent(in.state)
+}
+
+// Deregister implements sd.Instancer.
+func (in *FileInstancer) Deregister(c chan<- sd.Event) {
+	in.mtx.Lock()
+	defer in.mtx.Unlock()
+	delete(in.registry, c)
+}
+
+// Stop implements sd.Instancer. The file isn't read anymore after it.
+func (in *FileInstancer) Stop() {
+	close(in.quit)
+}
+
+// copyEvent returns a copy of event for one of the registered channels, so
+// that the endpointers, which sort the instances in place, don't share them.
+func copyEvent(event sd.Event) sd.Event {
+	if event.Instances != nil {
+		event.Instances = append([]string{}, event.Instances...)
+	}
+	return event
+}
@@ -3,18 +3,34 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/golang-jwt/jwt"
+
 	"github.com/go-kit/examples/profilesvc"
+	"github.com/go-kit/examples/profilesvc/pb"
 	"github.com/go-kit/kit/log"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/grpc"
 )
 
 func main() {
 	var (
 		httpAddr = flag.String("http.addr", ":8080", "HTTP listen address")
+		grpcAddr = flag.String("grpc.addr", "", "gRPC listen address; no gRPC transport if empty")
+		store    = flag.String("store", "", "BoltDB file to store profiles in; in-memory if empty")
+		natsURL  = flag.String("nats.url", "", "NATS server URL to publish profile events to; in-process only if empty")
+		subject  = flag.String("nats.subject", profilesvc.DefaultEventSubject, "NATS subject to publish profile events on")
+		audit    = flag.String("audit.file", "", "JSON lines file to append the audit trail to; in-memory if empty")
+
+		maxProfiles  = flag.Int("tenant.max-profiles", 0, "Profiles each tenant may have; unlimited if 0")
+		maxAddresses = flag.Int("tenant.max-addresses", 0, "Addresses each tenant may have, across its profiles; unlimited if 0")
+		jwtKey       = flag.String("jwt.key", "", "HMAC key of the JWTs to take tenants from; tenants are taken from the "+profilesvc.TenantHeader+" header if empty")
+		jwtClaim     = flag.String("jwt.claim", "tenant", "JWT claim that holds the tenant")
 	)
 	flag.Parse()
 
@@ -25,15 +41,78 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
+	var events interface {
+		profilesvc.EventPublisher
+		profilesvc.EventSubscriber
+	}
+	{
+		if *natsURL == "" {
+			events = profilesvc.NewInmemEventBus()
+		} else {
+			nc, err := nats.Connect(*natsURL)
+			if err != nil {
+				logger.Log("nats", *natsURL, "err", err)
+				os.Exit(1)
+			}
+			defer nc.Close()
+			events = profilesvc.NewNATSEventBus(nc, *subject)
+		}
+	}
+
+	var auditStore profilesvc.AuditStore
+	{
+		if *audit == "" {
+			auditStore = profilesvc.NewInmemAuditStore()
+		} else {
+			as, err := profilesvc.NewJSONLinesAuditStore(*audit)
+			if err != nil {
+				logger.Log("audit", *audit, "err", err)
+				os.Exit(1)
+			}
+			defer as.Close()
+			auditStore = as
+		}
+	}
+
 	var s profilesvc.Service
 	{
-		s = profilesvc.NewInmemService()
+		quota := profilesvc.Quota{MaxProfiles: *maxProfiles, MaxAddresses: *maxAddresses}
+		quotas := profilesvc.TenantQuotas(func(string) profilesvc.Quota { return quota })
+		if *store == "" {
+			s = profilesvc.NewInmemService(quotas)
+		} else {
+			bs, err := profilesvc.NewBoltService(*store, quotas)
+			if err != nil {
+				logger.Log("store", *store, "err", err)
+				os.Exit(1)
+			}
+			defer bs.Close()
+			s = bs
+		}
+		s = profilesvc.AuditMiddleware(auditStore, log.With(logger, "component", "audit"))(s)
+		s = profilesvc.EventingMiddleware(events, log.With(logger, "component", "events"))(s)
 		s = profilesvc.LoggingMiddleware(logger)(s)
 	}
 
+	var keyFunc jwt.Keyfunc
+	if *jwtKey != "" {
+		keyFunc = func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+			return []byte(*jwtKey), nil
+		}
+	}
+
 	var h http.Handler
 	{
-		h = profilesvc.MakeHTTPHandler(s, log.With(logger, "component", "HTTP"))
+		options := []profilesvc.HTTPOption{
+			profilesvc.WithHistory(profilesvc.NewHistory(auditStore, s)),
+		}
+		if keyFunc != nil {
+			options = append(options, profilesvc.TenantClaim(keyFunc, *jwtClaim))
+		}
+		h = profilesvc.MakeHTTPHandler(s, events, log.With(logger, "component", "HTTP"), options...)
 	}
 
 	errs := make(chan error)
@@ -48,5 +127,23 @@ func main() {
 		errs <- http.ListenAndServe(*httpAddr, h)
 	}()
 
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			logger.Log("transport", "gRPC", "addr", *grpcAddr, "err", err)
+			os.Exit(1)
+		}
+		var options []profilesvc.GRPCOption
+		if keyFunc != nil {
+			options = append(options, profilesvc.GRPCTenantClaim(keyFunc, *jwtClaim))
+		}
+		server := grpc.NewServer()
+		pb.RegisterProfilesvcServer(server, profilesvc.MakeGRPCServer(s, log.With(logger, "component", "gRPC"), options...))
+		go func() {
+			logger.Log("transport", "gRPC", "addr", *grpcAddr)
+			errs <- server.Serve(lis)
+		}()
+	}
+
 	logger.Log("exit", <-errs)
 }
@@ -2,6 +2,7 @@ package profilesvc
 
 import (
 	"context"
+	"net/http"
 	"net/url"
 	"strings"
 
@@ -29,9 +30,11 @@ type Endpoints struct {
 	PutProfileEndpoint    endpoint.Endpoint
 	PatchProfileEndpoint  endpoint.Endpoint
 	DeleteProfileEndpoint endpoint.Endpoint
+	ListProfilesEndpoint  endpoint.Endpoint
 	GetAddressesEndpoint  endpoint.Endpoint
 	GetAddressEndpoint    endpoint.Endpoint
 	PostAddressEndpoint   endpoint.Endpoint
+	UpdateAddressEndpoint endpoint.Endpoint
 	DeleteAddressEndpoint endpoint.Endpoint
 }
 
@@ -45,9 +48,11 @@ func MakeServerEndpoints(s Service) Endpoints {
 		PutProfileEndpoint:    MakePutProfileEndpoint(s),
 		PatchProfileEndpoint:  MakePatchProfileEndpoint(s),
 		DeleteProfileEndpoint: MakeDeleteProfileEndpoint(s),
+		ListProfilesEndpoint:  MakeListProfilesEndpoint(s),
 		GetAddressesEndpoint:  MakeGetAddressesEndpoint(s),
 		GetAddressEndpoint:    MakeGetAddressEndpoint(s),
 		PostAddressEndpoint:   MakePostAddressEndpoint(s),
+		UpdateAddressEndpoint: MakeUpdateAddressEndpoint(s),
 		DeleteAddressEndpoint: MakeDeleteAddressEndpoint(s),
 	}
 }
@@ -65,7 +70,15 @@ func MakeClientEndpoints(instance string) (Endpoints, error) {
 	}
 	tgt.Path = ""
 
-	options := []httptransport.ClientOption{}
+	options := []httptransport.ClientOption{
+		httptransport.ClientBefore(func(ctx context.Context, r *http.Request) context.Context {
+			r.Header.Set(TenantHeader, TenantFromContext(ctx))
+			if actor := ActorFromContext(ctx); actor != "" {
+				r.Header.Set(ActorHeader, actor)
+			}
+			return ctx
+		}),
+	}
 
 	// Note that the request encoders need to modify the request URL, changing
 	// the path. That's fine: we simply need to provide specific encoders for
@@ -77,9 +90,11 @@ func MakeClientEndpoints(instance string) (Endpoints, error) {
 		PutProfileEndpoint:    httptransport.NewClient("PUT", tgt, encodePutProfileRequest, decodePutProfileResponse, options...).Endpoint(),
 		PatchProfileEndpoint:  httptransport.NewClient("PATCH", tgt, encodePatchProfileRequest, decodePatchProfileResponse, options...).Endpoint(),
 		DeleteProfileEndpoint: httptransport.NewClient("DELETE", tgt, encodeDeleteProfileRequest, decodeDeleteProfileResponse, options...).Endpoint(),
+		ListProfilesEndpoint:  httptransport.NewClient("GET", tgt, encodeListProfilesRequest, decodeListProfilesResponse, options...).Endpoint(),
 		GetAddressesEndpoint:  httptransport.NewClient("GET", tgt, encodeGetAddressesRequest, decodeGetAddressesResponse, options...).Endpoint(),
 		GetAddressEndpoint:    httptransport.NewClient("GET", tgt, encodeGetAddressRequest, decodeGetAddressResponse, options...).Endpoint(),
 		PostAddressEndpoint:   httptransport.NewClient("POST", tgt, encodePostAddressRequest, decodePostAddressResponse, options...).Endpoint(),
+		UpdateAddressEndpoint: httptransport.NewClient("PUT", tgt, encodeUpdateAddressRequest, decodeUpdateAddressResponse, options...).Endpoint(),
 		DeleteAddressEndpoint: httptransport.NewClient("DELETE", tgt, encodeDeleteAddressRequest, decodeDeleteAddressResponse, options...).Endpoint(),
 	}, nil
 }
@@ -118,8 +133,8 @@ func (e Endpoints) PutProfile(ctx context.Context, id string, p Profile) error {
 }
 
 // PatchProfile implements Service. Primarily useful in a client.
-func (e Endpoints) PatchProfile(ctx context.Context, id string, p Profile) error {
-	request := patchProfileRequest{ID: id, Profile: p}
+func (e Endpoints) PatchProfile(ctx context.Context, id string, patch Patch, version int) error {
+	request := patchProfileRequest{ID: id, Patch: patch, Version: version}
 	response, err := e.PatchProfileEndpoint(ctx, request)
 	if err != nil {
 		return err
@@ -129,8 +144,8 @@ func (e Endpoints) PatchProfile(ctx context.Context, id string, p Profile) error
 }
 
 // DeleteProfile implements Service. Primarily useful in a client.
-func (e Endpoints) DeleteProfile(ctx context.Context, id string) error {
-	request := deleteProfileRequest{ID: id}
+func (e Endpoints) DeleteProfile(ctx context.Context, id string, version int) error {
+	request := deleteProfileRequest{ID: id, Version: version}
 	response, err := e.DeleteProfileEndpoint(ctx, request)
 	if err != nil {
 		return err
@@ -139,6 +154,17 @@ func (e Endpoints) DeleteProfile(ctx context.Context, id string) error {
 	return resp.Err
 }
 
+// ListProfiles implements Service. Primarily useful in a client.
+func (e Endpoints) ListProfiles(ctx context.Context, opts ListOptions) (ProfilePage, error) {
+	request := listProfilesRequest{Options: opts}
+	response, err := e.ListProfilesEndpoint(ctx, request)
+	if err != nil {
+		return ProfilePage{}, err
+	}
+	resp := response.(listProfilesResponse)
+	return resp.ProfilePage, resp.Err
+}
+
 // GetAddresses implements Service. Primarily useful in a client.
 func (e Endpoints) GetAddresses(ctx context.Context, profileID string) ([]Address, error) {
 	request := getAddressesRequest{ProfileID: profileID}
@@ -172,6 +198,17 @@ func (e Endpoints) PostAddress(ctx context.Context, profileID string, a Address)
 	return resp.Err
 }
 
+// UpdateAddress implements Service. Primarily useful in a client.
+func (e Endpoints) UpdateAddress(ctx context.Context, profileID string, addressID string, a Address) error {
+	request := updateAddressRequest{ProfileID: profileID, AddressID: addressID, Address: a}
+	response, err := e.UpdateAddressEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(updateAddressResponse)
+	return resp.Err
+}
+
 // DeleteAddress implements Service. Primarily useful in a client.
 func (e Endpoints) DeleteAddress(ctx context.Context, profileID string, addressID string) error {
 	request := deleteAddressRequest{ProfileID: profileID, AddressID: addressID}
@@ -218,7 +255,7 @@ func MakePutProfileEndpoint(s Service) endpoint.Endpoint {
 func MakePatchProfileEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(patchProfileRequest)
-		e := s.PatchProfile(ctx, req.ID, req.Profile)
+		e := s.PatchProfile(ctx, req.ID, req.Patch, req.Version)
 		return patchProfileResponse{Err: e}, nil
 	}
 }
@@ -228,11 +265,21 @@ func MakePatchProfileEndpoint(s Service) endpoint.Endpoint {
 func MakeDeleteProfileEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(deleteProfileRequest)
-		e := s.DeleteProfile(ctx, req.ID)
+		e := s.DeleteProfile(ctx, req.ID, req.Version)
 		return deleteProfileResponse{Err: e}, nil
 	}
 }
 
+// MakeListProfilesEndpoint returns an endpoint via the passed service.
+// Primarily useful in a server.
+func MakeListProfilesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listProfilesRequest)
+		page, e := s.ListProfiles(ctx, req.Options)
+		return listProfilesResponse{ProfilePage: page, Err: e}, nil
+	}
+}
+
 // MakeGetAddressesEndpoint returns an endpoint via the passed service.
 // Primarily useful in a server.
 func MakeGetAddressesEndpoint(s Service) endpoint.Endpoint {
@@ -254,12 +301,30 @@ func MakeGetAddressEndpoint(s Service) endpoint.Endpoint {
 }
 
 // MakePostAddressEndpoint returns an endpoint via the passed service.
-// Primarily useful in a server.
+// Primarily useful in a server. Addresses without an ID are given one here,
+// rather than by the service, so that the middlewares of s see it, and the
+// response can return it.
 func MakePostAddressEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(postAddressRequest)
+		if req.Address.ID == "" {
+			req.Address.ID = newAddressID()
+		}
 		e := s.PostAddress(ctx, req.ProfileID, req.Address)
-		return postAddressResponse{Err: e}, nil
+		if e != nil {
+			return postAddressResponse{Err: e}, nil
+		}
+		return postAddressResponse{ProfileID: req.ProfileID, ID: req.Address.ID}, nil
+	}
+}
+
+// MakeUpdateAddressEndpoint returns an endpoint via the passed service.
+// Primarily useful in a server.
+func MakeUpdateAddressEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateAddressRequest)
+		e := s.UpdateAddress(ctx, req.ProfileID, req.AddressID, req.Address)
+		return updateAddressResponse{Err: e}, nil
 	}
 }
 
@@ -273,6 +338,36 @@ func MakeDeleteAddressEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+// MakePatchAddressEndpoint returns an endpoint that patches an address with
+// PatchAddress, via the passed service. Primarily useful in a server.
+func MakePatchAddressEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(patchAddressRequest)
+		e := PatchAddress(ctx, s, req.ProfileID, req.AddressID, req.Patch)
+		return patchAddressResponse{Err: e}, nil
+	}
+}
+
+// MakeProfileHistoryEndpoint returns an endpoint via the passed History.
+// Primarily useful in a server.
+func MakeProfileHistoryEndpoint(h History) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(profileHistoryRequest)
+		records, e := h.ProfileHistory(ctx, req.ID)
+		return profileHistoryResponse{History: records, Err: e}, nil
+	}
+}
+
+// MakeRestoreProfileEndpoint returns an endpoint via the passed History.
+// Primarily useful in a server.
+func MakeRestoreProfileEndpoint(h History) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(restoreProfileRequest)
+		e := h.RestoreProfile(ctx, req.ID, req.Seq)
+		return restoreProfileResponse{Err: e}, nil
+	}
+}
+
 // We have two options to return errors from the business logic.
 //
 // We could return the error via the endpoint itself. That makes certain things
@@ -318,11 +413,12 @@ type putProfileResponse struct {
 	Err error `json:"err,omitempty"`
 }
 
-func (r putProfileResponse) error() error { return nil }
+func (r putProfileResponse) error() error { return r.Err }
 
 type patchProfileRequest struct {
 	ID      string
-	Profile Profile
+	Patch   Patch
+	Version int
 }
 
 type patchProfileResponse struct {
@@ -332,7 +428,8 @@ type patchProfileResponse struct {
 func (r patchProfileResponse) error() error { return r.Err }
 
 type deleteProfileRequest struct {
-	ID string
+	ID      string
+	Version int
 }
 
 type deleteProfileResponse struct {
@@ -341,6 +438,17 @@ type deleteProfileResponse struct {
 
 func (r deleteProfileResponse) error() error { return r.Err }
 
+type listProfilesRequest struct {
+	Options ListOptions
+}
+
+type listProfilesResponse struct {
+	ProfilePage
+	Err error `json:"err,omitempty"`
+}
+
+func (r listProfilesResponse) error() error { return r.Err }
+
 type getAddressesRequest struct {
 	ProfileID string
 }
@@ -370,11 +478,37 @@ type postAddressRequest struct {
 }
 
 type postAddressResponse struct {
-	Err error `json:"err,omitempty"`
+	ProfileID string `json:"-"`
+	ID        string `json:"id,omitempty"`
+	Err       error  `json:"err,omitempty"`
 }
 
 func (r postAddressResponse) error() error { return r.Err }
 
+type updateAddressRequest struct {
+	ProfileID string
+	AddressID string
+	Address   Address
+}
+
+type updateAddressResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r updateAddressResponse) error() error { return r.Err }
+
+type patchAddressRequest struct {
+	ProfileID string
+	AddressID string
+	Patch     Patch
+}
+
+type patchAddressResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r patchAddressResponse) error() error { return r.Err }
+
 type deleteAddressRequest struct {
 	ProfileID string
 	AddressID string
@@ -385,3 +519,25 @@ type deleteAddressResponse struct {
 }
 
 func (r deleteAddressResponse) error() error { return r.Err }
+
+type profileHistoryRequest struct {
+	ID string
+}
+
+type profileHistoryResponse struct {
+	History []AuditRecord `json:"history,omitempty"`
+	Err     error         `json:"err,omitempty"`
+}
+
+func (r profileHistoryResponse) error() error { return r.Err }
+
+type restoreProfileRequest struct {
+	ID  string `json:"-"` // from the path
+	Seq int    `json:"seq"`
+}
+
+type restoreProfileResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r restoreProfileResponse) error() error { return r.Err }
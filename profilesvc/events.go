@@ -0,0 +1,183 @@
+package profilesvc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// EventType is the kind of change an Event describes.
+type EventType string
+
+// The types of the events published by EventingMiddleware.
+const (
+	ProfileCreated EventType = "ProfileCreated" // PostProfile, or PutProfile of a new profile
+	ProfileUpdated EventType = "ProfileUpdated" // PutProfile of an existing profile, or PatchProfile
+	ProfileDeleted EventType = "ProfileDeleted"
+	AddressAdded   EventType = "AddressAdded"
+	AddressUpdated EventType = "AddressUpdated"
+	AddressRemoved EventType = "AddressRemoved"
+)
+
+// Event describes a change of a profile. Consumers that need the state of
+// the profile after the change get it from the service.
+type Event struct {
+	Type      EventType `json:"type"`
+	Tenant    string    `json:"tenant"`
+	ProfileID string    `json:"profile_id"`
+	AddressID string    `json:"address_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// EventPublisher delivers events to whoever is interested.
+type EventPublisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// EventSubscriber is a source of events.
+type EventSubscriber interface {
+	// Subscribe returns a channel with the events published from now on,
+	// which is closed when ctx is done.
+	Subscribe(ctx context.Context) (<-chan Event, error)
+}
+
+// EventingMiddleware returns a service middleware that publishes an event
+// after every successful call that changes a profile. Publishing errors are
+// logged, but don't fail the call, which already happened.
+func EventingMiddleware(publisher EventPublisher, logger log.Logger) Middleware {
+	return func(next Service) Service {
+		return &eventingMiddleware{
+			Service:   next,
+			publisher: publisher,
+			logger:    logger,
+		}
+	}
+}
+
+type eventingMiddleware struct {
+	// The calls that change nothing go straight to the embedded Service.
+	Service
+	publisher EventPublisher
+	logger    log.Logger
+}
+
+func (mw eventingMiddleware) publish(ctx context.Context, typ EventType, profileID, addressID string) {
+	e := Event{Type: typ, Tenant: TenantFromContext(ctx), ProfileID: profileID, AddressID: addressID, Time: time.Now().UTC()}
+	if err := mw.publisher.Publish(ctx, e); err != nil {
+		mw.logger.Log("event", typ, "profileID", profileID, "addressID", addressID, "err", err)
+	}
+}
+
+func (mw eventingMiddleware) PostProfile(ctx context.Context, p Profile) error {
+	if err := mw.Service.PostProfile(ctx, p); err != nil {
+		return err
+	}
+	mw.publish(ctx, ProfileCreated, p.ID, "")
+	return nil
+}
+
+func (mw eventingMiddleware) PutProfile(ctx context.Context, id string, p Profile) error {
+	// Whether PUT created the profile is only known to the service, which
+	// tells by the version it wrote.
+	var version int
+	if err := mw.Service.PutProfile(withWrittenVersion(ctx, &version), id, p); err != nil {
+		return err
+	}
+	typ := ProfileUpdated
+	if version == 1 {
+		typ = ProfileCreated
+	}
+	mw.publish(ctx, typ, id, "")
+	return nil
+}
+
+func (mw eventingMiddleware) PatchProfile(ctx context.Context, id string, patch Patch, version int) error {
+	if err := mw.Service.PatchProfile(ctx, id, patch, version); err != nil {
+		return err
+	}
+	mw.publish(ctx, ProfileUpdated, id, "")
+	return nil
+}
+
+func (mw eventingMiddleware) DeleteProfile(ctx context.Context, id string, version int) error {
+	if err := mw.Service.DeleteProfile(ctx, id, version); err != nil {
+		return err
+	}
+	mw.publish(ctx, ProfileDeleted, id, "")
+	return nil
+}
+
+func (mw eventingMiddleware) PostAddress(ctx context.Context, profileID string, a Address) error {
+	if a.ID == "" {
+		a.ID = newAddressID() // so that the event has it
+	}
+	if err := mw.Service.PostAddress(ctx, profileID, a); err != nil {
+		return err
+	}
+	mw.publish(ctx, AddressAdded, profileID, a.ID)
+	return nil
+}
+
+func (mw eventingMiddleware) UpdateAddress(ctx context.Context, profileID string, addressID string, a Address) error {
+	if err := mw.Service.UpdateAddress(ctx, profileID, addressID, a); err != nil {
+		return err
+	}
+	mw.publish(ctx, AddressUpdated, profileID, addressID)
+	return nil
+}
+
+func (mw eventingMiddleware) DeleteAddress(ctx context.Context, profileID string, addressID string) error {
+	if err := mw.Service.DeleteAddress(ctx, profileID, addressID); err != nil {
+		return err
+	}
+	mw.publish(ctx, AddressRemoved, profileID, addressID)
+	return nil
+}
+
+// eventBufferSize is the number of events a subscriber of an InmemEventBus
+// may fall behind by before it misses events.
+const eventBufferSize = 64
+
+// InmemEventBus is an EventPublisher and EventSubscriber that fans events out
+// to the subscribers in the same process. Publish never blocks: subscribers
+// that fall too far behind miss events.
+type InmemEventBus struct {
+	mtx         sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewInmemEventBus returns an InmemEventBus without subscribers.
+func NewInmemEventBus() *InmemEventBus {
+	return &InmemEventBus{subscribers: map[chan Event]struct{}{}}
+}
+
+// Publish implements EventPublisher.
+func (b *InmemEventBus) Publish(ctx context.Context, e Event) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for c := range b.subscribers {
+		select {
+		case c <- e:
+		default: // the subscriber is too slow
+		}
+	}
+	return nil
+}
+
+// Subscribe implements EventSubscriber.
+func (b *InmemEventBus) Subscribe(ctx context.Context) (<-chan Event, error) {
+	c := make(chan Event, eventBufferSize)
+	b.mtx.Lock()
+	b.subscribers[c] = struct{}{}
+	b.mtx.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mtx.Lock()
+		delete(b.subscribers, c)
+		b.mtx.Unlock()
+		close(c)
+	}()
+	return c, nil
+}
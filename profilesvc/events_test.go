@@ -0,0 +1,232 @@
+package profilesvc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestEventingMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewInmemEventBus()
+	events, err := bus.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := EventingMiddleware(bus, log.NewNopLogger())(NewInmemService())
+
+	type call struct {
+		name string
+		do   func() error
+		want []Event // without Time
+	}
+	for _, c := range []call{
+		{"PostProfile", func() error { return s.PostProfile(ctx, Profile{ID: "1"}) }, []Event{{Type: ProfileCreated, Tenant: DefaultTenant, ProfileID: "1"}}},
+		{"PostProfile again", func() error { return s.PostProfile(ctx, Profile{ID: "1"}) }, nil},
+		{"PutProfile(update)", func() error { return s.PutProfile(ctx, "1", Profile{ID: "1", Name: "Go Kit"}) }, []Event{{Type: ProfileUpdated, Tenant: DefaultTenant, ProfileID: "1"}}},
+		{"PutProfile(create)", func() error { return s.PutProfile(ctx, "2", Profile{ID: "2"}) }, []Event{{Type: ProfileCreated, Tenant: DefaultTenant, ProfileID: "2"}}},
+		{"PutProfile(stale version)", func() error { return s.PutProfile(ctx, "2", Profile{ID: "2", Version: 5}) }, nil},
+		{"PatchProfile", func() error { return s.PatchProfile(ctx, "1", mergePatch(`{"name":null}`), 0) }, []Event{{Type: ProfileUpdated, Tenant: DefaultTenant, ProfileID: "1"}}},
+		{"PatchProfile(invalid)", func() error { return s.PatchProfile(ctx, "1", mergePatch(`[`), 0) }, nil},
+		{"PostAddress", func() error { return s.PostAddress(ctx, "1", Address{ID: "home"}) }, []Event{{Type: AddressAdded, Tenant: DefaultTenant, ProfileID: "1", AddressID: "home"}}},
+		{"UpdateAddress", func() error { return s.UpdateAddress(ctx, "1", "home", Address{ID: "home", Location: "Berlin"}) }, []Event{{Type: AddressUpdated, Tenant: DefaultTenant, ProfileID: "1", AddressID: "home"}}},
+		{"DeleteAddress", func() error { return s.DeleteAddress(ctx, "1", "home") }, []Event{{Type: AddressRemoved, Tenant: DefaultTenant, ProfileID: "1", AddressID: "home"}}},
+		{"DeleteAddress again", func() error { return s.DeleteAddress(ctx, "1", "home") }, nil},
+		{"GetProfile", func() error { _, err := s.GetProfile(ctx, "1"); return err }, nil},
+		{"DeleteProfile", func() error { return s.DeleteProfile(ctx, "1", 0) }, []Event{{Type: ProfileDeleted, Tenant: DefaultTenant, ProfileID: "1"}}},
+		{"PutProfile(recreate)", func() error { return s.PutProfile(ctx, "1", Profile{ID: "1"}) }, []Event{{Type: ProfileCreated, Tenant: DefaultTenant, ProfileID: "1"}}},
+	} {
+		c.do()
+		var have []Event
+	drain:
+		for {
+			select {
+			case e := <-events:
+				if e.Time.IsZero() {
+					t.Errorf("%s: event without time: %+v", c.name, e)
+				}
+				e.Time = time.Time{}
+				have = append(have, e)
+			default:
+				break drain
+			}
+		}
+		if len(have) != len(c.want) || (len(have) > 0 && have[0] != c.want[0]) {
+			t.Errorf("%s: want events %+v, have %+v", c.name, c.want, have)
+		}
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("subscription still open after its context is done")
+	}
+}
+
+func TestInmemEventBusSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewInmemEventBus()
+	slow, _ := bus.Subscribe(ctx)
+	fast, _ := bus.Subscribe(ctx)
+
+	// Publishing never blocks, so the fast subscriber gets every event, and
+	// the slow one, which doesn't read, as many as fit in its buffer.
+	done := make(chan int)
+	go func() {
+		var n int
+		for range fast {
+			n++
+			if n == 2*eventBufferSize {
+				break
+			}
+		}
+		done <- n
+	}()
+	for i := 0; i < 2*eventBufferSize; i++ {
+		bus.Publish(ctx, Event{Type: ProfileCreated})
+		if i%eventBufferSize == 0 {
+			time.Sleep(10 * time.Millisecond) // let the fast one catch up
+		}
+	}
+	select {
+	case n := <-done:
+		if n != 2*eventBufferSize {
+			t.Errorf("fast subscriber: want %d events, have %d", 2*eventBufferSize, n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fast subscriber didn't get every event")
+	}
+	if len(slow) != eventBufferSize {
+		t.Errorf("slow subscriber: want %d buffered events, have %d", eventBufferSize, len(slow))
+	}
+}
+
+func TestHTTPEventStream(t *testing.T) {
+	bus := NewInmemEventBus()
+	s := EventingMiddleware(bus, log.NewNopLogger())(NewInmemService())
+	srv := httptest.NewServer(MakeHTTPHandler(s, bus, log.NewNopLogger()))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/profiles/events", nil)
+	req.Header.Set(TenantHeader, "acme")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if want, have := "text/event-stream", resp.Header.Get("Content-Type"); want != have {
+		t.Errorf("Content-Type: want %s, have %s", want, have)
+	}
+
+	// The stream is subscribed once the headers are in. It only has the
+	// events of its own tenant.
+	if err := s.PostProfile(ctx, Profile{ID: "0"}); err != nil {
+		t.Fatal(err)
+	}
+	acme := WithTenant(ctx, "acme")
+	if err := s.PostProfile(acme, Profile{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PostAddress(acme, "1", Address{ID: "home"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for _, want := range []Event{
+		{Type: ProfileCreated, Tenant: "acme", ProfileID: "1"},
+		{Type: AddressAdded, Tenant: "acme", ProfileID: "1", AddressID: "home"},
+	} {
+		var name, data string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading the stream: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				break
+			}
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		var have Event
+		if err := json.Unmarshal([]byte(data), &have); err != nil {
+			t.Fatalf("event data %q: %v", data, err)
+		}
+		have.Time = time.Time{}
+		if name != string(want.Type) || have != want {
+			t.Errorf("want event %s %+v, have %s %+v", want.Type, want, name, have)
+		}
+	}
+}
+
+func TestAddressAddedWithoutID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := NewInmemEventBus()
+	events, err := bus.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := EventingMiddleware(bus, log.NewNopLogger())(NewInmemService())
+	srv := httptest.NewServer(MakeHTTPHandler(s, nil, log.NewNopLogger()))
+	defer srv.Close()
+	if err := s.PostProfile(ctx, Profile{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	<-events
+
+	// The ID generated for the address is the one in the response, its
+	// Location, the event, and the profile.
+	resp, err := http.Post(srv.URL+"/profiles/1/addresses/", "application/json", strings.NewReader(`{"location":"Berlin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != http.StatusOK || body.ID == "" {
+		t.Fatalf("POST address: want %d and an ID, have %d and %+v (%v)", http.StatusOK, resp.StatusCode, body, err)
+	}
+	if want, have := "/profiles/1/addresses/"+body.ID, resp.Header.Get("Location"); want != have {
+		t.Errorf("Location: want %s, have %s", want, have)
+	}
+	select {
+	case e := <-events:
+		if e.Type != AddressAdded || e.AddressID != body.ID {
+			t.Errorf("want %s of %s, have %+v", AddressAdded, body.ID, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want an event, have none")
+	}
+	if _, err := s.GetAddress(ctx, "1", body.ID); err != nil {
+		t.Errorf("GetAddress: %v", err)
+	}
+
+	// So is the one the middleware generates for callers of the service.
+	if err := s.PostAddress(ctx, "1", Address{Location: "Hamburg"}); err != nil {
+		t.Fatal(err)
+	}
+	e := <-events
+	if e.AddressID == "" || e.AddressID == body.ID {
+		t.Fatalf("want the event of another address, have %+v", e)
+	}
+	if _, err := s.GetAddress(ctx, "1", e.AddressID); err != nil {
+		t.Errorf("GetAddress: %v", err)
+	}
+}
@@ -0,0 +1,757 @@
+package profilesvc
+
+// The gRPC transport of profilesvc. The messages and the service are defined
+// in pb/profilesvc.proto.
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+
+	"github.com/go-kit/examples/profilesvc/pb"
+)
+
+type grpcServer struct {
+	postProfile   grpctransport.Handler
+	getProfile    grpctransport.Handler
+	putProfile    grpctransport.Handler
+	patchProfile  grpctransport.Handler
+	deleteProfile grpctransport.Handler
+	listProfiles  grpctransport.Handler
+	getAddresses  grpctransport.Handler
+	getAddress    grpctransport.Handler
+	postAddress   grpctransport.Handler
+	updateAddress grpctransport.Handler
+	deleteAddress grpctransport.Handler
+
+	callerOf func(md metadata.MD) (tenant, actor string, err error)
+}
+
+// GRPCOption sets an optional parameter of MakeGRPCServer.
+type GRPCOption func(*grpcOptions)
+
+type grpcOptions struct {
+	callerOf func(md metadata.MD) (tenant, actor string, err error)
+}
+
+// GRPCTenantClaim is the gRPC counterpart of TenantClaim: the tenant and actor
+// of a call are taken from the JWT in its "authorization" metadata, rather
+// than from the x-tenant-id and x-actor-id metadata, which clients could set
+// to anything. Calls without a valid token fail with Unauthenticated.
+func GRPCTenantClaim(keyFunc jwt.Keyfunc, claim string) GRPCOption {
+	callerOf := tokenCaller(keyFunc, claim)
+	return func(o *grpcOptions) {
+		o.callerOf = func(md metadata.MD) (string, string, error) {
+			var auth string
+			if v := md.Get(authorizationMetadataKey); len(v) > 0 {
+				auth = v[0]
+			}
+			return callerOf(auth)
+		}
+	}
+}
+
+// MakeGRPCServer makes all of the service endpoints available as a gRPC
+// ProfilesvcServer. Useful in a profilesvc server. Every call is served in the
+// context of its tenant and actor, from its metadata or, with
+// GRPCTenantClaim, its token.
+func MakeGRPCServer(s Service, logger log.Logger, options ...GRPCOption) pb.ProfilesvcServer {
+	o := grpcOptions{callerOf: callerFromMetadata}
+	for _, option := range options {
+		option(&o)
+	}
+	e := MakeServerEndpoints(s)
+	serverOptions := []grpctransport.ServerOption{
+		grpctransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+	}
+
+	return &grpcServer{
+		callerOf: o.callerOf,
+		postProfile: grpctransport.NewServer(
+			e.PostProfileEndpoint,
+			decodeGRPCPostProfileRequest,
+			encodeGRPCResponse(encodeGRPCPostProfileResponse),
+			serverOptions...,
+		),
+		getProfile: grpctransport.NewServer(
+			e.GetProfileEndpoint,
+			decodeGRPCGetProfileRequest,
+			encodeGRPCResponse(encodeGRPCGetProfileResponse),
+			serverOptions...,
+		),
+		putProfile: grpctransport.NewServer(
+			e.PutProfileEndpoint,
+			decodeGRPCPutProfileRequest,
+			encodeGRPCResponse(encodeGRPCPutProfileResponse),
+			serverOptions...,
+		),
+		patchProfile: grpctransport.NewServer(
+			e.PatchProfileEndpoint,
+			decodeGRPCPatchProfileRequest,
+			encodeGRPCResponse(encodeGRPCPatchProfileResponse),
+			serverOptions...,
+		),
+		deleteProfile: grpctransport.NewServer(
+			e.DeleteProfileEndpoint,
+			decodeGRPCDeleteProfileRequest,
+			encodeGRPCResponse(encodeGRPCDeleteProfileResponse),
+			serverOptions...,
+		),
+		listProfiles: grpctransport.NewServer(
+			e.ListProfilesEndpoint,
+			decodeGRPCListProfilesRequest,
+			encodeGRPCResponse(encodeGRPCListProfilesResponse),
+			serverOptions...,
+		),
+		getAddresses: grpctransport.NewServer(
+			e.GetAddressesEndpoint,
+			decodeGRPCGetAddressesRequest,
+			encodeGRPCResponse(encodeGRPCGetAddressesResponse),
+			serverOptions...,
+		),
+		getAddress: grpctransport.NewServer(
+			e.GetAddressEndpoint,
+			decodeGRPCGetAddressRequest,
+			encodeGRPCResponse(encodeGRPCGetAddressResponse),
+			serverOptions...,
+		),
+		postAddress: grpctransport.NewServer(
+			e.PostAddressEndpoint,
+			decodeGRPCPostAddressRequest,
+			encodeGRPCResponse(encodeGRPCPostAddressResponse),
+			serverOptions...,
+		),
+		updateAddress: grpctransport.NewServer(
+			e.UpdateAddressEndpoint,
+			decodeGRPCUpdateAddressRequest,
+			encodeGRPCResponse(encodeGRPCUpdateAddressResponse),
+			serverOptions...,
+		),
+		deleteAddress: grpctransport.NewServer(
+			e.DeleteAddressEndpoint,
+			decodeGRPCDeleteAddressRequest,
+			encodeGRPCResponse(encodeGRPCDeleteAddressResponse),
+			serverOptions...,
+		),
+	}
+}
+
+func (s *grpcServer) PostProfile(ctx context.Context, req *pb.PostProfileRequest) (*pb.PostProfileReply, error) {
+	rep, err := s.serve(ctx, s.postProfile, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.PostProfileReply), nil
+}
+
+func (s *grpcServer) GetProfile(ctx context.Context, req *pb.GetProfileRequest) (*pb.GetProfileReply, error) {
+	rep, err := s.serve(ctx, s.getProfile, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.GetProfileReply), nil
+}
+
+func (s *grpcServer) PutProfile(ctx context.Context, req *pb.PutProfileRequest) (*pb.PutProfileReply, error) {
+	rep, err := s.serve(ctx, s.putProfile, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.PutProfileReply), nil
+}
+
+func (s *grpcServer) PatchProfile(ctx context.Context, req *pb.PatchProfileRequest) (*pb.PatchProfileReply, error) {
+	rep, err := s.serve(ctx, s.patchProfile, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.PatchProfileReply), nil
+}
+
+func (s *grpcServer) DeleteProfile(ctx context.Context, req *pb.DeleteProfileRequest) (*pb.DeleteProfileReply, error) {
+	rep, err := s.serve(ctx, s.deleteProfile, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.DeleteProfileReply), nil
+}
+
+func (s *grpcServer) ListProfiles(ctx context.Context, req *pb.ListProfilesRequest) (*pb.ListProfilesReply, error) {
+	rep, err := s.serve(ctx, s.listProfiles, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.ListProfilesReply), nil
+}
+
+func (s *grpcServer) GetAddresses(ctx context.Context, req *pb.GetAddressesRequest) (*pb.GetAddressesReply, error) {
+	rep, err := s.serve(ctx, s.getAddresses, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.GetAddressesReply), nil
+}
+
+func (s *grpcServer) GetAddress(ctx context.Context, req *pb.GetAddressRequest) (*pb.GetAddressReply, error) {
+	rep, err := s.serve(ctx, s.getAddress, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.GetAddressReply), nil
+}
+
+func (s *grpcServer) PostAddress(ctx context.Context, req *pb.PostAddressRequest) (*pb.PostAddressReply, error) {
+	rep, err := s.serve(ctx, s.postAddress, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.PostAddressReply), nil
+}
+
+func (s *grpcServer) UpdateAddress(ctx context.Context, req *pb.UpdateAddressRequest) (*pb.UpdateAddressReply, error) {
+	rep, err := s.serve(ctx, s.updateAddress, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.UpdateAddressReply), nil
+}
+
+func (s *grpcServer) DeleteAddress(ctx context.Context, req *pb.DeleteAddressRequest) (*pb.DeleteAddressReply, error) {
+	rep, err := s.serve(ctx, s.deleteAddress, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.DeleteAddressReply), nil
+}
+
+// serve serves a request with h, in the context of the tenant and actor of
+// the call. A response with a business-logic error, which encodeGRPCResponse
+// passes on as is, is returned as a gRPC status.
+func (s *grpcServer) serve(ctx context.Context, h grpctransport.Handler, req interface{}) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tenant, actor, err := s.callerOf(md)
+	if err != nil {
+		return nil, statusFromError(err).Err()
+	}
+	_, rep, err := h.ServeGRPC(WithActor(WithTenant(ctx, tenant), actor), req)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := rep.(errorer); ok {
+		return nil, statusFromError(e.error()).Err()
+	}
+	return rep, nil
+}
+
+// encodeGRPCResponse wraps the reply encoder of an endpoint. Like in the HTTP
+// transport, business-logic errors aren't Go kit transport errors, so they
+// aren't returned, which would log them, but passed on to grpcServer.serve.
+func encodeGRPCResponse(enc grpctransport.EncodeResponseFunc) grpctransport.EncodeResponseFunc {
+	return func(ctx context.Context, response interface{}) (interface{}, error) {
+		if e, ok := response.(errorer); ok && e.error() != nil {
+			return response, nil
+		}
+		return enc(ctx, response)
+	}
+}
+
+// MakeGRPCClientEndpoints returns an Endpoints struct where each endpoint
+// invokes the corresponding method on the remote instance at the other end
+// of conn, via a transport/grpc.Client. Since Endpoints implements Service,
+// it's a gRPC client of profilesvc. The caller is responsible for
+// constructing the conn, and eventually closing it.
+func MakeGRPCClientEndpoints(conn *grpc.ClientConn) Endpoints {
+	const service = "pb.Profilesvc"
+	options := []grpctransport.ClientOption{
+		grpctransport.ClientBefore(callerToMetadata),
+	}
+
+	return Endpoints{
+		PostProfileEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "PostProfile", encodeGRPCPostProfileRequest, decodeGRPCPostProfileResponse, pb.PostProfileReply{}, options...),
+			func(err error) interface{} { return postProfileResponse{Err: err} },
+		),
+		GetProfileEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "GetProfile", encodeGRPCGetProfileRequest, decodeGRPCGetProfileResponse, pb.GetProfileReply{}, options...),
+			func(err error) interface{} { return getProfileResponse{Err: err} },
+		),
+		PutProfileEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "PutProfile", encodeGRPCPutProfileRequest, decodeGRPCPutProfileResponse, pb.PutProfileReply{}, options...),
+			func(err error) interface{} { return putProfileResponse{Err: err} },
+		),
+		PatchProfileEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "PatchProfile", encodeGRPCPatchProfileRequest, decodeGRPCPatchProfileResponse, pb.PatchProfileReply{}, options...),
+			func(err error) interface{} { return patchProfileResponse{Err: err} },
+		),
+		DeleteProfileEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "DeleteProfile", encodeGRPCDeleteProfileRequest, decodeGRPCDeleteProfileResponse, pb.DeleteProfileReply{}, options...),
+			func(err error) interface{} { return deleteProfileResponse{Err: err} },
+		),
+		ListProfilesEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "ListProfiles", encodeGRPCListProfilesRequest, decodeGRPCListProfilesResponse, pb.ListProfilesReply{}, options...),
+			func(err error) interface{} { return listProfilesResponse{Err: err} },
+		),
+		GetAddressesEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "GetAddresses", encodeGRPCGetAddressesRequest, decodeGRPCGetAddressesResponse, pb.GetAddressesReply{}, options...),
+			func(err error) interface{} { return getAddressesResponse{Err: err} },
+		),
+		GetAddressEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "GetAddress", encodeGRPCGetAddressRequest, decodeGRPCGetAddressResponse, pb.GetAddressReply{}, options...),
+			func(err error) interface{} { return getAddressResponse{Err: err} },
+		),
+		PostAddressEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "PostAddress", encodeGRPCPostAddressRequest, decodeGRPCPostAddressResponse, pb.PostAddressReply{}, options...),
+			func(err error) interface{} { return postAddressResponse{Err: err} },
+		),
+		UpdateAddressEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "UpdateAddress", encodeGRPCUpdateAddressRequest, decodeGRPCUpdateAddressResponse, pb.UpdateAddressReply{}, options...),
+			func(err error) interface{} { return updateAddressResponse{Err: err} },
+		),
+		DeleteAddressEndpoint: grpcClientEndpoint(
+			grpctransport.NewClient(conn, service, "DeleteAddress", encodeGRPCDeleteAddressRequest, decodeGRPCDeleteAddressResponse, pb.DeleteAddressReply{}, options...),
+			func(err error) interface{} { return deleteAddressResponse{Err: err} },
+		),
+	}
+}
+
+// grpcClientEndpoint returns the endpoint of c. Business-logic errors, which
+// come back as a gRPC status, are returned in a response built by failed,
+// like the server endpoints and the HTTP client endpoints return them, so they
+// don't count as transport errors, e.g. in lb.Retry.
+func grpcClientEndpoint(c *grpctransport.Client, failed func(error) interface{}) endpoint.Endpoint {
+	e := c.Endpoint()
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := e(ctx, request)
+		if err != nil {
+			if st, ok := status.FromError(err); ok && isBusinessCode(st.Code()) {
+				return failed(errorFromStatus(st)), nil
+			}
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+// grpcCodeFrom is the gRPC counterpart of codeFrom.
+func grpcCodeFrom(err error) codes.Code {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return codes.InvalidArgument
+	}
+	switch err {
+	case ErrNotFound:
+		return codes.NotFound
+	case ErrAlreadyExists:
+		return codes.AlreadyExists
+	case ErrInconsistentIDs, ErrInvalidCursor, ErrInvalidListOptions, ErrInvalidPatch, ErrUnsupportedPatch:
+		return codes.InvalidArgument
+	case ErrVersionConflict:
+		// The code for a failed test-and-set, after which the client should
+		// get the profile again.
+		return codes.Aborted
+	case ErrPatchConflict:
+		return codes.FailedPrecondition
+	case ErrQuotaExceeded:
+		return codes.ResourceExhausted
+	case ErrUnauthorized:
+		return codes.Unauthenticated
+	default:
+		return codes.Unknown
+	}
+}
+
+// The gRPC metadata keys that carry the tenant of a call, and the actor to
+// whom the audit trail attributes its changes. Calls without a tenant are of
+// the DefaultTenant.
+const (
+	tenantMetadataKey        = "x-tenant-id"
+	actorMetadataKey         = "x-actor-id"
+	authorizationMetadataKey = "authorization"
+)
+
+func callerFromMetadata(md metadata.MD) (tenant, actor string, err error) {
+	if v := md.Get(tenantMetadataKey); len(v) > 0 {
+		tenant = v[0]
+	}
+	if v := md.Get(actorMetadataKey); len(v) > 0 {
+		actor = v[0]
+	}
+	return tenant, actor, nil
+}
+
+func callerToMetadata(ctx context.Context, md *metadata.MD) context.Context {
+	md.Set(tenantMetadataKey, TenantFromContext(ctx))
+	if actor := ActorFromContext(ctx); actor != "" {
+		md.Set(actorMetadataKey, actor)
+	}
+	return ctx
+}
+
+// isBusinessCode reports whether a gRPC status with code is a business-logic
+// error returned by grpcCodeFrom, rather than a transport error.
+func isBusinessCode(code codes.Code) bool {
+	switch code {
+	case codes.NotFound, codes.AlreadyExists, codes.InvalidArgument, codes.Aborted, codes.FailedPrecondition, codes.ResourceExhausted, codes.Unauthenticated:
+		return true
+	default:
+		return false
+	}
+}
+
+// statusFromError returns a gRPC status for a business-logic error. The
+// invalid fields of a ValidationError are attached as a google.rpc.BadRequest
+// detail.
+func statusFromError(err error) *status.Status {
+	st := status.New(grpcCodeFrom(err), err.Error())
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		br := &errdetails.BadRequest{}
+		for field, problem := range verr.Fields {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field,
+				Description: problem,
+			})
+		}
+		sort.Slice(br.FieldViolations, func(i, j int) bool {
+			return br.FieldViolations[i].Field < br.FieldViolations[j].Field
+		})
+		if withDetails, err := st.WithDetails(br); err == nil {
+			return withDetails
+		}
+	}
+	return st
+}
+
+// errorFromStatus is the inverse of statusFromError: the errors of this
+// package come back as themselves, like in errorFromResponse.
+func errorFromStatus(st *status.Status) error {
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			fields := map[string]string{}
+			for _, v := range br.FieldViolations {
+				fields[v.Field] = v.Description
+			}
+			return &ValidationError{Fields: fields}
+		}
+	}
+	return errorFromMessage(st.Message())
+}
+
+func decodeGRPCPostProfileRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PostProfileRequest)
+	return postProfileRequest{Profile: profileFromPB(req.Profile)}, nil
+}
+
+func decodeGRPCGetProfileRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetProfileRequest)
+	return getProfileRequest{ID: req.Id}, nil
+}
+
+func decodeGRPCPutProfileRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PutProfileRequest)
+	return putProfileRequest{ID: req.Id, Profile: profileFromPB(req.Profile)}, nil
+}
+
+func decodeGRPCPatchProfileRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PatchProfileRequest)
+	return patchProfileRequest{
+		ID:      req.Id,
+		Patch:   Patch{Type: req.Type, Document: req.Document},
+		Version: int(req.Version),
+	}, nil
+}
+
+func decodeGRPCDeleteProfileRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.DeleteProfileRequest)
+	return deleteProfileRequest{ID: req.Id, Version: int(req.Version)}, nil
+}
+
+func decodeGRPCListProfilesRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ListProfilesRequest)
+	return listProfilesRequest{Options: ListOptions{
+		Cursor:     req.Cursor,
+		Limit:      int(req.Limit),
+		NamePrefix: req.NamePrefix,
+		Location:   req.Location,
+		Sort:       req.Sort,
+	}}, nil
+}
+
+func decodeGRPCGetAddressesRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetAddressesRequest)
+	return getAddressesRequest{ProfileID: req.ProfileId}, nil
+}
+
+func decodeGRPCGetAddressRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetAddressRequest)
+	return getAddressRequest{ProfileID: req.ProfileId, AddressID: req.AddressId}, nil
+}
+
+func decodeGRPCPostAddressRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PostAddressRequest)
+	return postAddressRequest{ProfileID: req.ProfileId, Address: addressFromPB(req.Address)}, nil
+}
+
+func decodeGRPCUpdateAddressRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.UpdateAddressRequest)
+	return updateAddressRequest{
+		ProfileID: req.ProfileId,
+		AddressID: req.AddressId,
+		Address:   addressFromPB(req.Address),
+	}, nil
+}
+
+func decodeGRPCDeleteAddressRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.DeleteAddressRequest)
+	return deleteAddressRequest{ProfileID: req.ProfileId, AddressID: req.AddressId}, nil
+}
+
+func encodeGRPCPostProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.PostProfileReply{}, nil
+}
+
+func encodeGRPCGetProfileResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getProfileResponse)
+	return &pb.GetProfileReply{Profile: profileToPB(resp.Profile)}, nil
+}
+
+func encodeGRPCPutProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.PutProfileReply{}, nil
+}
+
+func encodeGRPCPatchProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.PatchProfileReply{}, nil
+}
+
+func encodeGRPCDeleteProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.DeleteProfileReply{}, nil
+}
+
+func encodeGRPCListProfilesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(listProfilesResponse)
+	reply := &pb.ListProfilesReply{NextCursor: resp.NextCursor}
+	for _, p := range resp.Profiles {
+		reply.Profiles = append(reply.Profiles, profileToPB(p))
+	}
+	return reply, nil
+}
+
+func encodeGRPCGetAddressesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getAddressesResponse)
+	return &pb.GetAddressesReply{Addresses: addressesToPB(resp.Addresses)}, nil
+}
+
+func encodeGRPCGetAddressResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getAddressResponse)
+	return &pb.GetAddressReply{Address: addressToPB(resp.Address)}, nil
+}
+
+func encodeGRPCPostAddressResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.PostAddressReply{}, nil
+}
+
+func encodeGRPCUpdateAddressResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.UpdateAddressReply{}, nil
+}
+
+func encodeGRPCDeleteAddressResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.DeleteAddressReply{}, nil
+}
+
+func encodeGRPCPostProfileRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(postProfileRequest)
+	return &pb.PostProfileRequest{Profile: profileToPB(req.Profile)}, nil
+}
+
+func encodeGRPCGetProfileRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(getProfileRequest)
+	return &pb.GetProfileRequest{Id: req.ID}, nil
+}
+
+func encodeGRPCPutProfileRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(putProfileRequest)
+	return &pb.PutProfileRequest{Id: req.ID, Profile: profileToPB(req.Profile)}, nil
+}
+
+func encodeGRPCPatchProfileRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(patchProfileRequest)
+	return &pb.PatchProfileRequest{
+		Id:       req.ID,
+		Type:     req.Patch.Type,
+		Document: req.Patch.Document,
+		Version:  int64(req.Version),
+	}, nil
+}
+
+func encodeGRPCDeleteProfileRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(deleteProfileRequest)
+	return &pb.DeleteProfileRequest{Id: req.ID, Version: int64(req.Version)}, nil
+}
+
+func encodeGRPCListProfilesRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(listProfilesRequest)
+	return &pb.ListProfilesRequest{
+		Cursor:     req.Options.Cursor,
+		Limit:      int32(req.Options.Limit),
+		NamePrefix: req.Options.NamePrefix,
+		Location:   req.Options.Location,
+		Sort:       req.Options.Sort,
+	}, nil
+}
+
+func encodeGRPCGetAddressesRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(getAddressesRequest)
+	return &pb.GetAddressesRequest{ProfileId: req.ProfileID}, nil
+}
+
+func encodeGRPCGetAddressRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(getAddressRequest)
+	return &pb.GetAddressRequest{ProfileId: req.ProfileID, AddressId: req.AddressID}, nil
+}
+
+func encodeGRPCPostAddressRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(postAddressRequest)
+	return &pb.PostAddressRequest{ProfileId: req.ProfileID, Address: addressToPB(req.Address)}, nil
+}
+
+func encodeGRPCUpdateAddressRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(updateAddressRequest)
+	return &pb.UpdateAddressRequest{
+		ProfileId: req.ProfileID,
+		AddressId: req.AddressID,
+		Address:   addressToPB(req.Address),
+	}, nil
+}
+
+func encodeGRPCDeleteAddressRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(deleteAddressRequest)
+	return &pb.DeleteAddressRequest{ProfileId: req.ProfileID, AddressId: req.AddressID}, nil
+}
+
+func decodeGRPCPostProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return postProfileResponse{}, nil
+}
+
+func decodeGRPCGetProfileResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetProfileReply)
+	return getProfileResponse{Profile: profileFromPB(reply.Profile)}, nil
+}
+
+func decodeGRPCPutProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return putProfileResponse{}, nil
+}
+
+func decodeGRPCPatchProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return patchProfileResponse{}, nil
+}
+
+func decodeGRPCDeleteProfileResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return deleteProfileResponse{}, nil
+}
+
+func decodeGRPCListProfilesResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.ListProfilesReply)
+	page := ProfilePage{Profiles: []Profile{}, NextCursor: reply.NextCursor}
+	for _, p := range reply.Profiles {
+		page.Profiles = append(page.Profiles, profileFromPB(p))
+	}
+	return listProfilesResponse{ProfilePage: page}, nil
+}
+
+func decodeGRPCGetAddressesResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetAddressesReply)
+	return getAddressesResponse{Addresses: addressesFromPB(reply.Addresses)}, nil
+}
+
+func decodeGRPCGetAddressResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetAddressReply)
+	return getAddressResponse{Address: addressFromPB(reply.Address)}, nil
+}
+
+func decodeGRPCPostAddressResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return postAddressResponse{}, nil
+}
+
+func decodeGRPCUpdateAddressResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return updateAddressResponse{}, nil
+}
+
+func decodeGRPCDeleteAddressResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return deleteAddressResponse{}, nil
+}
+
+func profileToPB(p Profile) *pb.Profile {
+	return &pb.Profile{
+		Id:        p.ID,
+		Name:      p.Name,
+		Addresses: addressesToPB(p.Addresses),
+		Version:   int64(p.Version),
+	}
+}
+
+func profileFromPB(p *pb.Profile) Profile {
+	if p == nil {
+		return Profile{}
+	}
+	return Profile{
+		ID:        p.Id,
+		Name:      p.Name,
+		Addresses: addressesFromPB(p.Addresses),
+		Version:   int(p.Version),
+	}
+}
+
+func addressToPB(a Address) *pb.Address {
+	return &pb.Address{
+		Id:         a.ID,
+		Location:   a.Location,
+		Street:     a.Street,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func addressFromPB(a *pb.Address) Address {
+	if a == nil {
+		return Address{}
+	}
+	return Address{
+		ID:         a.Id,
+		Location:   a.Location,
+		Street:     a.Street,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func addressesToPB(addresses []Address) []*pb.Address {
+	var pbAddresses []*pb.Address
+	for _, a := range addresses {
+		pbAddresses = append(pbAddresses, addressToPB(a))
+	}
+	return pbAddresses
+}
+
+// addressesFromPB returns nil for no addresses, like the service does for a
+// profile without addresses, since protobuf doesn't tell nil and empty apart.
+func addressesFromPB(pbAddresses []*pb.Address) []Address {
+	var addresses []Address
+	for _, a := range pbAddresses {
+		addresses = append(addresses, addressFromPB(a))
+	}
+	return addresses
+}
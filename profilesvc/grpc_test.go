@@ -0,0 +1,188 @@
+package profilesvc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/profilesvc/pb"
+)
+
+// newGRPCConn serves s over gRPC on an in-memory listener, and returns a
+// connection to it. Both are closed when the test finishes.
+func newGRPCConn(t *testing.T, s Service, options ...GRPCOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterProfilesvcServer(server, MakeGRPCServer(s, log.NewNopLogger(), options...))
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCService(t *testing.T) {
+	// The gRPC client must behave like the service it's a client of.
+	testService(t, func(t *testing.T, options ...ServiceOption) Service {
+		return MakeGRPCClientEndpoints(newGRPCConn(t, NewInmemService(options...)))
+	})
+}
+
+func TestGRPCErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	client := pb.NewProfilesvcClient(newGRPCConn(t, NewInmemService()))
+	if _, err := client.PostProfile(ctx, &pb.PostProfileRequest{Profile: &pb.Profile{Id: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"GetProfile(unknown)", func() error {
+			_, err := client.GetProfile(ctx, &pb.GetProfileRequest{Id: "2"})
+			return err
+		}, codes.NotFound},
+		{"PostProfile(existing)", func() error {
+			_, err := client.PostProfile(ctx, &pb.PostProfileRequest{Profile: &pb.Profile{Id: "1"}})
+			return err
+		}, codes.AlreadyExists},
+		{"PutProfile(other ID)", func() error {
+			_, err := client.PutProfile(ctx, &pb.PutProfileRequest{Id: "1", Profile: &pb.Profile{Id: "2"}})
+			return err
+		}, codes.InvalidArgument},
+		{"DeleteProfile(stale version)", func() error {
+			_, err := client.DeleteProfile(ctx, &pb.DeleteProfileRequest{Id: "1", Version: 7})
+			return err
+		}, codes.Aborted},
+		{"PatchProfile(failed test)", func() error {
+			_, err := client.PatchProfile(ctx, &pb.PatchProfileRequest{
+				Id:       "1",
+				Type:     JSONPatchType,
+				Document: []byte(`[{"op":"test","path":"/name","value":"Gopher"}]`),
+			})
+			return err
+		}, codes.FailedPrecondition},
+		{"ListProfiles(bad cursor)", func() error {
+			_, err := client.ListProfiles(ctx, &pb.ListProfilesRequest{Cursor: "?"})
+			return err
+		}, codes.InvalidArgument},
+	} {
+		if want, have := tc.want, status.Code(tc.call()); want != have {
+			t.Errorf("%s: want %s, have %s", tc.name, want, have)
+		}
+	}
+
+	// Invalid fields are listed in a BadRequest detail.
+	_, err := client.PostAddress(ctx, &pb.PostAddressRequest{ProfileId: "1", Address: &pb.Address{Id: "home", Street: "Unter den Linden 1"}})
+	st := status.Convert(err)
+	if want, have := codes.InvalidArgument, st.Code(); want != have {
+		t.Fatalf("PostAddress(invalid): want %s, have %s", want, have)
+	}
+	var violations []string
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				violations = append(violations, v.Field+": "+v.Description)
+			}
+		}
+	}
+	if want := []string{"city: required", "country: required"}; !reflect.DeepEqual(want, violations) {
+		t.Errorf("PostAddress(invalid): want violations %q, have %q", want, violations)
+	}
+
+	// The Go kit client returns them as the service's errors.
+	c := MakeGRPCClientEndpoints(newGRPCConn(t, NewInmemService()))
+	err = c.PostAddress(ctx, "1", Address{ID: "home"})
+	if err != ErrNotFound {
+		t.Errorf("PostAddress(unknown profile): want %v, have %v", ErrNotFound, err)
+	}
+	c.PostProfile(ctx, Profile{ID: "1"})
+	err = c.PostAddress(ctx, "1", Address{ID: "home", Street: "Unter den Linden 1"})
+	want := &ValidationError{Fields: map[string]string{"city": "required", "country": "required"}}
+	if !reflect.DeepEqual(want, err) {
+		t.Errorf("PostAddress(invalid): want %v, have %v", want, err)
+	}
+}
+
+func TestGRPCTenantClaim(t *testing.T) {
+	key := []byte("secret")
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	}
+	s := NewInmemService()
+	client := pb.NewProfilesvcClient(newGRPCConn(t, s, GRPCTenantClaim(keyFunc, "tenant")))
+
+	// as calls client in the tenant of a token for tenant, with metadata that
+	// claims another one, which must be ignored.
+	as := func(tenant string) context.Context {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"tenant": tenant, "sub": "gopher"}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return metadata.AppendToOutgoingContext(context.Background(),
+			"authorization", "Bearer "+token,
+			tenantMetadataKey, "initech",
+		)
+	}
+	if _, err := client.PostProfile(as("acme"), &pb.PostProfileRequest{Profile: &pb.Profile{Id: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetProfile(as("acme"), &pb.GetProfileRequest{Id: "1"}); err != nil {
+		t.Errorf("GetProfile in the tenant of the token: %v", err)
+	}
+	for _, tenant := range []string{"initech", "globex"} {
+		_, err := client.GetProfile(as(tenant), &pb.GetProfileRequest{Id: "1"})
+		if want, have := codes.NotFound, status.Code(err); want != have {
+			t.Errorf("GetProfile with a token of %s: want %s, have %s", tenant, want, have)
+		}
+	}
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+	}{
+		{"no token", ""},
+		{"bad token", "Bearer garbage"},
+		{"not a bearer token", "Basic Z29waGVyOg=="},
+	} {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), tenantMetadataKey, "acme")
+		if tc.authorization != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tc.authorization)
+		}
+		_, err := client.GetProfile(ctx, &pb.GetProfileRequest{Id: "1"})
+		if want, have := codes.Unauthenticated, status.Code(err); want != have {
+			t.Errorf("%s: want %s, have %s", tc.name, want, have)
+		}
+	}
+
+	if _, err := s.GetProfile(WithTenant(context.Background(), "acme"), "1"); err != nil {
+		t.Errorf("GetProfile in the tenant of the claim: %v", err)
+	}
+	if _, err := s.GetProfile(WithTenant(context.Background(), "initech"), "1"); err != ErrNotFound {
+		t.Errorf("GetProfile in the tenant of the metadata: want %v, have %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,174 @@
+package profilesvc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// The limits of the page size of ListProfiles.
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+var (
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrInvalidListOptions = errors.New("invalid list options")
+)
+
+// ListOptions selects, orders and paginates the profiles returned by
+// ListProfiles.
+type ListOptions struct {
+	// Cursor is the NextCursor of the previous page, or empty for the first
+	// page. The other options must be the same as for the previous page.
+	Cursor string
+
+	// Limit is the maximum number of profiles in the page. Zero means
+	// DefaultListLimit, and it's capped at MaxListLimit.
+	Limit int
+
+	// NamePrefix, if not empty, selects the profiles whose name starts with
+	// it.
+	NamePrefix string
+
+	// Location, if not empty, selects the profiles with an address whose
+	// location contains it.
+	Location string
+
+	// Sort is the field the profiles are ordered by: "id", the default, or
+	// "name", with ties broken by ID. A "-" prefix reverses the order.
+	Sort string
+}
+
+// ProfilePage is a page of the profiles returned by ListProfiles.
+type ProfilePage struct {
+	Profiles []Profile `json:"profiles"`
+
+	// NextCursor is passed in ListOptions to get the next page. It's empty
+	// on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listCursor is the position after which the next page starts. Since it's
+// the position of the last profile of the previous page rather than an
+// offset, profiles that are created or deleted in between don't shift pages.
+type listCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+func (c listCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	var c listCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// listProfiles returns the page of profiles selected by opts, out of all of
+// the profiles of a service, in any order. Every Service implementation uses
+// it, so they paginate the same way.
+func listProfiles(profiles []Profile, opts ListOptions) (ProfilePage, error) {
+	field, desc := strings.TrimPrefix(opts.Sort, "-"), strings.HasPrefix(opts.Sort, "-")
+	if field == "" {
+		field = "id"
+	}
+	if field != "id" && field != "name" {
+		return ProfilePage{}, ErrInvalidListOptions
+	}
+	sortBy := field
+	if desc {
+		sortBy = "-" + field
+	}
+
+	limit := opts.Limit
+	switch {
+	case limit < 0:
+		return ProfilePage{}, ErrInvalidListOptions
+	case limit == 0:
+		limit = DefaultListLimit
+	case limit > MaxListLimit:
+		limit = MaxListLimit
+	}
+
+	key := func(p Profile) string {
+		if field == "name" {
+			return p.Name
+		}
+		return p.ID
+	}
+	// compare orders two positions in the requested order.
+	compare := func(keyA, idA, keyB, idB string) int {
+		c := strings.Compare(keyA, keyB)
+		if c == 0 {
+			c = strings.Compare(idA, idB)
+		}
+		if desc {
+			c = -c
+		}
+		return c
+	}
+
+	selected := make([]Profile, 0, len(profiles))
+	for _, p := range profiles {
+		if matches(p, opts) {
+			selected = append(selected, p)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return compare(key(selected[i]), selected[i].ID, key(selected[j]), selected[j].ID) < 0
+	})
+
+	start := 0
+	if opts.Cursor != "" {
+		c, err := decodeListCursor(opts.Cursor)
+		if err != nil {
+			return ProfilePage{}, err
+		}
+		if c.Sort != sortBy {
+			return ProfilePage{}, ErrInvalidCursor
+		}
+		start = sort.Search(len(selected), func(i int) bool {
+			return compare(key(selected[i]), selected[i].ID, c.Key, c.ID) > 0
+		})
+	}
+
+	end := start + limit
+	if end > len(selected) {
+		end = len(selected)
+	}
+	page := ProfilePage{Profiles: selected[start:end]}
+	if end < len(selected) {
+		last := selected[end-1]
+		page.NextCursor = listCursor{Sort: sortBy, Key: key(last), ID: last.ID}.encode()
+	}
+	return page, nil
+}
+
+func matches(p Profile, opts ListOptions) bool {
+	if !strings.HasPrefix(p.Name, opts.NamePrefix) {
+		return false
+	}
+	if opts.Location == "" {
+		return true
+	}
+	for _, a := range p.Addresses {
+		if strings.Contains(a.Location, opts.Location) {
+			return true
+		}
+	}
+	return false
+}
@@ -40,23 +40,30 @@ func (mw loggingMiddleware) GetProfile(ctx context.Context, id string) (p Profil
 
 func (mw loggingMiddleware) PutProfile(ctx context.Context, id string, p Profile) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PutProfile", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "PutProfile", "id", id, "version", p.Version, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.PutProfile(ctx, id, p)
 }
 
-func (mw loggingMiddleware) PatchProfile(ctx context.Context, id string, p Profile) (err error) {
+func (mw loggingMiddleware) PatchProfile(ctx context.Context, id string, patch Patch, version int) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PatchProfile", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "PatchProfile", "id", id, "type", patch.Type, "version", version, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.PatchProfile(ctx, id, p)
+	return mw.next.PatchProfile(ctx, id, patch, version)
 }
 
-func (mw loggingMiddleware) DeleteProfile(ctx context.Context, id string) (err error) {
+func (mw loggingMiddleware) DeleteProfile(ctx context.Context, id string, version int) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "DeleteProfile", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "DeleteProfile", "id", id, "version", version, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.DeleteProfile(ctx, id)
+	return mw.next.DeleteProfile(ctx, id, version)
+}
+
+func (mw loggingMiddleware) ListProfiles(ctx context.Context, opts ListOptions) (page ProfilePage, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListProfiles", "cursor", opts.Cursor, "limit", opts.Limit, "name", opts.NamePrefix, "location", opts.Location, "sort", opts.Sort, "count", len(page.Profiles), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListProfiles(ctx, opts)
 }
 
 func (mw loggingMiddleware) GetAddresses(ctx context.Context, profileID string) (addresses []Address, err error) {
@@ -80,6 +87,13 @@ func (mw loggingMiddleware) PostAddress(ctx context.Context, profileID string, a
 	return mw.next.PostAddress(ctx, profileID, a)
 }
 
+func (mw loggingMiddleware) UpdateAddress(ctx context.Context, profileID string, addressID string, a Address) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "UpdateAddress", "profileID", profileID, "addressID", addressID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.UpdateAddress(ctx, profileID, addressID, a)
+}
+
 func (mw loggingMiddleware) DeleteAddress(ctx context.Context, profileID string, addressID string) (err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log("method", "DeleteAddress", "profileID", profileID, "addressID", addressID, "took", time.Since(begin), "err", err)
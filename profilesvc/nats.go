@@ -0,0 +1,81 @@
+package profilesvc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultEventSubject is the NATS subject profile events are published on,
+// unless told otherwise.
+const DefaultEventSubject = "profilesvc.events"
+
+// NATSEventBus is an EventPublisher and EventSubscriber that sends events,
+// JSON encoded, through a NATS subject, so that they reach the subscribers of
+// every instance of the service, and consumers written in any language.
+type NATSEventBus struct {
+	nc      *nats.Conn
+	subject string
+}
+
+// NewNATSEventBus returns a NATSEventBus publishing on subject over nc.
+func NewNATSEventBus(nc *nats.Conn, subject string) *NATSEventBus {
+	return &NATSEventBus{nc: nc, subject: subject}
+}
+
+// Publish implements EventPublisher.
+func (b *NATSEventBus) Publish(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.nc.Publish(b.subject, data)
+}
+
+// Subscribe implements EventSubscriber. Like those of an InmemEventBus,
+// subscribers that fall too far behind miss events; so do subscribers of a
+// connection that is reconnecting.
+func (b *NATSEventBus) Subscribe(ctx context.Context) (<-chan Event, error) {
+	var (
+		c      = make(chan Event, eventBufferSize)
+		mtx    sync.Mutex
+		closed bool
+	)
+	sub, err := b.nc.Subscribe(b.subject, func(m *nats.Msg) {
+		var e Event
+		if err := json.Unmarshal(m.Data, &e); err != nil {
+			return // not one of ours
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case c <- e:
+		default: // the subscriber is too slow
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the server knows about the subscription before returning,
+	// so that it gets the events published from now on.
+	if err := b.nc.Flush(); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		sub.Unsubscribe()
+		// A message may still be in the handler, so the channel is closed
+		// under the lock.
+		mtx.Lock()
+		closed = true
+		close(c)
+		mtx.Unlock()
+	}()
+	return c, nil
+}
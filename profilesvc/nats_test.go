@@ -0,0 +1,103 @@
+package profilesvc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+
+	"github.com/go-kit/kit/log"
+)
+
+// newNATSConn runs an embedded NATS server, and returns a connection to it.
+// Both are closed when the test finishes.
+func newNATSConn(t *testing.T) *nats.Conn {
+	opts := natstest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func TestNATSEventBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nc := newNATSConn(t)
+
+	// Instances publishing on the same subject get each other's events;
+	// those on other subjects don't.
+	bus, other := NewNATSEventBus(nc, DefaultEventSubject), NewNATSEventBus(nc, "elsewhere.events")
+	events, err := bus.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elsewhere, err := other.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// So do consumers in any language, of the JSON on the subject.
+	raw := make(chan *nats.Msg, 2)
+	sub, err := nc.ChanSubscribe(DefaultEventSubject, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	s := EventingMiddleware(bus, log.NewNopLogger())(NewInmemService())
+	if err := s.PostProfile(WithTenant(ctx, "acme"), Profile{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteProfile(ctx, "2", 0); err != ErrNotFound {
+		t.Fatalf("DeleteProfile: want %v, have %v", ErrNotFound, err)
+	}
+
+	want := Event{Type: ProfileCreated, Tenant: "acme", ProfileID: "1"}
+	select {
+	case e := <-events:
+		e.Time = time.Time{}
+		if e != want {
+			t.Errorf("want %+v, have %+v", want, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want an event, have none")
+	}
+	select {
+	case m := <-raw:
+		var e Event
+		if err := json.Unmarshal(m.Data, &e); err != nil {
+			t.Fatal(err)
+		}
+		e.Time = time.Time{}
+		if e != want {
+			t.Errorf("%s: want %+v, have %+v", m.Subject, want, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("want an event on %s, have none", DefaultEventSubject)
+	}
+
+	// Failed changes aren't published.
+	nc.Flush()
+	select {
+	case e := <-events:
+		t.Errorf("want no more events, have %+v", e)
+	case e := <-elsewhere:
+		t.Errorf("want no events on another subject, have %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("subscription still open after its context is done")
+	}
+}
@@ -0,0 +1,443 @@
+package profilesvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The media types of the patches that PatchProfile applies.
+const (
+	MergePatchType = "application/merge-patch+json" // RFC 7396
+	JSONPatchType  = "application/json-patch+json"  // RFC 6902
+)
+
+var (
+	ErrUnsupportedPatch = errors.New("unsupported patch type")
+	ErrInvalidPatch     = errors.New("invalid patch")
+	ErrPatchConflict    = errors.New("patch does not apply to the profile")
+)
+
+// Patch describes changes to a profile, as a JSON Merge Patch or a JSON Patch
+// document. Either applies to the JSON representation of the profile, in
+// which every field is present, so that e.g. {"name": null} clears the name,
+// and [{"op": "add", "path": "/addresses/-", "value": {"id": "home"}}] adds an
+// address to the ones the profile has, if any. The ID and the version of the
+// profile can't be patched.
+type Patch struct {
+	// Type is MergePatchType or JSONPatchType.
+	Type string
+
+	// Document is the merge patch, or the array of JSON Patch operations.
+	Document json.RawMessage
+}
+
+// applyPatch returns the profile that patch turns p into. Every Service
+// implementation uses it, so they patch the same way.
+func applyPatch(p Profile, patch Patch) (Profile, error) {
+	doc, err := patchDocument(profileDocument(p), patch)
+	if err != nil {
+		return Profile{}, err
+	}
+	var patched Profile
+	if err := fromDocument(doc, &patched); err != nil {
+		return Profile{}, err
+	}
+	if len(patched.Addresses) == 0 {
+		patched.Addresses = nil // as PostProfile would store it
+	}
+	if patched.ID != p.ID {
+		return Profile{}, ErrInconsistentIDs
+	}
+	ids := map[string]bool{}
+	for _, a := range patched.Addresses {
+		if a.ID == "" {
+			continue // given one by validateProfile
+		}
+		if ids[a.ID] {
+			return Profile{}, ErrAlreadyExists
+		}
+		ids[a.ID] = true
+	}
+	patched.Version = p.Version
+	return patched, nil
+}
+
+// maxPatchAddressAttempts is how many times PatchAddress tries to patch an
+// address of a profile that other requests keep changing.
+const maxPatchAddressAttempts = 3
+
+// PatchAddress applies patch to an address of a profile, as it would to the
+// address in a Patch of the whole profile, e.g. {"city": "Berlin"} as a merge
+// patch. It's a PatchProfile replacing just that address, at the version of
+// the profile it was read at, so it works with any Service, and is retried
+// if the profile changes in the meantime. The ID of the address can't be
+// patched.
+func PatchAddress(ctx context.Context, s Service, profileID, addressID string, patch Patch) error {
+	for attempt := 1; ; attempt++ {
+		p, err := s.GetProfile(ctx, profileID)
+		if err != nil {
+			return err
+		}
+		i := -1
+		for j, a := range p.Addresses {
+			if a.ID == addressID {
+				i = j
+			}
+		}
+		if i < 0 {
+			return ErrNotFound
+		}
+		doc, err := patchDocument(addressDocument(p.Addresses[i]), patch)
+		if err != nil {
+			return err
+		}
+		var a Address
+		if err := fromDocument(doc, &a); err != nil {
+			return err
+		}
+		if a.ID != addressID {
+			return ErrInconsistentIDs
+		}
+		if a, err = validateAddress(a); err != nil {
+			return err // with the fields of the address, not addresses[i]
+		}
+		path := fmt.Sprintf("/addresses/%d", i)
+		value, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		ops, err := json.Marshal([]patchOperation{{Op: "replace", Path: &path, Value: value}})
+		if err != nil {
+			return err
+		}
+		err = s.PatchProfile(ctx, profileID, Patch{Type: JSONPatchType, Document: ops}, p.Version)
+		if err != ErrVersionConflict || attempt == maxPatchAddressAttempts {
+			return err
+		}
+	}
+}
+
+// patchDocument returns the document that patch turns doc into. It may
+// modify doc.
+func patchDocument(doc interface{}, patch Patch) (interface{}, error) {
+	switch patch.Type {
+	case MergePatchType:
+		var mergePatch interface{}
+		if err := json.Unmarshal(patch.Document, &mergePatch); err != nil {
+			return nil, ErrInvalidPatch
+		}
+		return applyMergePatch(doc, mergePatch), nil
+	case JSONPatchType:
+		var ops []patchOperation
+		if err := json.Unmarshal(patch.Document, &ops); err != nil {
+			return nil, ErrInvalidPatch
+		}
+		for _, op := range ops {
+			var err error
+			if doc, err = op.apply(doc); err != nil {
+				return nil, err
+			}
+		}
+		return doc, nil
+	default:
+		return nil, ErrUnsupportedPatch
+	}
+}
+
+// profileDocument returns the JSON representation of p that patches apply to.
+// Unlike the one encoding/json produces, it has every field, even empty ones.
+func profileDocument(p Profile) map[string]interface{} {
+	addresses := make([]interface{}, len(p.Addresses))
+	for i, a := range p.Addresses {
+		addresses[i] = addressDocument(a)
+	}
+	return map[string]interface{}{"id": p.ID, "name": p.Name, "addresses": addresses}
+}
+
+// addressDocument is the JSON representation of a within profileDocument.
+func addressDocument(a Address) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          a.ID,
+		"location":    a.Location,
+		"street":      a.Street,
+		"city":        a.City,
+		"postal_code": a.PostalCode,
+		"country":     a.Country,
+	}
+}
+
+// fromDocument decodes doc, a patched profileDocument or addressDocument,
+// into v. Patches that leave a document that isn't one are invalid.
+func fromDocument(doc interface{}, v interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return ErrInvalidPatch
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return ErrInvalidPatch
+	}
+	return nil
+}
+
+// applyMergePatch implements the MergePatch function of RFC 7396.
+func applyMergePatch(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = map[string]interface{}{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(doc, name)
+		} else {
+			doc[name] = applyMergePatch(doc[name], value)
+		}
+	}
+	return doc
+}
+
+// patchOperation is an operation of a JSON Patch document.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// apply returns the document that op turns doc into. It may modify doc.
+func (op patchOperation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, ErrInvalidPatch
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, ErrInvalidPatch
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, ErrInvalidPatch
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, ErrInvalidPatch
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = getValue(doc, from); err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			value = copyValue(value)
+			break
+		}
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, ErrInvalidPatch // can't move a value into itself
+		}
+		if doc, err = removeValue(doc, from); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addValue(doc, path, value)
+	case "remove":
+		return removeValue(doc, path)
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = removeValue(doc, path); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "test":
+		current, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrPatchConflict
+		}
+		return doc, nil
+	default:
+		return nil, ErrInvalidPatch
+	}
+}
+
+// parsePointer splits a JSON Pointer, as defined by RFC 6901, into its
+// unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if pointer[0] != '/' {
+		return nil, ErrInvalidPatch
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// arrayIndex parses a reference token to an element of an array of length n.
+// The "-" token, and n itself, refer to the position after the last element,
+// which is only allowed if end is true.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if token == "-" {
+		token = strconv.Itoa(n)
+	}
+	if token == "" || strings.Trim(token, "0123456789") != "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidPatch
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, ErrInvalidPatch
+	}
+	if i > n || (i == n && !end) {
+		return 0, ErrPatchConflict
+	}
+	return i, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, ErrPatchConflict
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, ErrPatchConflict
+		}
+	}
+	return doc, nil
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, ErrPatchConflict
+		}
+		child, err := addValue(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(node), len(rest) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		if node[i], err = addValue(node[i], rest, value); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, ErrPatchConflict
+	}
+}
+
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, ErrInvalidPatch // can't remove the whole profile
+	}
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, ErrPatchConflict
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, nil
+		}
+		child, err := removeValue(child, rest)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			return append(node[:i], node[i+1:]...), nil
+		}
+		if node[i], err = removeValue(node[i], rest); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, ErrPatchConflict
+	}
+}
+
+// copyValue returns a deep copy of a JSON value.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for name, member := range v {
+			m[name] = copyValue(member)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, element := range v {
+			a[i] = copyValue(element)
+		}
+		return a
+	default:
+		return v
+	}
+}
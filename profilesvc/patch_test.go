@@ -0,0 +1,216 @@
+package profilesvc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func mergePatch(doc string) Patch {
+	return Patch{Type: MergePatchType, Document: []byte(doc)}
+}
+
+func jsonPatch(doc string) Patch {
+	return Patch{Type: JSONPatchType, Document: []byte(doc)}
+}
+
+func TestApplyPatch(t *testing.T) {
+	home := Address{ID: "home", Location: "Berlin"}
+	work := Address{ID: "work", Location: "Hamburg"}
+	profile := Profile{ID: "1", Name: "Go Kit", Addresses: []Address{home, work}, Version: 3}
+
+	for _, tc := range []struct {
+		name  string
+		patch Patch
+		want  Profile
+		err   error
+	}{
+		// RFC 7396
+		{
+			name:  "merge: set name",
+			patch: mergePatch(`{"name":"Go kit"}`),
+			want:  Profile{ID: "1", Name: "Go kit", Addresses: []Address{home, work}, Version: 3},
+		},
+		{
+			name:  "merge: clear name",
+			patch: mergePatch(`{"name":null}`),
+			want:  Profile{ID: "1", Addresses: []Address{home, work}, Version: 3},
+		},
+		{
+			name:  "merge: replace addresses",
+			patch: mergePatch(`{"addresses":[{"id":"school"}]}`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{{ID: "school"}}, Version: 3},
+		},
+		{
+			name:  "merge: clear addresses",
+			patch: mergePatch(`{"addresses":null}`),
+			want:  Profile{ID: "1", Name: "Go Kit", Version: 3},
+		},
+		{
+			name:  "merge: empty",
+			patch: mergePatch(`{}`),
+			want:  profile,
+		},
+		{
+			name:  "merge: same ID",
+			patch: mergePatch(`{"id":"1"}`),
+			want:  profile,
+		},
+		{
+			name:  "merge: version is ignored",
+			patch: mergePatch(`{"version":7}`),
+			want:  profile,
+		},
+		{name: "merge: other ID", patch: mergePatch(`{"id":"2"}`), err: ErrInconsistentIDs},
+		{name: "merge: remove ID", patch: mergePatch(`{"id":null}`), err: ErrInconsistentIDs},
+		{name: "merge: unknown field", patch: mergePatch(`{"email":"gopher@example.com"}`), err: ErrInvalidPatch},
+		{name: "merge: wrong type", patch: mergePatch(`{"name":42}`), err: ErrInvalidPatch},
+		{name: "merge: not an object", patch: mergePatch(`"Go kit"`), err: ErrInvalidPatch},
+		{name: "merge: malformed", patch: mergePatch(`{"name":`), err: ErrInvalidPatch},
+		{name: "merge: duplicate addresses", patch: mergePatch(`{"addresses":[{"id":"a"},{"id":"a"}]}`), err: ErrAlreadyExists},
+
+		// RFC 6902
+		{
+			name:  "json: replace name",
+			patch: jsonPatch(`[{"op":"replace","path":"/name","value":"Go kit"}]`),
+			want:  Profile{ID: "1", Name: "Go kit", Addresses: []Address{home, work}, Version: 3},
+		},
+		{
+			name:  "json: remove name",
+			patch: jsonPatch(`[{"op":"remove","path":"/name"}]`),
+			want:  Profile{ID: "1", Addresses: []Address{home, work}, Version: 3},
+		},
+		{
+			name:  "json: append address",
+			patch: jsonPatch(`[{"op":"add","path":"/addresses/-","value":{"id":"school","location":"Bremen"}}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{home, work, {ID: "school", Location: "Bremen"}}, Version: 3},
+		},
+		{
+			name:  "json: insert address",
+			patch: jsonPatch(`[{"op":"add","path":"/addresses/0","value":{"id":"school"}}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{{ID: "school"}, home, work}, Version: 3},
+		},
+		{
+			name:  "json: remove address",
+			patch: jsonPatch(`[{"op":"remove","path":"/addresses/0"}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{work}, Version: 3},
+		},
+		{
+			name:  "json: replace address",
+			patch: jsonPatch(`[{"op":"replace","path":"/addresses/1","value":{"id":"office","location":"Munich"}}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{home, {ID: "office", Location: "Munich"}}, Version: 3},
+		},
+		{
+			name:  "json: replace location",
+			patch: jsonPatch(`[{"op":"replace","path":"/addresses/1/location","value":"Munich"}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{home, {ID: "work", Location: "Munich"}}, Version: 3},
+		},
+		{
+			name:  "json: move address",
+			patch: jsonPatch(`[{"op":"move","from":"/addresses/1","path":"/addresses/0"}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{work, home}, Version: 3},
+		},
+		{
+			name: "json: copy address",
+			patch: jsonPatch(`[
+				{"op":"copy","from":"/addresses/0","path":"/addresses/-"},
+				{"op":"replace","path":"/addresses/2/id","value":"second home"}
+			]`),
+			want: Profile{ID: "1", Name: "Go Kit", Addresses: []Address{home, work, {ID: "second home", Location: "Berlin"}}, Version: 3},
+		},
+		{
+			name:  "json: copy location to name",
+			patch: jsonPatch(`[{"op":"copy","from":"/addresses/1/location","path":"/name"}]`),
+			want:  Profile{ID: "1", Name: "Hamburg", Addresses: []Address{home, work}, Version: 3},
+		},
+		{
+			name:  "json: test passes",
+			patch: jsonPatch(`[{"op":"test","path":"/addresses/0/id","value":"home"},{"op":"remove","path":"/addresses/0"}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{work}, Version: 3},
+		},
+		{
+			name:  "json: escaped pointer",
+			patch: jsonPatch(`[{"op":"add","path":"/addresses/0/id","value":"a/b~c"},{"op":"test","path":"/addresses/0/id","value":"a/b~c"}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Addresses: []Address{{ID: "a/b~c", Location: "Berlin"}, work}, Version: 3},
+		},
+		{
+			name:  "json: remove all addresses",
+			patch: jsonPatch(`[{"op":"remove","path":"/addresses/1"},{"op":"remove","path":"/addresses/0"}]`),
+			want:  Profile{ID: "1", Name: "Go Kit", Version: 3},
+		},
+		{
+			name:  "json: no operations",
+			patch: jsonPatch(`[]`),
+			want:  profile,
+		},
+		{name: "json: test fails", patch: jsonPatch(`[{"op":"test","path":"/name","value":"Gopher"}]`), err: ErrPatchConflict},
+		{name: "json: test fails after changes", patch: jsonPatch(`[{"op":"remove","path":"/name"},{"op":"test","path":"/name","value":""}]`), err: ErrPatchConflict},
+		{name: "json: remove missing", patch: jsonPatch(`[{"op":"remove","path":"/addresses/2"}]`), err: ErrPatchConflict},
+		{name: "json: replace missing", patch: jsonPatch(`[{"op":"replace","path":"/email","value":"x"}]`), err: ErrPatchConflict},
+		{name: "json: add past the end", patch: jsonPatch(`[{"op":"add","path":"/addresses/3","value":{"id":"x"}}]`), err: ErrPatchConflict},
+		{name: "json: add to missing parent", patch: jsonPatch(`[{"op":"add","path":"/phones/0","value":"x"}]`), err: ErrPatchConflict},
+		{name: "json: move into itself", patch: jsonPatch(`[{"op":"move","from":"/addresses","path":"/addresses/0"}]`), err: ErrInvalidPatch},
+		{name: "json: leading zero index", patch: jsonPatch(`[{"op":"remove","path":"/addresses/01"}]`), err: ErrInvalidPatch},
+		{name: "json: signed index", patch: jsonPatch(`[{"op":"remove","path":"/addresses/+1"}]`), err: ErrInvalidPatch},
+		{name: "json: relative pointer", patch: jsonPatch(`[{"op":"remove","path":"name"}]`), err: ErrInvalidPatch},
+		{name: "json: remove the profile", patch: jsonPatch(`[{"op":"remove","path":""}]`), err: ErrInvalidPatch},
+		{name: "json: unknown op", patch: jsonPatch(`[{"op":"merge","path":"/name","value":"x"}]`), err: ErrInvalidPatch},
+		{name: "json: missing path", patch: jsonPatch(`[{"op":"remove"}]`), err: ErrInvalidPatch},
+		{name: "json: missing value", patch: jsonPatch(`[{"op":"add","path":"/name"}]`), err: ErrInvalidPatch},
+		{name: "json: missing from", patch: jsonPatch(`[{"op":"copy","path":"/name"}]`), err: ErrInvalidPatch},
+		{name: "json: null name", patch: jsonPatch(`[{"op":"replace","path":"/name","value":null}]`), want: Profile{ID: "1", Addresses: []Address{home, work}, Version: 3}},
+		{name: "json: not an array", patch: jsonPatch(`{"op":"remove","path":"/name"}`), err: ErrInvalidPatch},
+		{name: "json: change ID", patch: jsonPatch(`[{"op":"replace","path":"/id","value":"2"}]`), err: ErrInconsistentIDs},
+		{name: "json: unknown field", patch: jsonPatch(`[{"op":"add","path":"/email","value":"x"}]`), err: ErrInvalidPatch},
+		{name: "json: duplicate addresses", patch: jsonPatch(`[{"op":"copy","from":"/addresses/0","path":"/addresses/-"}]`), err: ErrAlreadyExists},
+
+		{name: "unsupported type", patch: Patch{Type: "application/json", Document: []byte(`{}`)}, err: ErrUnsupportedPatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := profile
+			p.Addresses = append([]Address(nil), profile.Addresses...)
+			have, err := applyPatch(p, tc.patch)
+			if err != tc.err {
+				t.Fatalf("want error %v, have %v", tc.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(tc.want, have) {
+				t.Errorf("want %+v, have %+v", tc.want, have)
+			}
+			if !reflect.DeepEqual(profile.Addresses, p.Addresses) {
+				t.Errorf("patch modified the original profile: %+v", p)
+			}
+		})
+	}
+}
+
+// racingService changes a profile before its first PatchProfile, as another
+// request could between the GetProfile and PatchProfile of PatchAddress.
+type racingService struct {
+	Service
+	raced bool
+}
+
+func (s *racingService) PatchProfile(ctx context.Context, id string, patch Patch, version int) error {
+	if !s.raced {
+		s.raced = true
+		if err := s.Service.PostAddress(ctx, id, Address{ID: "home", Location: "Berlin"}); err != nil {
+			return err
+		}
+	}
+	return s.Service.PatchProfile(ctx, id, patch, version)
+}
+
+func TestPatchAddressRetries(t *testing.T) {
+	ctx := context.Background()
+	s := &racingService{Service: NewInmemService()}
+	if err := s.PostProfile(ctx, Profile{ID: "1", Addresses: []Address{{ID: "work", Location: "Hamburg"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := PatchAddress(ctx, s, "1", "work", mergePatch(`{"location":"Bremen"}`)); err != nil {
+		t.Fatalf("PatchAddress: %v", err)
+	}
+	want := []Address{{ID: "work", Location: "Bremen"}, {ID: "home", Location: "Berlin"}}
+	if have, err := s.GetAddresses(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v (%v)", want, have, err)
+	}
+}
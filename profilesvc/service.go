@@ -11,60 +11,143 @@ type Service interface {
 	PostProfile(ctx context.Context, p Profile) error
 	GetProfile(ctx context.Context, id string) (Profile, error)
 	PutProfile(ctx context.Context, id string, p Profile) error
-	PatchProfile(ctx context.Context, id string, p Profile) error
-	DeleteProfile(ctx context.Context, id string) error
+	PatchProfile(ctx context.Context, id string, patch Patch, version int) error
+	DeleteProfile(ctx context.Context, id string, version int) error
+	ListProfiles(ctx context.Context, opts ListOptions) (ProfilePage, error)
 	GetAddresses(ctx context.Context, profileID string) ([]Address, error)
 	GetAddress(ctx context.Context, profileID string, addressID string) (Address, error)
 	PostAddress(ctx context.Context, profileID string, a Address) error
+	UpdateAddress(ctx context.Context, profileID string, addressID string, a Address) error
 	DeleteAddress(ctx context.Context, profileID string, addressID string) error
 }
 
 // Profile represents a single user profile.
-// ID should be globally unique.
+// ID should be unique within the tenant of the profile.
 type Profile struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name,omitempty"`
 	Addresses []Address `json:"addresses,omitempty"`
+
+	// Version is set by the service, starting at 1 when the profile is
+	// created and incremented whenever it changes, addresses included. A
+	// non-zero Version passed to PutProfile, and likewise the version passed
+	// to PatchProfile and DeleteProfile, must be the current one, so that
+	// concurrent updates don't overwrite each other.
+	Version int `json:"version,omitempty"`
 }
 
 // Address is a field of a user profile.
-// ID should be unique within the profile (at a minimum).
+// ID should be unique within the profile (at a minimum). The service generates
+// one for addresses that are added without it.
 type Address struct {
 	ID       string `json:"id"`
 	Location string `json:"location,omitempty"`
+
+	// The structured fields are optional, but if any is set, City and
+	// Country, an ISO 3166-1 alpha-2 code, are required. The service fills
+	// in Location from them if it's empty, for clients that only know the
+	// free text Location.
+	Street     string `json:"street,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
 }
 
 var (
 	ErrInconsistentIDs = errors.New("inconsistent IDs")
 	ErrAlreadyExists   = errors.New("already exists")
 	ErrNotFound        = errors.New("not found")
+	ErrVersionConflict = errors.New("version conflict")
 )
 
+// checkVersion returns ErrVersionConflict if version, the one a caller
+// expects a profile to be at, isn't zero or current, the one it's actually at.
+// The current version of a profile that doesn't exist is zero.
+func checkVersion(current, version int) error {
+	if version != 0 && version != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+type writtenVersionContextKey struct{}
+
+// withWrittenVersion returns a copy of ctx in which PutProfile sets *version
+// to the version it wrote the profile at, so that middlewares can tell from
+// the write itself whether it created the profile: then it's 1. Services
+// that don't store profiles themselves, like the clients, leave it alone.
+func withWrittenVersion(ctx context.Context, version *int) context.Context {
+	return context.WithValue(ctx, writtenVersionContextKey{}, version)
+}
+
+// setWrittenVersion sets the version of withWrittenVersion, if ctx has one.
+func setWrittenVersion(ctx context.Context, version int) {
+	if v, ok := ctx.Value(writtenVersionContextKey{}).(*int); ok {
+		*v = version
+	}
+}
+
 type inmemService struct {
-	mtx sync.RWMutex
-	m   map[string]Profile
+	mtx     sync.RWMutex
+	m       map[string]map[string]Profile // by tenant, then ID
+	options serviceOptions
 }
 
-func NewInmemService() Service {
+func NewInmemService(options ...ServiceOption) Service {
 	return &inmemService{
-		m: map[string]Profile{},
+		m:       map[string]map[string]Profile{},
+		options: newServiceOptions(options),
 	}
 }
 
+// profiles returns the profiles of the tenant of ctx. It must only be called
+// with the write lock held, since it creates the map of a new tenant; readers
+// use s.m directly, where the map of a tenant without profiles is nil.
+func (s *inmemService) profiles(ctx context.Context) map[string]Profile {
+	tenant := TenantFromContext(ctx)
+	m, ok := s.m[tenant]
+	if !ok {
+		m = map[string]Profile{}
+		s.m[tenant] = m
+	}
+	return m
+}
+
+// checkQuota returns ErrQuotaExceeded if a change from usage b to usage a
+// takes the tenant of profiles over its quota.
+func (s *inmemService) checkQuota(ctx context.Context, profiles map[string]Profile, b, a usage) error {
+	return s.options.checkQuota(ctx, b, a, func() (usage, error) {
+		var u usage
+		for _, p := range profiles {
+			u.add(usageOf(p))
+		}
+		return u, nil
+	})
+}
+
 func (s *inmemService) PostProfile(ctx context.Context, p Profile) error {
+	p, err := validateProfile(p)
+	if err != nil {
+		return err
+	}
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	if _, ok := s.m[p.ID]; ok {
+	profiles := s.profiles(ctx)
+	if _, ok := profiles[p.ID]; ok {
 		return ErrAlreadyExists // POST = create, don't overwrite
 	}
-	s.m[p.ID] = p
+	if err := s.checkQuota(ctx, profiles, usage{}, usageOf(p)); err != nil {
+		return err
+	}
+	p.Version = 1
+	profiles[p.ID] = p
 	return nil
 }
 
 func (s *inmemService) GetProfile(ctx context.Context, id string) (Profile, error) {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
-	p, ok := s.m[id]
+	p, ok := s.m[TenantFromContext(ctx)][id]
 	if !ok {
 		return Profile{}, ErrNotFound
 	}
@@ -75,55 +158,87 @@ func (s *inmemService) PutProfile(ctx context.Context, id string, p Profile) err
 	if id != p.ID {
 		return ErrInconsistentIDs
 	}
+	p, err := validateProfile(p)
+	if err != nil {
+		return err
+	}
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	s.m[id] = p // PUT = create or update
+	profiles := s.profiles(ctx)
+	existing, ok := profiles[id]
+	if err := checkVersion(existing.Version, p.Version); err != nil {
+		return err
+	}
+	var before usage
+	if ok {
+		before = usageOf(existing)
+	}
+	if err := s.checkQuota(ctx, profiles, before, usageOf(p)); err != nil {
+		return err
+	}
+	p.Version = existing.Version + 1
+	profiles[id] = p // PUT = create or update
+	setWrittenVersion(ctx, p.Version)
 	return nil
 }
 
-func (s *inmemService) PatchProfile(ctx context.Context, id string, p Profile) error {
-	if p.ID != "" && id != p.ID {
-		return ErrInconsistentIDs
-	}
-
+func (s *inmemService) PatchProfile(ctx context.Context, id string, patch Patch, version int) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	existing, ok := s.m[id]
+	profiles := s.profiles(ctx)
+	existing, ok := profiles[id]
 	if !ok {
 		return ErrNotFound // PATCH = update existing, don't create
 	}
-
-	// We assume that it's not possible to PATCH the ID, and that it's not
-	// possible to PATCH any field to its zero value. That is, the zero value
-	// means not specified. The way around this is to use e.g. Name *string in
-	// the Profile definition. But since this is just a demonstrative example,
-	// I'm leaving that out.
-
-	if p.Name != "" {
-		existing.Name = p.Name
+	if err := checkVersion(existing.Version, version); err != nil {
+		return err
+	}
+	p, err := applyPatch(existing, patch)
+	if err != nil {
+		return err
 	}
-	if len(p.Addresses) > 0 {
-		existing.Addresses = p.Addresses
+	if p, err = validateProfile(p); err != nil {
+		return err
 	}
-	s.m[id] = existing
+	if err := s.checkQuota(ctx, profiles, usageOf(existing), usageOf(p)); err != nil {
+		return err
+	}
+	p.Version++
+	profiles[id] = p
 	return nil
 }
 
-func (s *inmemService) DeleteProfile(ctx context.Context, id string) error {
+func (s *inmemService) DeleteProfile(ctx context.Context, id string, version int) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	if _, ok := s.m[id]; !ok {
+	profiles := s.profiles(ctx)
+	p, ok := profiles[id]
+	if !ok {
 		return ErrNotFound
 	}
-	delete(s.m, id)
+	if err := checkVersion(p.Version, version); err != nil {
+		return err
+	}
+	delete(profiles, id)
 	return nil
 }
 
+func (s *inmemService) ListProfiles(ctx context.Context, opts ListOptions) (ProfilePage, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	m := s.m[TenantFromContext(ctx)]
+	profiles := make([]Profile, 0, len(m))
+	for _, p := range m {
+		profiles = append(profiles, p)
+	}
+	return listProfiles(profiles, opts)
+}
+
 func (s *inmemService) GetAddresses(ctx context.Context, profileID string) ([]Address, error) {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
-	p, ok := s.m[profileID]
+	p, ok := s.m[TenantFromContext(ctx)][profileID]
 	if !ok {
 		return []Address{}, ErrNotFound
 	}
@@ -133,7 +248,7 @@ func (s *inmemService) GetAddresses(ctx context.Context, profileID string) ([]Ad
 func (s *inmemService) GetAddress(ctx context.Context, profileID string, addressID string) (Address, error) {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
-	p, ok := s.m[profileID]
+	p, ok := s.m[TenantFromContext(ctx)][profileID]
 	if !ok {
 		return Address{}, ErrNotFound
 	}
@@ -146,9 +261,14 @@ func (s *inmemService) GetAddress(ctx context.Context, profileID string, address
 }
 
 func (s *inmemService) PostAddress(ctx context.Context, profileID string, a Address) error {
+	a, err := validateAddress(a)
+	if err != nil {
+		return err
+	}
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	p, ok := s.m[profileID]
+	profiles := s.profiles(ctx)
+	p, ok := profiles[profileID]
 	if !ok {
 		return ErrNotFound
 	}
@@ -157,15 +277,53 @@ func (s *inmemService) PostAddress(ctx context.Context, profileID string, a Addr
 			return ErrAlreadyExists
 		}
 	}
+	if err := s.checkQuota(ctx, profiles, usage{}, usage{addresses: 1}); err != nil {
+		return err
+	}
 	p.Addresses = append(p.Addresses, a)
-	s.m[profileID] = p
+	p.Version++
+	profiles[profileID] = p
 	return nil
 }
 
+func (s *inmemService) UpdateAddress(ctx context.Context, profileID string, addressID string, a Address) error {
+	if a.ID == "" {
+		a.ID = addressID
+	} else if a.ID != addressID {
+		return ErrInconsistentIDs
+	}
+	a, err := validateAddress(a)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	profiles := s.profiles(ctx)
+	p, ok := profiles[profileID]
+	if !ok {
+		return ErrNotFound
+	}
+	// Copy the addresses, since the stored ones may be shared with callers
+	// of GetProfile and GetAddresses.
+	addresses := make([]Address, len(p.Addresses))
+	copy(addresses, p.Addresses)
+	for i, address := range addresses {
+		if address.ID == addressID {
+			addresses[i] = a // PUT = update existing, don't create
+			p.Addresses = addresses
+			p.Version++
+			profiles[profileID] = p
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
 func (s *inmemService) DeleteAddress(ctx context.Context, profileID string, addressID string) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	p, ok := s.m[profileID]
+	profiles := s.profiles(ctx)
+	p, ok := profiles[profileID]
 	if !ok {
 		return ErrNotFound
 	}
@@ -180,6 +338,7 @@ func (s *inmemService) DeleteAddress(ctx context.Context, profileID string, addr
 		return ErrNotFound
 	}
 	p.Addresses = newAddresses
-	s.m[profileID] = p
+	p.Version++
+	profiles[profileID] = p
 	return nil
 }
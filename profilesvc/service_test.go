@@ -0,0 +1,475 @@
+package profilesvc
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The conformance suite runs against every Service implementation, so they
+// all keep the semantics of the in-memory one.
+
+func TestInmemService(t *testing.T) {
+	testService(t, func(t *testing.T, options ...ServiceOption) Service { return NewInmemService(options...) })
+}
+
+func TestBoltService(t *testing.T) {
+	testService(t, func(t *testing.T, options ...ServiceOption) Service {
+		s, err := NewBoltService(filepath.Join(t.TempDir(), "profiles.db"), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestWrittenVersion(t *testing.T) {
+	boltService, err := NewBoltService(filepath.Join(t.TempDir(), "profiles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer boltService.Close()
+	for name, s := range map[string]Service{"inmem": NewInmemService(), "bolt": boltService} {
+		ctx := context.Background()
+		var written int
+		if err := s.PutProfile(withWrittenVersion(ctx, &written), "1", Profile{ID: "1"}); err != nil || written != 1 {
+			t.Errorf("%s: PutProfile(create): want version 1 written, have %d (%v)", name, written, err)
+		}
+		if err := s.PutProfile(withWrittenVersion(ctx, &written), "1", Profile{ID: "1", Name: "Go kit"}); err != nil || written != 2 {
+			t.Errorf("%s: PutProfile(update): want version 2 written, have %d (%v)", name, written, err)
+		}
+	}
+}
+
+func TestBoltServicePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.db")
+	ctx := context.Background()
+
+	s, err := NewBoltService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PostAddress(ctx, "1", Address{ID: "home", Location: "Berlin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the file again goes through the migrations, which must leave
+	// the data of a file that's already up to date alone.
+	s, err = NewBoltService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	want := Profile{ID: "1", Name: "Go Kit", Addresses: []Address{{ID: "home", Location: "Berlin"}}, Version: 2}
+	if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile: want %+v, have %+v (%v)", want, have, err)
+	}
+}
+
+func TestBoltServiceMigratesToTenants(t *testing.T) {
+	// A file at schema version 1, from before tenants.
+	path := filepath.Join(t.TempDir(), "profiles.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(versionKey, []byte("1")); err != nil {
+			return err
+		}
+		if err := migrations[0](tx); err != nil {
+			return err
+		}
+		return tx.Bucket(profilesBucket).Put([]byte("1"), []byte(`{"id":"1","name":"Go Kit","version":3}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Its profiles now belong to the default tenant.
+	s, err := NewBoltService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	want := Profile{ID: "1", Name: "Go Kit", Version: 3}
+	if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile: want %+v, have %+v (%v)", want, have, err)
+	}
+	if _, err := s.GetProfile(WithTenant(ctx, "acme"), "1"); err != ErrNotFound {
+		t.Errorf("GetProfile(other tenant): want %v, have %v", ErrNotFound, err)
+	}
+}
+
+func testService(t *testing.T, newService func(t *testing.T, options ...ServiceOption) Service) {
+	ctx := context.Background()
+
+	t.Run("Profiles", func(t *testing.T) {
+		s := newService(t)
+		p := Profile{ID: "1", Name: "Go Kit"}
+		if err := s.PostProfile(ctx, p); err != nil {
+			t.Fatalf("PostProfile: %v", err)
+		}
+		if err := s.PostProfile(ctx, p); err != ErrAlreadyExists {
+			t.Errorf("PostProfile again: want %v, have %v", ErrAlreadyExists, err)
+		}
+		p.Version = 1
+		if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(p, have) {
+			t.Errorf("GetProfile: want %+v, have %+v (%v)", p, have, err)
+		}
+		if _, err := s.GetProfile(ctx, "2"); err != ErrNotFound {
+			t.Errorf("GetProfile(unknown): want %v, have %v", ErrNotFound, err)
+		}
+
+		if err := s.PutProfile(ctx, "2", Profile{ID: "3"}); err != ErrInconsistentIDs {
+			t.Errorf("PutProfile(inconsistent): want %v, have %v", ErrInconsistentIDs, err)
+		}
+		p = Profile{ID: "1", Name: "Go kit"}
+		if err := s.PutProfile(ctx, "1", p); err != nil {
+			t.Errorf("PutProfile(update): %v", err)
+		}
+		p.Version = 2
+		if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(p, have) {
+			t.Errorf("GetProfile after PutProfile: want %+v, have %+v (%v)", p, have, err)
+		}
+		if err := s.PutProfile(ctx, "2", Profile{ID: "2"}); err != nil {
+			t.Errorf("PutProfile(create): %v", err)
+		}
+
+		if err := s.PatchProfile(ctx, "3", mergePatch(`{"name":"x"}`), 0); err != ErrNotFound {
+			t.Errorf("PatchProfile(unknown): want %v, have %v", ErrNotFound, err)
+		}
+		if err := s.PatchProfile(ctx, "1", mergePatch(`{"id":"2"}`), 0); err != ErrInconsistentIDs {
+			t.Errorf("PatchProfile(inconsistent): want %v, have %v", ErrInconsistentIDs, err)
+		}
+		addresses := []Address{{ID: "home", Location: "Berlin"}}
+		if err := s.PatchProfile(ctx, "1", mergePatch(`{"addresses":[{"id":"home","location":"Berlin"}]}`), 0); err != nil {
+			t.Errorf("PatchProfile: %v", err)
+		}
+		p = Profile{ID: "1", Name: "Go kit", Addresses: addresses, Version: 3}
+		if have, err := s.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(p, have) {
+			t.Errorf("GetProfile after PatchProfile: want %+v, have %+v (%v)", p, have, err)
+		}
+
+		if err := s.DeleteProfile(ctx, "1", 0); err != nil {
+			t.Errorf("DeleteProfile: %v", err)
+		}
+		if err := s.DeleteProfile(ctx, "1", 0); err != ErrNotFound {
+			t.Errorf("DeleteProfile again: want %v, have %v", ErrNotFound, err)
+		}
+		if _, err := s.GetProfile(ctx, "1"); err != ErrNotFound {
+			t.Errorf("GetProfile after DeleteProfile: want %v, have %v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		s := newService(t)
+		if err := s.PutProfile(ctx, "1", Profile{ID: "1", Version: 1}); err != ErrVersionConflict {
+			t.Errorf("PutProfile(create, version 1): want %v, have %v", ErrVersionConflict, err)
+		}
+		if err := s.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit", Version: 7}); err != nil {
+			t.Fatalf("PostProfile: %v", err)
+		}
+
+		// Every change bumps the version, and only callers that have seen
+		// the current one get to make the next.
+		for i, change := range []func(version int) error{
+			func(version int) error {
+				return s.PutProfile(ctx, "1", Profile{ID: "1", Name: "Go kit", Version: version})
+			},
+			func(version int) error { return s.PatchProfile(ctx, "1", mergePatch(`{"name":"Gokit"}`), version) },
+			func(version int) error { return s.PostAddress(ctx, "1", Address{ID: "home"}) },
+			func(version int) error { return s.DeleteAddress(ctx, "1", "home") },
+		} {
+			current := i + 1
+			if have, err := s.GetProfile(ctx, "1"); err != nil || have.Version != current {
+				t.Fatalf("change %d: want version %d, have %d (%v)", i, current, have.Version, err)
+			}
+			if i < 2 {
+				if err := change(current + 1); err != ErrVersionConflict {
+					t.Errorf("change %d with a stale version: want %v, have %v", i, ErrVersionConflict, err)
+				}
+			}
+			if err := change(current); err != nil {
+				t.Errorf("change %d: %v", i, err)
+			}
+		}
+
+		if err := s.PatchProfile(ctx, "1", mergePatch(`{}`), 0); err != nil {
+			t.Errorf("PatchProfile(unconditional): %v", err)
+		}
+		if err := s.DeleteProfile(ctx, "1", 5); err != ErrVersionConflict {
+			t.Errorf("DeleteProfile(stale version): want %v, have %v", ErrVersionConflict, err)
+		}
+		if err := s.DeleteProfile(ctx, "1", 6); err != nil {
+			t.Errorf("DeleteProfile: %v", err)
+		}
+	})
+
+	t.Run("Addresses", func(t *testing.T) {
+		s := newService(t)
+		if err := s.PostAddress(ctx, "1", Address{ID: "home"}); err != ErrNotFound {
+			t.Errorf("PostAddress(unknown profile): want %v, have %v", ErrNotFound, err)
+		}
+		if _, err := s.GetAddresses(ctx, "1"); err != ErrNotFound {
+			t.Errorf("GetAddresses(unknown profile): want %v, have %v", ErrNotFound, err)
+		}
+		if err := s.PostProfile(ctx, Profile{ID: "1"}); err != nil {
+			t.Fatalf("PostProfile: %v", err)
+		}
+
+		home := Address{ID: "home", Location: "Berlin"}
+		work := Address{ID: "work", Location: "Hamburg"}
+		for _, a := range []Address{home, work} {
+			if err := s.PostAddress(ctx, "1", a); err != nil {
+				t.Errorf("PostAddress(%s): %v", a.ID, err)
+			}
+		}
+		if err := s.PostAddress(ctx, "1", home); err != ErrAlreadyExists {
+			t.Errorf("PostAddress again: want %v, have %v", ErrAlreadyExists, err)
+		}
+		want := []Address{home, work}
+		if have, err := s.GetAddresses(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+			t.Errorf("GetAddresses: want %+v, have %+v (%v)", want, have, err)
+		}
+		if have, err := s.GetAddress(ctx, "1", "work"); err != nil || have != work {
+			t.Errorf("GetAddress: want %+v, have %+v (%v)", work, have, err)
+		}
+		if _, err := s.GetAddress(ctx, "1", "school"); err != ErrNotFound {
+			t.Errorf("GetAddress(unknown): want %v, have %v", ErrNotFound, err)
+		}
+		if _, err := s.GetAddress(ctx, "2", "home"); err != ErrNotFound {
+			t.Errorf("GetAddress(unknown profile): want %v, have %v", ErrNotFound, err)
+		}
+
+		got, err := s.GetAddresses(ctx, "1")
+		if err != nil {
+			t.Fatalf("GetAddresses: %v", err)
+		}
+		office := Address{ID: "work", Street: "Hauptstraße 1", City: "Hamburg", PostalCode: "20095", Country: "de"}
+		if err := s.UpdateAddress(ctx, "1", "work", office); err != nil {
+			t.Errorf("UpdateAddress: %v", err)
+		}
+		if !reflect.DeepEqual([]Address{home, work}, got) {
+			t.Errorf("UpdateAddress modified the addresses returned before: %+v", got)
+		}
+		work = Address{ID: "work", Location: "Hauptstraße 1, 20095 Hamburg, DE", Street: "Hauptstraße 1", City: "Hamburg", PostalCode: "20095", Country: "DE"}
+		if have, err := s.GetAddress(ctx, "1", "work"); err != nil || have != work {
+			t.Errorf("GetAddress after UpdateAddress: want %+v, have %+v (%v)", work, have, err)
+		}
+		if err := s.UpdateAddress(ctx, "1", "work", Address{ID: "home"}); err != ErrInconsistentIDs {
+			t.Errorf("UpdateAddress(inconsistent): want %v, have %v", ErrInconsistentIDs, err)
+		}
+		if err := s.UpdateAddress(ctx, "1", "school", Address{ID: "school"}); err != ErrNotFound {
+			t.Errorf("UpdateAddress(unknown): want %v, have %v", ErrNotFound, err)
+		}
+		if err := s.UpdateAddress(ctx, "2", "work", Address{ID: "work"}); err != ErrNotFound {
+			t.Errorf("UpdateAddress(unknown profile): want %v, have %v", ErrNotFound, err)
+		}
+		if err := s.UpdateAddress(ctx, "1", "work", Address{ID: "work", City: "Hamburg"}); err == nil {
+			t.Errorf("UpdateAddress(invalid): want an error, have none")
+		}
+		if err := s.PostAddress(ctx, "1", Address{ID: "school", Country: "XX"}); err == nil {
+			t.Errorf("PostAddress(invalid): want an error, have none")
+		}
+
+		if err := s.DeleteAddress(ctx, "1", "home"); err != nil {
+			t.Errorf("DeleteAddress: %v", err)
+		}
+		if err := s.DeleteAddress(ctx, "1", "home"); err != ErrNotFound {
+			t.Errorf("DeleteAddress again: want %v, have %v", ErrNotFound, err)
+		}
+		if err := s.DeleteAddress(ctx, "2", "home"); err != ErrNotFound {
+			t.Errorf("DeleteAddress(unknown profile): want %v, have %v", ErrNotFound, err)
+		}
+		want = []Address{work}
+		if have, err := s.GetAddresses(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+			t.Errorf("GetAddresses after DeleteAddress: want %+v, have %+v (%v)", want, have, err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		s := newService(t)
+		profiles := []Profile{
+			{ID: "1", Name: "Gopher", Addresses: []Address{{ID: "home", Location: "Berlin"}}},
+			{ID: "2", Name: "Go Kit", Addresses: []Address{{ID: "work", Location: "Hamburg"}}},
+			{ID: "3", Name: "Alice", Addresses: []Address{{ID: "home", Location: "Berlin Mitte"}}},
+			{ID: "4", Name: "Gopher"},
+			{ID: "5", Name: "Bob"},
+		}
+		for _, p := range profiles {
+			if err := s.PostProfile(ctx, p); err != nil {
+				t.Fatalf("PostProfile(%s): %v", p.ID, err)
+			}
+		}
+
+		// list collects the IDs of every page, two profiles at a time.
+		list := func(opts ListOptions) (ids []string, pages int) {
+			opts.Limit = 2
+			for {
+				page, err := s.ListProfiles(ctx, opts)
+				if err != nil {
+					t.Fatalf("ListProfiles(%+v): %v", opts, err)
+				}
+				pages++
+				for _, p := range page.Profiles {
+					ids = append(ids, p.ID)
+				}
+				if page.NextCursor == "" {
+					return ids, pages
+				}
+				opts.Cursor = page.NextCursor
+			}
+		}
+		for _, tc := range []struct {
+			opts  ListOptions
+			want  []string
+			pages int
+		}{
+			{ListOptions{}, []string{"1", "2", "3", "4", "5"}, 3},
+			{ListOptions{Sort: "-id"}, []string{"5", "4", "3", "2", "1"}, 3},
+			{ListOptions{Sort: "name"}, []string{"3", "5", "2", "1", "4"}, 3},
+			{ListOptions{Sort: "-name"}, []string{"4", "1", "2", "5", "3"}, 3},
+			{ListOptions{NamePrefix: "Go"}, []string{"1", "2", "4"}, 2},
+			{ListOptions{Location: "Berlin"}, []string{"1", "3"}, 1},
+			{ListOptions{NamePrefix: "Go", Location: "Berlin"}, []string{"1"}, 1},
+			{ListOptions{NamePrefix: "Nobody"}, nil, 1},
+		} {
+			if ids, pages := list(tc.opts); !reflect.DeepEqual(tc.want, ids) || tc.pages != pages {
+				t.Errorf("ListProfiles(%+v): want %v in %d pages, have %v in %d", tc.opts, tc.want, tc.pages, ids, pages)
+			}
+		}
+
+		// Cursors point past the last profile of a page, so deleting it
+		// doesn't make the next page skip or repeat profiles.
+		page, err := s.ListProfiles(ctx, ListOptions{Limit: 2})
+		if err != nil {
+			t.Fatalf("ListProfiles: %v", err)
+		}
+		if err := s.DeleteProfile(ctx, "2", 0); err != nil {
+			t.Fatalf("DeleteProfile: %v", err)
+		}
+		page, err = s.ListProfiles(ctx, ListOptions{Limit: 2, Cursor: page.NextCursor})
+		if err != nil || len(page.Profiles) != 2 || page.Profiles[0].ID != "3" {
+			t.Errorf("ListProfiles after DeleteProfile: want profiles 3 and 4, have %+v (%v)", page.Profiles, err)
+		}
+
+		if _, err := s.ListProfiles(ctx, ListOptions{Sort: "name", Cursor: page.NextCursor}); err != ErrInvalidCursor {
+			t.Errorf("ListProfiles(cursor of another sort): want %v, have %v", ErrInvalidCursor, err)
+		}
+		if _, err := s.ListProfiles(ctx, ListOptions{Cursor: "!"}); err != ErrInvalidCursor {
+			t.Errorf("ListProfiles(malformed cursor): want %v, have %v", ErrInvalidCursor, err)
+		}
+		for _, opts := range []ListOptions{{Sort: "location"}, {Limit: -1}} {
+			if _, err := s.ListProfiles(ctx, opts); err != ErrInvalidListOptions {
+				t.Errorf("ListProfiles(%+v): want %v, have %v", opts, ErrInvalidListOptions, err)
+			}
+		}
+	})
+	t.Run("Tenants", func(t *testing.T) {
+		s := newService(t)
+		acme, initech := WithTenant(ctx, "acme"), WithTenant(ctx, "initech")
+		if err := s.PostProfile(acme, Profile{ID: "1", Name: "Acme"}); err != nil {
+			t.Fatalf("PostProfile: %v", err)
+		}
+		if err := s.PostAddress(acme, "1", Address{ID: "home", Location: "Berlin"}); err != nil {
+			t.Fatalf("PostAddress: %v", err)
+		}
+
+		// The profiles of other tenants aren't there, whatever the call.
+		for _, c := range []struct {
+			name string
+			err  error
+		}{
+			{"GetProfile", func() error { _, err := s.GetProfile(initech, "1"); return err }()},
+			{"PatchProfile", s.PatchProfile(initech, "1", mergePatch(`{"name":"Initech"}`), 0)},
+			{"DeleteProfile", s.DeleteProfile(initech, "1", 0)},
+			{"GetAddresses", func() error { _, err := s.GetAddresses(initech, "1"); return err }()},
+			{"GetAddress", func() error { _, err := s.GetAddress(initech, "1", "home"); return err }()},
+			{"PostAddress", s.PostAddress(initech, "1", Address{ID: "work"})},
+			{"UpdateAddress", s.UpdateAddress(initech, "1", "home", Address{ID: "home"})},
+			{"DeleteAddress", s.DeleteAddress(initech, "1", "home")},
+			{"GetProfile(default tenant)", func() error { _, err := s.GetProfile(ctx, "1"); return err }()},
+		} {
+			if c.err != ErrNotFound {
+				t.Errorf("%s of another tenant: want %v, have %v", c.name, ErrNotFound, c.err)
+			}
+		}
+		if page, err := s.ListProfiles(initech, ListOptions{}); err != nil || len(page.Profiles) != 0 {
+			t.Errorf("ListProfiles of another tenant: want none, have %+v (%v)", page.Profiles, err)
+		}
+
+		// IDs only need to be unique within a tenant.
+		if err := s.PostProfile(initech, Profile{ID: "1", Name: "Initech"}); err != nil {
+			t.Fatalf("PostProfile(same ID, other tenant): %v", err)
+		}
+		if err := s.PutProfile(initech, "1", Profile{ID: "1", Name: "Initrode", Version: 1}); err != nil {
+			t.Fatalf("PutProfile(same ID, other tenant): %v", err)
+		}
+		want := Profile{ID: "1", Name: "Acme", Addresses: []Address{{ID: "home", Location: "Berlin"}}, Version: 2}
+		if have, err := s.GetProfile(acme, "1"); err != nil || !reflect.DeepEqual(want, have) {
+			t.Errorf("GetProfile after the other tenant's changes: want %+v, have %+v (%v)", want, have, err)
+		}
+		if err := s.DeleteProfile(initech, "1", 0); err != nil {
+			t.Fatalf("DeleteProfile: %v", err)
+		}
+		if _, err := s.GetProfile(acme, "1"); err != nil {
+			t.Errorf("GetProfile after the other tenant's DeleteProfile: %v", err)
+		}
+	})
+
+	t.Run("Quotas", func(t *testing.T) {
+		s := newService(t, TenantQuotas(func(tenant string) Quota {
+			if tenant == "acme" {
+				return Quota{MaxProfiles: 2, MaxAddresses: 2}
+			}
+			return Quota{}
+		}))
+		acme, initech := WithTenant(ctx, "acme"), WithTenant(ctx, "initech")
+		two := []Address{{ID: "home"}, {ID: "work"}}
+
+		steps := []struct {
+			name string
+			do   func() error
+			want error
+		}{
+			{"PostProfile", func() error { return s.PostProfile(acme, Profile{ID: "1", Addresses: two[:1]}) }, nil},
+			{"PutProfile(create)", func() error { return s.PutProfile(acme, "2", Profile{ID: "2"}) }, nil},
+			{"PostProfile(over profiles)", func() error { return s.PostProfile(acme, Profile{ID: "3"}) }, ErrQuotaExceeded},
+			{"PutProfile(create, over profiles)", func() error { return s.PutProfile(acme, "3", Profile{ID: "3"}) }, ErrQuotaExceeded},
+			{"PutProfile(update)", func() error { return s.PutProfile(acme, "2", Profile{ID: "2", Addresses: two[1:]}) }, nil},
+			{"PostAddress(over addresses)", func() error { return s.PostAddress(acme, "2", Address{ID: "home"}) }, ErrQuotaExceeded},
+			{"PatchProfile(over addresses)", func() error {
+				return s.PatchProfile(acme, "1", mergePatch(`{"addresses":[{"id":"home"},{"id":"work"}]}`), 0)
+			}, ErrQuotaExceeded},
+			{"PutProfile(update, over addresses)", func() error { return s.PutProfile(acme, "2", Profile{ID: "2", Addresses: two}) }, ErrQuotaExceeded},
+			{"DeleteAddress", func() error { return s.DeleteAddress(acme, "2", "work") }, nil},
+			{"PostAddress", func() error { return s.PostAddress(acme, "2", Address{ID: "home"}) }, nil},
+			{"DeleteProfile", func() error { return s.DeleteProfile(acme, "1", 0) }, nil},
+			{"PostProfile(after DeleteProfile)", func() error { return s.PostProfile(acme, Profile{ID: "3", Addresses: two[1:]}) }, nil},
+			{"PostProfile(other tenant)", func() error { return s.PostProfile(initech, Profile{ID: "4", Addresses: two}) }, nil},
+			{"PostProfile(other tenant, no quota)", func() error { return s.PostProfile(initech, Profile{ID: "5", Addresses: two}) }, nil},
+		}
+		for _, step := range steps {
+			if err := step.do(); err != step.want {
+				t.Errorf("%s: want %v, have %v", step.name, step.want, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package profilesvc
+
+import (
+	"context"
+	"errors"
+)
+
+// Profiles belong to tenants, the customers we host profiles for. Every
+// Service method works on the profiles of the tenant in its context, so IDs
+// only need to be unique within a tenant, and the profiles of other tenants
+// are, as far as a caller can tell, not there.
+
+// DefaultTenant is the tenant of calls whose context doesn't name one, so
+// that single-tenant deployments don't need to.
+const DefaultTenant = "default"
+
+// ErrQuotaExceeded is returned for changes that would take a tenant over its
+// Quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx in which Service methods work on the
+// profiles of tenant. Server transports put the tenant of a request there.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx, or DefaultTenant.
+func TenantFromContext(ctx context.Context) string {
+	if tenant, _ := ctx.Value(tenantContextKey{}).(string); tenant != "" {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// Quota limits the number of profiles, and of addresses across all of its
+// profiles, that a tenant may have. Zero means no limit.
+type Quota struct {
+	MaxProfiles  int
+	MaxAddresses int
+}
+
+// ServiceOption sets an optional parameter of NewInmemService and
+// NewBoltService.
+type ServiceOption func(*serviceOptions)
+
+type serviceOptions struct {
+	quotas func(tenant string) Quota
+}
+
+// TenantQuotas sets the quota of each tenant. By default, there are none.
+func TenantQuotas(quotas func(tenant string) Quota) ServiceOption {
+	return func(o *serviceOptions) { o.quotas = quotas }
+}
+
+func newServiceOptions(options []ServiceOption) serviceOptions {
+	o := serviceOptions{
+		quotas: func(string) Quota { return Quota{} },
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// usage counts the profiles and addresses of a tenant, or the ones a change
+// adds.
+type usage struct {
+	profiles, addresses int
+}
+
+func usageOf(p Profile) usage {
+	return usage{profiles: 1, addresses: len(p.Addresses)}
+}
+
+func (u *usage) add(v usage) {
+	u.profiles += v.profiles
+	u.addresses += v.addresses
+}
+
+// checkQuota returns ErrQuotaExceeded if a change from usage b to usage a
+// takes the tenant of ctx over its quota. The current usage of the tenant is
+// only counted if needed. Changes that don't add profiles or addresses pass,
+// so that tenants over a quota that was lowered can still clean up.
+func (o serviceOptions) checkQuota(ctx context.Context, b, a usage, current func() (usage, error)) error {
+	q := o.quotas(TenantFromContext(ctx))
+	var (
+		checkProfiles  = q.MaxProfiles > 0 && a.profiles > b.profiles
+		checkAddresses = q.MaxAddresses > 0 && a.addresses > b.addresses
+	)
+	if !checkProfiles && !checkAddresses {
+		return nil
+	}
+	u, err := current()
+	if err != nil {
+		return err
+	}
+	if checkProfiles && u.profiles-b.profiles+a.profiles > q.MaxProfiles {
+		return ErrQuotaExceeded
+	}
+	if checkAddresses && u.addresses-b.addresses+a.addresses > q.MaxAddresses {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
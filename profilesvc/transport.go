@@ -1,16 +1,22 @@
 package profilesvc
 
-// The profilesvc is just over HTTP, so we just have a single transport.go.
+// The HTTP transport of profilesvc. The gRPC one is in grpc.go.
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 
 	"github.com/go-kit/kit/log"
@@ -22,11 +28,104 @@ var (
 	// ErrBadRouting is returned when an expected path variable is missing.
 	// It always indicates programmer error.
 	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+
+	// ErrUnauthorized is returned for requests without a valid token, when
+	// their tenant is taken from one; see TenantClaim and GRPCTenantClaim.
+	ErrUnauthorized = errors.New("unauthorized")
 )
 
-// MakeHTTPHandler mounts all of the service endpoints into an http.Handler.
-// Useful in a profilesvc server.
-func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
+// TenantHeader is the HTTP header that carries the tenant of a request,
+// unless TenantClaim is used. Requests without it are of the DefaultTenant.
+const TenantHeader = "X-Tenant-ID"
+
+// ActorHeader is the HTTP header that names who makes a request, to whom the
+// audit trail attributes its changes, unless TenantClaim is used.
+const ActorHeader = "X-Actor-ID"
+
+// HTTPOption sets an optional parameter of MakeHTTPHandler.
+type HTTPOption func(*httpOptions)
+
+type httpOptions struct {
+	callerOf func(r *http.Request) (tenant, actor string, err error)
+	history  History
+}
+
+// TenantClaim takes the tenant of a request from a claim of the JWT in its
+// Authorization header, a Bearer token verified with keyFunc, rather than
+// from TenantHeader, which clients could set to anything; likewise, the actor
+// is the subject of the token rather than ActorHeader. keyFunc should check
+// the signing method of the token. Requests without a valid token, or whose
+// token doesn't have the claim, fail with 401 Unauthorized.
+func TenantClaim(keyFunc jwt.Keyfunc, claim string) HTTPOption {
+	callerOf := tokenCaller(keyFunc, claim)
+	return func(o *httpOptions) {
+		o.callerOf = func(r *http.Request) (string, string, error) {
+			return callerOf(r.Header.Get("Authorization"))
+		}
+	}
+}
+
+// tokenCaller returns a func that finds the tenant and actor of a request in
+// the claim and subject of the JWT of its authorization, "Bearer <token>".
+// TenantClaim and GRPCTenantClaim share it.
+func tokenCaller(keyFunc jwt.Keyfunc, claim string) func(authorization string) (tenant, actor string, err error) {
+	return func(auth string) (string, string, error) {
+		if len(auth) < len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+			return "", "", ErrUnauthorized
+		}
+		token, err := jwt.Parse(auth[len("Bearer "):], keyFunc)
+		if err != nil || !token.Valid {
+			return "", "", ErrUnauthorized
+		}
+		claims, _ := token.Claims.(jwt.MapClaims)
+		tenant, _ := claims[claim].(string)
+		if tenant == "" {
+			return "", "", ErrUnauthorized
+		}
+		actor, _ := claims["sub"].(string)
+		return tenant, actor, nil
+	}
+}
+
+// WithHistory mounts the audit trail of h as well: GET /profiles/:id/history
+// returns it, and POST /profiles/:id/restore, with the seq of the record to
+// restore as {"seq":N}, restores a profile from it.
+func WithHistory(h History) HTTPOption {
+	return func(o *httpOptions) { o.history = h }
+}
+
+// MakeHTTPHandler mounts all of the service endpoints into an http.Handler,
+// plus a Server-Sent Events stream of the events of the passed subscriber, if
+// it isn't nil. Useful in a profilesvc server. Every request is served in the
+// context of its tenant and actor, from TenantHeader and ActorHeader or, with
+// TenantClaim, its token.
+func MakeHTTPHandler(s Service, events EventSubscriber, logger log.Logger, options ...HTTPOption) http.Handler {
+	o := httpOptions{
+		callerOf: func(r *http.Request) (string, string, error) {
+			return r.Header.Get(TenantHeader), r.Header.Get(ActorHeader), nil
+		},
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return withCaller(o.callerOf, makeRouter(s, events, o.history, logger))
+}
+
+// withCaller serves the requests whose tenant and actor callerOf finds with
+// next, in the context of those.
+func withCaller(callerOf func(r *http.Request) (tenant, actor string, err error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, actor, err := callerOf(r)
+		if err != nil {
+			encodeError(r.Context(), err, w)
+			return
+		}
+		ctx := WithActor(WithTenant(r.Context(), tenant), actor)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func makeRouter(s Service, events EventSubscriber, history History, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
 	e := MakeServerEndpoints(s)
 	options := []httptransport.ServerOption{
@@ -35,14 +134,24 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 	}
 
 	// POST    /profiles/                          adds another profile
+	// GET     /profiles/                          lists a page of profiles, see ListOptions
+	// GET     /profiles/events                    streams profile events as Server-Sent Events
 	// GET     /profiles/:id                       retrieves the given profile by id
 	// PUT     /profiles/:id                       post updated profile information about the profile
-	// PATCH   /profiles/:id                       partial updated profile information
+	// PATCH   /profiles/:id                       apply a JSON Merge Patch or JSON Patch, see Patch
 	// DELETE  /profiles/:id                       remove the given profile
 	// GET     /profiles/:id/addresses/            retrieve addresses associated with the profile
 	// GET     /profiles/:id/addresses/:addressID  retrieve a particular profile address
-	// POST    /profiles/:id/addresses/            add a new address
+	// POST    /profiles/:id/addresses/            add a new address, returning its id, and its URL as Location
+	// PUT     /profiles/:id/addresses/:addressID  update an address
+	// PATCH   /profiles/:id/addresses/:addressID  apply a JSON Merge Patch or JSON Patch to an address, see PatchAddress
 	// DELETE  /profiles/:id/addresses/:addressID  remove an address
+	// GET     /profiles/:id/history               retrieve the audit trail of the profile, see WithHistory
+	// POST    /profiles/:id/restore               restore a version of the profile from its audit trail
+	//
+	// GET /profiles/:id returns the version of the profile as its ETag, and
+	// PUT, PATCH and DELETE /profiles/:id honor it in If-Match, answering 412
+	// Precondition Failed if the profile is at another version.
 
 	r.Methods("POST").Path("/profiles/").Handler(httptransport.NewServer(
 		e.PostProfileEndpoint,
@@ -50,10 +159,20 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+	r.Methods("GET").Path("/profiles/").Handler(httptransport.NewServer(
+		e.ListProfilesEndpoint,
+		decodeListProfilesRequest,
+		encodeResponse,
+		options...,
+	))
+	if events != nil {
+		// Registered before /profiles/{id}, which would match it too.
+		r.Methods("GET").Path("/profiles/events").Handler(eventStreamHandler(events, logger))
+	}
 	r.Methods("GET").Path("/profiles/{id}").Handler(httptransport.NewServer(
 		e.GetProfileEndpoint,
 		decodeGetProfileRequest,
-		encodeResponse,
+		encodeGetProfileResponse,
 		options...,
 	))
 	r.Methods("PUT").Path("/profiles/{id}").Handler(httptransport.NewServer(
@@ -89,6 +208,18 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 	r.Methods("POST").Path("/profiles/{id}/addresses/").Handler(httptransport.NewServer(
 		e.PostAddressEndpoint,
 		decodePostAddressRequest,
+		encodePostAddressResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/profiles/{id}/addresses/{addressID}").Handler(httptransport.NewServer(
+		e.UpdateAddressEndpoint,
+		decodeUpdateAddressRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PATCH").Path("/profiles/{id}/addresses/{addressID}").Handler(httptransport.NewServer(
+		MakePatchAddressEndpoint(s),
+		decodePatchAddressRequest,
 		encodeResponse,
 		options...,
 	))
@@ -98,6 +229,20 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+	if history != nil {
+		r.Methods("GET").Path("/profiles/{id}/history").Handler(httptransport.NewServer(
+			MakeProfileHistoryEndpoint(history),
+			decodeProfileHistoryRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path("/profiles/{id}/restore").Handler(httptransport.NewServer(
+			MakeRestoreProfileEndpoint(history),
+			decodeRestoreProfileRequest,
+			encodeResponse,
+			options...,
+		))
+	}
 	return r
 }
 
@@ -109,6 +254,22 @@ func decodePostProfileRequest(_ context.Context, r *http.Request) (request inter
 	return req, nil
 }
 
+func decodeListProfilesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	opts := ListOptions{
+		Cursor:     q.Get("cursor"),
+		NamePrefix: q.Get("name"),
+		Location:   q.Get("location"),
+		Sort:       q.Get("sort"),
+	}
+	if limit := q.Get("limit"); limit != "" {
+		if opts.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, ErrInvalidListOptions
+		}
+	}
+	return listProfilesRequest{Options: opts}, nil
+}
+
 func decodeGetProfileRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -128,6 +289,9 @@ func decodePutProfileRequest(_ context.Context, r *http.Request) (request interf
 	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
 		return nil, err
 	}
+	if profile.Version, err = versionFromIfMatch(r); err != nil {
+		return nil, err
+	}
 	return putProfileRequest{
 		ID:      id,
 		Profile: profile,
@@ -140,23 +304,79 @@ func decodePatchProfileRequest(_ context.Context, r *http.Request) (request inte
 	if !ok {
 		return nil, ErrBadRouting
 	}
-	var profile Profile
-	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+	patch, err := decodePatch(r)
+	if err != nil {
+		return nil, err
+	}
+	version, err := versionFromIfMatch(r)
+	if err != nil {
 		return nil, err
 	}
 	return patchProfileRequest{
 		ID:      id,
-		Profile: profile,
+		Patch:   patch,
+		Version: version,
 	}, nil
 }
 
+// decodePatch returns the patch in the body of a PATCH request, of the type
+// given by its Content-Type.
+func decodePatch(r *http.Request) (Patch, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return Patch{}, ErrUnsupportedPatch
+	}
+	var patch Patch
+	switch mediaType {
+	case MergePatchType, "application/json":
+		// Plain JSON is taken as a merge patch, which is what PATCH
+		// requests with a partial profile always meant.
+		patch.Type = MergePatchType
+	case JSONPatchType:
+		patch.Type = JSONPatchType
+	default:
+		return Patch{}, ErrUnsupportedPatch
+	}
+	if patch.Document, err = ioutil.ReadAll(r.Body); err != nil {
+		return Patch{}, err
+	}
+	return patch, nil
+}
+
 func decodeDeleteProfileRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
 	if !ok {
 		return nil, ErrBadRouting
 	}
-	return deleteProfileRequest{ID: id}, nil
+	version, err := versionFromIfMatch(r)
+	if err != nil {
+		return nil, err
+	}
+	return deleteProfileRequest{ID: id, Version: version}, nil
+}
+
+// versionFromIfMatch returns the version of a profile that the If-Match header
+// of a request expects, or zero if there is none. An ETag that isn't one of
+// ours can't match any version, so it's a conflict.
+func versionFromIfMatch(r *http.Request) (int, error) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+	if len(ifMatch) < 2 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, ErrVersionConflict
+	}
+	version, err := strconv.Atoi(ifMatch[1 : len(ifMatch)-1])
+	if err != nil || version <= 0 {
+		return 0, ErrVersionConflict
+	}
+	return version, nil
+}
+
+// etag returns the ETag of a version of a profile.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
 }
 
 func decodeGetAddressesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
@@ -200,6 +420,48 @@ func decodePostAddressRequest(_ context.Context, r *http.Request) (request inter
 	}, nil
 }
 
+func decodeUpdateAddressRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	addressID, ok := vars["addressID"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var address Address
+	if err := json.NewDecoder(r.Body).Decode(&address); err != nil {
+		return nil, err
+	}
+	return updateAddressRequest{
+		ProfileID: id,
+		AddressID: addressID,
+		Address:   address,
+	}, nil
+}
+
+func decodePatchAddressRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	addressID, ok := vars["addressID"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	patch, err := decodePatch(r)
+	if err != nil {
+		return nil, err
+	}
+	return patchAddressRequest{
+		ProfileID: id,
+		AddressID: addressID,
+		Patch:     patch,
+	}, nil
+}
+
 func decodeDeleteAddressRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -216,10 +478,55 @@ func decodeDeleteAddressRequest(_ context.Context, r *http.Request) (request int
 	}, nil
 }
 
+func decodeProfileHistoryRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return profileHistoryRequest{ID: id}, nil
+}
+
+func decodeRestoreProfileRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	req := restoreProfileRequest{ID: id}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
 func encodePostProfileRequest(ctx context.Context, req *http.Request, request interface{}) error {
 	// r.Methods("POST").Path("/profiles/")
+	r := request.(postProfileRequest)
 	req.URL.Path = "/profiles/"
-	return encodeRequest(ctx, req, request)
+	return encodeRequest(ctx, req, r.Profile)
+}
+
+func encodeListProfilesRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	// r.Methods("GET").Path("/profiles/")
+	r := request.(listProfilesRequest)
+	q := url.Values{}
+	for key, value := range map[string]string{
+		"cursor":   r.Options.Cursor,
+		"name":     r.Options.NamePrefix,
+		"location": r.Options.Location,
+		"sort":     r.Options.Sort,
+	} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	if r.Options.Limit != 0 {
+		q.Set("limit", strconv.Itoa(r.Options.Limit))
+	}
+	req.URL.Path = "/profiles/"
+	req.URL.RawQuery = q.Encode()
+	return nil
 }
 
 func encodeGetProfileRequest(ctx context.Context, req *http.Request, request interface{}) error {
@@ -235,7 +542,8 @@ func encodePutProfileRequest(ctx context.Context, req *http.Request, request int
 	r := request.(putProfileRequest)
 	profileID := url.QueryEscape(r.ID)
 	req.URL.Path = "/profiles/" + profileID
-	return encodeRequest(ctx, req, request)
+	setIfMatch(req, r.Profile.Version)
+	return encodeRequest(ctx, req, r.Profile)
 }
 
 func encodePatchProfileRequest(ctx context.Context, req *http.Request, request interface{}) error {
@@ -243,7 +551,10 @@ func encodePatchProfileRequest(ctx context.Context, req *http.Request, request i
 	r := request.(patchProfileRequest)
 	profileID := url.QueryEscape(r.ID)
 	req.URL.Path = "/profiles/" + profileID
-	return encodeRequest(ctx, req, request)
+	setIfMatch(req, r.Version)
+	req.Header.Set("Content-Type", r.Patch.Type)
+	req.Body = ioutil.NopCloser(bytes.NewReader(r.Patch.Document))
+	return nil
 }
 
 func encodeDeleteProfileRequest(ctx context.Context, req *http.Request, request interface{}) error {
@@ -251,9 +562,18 @@ func encodeDeleteProfileRequest(ctx context.Context, req *http.Request, request
 	r := request.(deleteProfileRequest)
 	profileID := url.QueryEscape(r.ID)
 	req.URL.Path = "/profiles/" + profileID
+	setIfMatch(req, r.Version)
 	return encodeRequest(ctx, req, request)
 }
 
+// setIfMatch makes a request conditional on a profile being at version, unless
+// it's zero.
+func setIfMatch(req *http.Request, version int) {
+	if version != 0 {
+		req.Header.Set("If-Match", etag(version))
+	}
+}
+
 func encodeGetAddressesRequest(ctx context.Context, req *http.Request, request interface{}) error {
 	// r.Methods("GET").Path("/profiles/{id}/addresses/")
 	r := request.(getAddressesRequest)
@@ -276,7 +596,16 @@ func encodePostAddressRequest(ctx context.Context, req *http.Request, request in
 	r := request.(postAddressRequest)
 	profileID := url.QueryEscape(r.ProfileID)
 	req.URL.Path = "/profiles/" + profileID + "/addresses/"
-	return encodeRequest(ctx, req, request)
+	return encodeRequest(ctx, req, r.Address)
+}
+
+func encodeUpdateAddressRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	// r.Methods("PUT").Path("/profiles/{id}/addresses/{addressID}")
+	r := request.(updateAddressRequest)
+	profileID := url.QueryEscape(r.ProfileID)
+	addressID := url.QueryEscape(r.AddressID)
+	req.URL.Path = "/profiles/" + profileID + "/addresses/" + addressID
+	return encodeRequest(ctx, req, r.Address)
 }
 
 func encodeDeleteAddressRequest(ctx context.Context, req *http.Request, request interface{}) error {
@@ -290,54 +619,99 @@ func encodeDeleteAddressRequest(ctx context.Context, req *http.Request, request
 
 func decodePostProfileResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response postProfileResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeListProfilesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response listProfilesResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodeGetProfileResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response getProfileResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodePutProfileResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response putProfileResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodePatchProfileResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response patchProfileResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodeDeleteProfileResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response deleteProfileResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodeGetAddressesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response getAddressesResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodeGetAddressResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response getAddressResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodePostAddressResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response postAddressResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeUpdateAddressResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response updateAddressResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func decodeDeleteAddressResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response deleteAddressResponse
+	if response.Err = errorFromResponse(resp); response.Err != nil {
+		return response, nil
+	}
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
@@ -365,6 +739,24 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 	return json.NewEncoder(w).Encode(response)
 }
 
+// encodeGetProfileResponse is encodeResponse, plus the version of the profile
+// as an ETag.
+func encodeGetProfileResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if r := response.(getProfileResponse); r.Err == nil && r.Profile.Version != 0 {
+		w.Header().Set("ETag", etag(r.Profile.Version))
+	}
+	return encodeResponse(ctx, w, response)
+}
+
+// encodePostAddressResponse is encodeResponse, plus the URL of the added
+// address as its Location.
+func encodePostAddressResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if r := response.(postAddressResponse); r.Err == nil && r.ID != "" {
+		w.Header().Set("Location", "/profiles/"+url.PathEscape(r.ProfileID)+"/addresses/"+url.PathEscape(r.ID))
+	}
+	return encodeResponse(ctx, w, response)
+}
+
 // encodeRequest likewise JSON-encodes the request to the HTTP request body.
 // Don't use it directly as a transport/http.Client EncodeRequestFunc:
 // profilesvc endpoints require mutating the HTTP method and request path.
@@ -382,20 +774,127 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
 	}
+	body := map[string]interface{}{
+		"error": err.Error(),
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		body["fields"] = verr.Fields
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(codeFrom(err))
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": err.Error(),
-	})
+	json.NewEncoder(w).Encode(body)
 }
 
 func codeFrom(err error) int {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return http.StatusBadRequest
+	}
 	switch err {
 	case ErrNotFound:
 		return http.StatusNotFound
-	case ErrAlreadyExists, ErrInconsistentIDs:
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidCursor, ErrInvalidListOptions, ErrInvalidPatch:
 		return http.StatusBadRequest
+	case ErrPatchConflict:
+		return http.StatusConflict
+	case ErrUnsupportedPatch:
+		return http.StatusUnsupportedMediaType
+	case ErrUnauthorized:
+		return http.StatusUnauthorized
+	case ErrQuotaExceeded:
+		return http.StatusTooManyRequests
+	case ErrVersionConflict:
+		return http.StatusPreconditionFailed
 	default:
 		return http.StatusInternalServerError
 	}
 }
+
+// errorFromResponse returns the business-logic error that encodeError wrote to
+// a response, or nil if it's a successful one. The errors of this package come
+// back as themselves, so clients can compare them like the service's callers.
+func errorFromResponse(resp *http.Response) error {
+	if resp.StatusCode < 400 {
+		return nil
+	}
+	var body struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+		return errors.New(resp.Status)
+	}
+	if len(body.Fields) > 0 {
+		return &ValidationError{Fields: body.Fields}
+	}
+	return errorFromMessage(body.Error)
+}
+
+// errorFromMessage returns the error of this package with the passed message,
+// or a new error with it.
+func errorFromMessage(msg string) error {
+	for _, err := range []error{
+		ErrInconsistentIDs, ErrAlreadyExists, ErrNotFound, ErrVersionConflict,
+		ErrInvalidCursor, ErrInvalidListOptions, ErrUnsupportedPatch,
+		ErrInvalidPatch, ErrPatchConflict, ErrQuotaExceeded, ErrUnauthorized,
+		ErrBadRouting,
+	} {
+		if msg == err.Error() {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+// eventKeepAlive is how often the event stream sends a comment when there are
+// no events, so that proxies don't time it out.
+const eventKeepAlive = 15 * time.Second
+
+// eventStreamHandler returns a handler streaming the events of the passed
+// subscriber as Server-Sent Events, from the time of the request on, and of
+// the tenant of the request only. Each event has its type as the event name,
+// and its JSON encoding as the data.
+func eventStreamHandler(events EventSubscriber, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		c, err := events.Subscribe(r.Context())
+		if err != nil {
+			logger.Log("err", err)
+			encodeError(r.Context(), err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		tenant := TenantFromContext(r.Context())
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case e, ok := <-c:
+				if !ok {
+					return
+				}
+				if e.Tenant != tenant {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					logger.Log("err", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			flusher.Flush()
+		}
+	})
+}
@@ -0,0 +1,354 @@
+package profilesvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestHTTPVersions(t *testing.T) {
+	srv := httptest.NewServer(MakeHTTPHandler(NewInmemService(), nil, log.NewNopLogger()))
+	defer srv.Close()
+	client, err := MakeClientEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := client.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit"}); err != nil {
+		t.Fatalf("PostProfile: %v", err)
+	}
+	resp, err := http.Get(srv.URL + "/profiles/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := `"1"`, resp.Header.Get("ETag"); want != have {
+		t.Errorf("ETag: want %s, have %s", want, have)
+	}
+
+	// The client sends the version of a profile as If-Match, and gets the
+	// service's errors back as themselves.
+	p, err := client.GetProfile(ctx, "1")
+	if err != nil || p.Version != 1 {
+		t.Fatalf("GetProfile: want version 1, have %+v (%v)", p, err)
+	}
+	p.Name = "Go kit"
+	if err := client.PutProfile(ctx, "1", p); err != nil {
+		t.Errorf("PutProfile: %v", err)
+	}
+	if err := client.PutProfile(ctx, "1", p); err != ErrVersionConflict {
+		t.Errorf("PutProfile(stale version): want %v, have %v", ErrVersionConflict, err)
+	}
+	if err := client.PatchProfile(ctx, "1", Patch{Type: MergePatchType, Document: []byte(`{"name":"Gokit"}`)}, 1); err != ErrVersionConflict {
+		t.Errorf("PatchProfile(stale version): want %v, have %v", ErrVersionConflict, err)
+	}
+	if err := client.DeleteProfile(ctx, "1", 1); err != ErrVersionConflict {
+		t.Errorf("DeleteProfile(stale version): want %v, have %v", ErrVersionConflict, err)
+	}
+	if _, err := client.GetProfile(ctx, "2"); err != ErrNotFound {
+		t.Errorf("GetProfile(unknown): want %v, have %v", ErrNotFound, err)
+	}
+
+	for _, tc := range []struct {
+		ifMatch string
+		want    int
+	}{
+		{`"1"`, http.StatusPreconditionFailed},
+		{`W/"2"`, http.StatusPreconditionFailed},
+		{`"2"`, http.StatusOK},
+	} {
+		req, _ := http.NewRequest("DELETE", srv.URL+"/profiles/1", nil)
+		req.Header.Set("If-Match", tc.ifMatch)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("DELETE with If-Match %s: want %d, have %d", tc.ifMatch, tc.want, resp.StatusCode)
+		}
+	}
+	if _, err := client.GetProfile(ctx, "1"); err != ErrNotFound {
+		t.Errorf("GetProfile after DELETE: want %v, have %v", ErrNotFound, err)
+	}
+}
+
+func TestHTTPPatch(t *testing.T) {
+	srv := httptest.NewServer(MakeHTTPHandler(NewInmemService(), nil, log.NewNopLogger()))
+	defer srv.Close()
+	client, err := MakeClientEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.PostProfile(ctx, Profile{ID: "1", Name: "Go Kit"}); err != nil {
+		t.Fatalf("PostProfile: %v", err)
+	}
+
+	for _, tc := range []struct {
+		contentType string
+		body        string
+		want        int
+	}{
+		{JSONPatchType, `[{"op":"add","path":"/addresses/-","value":{"id":"home"}}]`, http.StatusOK},
+		{MergePatchType + "; charset=utf-8", `{"name":null}`, http.StatusOK},
+		{"application/json", `{"name":"Go kit"}`, http.StatusOK},
+		{JSONPatchType, `[{"op":"test","path":"/name","value":"Gopher"}]`, http.StatusConflict},
+		{MergePatchType, `{"name":`, http.StatusBadRequest},
+		{"application/xml", `<name>Go kit</name>`, http.StatusUnsupportedMediaType},
+		{"", `{"name":"Go kit"}`, http.StatusUnsupportedMediaType},
+	} {
+		req, _ := http.NewRequest("PATCH", srv.URL+"/profiles/1", strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("PATCH %s %s: want %d, have %d", tc.contentType, tc.body, tc.want, resp.StatusCode)
+		}
+	}
+
+	patch := Patch{Type: JSONPatchType, Document: []byte(`[{"op":"replace","path":"/addresses/0/location","value":"Berlin"}]`)}
+	if err := client.PatchProfile(ctx, "1", patch, 4); err != nil {
+		t.Errorf("PatchProfile: %v", err)
+	}
+	want := Profile{ID: "1", Name: "Go kit", Addresses: []Address{{ID: "home", Location: "Berlin"}}, Version: 5}
+	if have, err := client.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile: want %+v, have %+v (%v)", want, have, err)
+	}
+	if err := client.PatchProfile(ctx, "1", Patch{Type: "text/plain"}, 0); err != ErrUnsupportedPatch {
+		t.Errorf("PatchProfile(unsupported type): want %v, have %v", ErrUnsupportedPatch, err)
+	}
+}
+
+func TestHTTPUpdateAddress(t *testing.T) {
+	srv := httptest.NewServer(MakeHTTPHandler(NewInmemService(), nil, log.NewNopLogger()))
+	defer srv.Close()
+	client, err := MakeClientEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.PostProfile(ctx, Profile{ID: "1", Addresses: []Address{{ID: "home", Location: "Berlin"}}}); err != nil {
+		t.Fatalf("PostProfile: %v", err)
+	}
+
+	home := Address{ID: "home", City: "Berlin", Country: "DE"}
+	if err := client.UpdateAddress(ctx, "1", "home", home); err != nil {
+		t.Errorf("UpdateAddress: %v", err)
+	}
+	home.Location = "Berlin, DE"
+	if have, err := client.GetAddress(ctx, "1", "home"); err != nil || have != home {
+		t.Errorf("GetAddress: want %+v, have %+v (%v)", home, have, err)
+	}
+
+	// Validation errors come back with the problem of every field.
+	err = client.UpdateAddress(ctx, "1", "home", Address{ID: "home", Street: "Unter den Linden 1", Country: "Germany"})
+	var verr *ValidationError
+	want := map[string]string{"city": "required", "country": "not an ISO 3166-1 alpha-2 code"}
+	if !errors.As(err, &verr) || !reflect.DeepEqual(want, verr.Fields) {
+		t.Errorf("UpdateAddress(invalid): want problems %v, have %v", want, err)
+	}
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/profiles/1/addresses/home", strings.NewReader(`{"id":"home","country":"DE"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || body.Fields["city"] != "required" {
+		t.Errorf("PUT invalid address: want 400 with the city field, have %d %v", resp.StatusCode, body.Fields)
+	}
+}
+
+func TestHTTPPatchAddress(t *testing.T) {
+	srv := httptest.NewServer(MakeHTTPHandler(NewInmemService(), nil, log.NewNopLogger()))
+	defer srv.Close()
+	client, err := MakeClientEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	addresses := []Address{{ID: "home", Location: "Berlin"}, {ID: "work", Location: "Hamburg"}}
+	if err := client.PostProfile(ctx, Profile{ID: "1", Addresses: addresses}); err != nil {
+		t.Fatalf("PostProfile: %v", err)
+	}
+
+	for _, tc := range []struct {
+		contentType string
+		path        string
+		body        string
+		want        int
+	}{
+		{MergePatchType, "/profiles/1/addresses/work", `{"city":"Hamburg","country":"de"}`, http.StatusOK},
+		{JSONPatchType, "/profiles/1/addresses/work", `[{"op":"replace","path":"/street","value":"Jungfernstieg 1"}]`, http.StatusOK},
+		{"application/json", "/profiles/1/addresses/work", `{"location":null}`, http.StatusOK},
+		{MergePatchType, "/profiles/1/addresses/work", `{"id":"office"}`, http.StatusBadRequest},
+		{MergePatchType, "/profiles/1/addresses/work", `{"country":null}`, http.StatusBadRequest},
+		{MergePatchType, "/profiles/1/addresses/work", `{"floor":3}`, http.StatusBadRequest},
+		{JSONPatchType, "/profiles/1/addresses/work", `[{"op":"test","path":"/city","value":"Berlin"}]`, http.StatusConflict},
+		{MergePatchType, "/profiles/1/addresses/school", `{"city":"Hamburg"}`, http.StatusNotFound},
+		{MergePatchType, "/profiles/2/addresses/work", `{"city":"Hamburg"}`, http.StatusNotFound},
+		{"application/xml", "/profiles/1/addresses/work", `<city>Hamburg</city>`, http.StatusUnsupportedMediaType},
+	} {
+		req, _ := http.NewRequest("PATCH", srv.URL+tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("PATCH %s %s %s: want %d, have %d", tc.path, tc.contentType, tc.body, tc.want, resp.StatusCode)
+		}
+	}
+
+	// Only the patched address changed, and was normalized like any other.
+	addresses[1] = Address{ID: "work", Location: "Jungfernstieg 1, Hamburg, DE", Street: "Jungfernstieg 1", City: "Hamburg", Country: "DE"}
+	want := Profile{ID: "1", Addresses: addresses, Version: 4}
+	if have, err := client.GetProfile(ctx, "1"); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("GetProfile: want %+v, have %+v (%v)", want, have, err)
+	}
+}
+
+func TestHTTPAddressIDs(t *testing.T) {
+	srv := httptest.NewServer(MakeHTTPHandler(NewInmemService(), nil, log.NewNopLogger()))
+	defer srv.Close()
+	client, err := MakeClientEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.PostProfile(ctx, Profile{ID: "1"}); err != nil {
+		t.Fatalf("PostProfile: %v", err)
+	}
+
+	// Addresses added without an ID get one.
+	if err := client.PostAddress(ctx, "1", Address{Location: "Berlin"}); err != nil {
+		t.Fatalf("PostAddress: %v", err)
+	}
+	addresses, err := client.GetAddresses(ctx, "1")
+	if err != nil || len(addresses) != 1 || addresses[0].ID == "" {
+		t.Fatalf("GetAddresses: want an address with an ID, have %+v (%v)", addresses, err)
+	}
+
+	// Updates without one keep the ID in the path.
+	id := addresses[0].ID
+	if err := client.UpdateAddress(ctx, "1", id, Address{Location: "Hamburg"}); err != nil {
+		t.Errorf("UpdateAddress: %v", err)
+	}
+	want := Address{ID: id, Location: "Hamburg"}
+	if have, err := client.GetAddress(ctx, "1", id); err != nil || have != want {
+		t.Errorf("GetAddress: want %+v, have %+v (%v)", want, have, err)
+	}
+	if err := client.UpdateAddress(ctx, "1", id, Address{ID: "home"}); err != ErrInconsistentIDs {
+		t.Errorf("UpdateAddress(other ID): want %v, have %v", ErrInconsistentIDs, err)
+	}
+}
+
+func TestHTTPTenants(t *testing.T) {
+	s := NewInmemService(TenantQuotas(func(string) Quota { return Quota{MaxProfiles: 1} }))
+	srv := httptest.NewServer(MakeHTTPHandler(s, nil, log.NewNopLogger()))
+	defer srv.Close()
+	client, err := MakeClientEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client sends the tenant of its context as TenantHeader.
+	acme := WithTenant(context.Background(), "acme")
+	if err := client.PostProfile(acme, Profile{ID: "1"}); err != nil {
+		t.Fatalf("PostProfile: %v", err)
+	}
+	if _, err := s.GetProfile(acme, "1"); err != nil {
+		t.Errorf("GetProfile in the tenant of the request: %v", err)
+	}
+	if _, err := client.GetProfile(context.Background(), "1"); err != ErrNotFound {
+		t.Errorf("GetProfile(default tenant): want %v, have %v", ErrNotFound, err)
+	}
+	if err := client.PostProfile(acme, Profile{ID: "2"}); err != ErrQuotaExceeded {
+		t.Errorf("PostProfile(over quota): want %v, have %v", ErrQuotaExceeded, err)
+	}
+
+	req, _ := http.NewRequest("POST", srv.URL+"/profiles/", strings.NewReader(`{"id":"2"}`))
+	req.Header.Set(TenantHeader, "acme")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := http.StatusTooManyRequests, resp.StatusCode; want != have {
+		t.Errorf("POST over quota: want %d, have %d", want, have)
+	}
+}
+
+func TestHTTPTenantClaim(t *testing.T) {
+	key := []byte("secret")
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	}
+	s := NewInmemService()
+	srv := httptest.NewServer(MakeHTTPHandler(s, nil, log.NewNopLogger(), TenantClaim(keyFunc, "tenant")))
+	defer srv.Close()
+
+	sign := func(claims jwt.MapClaims, key []byte) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"valid token", sign(jwt.MapClaims{"tenant": "acme"}, key), http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"other key", sign(jwt.MapClaims{"tenant": "acme"}, []byte("guess")), http.StatusUnauthorized},
+		{"no claim", sign(jwt.MapClaims{"sub": "acme"}, key), http.StatusUnauthorized},
+		{"expired", sign(jwt.MapClaims{"tenant": "acme", "exp": 1}, key), http.StatusUnauthorized},
+	} {
+		req, _ := http.NewRequest("POST", srv.URL+"/profiles/", strings.NewReader(`{"id":"1"}`))
+		req.Header.Set("Authorization", tc.authorization)
+		req.Header.Set(TenantHeader, "initech") // ignored
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if tc.want != resp.StatusCode {
+			t.Errorf("%s: want %d, have %d", tc.name, tc.want, resp.StatusCode)
+		}
+	}
+
+	if _, err := s.GetProfile(WithTenant(context.Background(), "acme"), "1"); err != nil {
+		t.Errorf("GetProfile in the tenant of the claim: %v", err)
+	}
+	if _, err := s.GetProfile(WithTenant(context.Background(), "initech"), "1"); err != ErrNotFound {
+		t.Errorf("GetProfile in the tenant of the header: want %v, have %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,450 @@
+// Package boltdb provides implementations of all the domain repositories that
+// persist the domain objects in a BoltDB file, so they survive restarts.
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+var (
+	metaBucket           = []byte("meta")
+	cargosBucket         = []byte("cargos")
+	locationsBucket      = []byte("locations")
+	voyagesBucket        = []byte("voyages")
+	handlingEventsBucket = []byte("handling_events")
+	versionKey           = []byte("schema_version")
+	scheduledUntilKey    = []byte("voyages_scheduled_until")
+)
+
+// migrations bring the schema of a BoltDB file from one version to the next:
+// migrations[0] creates version 1 from an empty file, and so on. Migrations
+// are only ever appended, never changed, since files out there already went
+// through them.
+var migrations = []func(tx *bolt.Tx) error{
+	// Version 1 stores each cargo, location and voyage as JSON under its ID,
+	// and the handling events of each cargo, in the order they were stored,
+	// in a bucket per cargo. The locations and voyages are the samples the
+	// in-memory repositories have too.
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{cargosBucket, locationsBucket, voyagesBucket, handlingEventsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		for _, l := range []*location.Location{
+			location.Stockholm, location.Melbourne, location.Hongkong,
+			location.Tokyo, location.Rotterdam, location.Hamburg,
+		} {
+			if err := put(tx.Bucket(locationsBucket), string(l.UNLocode), l); err != nil {
+				return err
+			}
+		}
+		for _, v := range []*voyage.Voyage{
+			voyage.V100, voyage.V300, voyage.V400,
+			voyage.V0100S, voyage.V0200T, voyage.V0300A, voyage.V0301S, voyage.V0400S,
+		} {
+			if err := put(tx.Bucket(voyagesBucket), string(v.Number), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// DB is a BoltDB file holding the domain objects, which the repositories of
+// this package share.
+type DB struct {
+	db     *bolt.DB
+	logger log.Logger
+}
+
+// Open opens the BoltDB file at path, creating it if it doesn't exist, and
+// migrates it to the current schema. The file is locked until it's closed.
+// Errors of the repository methods that can't return one, which only happen
+// if the file is corrupt, are logged to logger.
+func Open(path string, logger log.Logger) (*DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(migrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{db: db, logger: logger}, nil
+}
+
+// migrate runs the migrations that the file hasn't been through yet.
+func migrate(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	var version int
+	if v := meta.Get(versionKey); v != nil {
+		if version, err = strconv.Atoi(string(v)); err != nil {
+			return fmt.Errorf("invalid schema version %q: %w", v, err)
+		}
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this binary's %d", version, len(migrations))
+	}
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](tx); err != nil {
+			return fmt.Errorf("migrating to schema version %d: %w", version+1, err)
+		}
+	}
+	return meta.Put(versionKey, []byte(strconv.Itoa(version)))
+}
+
+// Close closes the underlying BoltDB file.
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+type cargoRepository struct {
+	db *DB
+}
+
+func (r *cargoRepository) Store(c *cargo.Cargo) error {
+	return r.db.db.Update(func(tx *bolt.Tx) error {
+		return (&txCargoRepository{tx, r.db.logger}).Store(c)
+	})
+}
+
+func (r *cargoRepository) Find(id cargo.TrackingID) (*cargo.Cargo, error) {
+	var c *cargo.Cargo
+	err := r.db.db.View(func(tx *bolt.Tx) (err error) {
+		c, err = (&txCargoRepository{tx, r.db.logger}).Find(id)
+		return err
+	})
+	return c, err
+}
+
+func (r *cargoRepository) FindAll() []*cargo.Cargo {
+	c := []*cargo.Cargo{}
+	err := r.db.db.View(func(tx *bolt.Tx) error {
+		c = (&txCargoRepository{tx, r.db.logger}).FindAll()
+		return nil
+	})
+	if err != nil {
+		r.db.logger.Log("method", "FindAll", "err", err)
+	}
+	return c
+}
+
+// NewCargoRepository returns a new instance of a BoltDB cargo repository.
+func NewCargoRepository(db *DB) cargo.Repository {
+	return &cargoRepository{db: db}
+}
+
+type locationRepository struct {
+	db *DB
+}
+
+func (r *locationRepository) Find(locode location.UNLocode) (*location.Location, error) {
+	var l location.Location
+	err := r.db.db.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(locationsBucket), string(locode), &l, location.ErrUnknown)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *locationRepository) FindAll() []*location.Location {
+	l := []*location.Location{}
+	err := r.db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(locationsBucket).ForEach(func(k, v []byte) error {
+			var val location.Location
+			if err := decode(k, v, &val); err != nil {
+				return err
+			}
+			l = append(l, &val)
+			return nil
+		})
+	})
+	if err != nil {
+		r.db.logger.Log("method", "FindAll", "err", err)
+	}
+	return l
+}
+
+// NewLocationRepository returns a new instance of a BoltDB location
+// repository.
+func NewLocationRepository(db *DB) location.Repository {
+	return &locationRepository{db: db}
+}
+
+type voyageRepository struct {
+	db *DB
+
+	mtx   sync.Mutex
+	until time.Time // the sample voyages are scheduled until, as far as r knows
+	now   func() time.Time
+}
+
+func (r *voyageRepository) Find(voyageNumber voyage.Number) (*voyage.Voyage, error) {
+	if err := r.schedule(); err != nil {
+		return nil, err
+	}
+	var v voyage.Voyage
+	err := r.db.db.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(voyagesBucket), string(voyageNumber), &v, voyage.ErrUnknown)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *voyageRepository) FindAll() []*voyage.Voyage {
+	if err := r.schedule(); err != nil {
+		r.db.logger.Log("method", "FindAll", "err", err)
+	}
+	v := []*voyage.Voyage{}
+	err := r.db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(voyagesBucket).ForEach(func(k, val []byte) error {
+			var vv voyage.Voyage
+			if err := decode(k, val, &vv); err != nil {
+				return err
+			}
+			v = append(v, &vv)
+			return nil
+		})
+	})
+	if err != nil {
+		r.db.logger.Log("method", "FindAll", "err", err)
+	}
+	return v
+}
+
+// schedule extends the stored schedules of the sample voyages by another
+// voyage.SamplePeriod once they no longer reach voyage.SampleHorizon ahead.
+// Files from before the voyages were scheduled have voyages without times,
+// which are dropped as having arrived long ago.
+func (r *voyageRepository) schedule() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := r.now()
+	if r.until.After(now.Add(voyage.SampleHorizon)) {
+		return nil
+	}
+	var until time.Time
+	err := r.db.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if v := meta.Get(scheduledUntilKey); v != nil {
+			if err := until.UnmarshalText(v); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", scheduledUntilKey, v, err)
+			}
+		}
+		if until.After(now.Add(voyage.SampleHorizon)) {
+			// Another repository of the file extended them.
+			return nil
+		}
+
+		from, to := until, now.Add(voyage.SampleHorizon+voyage.SamplePeriod)
+		if from.Before(now) {
+			from = now
+		}
+		b := tx.Bucket(voyagesBucket)
+		for _, v := range voyage.SampleSchedules(from, to) {
+			var stored voyage.Voyage
+			switch err := get(b, string(v.Number), &stored, voyage.ErrUnknown); err {
+			case nil:
+				v = stored.Extend(v.Schedule, now)
+			case voyage.ErrUnknown:
+			default:
+				return err
+			}
+			if err := put(b, string(v.Number), v); err != nil {
+				return err
+			}
+		}
+		text, err := to.MarshalText()
+		if err != nil {
+			return err
+		}
+		until = to
+		return meta.Put(scheduledUntilKey, text)
+	})
+	if err != nil {
+		return err
+	}
+	r.until = until
+	return nil
+}
+
+// NewVoyageRepository returns a new instance of a BoltDB voyage repository of
+// the sample voyages, whose schedules it keeps extending as time goes by, see
+// voyage.SampleSchedules.
+func NewVoyageRepository(db *DB) voyage.Repository {
+	return &voyageRepository{db: db, now: time.Now}
+}
+
+type handlingEventRepository struct {
+	db *DB
+}
+
+func (r *handlingEventRepository) Store(e cargo.HandlingEvent) error {
+	return r.db.db.Update(func(tx *bolt.Tx) error {
+		return (&txHandlingEventRepository{tx, r.db.logger}).Store(e)
+	})
+}
+
+func (r *handlingEventRepository) QueryHandlingHistory(id cargo.TrackingID) cargo.HandlingHistory {
+	var h cargo.HandlingHistory
+	err := r.db.db.View(func(tx *bolt.Tx) error {
+		h = (&txHandlingEventRepository{tx, r.db.logger}).QueryHandlingHistory(id)
+		return nil
+	})
+	if err != nil {
+		r.db.logger.Log("method", "QueryHandlingHistory", "tracking_id", id, "err", err)
+	}
+	return h
+}
+
+// NewHandlingEventRepository returns a new instance of a BoltDB handling event
+// repository.
+func NewHandlingEventRepository(db *DB) cargo.HandlingEventRepository {
+	return &handlingEventRepository{db: db}
+}
+
+type unitOfWork struct {
+	db *DB
+}
+
+// Do runs work in a read-write transaction, which BoltDB serializes with the
+// others.
+func (u *unitOfWork) Do(work func(cargo.Repository, cargo.HandlingEventRepository) error) error {
+	return u.db.db.Update(func(tx *bolt.Tx) error {
+		return work(&txCargoRepository{tx, u.db.logger}, &txHandlingEventRepository{tx, u.db.logger})
+	})
+}
+
+// NewUnitOfWork returns a new instance of a unit of work over the BoltDB
+// cargo and handling event repositories.
+func NewUnitOfWork(db *DB) cargo.UnitOfWork {
+	return &unitOfWork{db: db}
+}
+
+// txCargoRepository is a cargo repository within a transaction, which the
+// other cargo repositories run in one of their own.
+type txCargoRepository struct {
+	tx     *bolt.Tx
+	logger log.Logger
+}
+
+func (r *txCargoRepository) Store(c *cargo.Cargo) error {
+	return put(r.tx.Bucket(cargosBucket), string(c.TrackingID), c)
+}
+
+func (r *txCargoRepository) Find(id cargo.TrackingID) (*cargo.Cargo, error) {
+	var c cargo.Cargo
+	if err := get(r.tx.Bucket(cargosBucket), string(id), &c, cargo.ErrUnknown); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *txCargoRepository) FindAll() []*cargo.Cargo {
+	c := []*cargo.Cargo{}
+	err := r.tx.Bucket(cargosBucket).ForEach(func(k, v []byte) error {
+		var val cargo.Cargo
+		if err := decode(k, v, &val); err != nil {
+			return err
+		}
+		c = append(c, &val)
+		return nil
+	})
+	if err != nil {
+		r.logger.Log("method", "FindAll", "err", err)
+	}
+	return c
+}
+
+// txHandlingEventRepository is a handling event repository within a
+// transaction, which the other handling event repositories run in one of
+// their own.
+type txHandlingEventRepository struct {
+	tx     *bolt.Tx
+	logger log.Logger
+}
+
+func (r *txHandlingEventRepository) Store(e cargo.HandlingEvent) error {
+	b, err := r.tx.Bucket(handlingEventsBucket).CreateBucketIfNotExists([]byte(e.TrackingID))
+	if err != nil {
+		return err
+	}
+	// Keys in sequence keep the events in the order they were stored.
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, v)
+}
+
+func (r *txHandlingEventRepository) QueryHandlingHistory(id cargo.TrackingID) cargo.HandlingHistory {
+	var events []cargo.HandlingEvent
+	b := r.tx.Bucket(handlingEventsBucket).Bucket([]byte(id))
+	if b == nil {
+		return cargo.HandlingHistory{}
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		var e cargo.HandlingEvent
+		if err := json.Unmarshal(v, &e); err != nil {
+			return fmt.Errorf("decoding handling event %d of cargo %q: %w", binary.BigEndian.Uint64(k), id, err)
+		}
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		r.logger.Log("method", "QueryHandlingHistory", "tracking_id", id, "err", err)
+	}
+	return cargo.HandlingHistory{HandlingEvents: events}
+}
+
+func put(b *bolt.Bucket, key string, val interface{}) error {
+	v, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), v)
+}
+
+// get decodes the value under key into val, or returns errNotFound if there's
+// none.
+func get(b *bolt.Bucket, key string, val interface{}, errNotFound error) error {
+	v := b.Get([]byte(key))
+	if v == nil {
+		return errNotFound
+	}
+	return decode([]byte(key), v, val)
+}
+
+func decode(k, v []byte, val interface{}) error {
+	if err := json.Unmarshal(v, val); err != nil {
+		return fmt.Errorf("decoding %q: %w", k, err)
+	}
+	return nil
+}
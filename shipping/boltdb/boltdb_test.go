@@ -0,0 +1,68 @@
+package boltdb
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/internal/repotest"
+	"github.com/go-kit/examples/shipping/location"
+)
+
+func TestRepositories(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		db, err := Open(filepath.Join(t.TempDir(), "shipping.db"), log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return repotest.Repositories{
+			Cargos:         NewCargoRepository(db),
+			Locations:      NewLocationRepository(db),
+			Voyages:        NewVoyageRepository(db),
+			HandlingEvents: NewHandlingEventRepository(db),
+			UnitOfWork:     NewUnitOfWork(db),
+		}
+	})
+}
+
+func TestPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shipping.db")
+	db, err := Open(path, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC),
+	})
+	if err := NewCargoRepository(db).Store(c); err != nil {
+		t.Fatal(err)
+	}
+	e := cargo.HandlingEvent{TrackingID: c.TrackingID, Activity: cargo.HandlingActivity{Type: cargo.Receive, Location: location.SESTO}}
+	if err := NewHandlingEventRepository(db).Store(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the file again goes through the migrations, which must leave
+	// the data of a file that's already up to date alone.
+	db, err = Open(path, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if have, err := NewCargoRepository(db).Find(c.TrackingID); err != nil || !reflect.DeepEqual(c, have) {
+		t.Errorf("Find: want %+v, have %+v (%v)", c, have, err)
+	}
+	if have := NewHandlingEventRepository(db).QueryHandlingHistory(c.TrackingID).HandlingEvents; !reflect.DeepEqual([]cargo.HandlingEvent{e}, have) {
+		t.Errorf("QueryHandlingHistory: want %+v, have %+v", []cargo.HandlingEvent{e}, have)
+	}
+}
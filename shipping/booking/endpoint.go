@@ -107,10 +107,32 @@ func makeChangeDestinationEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
-type listCargosRequest struct{}
+type rerouteRequest struct {
+	ID cargo.TrackingID
+}
+
+type rerouteResponse struct {
+	Itinerary *cargo.Itinerary `json:"itinerary,omitempty"`
+	Err       error            `json:"error,omitempty"`
+}
+
+func (r rerouteResponse) error() error { return r.Err }
+
+func makeRerouteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(rerouteRequest)
+		itinerary, err := s.RerouteCargo(req.ID)
+		return rerouteResponse{Itinerary: &itinerary, Err: err}, nil
+	}
+}
+
+type listCargosRequest struct {
+	Filter CargoFilter
+}
 
 type listCargosResponse struct {
 	Cargos []Cargo `json:"cargos,omitempty"`
+	Total  int     `json:"total"`
 	Err    error   `json:"error,omitempty"`
 }
 
@@ -118,8 +140,9 @@ func (r listCargosResponse) error() error { return r.Err }
 
 func makeListCargosEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		_ = request.(listCargosRequest)
-		return listCargosResponse{Cargos: s.Cargos(), Err: nil}, nil
+		req := request.(listCargosRequest)
+		cargos, total := s.Cargos(req.Filter)
+		return listCargosResponse{Cargos: cargos, Total: total, Err: nil}, nil
 	}
 }
 
@@ -0,0 +1,21 @@
+package booking
+
+import (
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/inspection"
+)
+
+type inspectionEventHandler struct{}
+
+func (inspectionEventHandler) CargoWasMisdirected(c *cargo.Cargo) {
+	c.FlagForRerouting()
+}
+
+func (inspectionEventHandler) CargoHasArrived(*cargo.Cargo) {}
+
+// NewInspectionEventHandler returns an inspection event handler that flags
+// misdirected cargos for rerouting, which booking views show until they're
+// assigned to a new route.
+func NewInspectionEventHandler() inspection.EventHandler {
+	return inspectionEventHandler{}
+}
@@ -60,6 +60,15 @@ func (s *instrumentingService) AssignCargoToRoute(id cargo.TrackingID, itinerary
 	return s.Service.AssignCargoToRoute(id, itinerary)
 }
 
+func (s *instrumentingService) RerouteCargo(id cargo.TrackingID) (cargo.Itinerary, error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "reroute").Add(1)
+		s.requestLatency.With("method", "reroute").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.Service.RerouteCargo(id)
+}
+
 func (s *instrumentingService) ChangeDestination(id cargo.TrackingID, l location.UNLocode) (err error) {
 	defer func(begin time.Time) {
 		s.requestCount.With("method", "change_destination").Add(1)
@@ -69,13 +78,13 @@ func (s *instrumentingService) ChangeDestination(id cargo.TrackingID, l location
 	return s.Service.ChangeDestination(id, l)
 }
 
-func (s *instrumentingService) Cargos() []Cargo {
+func (s *instrumentingService) Cargos(f CargoFilter) ([]Cargo, int) {
 	defer func(begin time.Time) {
 		s.requestCount.With("method", "list_cargos").Add(1)
 		s.requestLatency.With("method", "list_cargos").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.Service.Cargos()
+	return s.Service.Cargos(f)
 }
 
 func (s *instrumentingService) Locations() []Location {
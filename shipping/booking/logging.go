@@ -68,6 +68,19 @@ func (s *loggingService) AssignCargoToRoute(id cargo.TrackingID, itinerary cargo
 	return s.Service.AssignCargoToRoute(id, itinerary)
 }
 
+func (s *loggingService) RerouteCargo(id cargo.TrackingID) (itinerary cargo.Itinerary, err error) {
+	defer func(begin time.Time) {
+		s.logger.Log(
+			"method", "reroute",
+			"tracking_id", id,
+			"legs", len(itinerary.Legs),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.RerouteCargo(id)
+}
+
 func (s *loggingService) ChangeDestination(id cargo.TrackingID, l location.UNLocode) (err error) {
 	defer func(begin time.Time) {
 		s.logger.Log(
@@ -81,14 +94,17 @@ func (s *loggingService) ChangeDestination(id cargo.TrackingID, l location.UNLoc
 	return s.Service.ChangeDestination(id, l)
 }
 
-func (s *loggingService) Cargos() []Cargo {
+func (s *loggingService) Cargos(f CargoFilter) (cargos []Cargo, total int) {
 	defer func(begin time.Time) {
 		s.logger.Log(
 			"method", "list_cargos",
+			"offset", f.Offset,
+			"limit", f.Limit,
+			"total", total,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return s.Service.Cargos()
+	return s.Service.Cargos(f)
 }
 
 func (s *loggingService) Locations() []Location {
@@ -0,0 +1,119 @@
+package booking
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
+)
+
+// CargoFilter selects cargos from the read models, and a page of them. The
+// zero value selects all cargos.
+type CargoFilter struct {
+	// Routed and Misrouted select cargos with the given routing status, if
+	// set.
+	Routed    *bool
+	Misrouted *bool
+
+	// Destination selects cargos bound for a location, if set.
+	Destination location.UNLocode
+
+	// DeadlineFrom and DeadlineTo select cargos with an arrival deadline
+	// within the window, both inclusive, if set.
+	DeadlineFrom time.Time
+	DeadlineTo   time.Time
+
+	// Offset skips that many matching cargos, ordered by tracking ID, and
+	// Limit returns at most that many of the rest, if positive.
+	Offset int
+	Limit  int
+}
+
+func (f CargoFilter) matches(c Cargo) bool {
+	switch {
+	case f.Routed != nil && c.Routed != *f.Routed:
+		return false
+	case f.Misrouted != nil && c.Misrouted != *f.Misrouted:
+		return false
+	case f.Destination != "" && c.Destination != string(f.Destination):
+		return false
+	case !f.DeadlineFrom.IsZero() && c.ArrivalDeadline.Before(f.DeadlineFrom):
+		return false
+	case !f.DeadlineTo.IsZero() && c.ArrivalDeadline.After(f.DeadlineTo):
+		return false
+	}
+	return true
+}
+
+// Projection maintains the read models of cargos for booking views.
+type Projection struct {
+	mtx    sync.RWMutex
+	cargos map[cargo.TrackingID]Cargo
+	ids    []cargo.TrackingID
+}
+
+// NewProjection returns an empty projection.
+func NewProjection() *Projection {
+	return &Projection{
+		cargos: make(map[cargo.TrackingID]Cargo),
+	}
+}
+
+// Project updates the read model of c.
+func (p *Projection) Project(c *cargo.Cargo, h cargo.HandlingHistory) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if _, ok := p.cargos[c.TrackingID]; !ok {
+		i := sort.Search(len(p.ids), func(i int) bool { return p.ids[i] >= c.TrackingID })
+		p.ids = append(p.ids, "")
+		copy(p.ids[i+1:], p.ids[i:])
+		p.ids[i] = c.TrackingID
+	}
+	p.cargos[c.TrackingID] = assemble(c)
+}
+
+// Rebuild replaces the read models with the ones build projects into a new,
+// empty projection.
+func (p *Projection) Rebuild(build func(project func(*cargo.Cargo, cargo.HandlingHistory))) {
+	next := NewProjection()
+	build(next.Project)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.cargos, p.ids = next.cargos, next.ids
+}
+
+// Find returns the read model of a cargo.
+func (p *Projection) Find(id cargo.TrackingID) (Cargo, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	c, ok := p.cargos[id]
+	if !ok {
+		return Cargo{}, cargo.ErrUnknown
+	}
+	return c, nil
+}
+
+// Cargos returns the page of read models of the cargos selected by f, and
+// the number of cargos it selects across all pages.
+func (p *Projection) Cargos(f CargoFilter) ([]Cargo, int) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	var (
+		result []Cargo
+		total  int
+	)
+	for _, id := range p.ids {
+		c := p.cargos[id]
+		if !f.matches(c) {
+			continue
+		}
+		if total >= f.Offset && (f.Limit <= 0 || len(result) < f.Limit) {
+			result = append(result, c)
+		}
+		total++
+	}
+	return result, total
+}
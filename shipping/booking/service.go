@@ -14,6 +14,18 @@ import (
 // ErrInvalidArgument is returned when one or more arguments are invalid.
 var ErrInvalidArgument = errors.New("invalid argument")
 
+// ErrCannotReroute is returned when rerouting a cargo that isn't in port, or
+// waiting to be received.
+var ErrCannotReroute = errors.New("cargo can only be rerouted in port")
+
+// ErrNoRoute is returned when no route satisfies the route specification of
+// a cargo.
+var ErrNoRoute = errors.New("no route satisfies the route specification")
+
+// ErrCargoChanged is returned when a cargo is handled or rerouted while it's
+// being rerouted. Rerouting it again routes it from where it is then.
+var ErrCargoChanged = errors.New("cargo changed while being rerouted")
+
 // Service is the interface that provides booking methods.
 type Service interface {
 	// BookNewCargo registers a new cargo in the tracking system, not yet
@@ -34,8 +46,14 @@ type Service interface {
 	// ChangeDestination changes the destination of a cargo.
 	ChangeDestination(id cargo.TrackingID, destination location.UNLocode) error
 
-	// Cargos returns a list of all cargos that have been booked.
-	Cargos() []Cargo
+	// RerouteCargo assigns a cargo that's misdirected, or misrouted after a
+	// change of destination, to a new route from where it is now, keeping
+	// the legs it has completed, and returns the new itinerary.
+	RerouteCargo(id cargo.TrackingID) (cargo.Itinerary, error)
+
+	// Cargos returns a page of the cargos that have been booked, selected by
+	// f, and how many cargos f selects across all pages.
+	Cargos(f CargoFilter) ([]Cargo, int)
 
 	// Locations returns a list of registered locations.
 	Locations() []Location
@@ -44,8 +62,9 @@ type Service interface {
 type service struct {
 	cargos         cargo.Repository
 	locations      location.Repository
-	handlingEvents cargo.HandlingEventRepository
+	unitOfWork     cargo.UnitOfWork
 	routingService routing.Service
+	views          *Projection
 }
 
 func (s *service) AssignCargoToRoute(id cargo.TrackingID, itinerary cargo.Itinerary) error {
@@ -53,14 +72,16 @@ func (s *service) AssignCargoToRoute(id cargo.TrackingID, itinerary cargo.Itiner
 		return ErrInvalidArgument
 	}
 
-	c, err := s.cargos.Find(id)
-	if err != nil {
-		return err
-	}
+	return s.unitOfWork.Do(func(cargos cargo.Repository, _ cargo.HandlingEventRepository) error {
+		c, err := cargos.Find(id)
+		if err != nil {
+			return err
+		}
 
-	c.AssignToRoute(itinerary)
+		c.AssignToRoute(itinerary)
 
-	return s.cargos.Store(c)
+		return cargos.Store(c)
+	})
 }
 
 func (s *service) BookNewCargo(origin, destination location.UNLocode, deadline time.Time) (cargo.TrackingID, error) {
@@ -77,7 +98,10 @@ func (s *service) BookNewCargo(origin, destination location.UNLocode, deadline t
 
 	c := cargo.New(id, rs)
 
-	if err := s.cargos.Store(c); err != nil {
+	err := s.unitOfWork.Do(func(cargos cargo.Repository, _ cargo.HandlingEventRepository) error {
+		return cargos.Store(c)
+	})
+	if err != nil {
 		return "", err
 	}
 
@@ -94,7 +118,7 @@ func (s *service) LoadCargo(id cargo.TrackingID) (Cargo, error) {
 		return Cargo{}, err
 	}
 
-	return assemble(c, s.handlingEvents), nil
+	return assemble(c), nil
 }
 
 func (s *service) ChangeDestination(id cargo.TrackingID, destination location.UNLocode) error {
@@ -102,27 +126,25 @@ func (s *service) ChangeDestination(id cargo.TrackingID, destination location.UN
 		return ErrInvalidArgument
 	}
 
-	c, err := s.cargos.Find(id)
-	if err != nil {
-		return err
-	}
-
 	l, err := s.locations.Find(destination)
 	if err != nil {
 		return err
 	}
 
-	c.SpecifyNewRoute(cargo.RouteSpecification{
-		Origin:          c.Origin,
-		Destination:     l.UNLocode,
-		ArrivalDeadline: c.RouteSpecification.ArrivalDeadline,
-	})
+	return s.unitOfWork.Do(func(cargos cargo.Repository, _ cargo.HandlingEventRepository) error {
+		c, err := cargos.Find(id)
+		if err != nil {
+			return err
+		}
 
-	if err := s.cargos.Store(c); err != nil {
-		return err
-	}
+		c.SpecifyNewRoute(cargo.RouteSpecification{
+			Origin:          c.Origin,
+			Destination:     l.UNLocode,
+			ArrivalDeadline: c.RouteSpecification.ArrivalDeadline,
+		})
 
-	return nil
+		return cargos.Store(c)
+	})
 }
 
 func (s *service) RequestPossibleRoutesForCargo(id cargo.TrackingID) []cargo.Itinerary {
@@ -138,12 +160,152 @@ func (s *service) RequestPossibleRoutesForCargo(id cargo.TrackingID) []cargo.Iti
 	return s.routingService.FetchRoutesForSpecification(c.RouteSpecification)
 }
 
-func (s *service) Cargos() []Cargo {
-	var result []Cargo
-	for _, c := range s.cargos.FindAll() {
-		result = append(result, assemble(c, s.handlingEvents))
+func (s *service) RerouteCargo(id cargo.TrackingID) (cargo.Itinerary, error) {
+	if id == "" {
+		return cargo.Itinerary{}, ErrInvalidArgument
 	}
-	return result
+
+	c, err := s.cargos.Find(id)
+	if err != nil {
+		return cargo.Itinerary{}, err
+	}
+	from, err := rerouteFrom(c)
+	if err != nil {
+		return cargo.Itinerary{}, err
+	}
+
+	// Routing may take a while, or call another service, so the routes are
+	// fetched before the unit of work, rather than holding up the handling of
+	// cargos in the meantime. The cargo may already be where it's going, and
+	// only need an itinerary that says so.
+	routes := []cargo.Itinerary{{}}
+	if from != c.RouteSpecification.Destination {
+		routes = s.routingService.FetchRoutesForSpecification(cargo.RouteSpecification{
+			Origin:          from,
+			Destination:     c.RouteSpecification.Destination,
+			ArrivalDeadline: c.RouteSpecification.ArrivalDeadline,
+		})
+	}
+
+	// The unit of work only assigns one of them if the cargo is still where
+	// they start from, on the itinerary it had, so that it isn't handled or
+	// rerouted otherwise in the meantime.
+	var itinerary cargo.Itinerary
+	err = s.unitOfWork.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		current, err := cargos.Find(id)
+		if err != nil {
+			return err
+		}
+		now, err := rerouteFrom(current)
+		if err != nil {
+			return err
+		}
+		if now != from || !sameLegs(current.Itinerary, c.Itinerary) {
+			return ErrCargoChanged
+		}
+
+		completed := completedLegs(events.QueryHandlingHistory(id), current.Itinerary)
+		for _, r := range routes {
+			itinerary = cargo.Itinerary{Legs: append(append([]cargo.Leg{}, completed...), r.Legs...)}
+			if !satisfies(current.RouteSpecification, itinerary) {
+				continue
+			}
+			current.AssignToRoute(itinerary)
+			return cargos.Store(current)
+		}
+		return ErrNoRoute
+	})
+	if err != nil {
+		return cargo.Itinerary{}, err
+	}
+	return itinerary, nil
+}
+
+// rerouteFrom returns where a new route of c starts: where it is, if it's in
+// port, or its origin if it hasn't been received yet.
+func rerouteFrom(c *cargo.Cargo) (location.UNLocode, error) {
+	switch c.Delivery.TransportStatus {
+	case cargo.NotReceived:
+		return c.RouteSpecification.Origin, nil
+	case cargo.InPort:
+		return c.Delivery.LastKnownLocation, nil
+	default:
+		return "", ErrCannotReroute
+	}
+}
+
+// sameLegs tells whether a and b have the same legs, at the same times.
+func sameLegs(a, b cargo.Itinerary) bool {
+	if len(a.Legs) != len(b.Legs) {
+		return false
+	}
+	for i, l := range a.Legs {
+		m := b.Legs[i]
+		if l.VoyageNumber != m.VoyageNumber || l.LoadLocation != m.LoadLocation || l.UnloadLocation != m.UnloadLocation ||
+			!l.LoadTime.Equal(m.LoadTime) || !l.UnloadTime.Equal(m.UnloadTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// completedLegs returns the legs the cargo was loaded and unloaded on, as
+// recorded in its handling history, which differ from the ones of its
+// itinerary if it was misdirected. The times are those of the itinerary, if
+// it has the same voyage there, and otherwise those the cargo was actually
+// loaded and unloaded at.
+func completedLegs(h cargo.HandlingHistory, itinerary cargo.Itinerary) []cargo.Leg {
+	var (
+		legs []cargo.Leg
+		load *cargo.HandlingEvent
+	)
+	for _, e := range h.HandlingEvents {
+		e := e
+		a := e.Activity
+		switch a.Type {
+		case cargo.Load:
+			load = &e
+		case cargo.Unload:
+			if load != nil && load.Activity.VoyageNumber == a.VoyageNumber {
+				leg := cargo.Leg{
+					VoyageNumber:   a.VoyageNumber,
+					LoadLocation:   load.Activity.Location,
+					UnloadLocation: a.Location,
+					LoadTime:       load.CompletionTime,
+					UnloadTime:     e.CompletionTime,
+				}
+				for _, l := range itinerary.Legs {
+					if l.VoyageNumber == leg.VoyageNumber && l.LoadLocation == leg.LoadLocation {
+						leg.LoadTime = l.LoadTime
+					}
+					if l.VoyageNumber == leg.VoyageNumber && l.UnloadLocation == leg.UnloadLocation {
+						leg.UnloadTime = l.UnloadTime
+					}
+				}
+				legs = append(legs, leg)
+			}
+			load = nil
+		}
+	}
+	return legs
+}
+
+// satisfies tells whether itinerary is a route from the origin of rs to its
+// destination, without gaps, that arrives before its deadline.
+func satisfies(rs cargo.RouteSpecification, itinerary cargo.Itinerary) bool {
+	if !rs.IsSatisfiedBy(itinerary) || itinerary.IsEmpty() {
+		return false
+	}
+	for i := 1; i < len(itinerary.Legs); i++ {
+		if itinerary.Legs[i].LoadLocation != itinerary.Legs[i-1].UnloadLocation {
+			return false
+		}
+	}
+	return rs.ArrivalDeadline.IsZero() || !itinerary.FinalArrivalTime().After(rs.ArrivalDeadline)
+}
+
+func (s *service) Cargos(f CargoFilter) ([]Cargo, int) {
+	return s.views.Cargos(f)
 }
 
 func (s *service) Locations() []Location {
@@ -157,13 +319,17 @@ func (s *service) Locations() []Location {
 	return result
 }
 
-// NewService creates a booking service with necessary dependencies.
-func NewService(cargos cargo.Repository, locations location.Repository, events cargo.HandlingEventRepository, rs routing.Service) Service {
+// NewService creates a booking service with necessary dependencies. Cargos
+// are read from cargos, but changed in units of work of u, over the same
+// storage, so that they're serialized with the handling of cargos. They're
+// listed from views, which must be kept up to date with both.
+func NewService(cargos cargo.Repository, locations location.Repository, u cargo.UnitOfWork, rs routing.Service, views *Projection) Service {
 	return &service{
 		cargos:         cargos,
 		locations:      locations,
-		handlingEvents: events,
+		unitOfWork:     u,
 		routingService: rs,
+		views:          views,
 	}
 }
 
@@ -179,17 +345,19 @@ type Cargo struct {
 	Destination     string      `json:"destination"`
 	Legs            []cargo.Leg `json:"legs,omitempty"`
 	Misrouted       bool        `json:"misrouted"`
+	NeedsRerouting  bool        `json:"needs_rerouting"`
 	Origin          string      `json:"origin"`
 	Routed          bool        `json:"routed"`
 	TrackingID      string      `json:"tracking_id"`
 }
 
-func assemble(c *cargo.Cargo, events cargo.HandlingEventRepository) Cargo {
+func assemble(c *cargo.Cargo) Cargo {
 	return Cargo{
 		TrackingID:      string(c.TrackingID),
 		Origin:          string(c.Origin),
 		Destination:     string(c.RouteSpecification.Destination),
 		Misrouted:       c.Delivery.RoutingStatus == cargo.Misrouted,
+		NeedsRerouting:  c.NeedsRerouting,
 		Routed:          !c.Itinerary.IsEmpty(),
 		ArrivalDeadline: c.RouteSpecification.ArrivalDeadline,
 		Legs:            c.Itinerary.Legs,
@@ -0,0 +1,351 @@
+package booking
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/inmem"
+	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/projection"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+// routingService routes cargos on the itineraries from their origin.
+type routingService map[location.UNLocode][]cargo.Itinerary
+
+func (s routingService) FetchRoutesForSpecification(rs cargo.RouteSpecification) []cargo.Itinerary {
+	return s[rs.Origin]
+}
+
+var (
+	start = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	day   = func(n int) time.Time { return start.AddDate(0, 0, n) }
+)
+
+// newMisdirectedCargo stores a cargo from SESTO to CNHKG by way of DEHAM that
+// was unloaded in NLRTM instead of CNHKG.
+func newMisdirectedCargo(t *testing.T, cargos cargo.Repository, events cargo.HandlingEventRepository) *cargo.Cargo {
+	c := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: day(20),
+	})
+	c.AssignToRoute(cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg("V100", location.SESTO, location.DEHAM, day(1), day(3)),
+		cargo.NewLeg("V300", location.DEHAM, location.CNHKG, day(4), day(12)),
+	}})
+	for _, e := range []struct {
+		a         cargo.HandlingActivity
+		completed time.Time
+	}{
+		{cargo.HandlingActivity{Type: cargo.Receive, Location: location.SESTO}, day(0)},
+		{cargo.HandlingActivity{Type: cargo.Load, Location: location.SESTO, VoyageNumber: "V100"}, day(1)},
+		{cargo.HandlingActivity{Type: cargo.Unload, Location: location.DEHAM, VoyageNumber: "V100"}, day(3)},
+		{cargo.HandlingActivity{Type: cargo.Load, Location: location.DEHAM, VoyageNumber: "V300"}, day(4)},
+		{cargo.HandlingActivity{Type: cargo.Unload, Location: location.NLRTM, VoyageNumber: "V300"}, day(7)},
+	} {
+		handle(t, cargos, events, c, e.a, e.completed)
+	}
+	if !c.Delivery.IsMisdirected {
+		t.Fatalf("want the cargo misdirected, have %+v", c.Delivery)
+	}
+	return c
+}
+
+// handle stores a handling event of c, and derives its delivery, as
+// registering the event would.
+func handle(t *testing.T, cargos cargo.Repository, events cargo.HandlingEventRepository, c *cargo.Cargo, a cargo.HandlingActivity, completed time.Time) {
+	if err := events.Store(cargo.HandlingEvent{TrackingID: c.TrackingID, Activity: a, CompletionTime: completed}); err != nil {
+		t.Fatal(err)
+	}
+	c.DeriveDeliveryProgress(events.QueryHandlingHistory(c.TrackingID))
+	if err := cargos.Store(c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRerouteCargo(t *testing.T) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	rs := routingService{
+		location.NLRTM: {
+			{Legs: []cargo.Leg{cargo.NewLeg("0400S", location.NLRTM, location.CNHKG, day(8), day(30))}}, // too late
+			{Legs: []cargo.Leg{cargo.NewLeg("0300A", location.NLRTM, location.CNHKG, day(9), day(15))}},
+		},
+	}
+	s := NewService(cargos, inmem.NewLocationRepository(), inmem.NewUnitOfWork(cargos, events), rs, NewProjection())
+	c := newMisdirectedCargo(t, cargos, events)
+
+	// The new route starts with the legs the cargo completed, including the
+	// one it was misdirected on, which was unloaded when it happened rather
+	// than as planned, and continues from where it is.
+	want := cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg("V100", location.SESTO, location.DEHAM, day(1), day(3)),
+		cargo.NewLeg("V300", location.DEHAM, location.NLRTM, day(4), day(7)),
+		cargo.NewLeg("0300A", location.NLRTM, location.CNHKG, day(9), day(15)),
+	}}
+	have, err := s.RerouteCargo(c.TrackingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v", want, have)
+	}
+	c, _ = cargos.Find(c.TrackingID)
+	if !reflect.DeepEqual(want, c.Itinerary) || c.Delivery.IsMisdirected || c.Delivery.RoutingStatus != cargo.Routed {
+		t.Errorf("want the cargo routed on %+v, and no longer misdirected, have %+v", want, c)
+	}
+
+	// There's no route if none arrives in time.
+	rs[location.NLRTM] = rs[location.NLRTM][:1]
+	if _, err := s.RerouteCargo(c.TrackingID); err != ErrNoRoute {
+		t.Errorf("want %v, have %v", ErrNoRoute, err)
+	}
+
+	// Cargos on board can't be rerouted.
+	handle(t, cargos, events, c, cargo.HandlingActivity{Type: cargo.Load, Location: location.NLRTM, VoyageNumber: "0300A"}, day(9))
+	if _, err := s.RerouteCargo(c.TrackingID); err != ErrCannotReroute {
+		t.Errorf("want %v, have %v", ErrCannotReroute, err)
+	}
+
+	if _, err := s.RerouteCargo("XYZ789"); err != cargo.ErrUnknown {
+		t.Errorf("want %v, have %v", cargo.ErrUnknown, err)
+	}
+}
+
+// failingUnitOfWork fails units of work after their work succeeds, as if
+// they failed to commit.
+type failingUnitOfWork struct {
+	cargo.UnitOfWork
+	err error
+}
+
+func (u failingUnitOfWork) Do(work func(cargo.Repository, cargo.HandlingEventRepository) error) error {
+	return u.UnitOfWork.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		if err := work(cargos, events); err != nil {
+			return err
+		}
+		return u.err
+	})
+}
+
+func TestRerouteCargoRollsBack(t *testing.T) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	rs := routingService{
+		location.NLRTM: {
+			{Legs: []cargo.Leg{cargo.NewLeg("0300A", location.NLRTM, location.CNHKG, day(9), day(15))}},
+		},
+	}
+	errFailed := errors.New("failed")
+	s := NewService(cargos, inmem.NewLocationRepository(), failingUnitOfWork{inmem.NewUnitOfWork(cargos, events), errFailed}, rs, NewProjection())
+	c := newMisdirectedCargo(t, cargos, events)
+
+	if _, err := s.RerouteCargo(c.TrackingID); err != errFailed {
+		t.Errorf("want %v, have %v", errFailed, err)
+	}
+	if have, _ := cargos.Find(c.TrackingID); !reflect.DeepEqual(c.Itinerary, have.Itinerary) {
+		t.Errorf("want the route rolled back to %+v, have %+v", c.Itinerary, have.Itinerary)
+	}
+}
+
+// routingFunc routes cargos with a func.
+type routingFunc func(cargo.RouteSpecification) []cargo.Itinerary
+
+func (f routingFunc) FetchRoutesForSpecification(rs cargo.RouteSpecification) []cargo.Itinerary {
+	return f(rs)
+}
+
+// trackingUnitOfWork tells whether a unit of work is running.
+type trackingUnitOfWork struct {
+	cargo.UnitOfWork
+	running *bool
+}
+
+func (u trackingUnitOfWork) Do(work func(cargo.Repository, cargo.HandlingEventRepository) error) error {
+	return u.UnitOfWork.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		*u.running = true
+		defer func() { *u.running = false }()
+		return work(cargos, events)
+	})
+}
+
+func TestRerouteCargoRoutesOutsideUnitOfWork(t *testing.T) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	var running, handled bool
+	var c *cargo.Cargo
+	rs := routingFunc(func(cargo.RouteSpecification) []cargo.Itinerary {
+		if running {
+			t.Error("want routes fetched outside of the unit of work, have them fetched within")
+		}
+		// The cargo is handled while it's being routed.
+		if !handled {
+			handled = true
+			handle(t, cargos, events, c, cargo.HandlingActivity{Type: cargo.Load, Location: location.NLRTM, VoyageNumber: "0300A"}, day(8))
+			handle(t, cargos, events, c, cargo.HandlingActivity{Type: cargo.Unload, Location: location.CNHKG, VoyageNumber: "0300A"}, day(14))
+		}
+		return []cargo.Itinerary{{Legs: []cargo.Leg{cargo.NewLeg("0300A", location.NLRTM, location.CNHKG, day(9), day(15))}}}
+	})
+	s := NewService(cargos, inmem.NewLocationRepository(), trackingUnitOfWork{inmem.NewUnitOfWork(cargos, events), &running}, rs, NewProjection())
+	c = newMisdirectedCargo(t, cargos, events)
+
+	// Those routes start where it no longer is.
+	if _, err := s.RerouteCargo(c.TrackingID); err != ErrCargoChanged {
+		t.Errorf("want %v, have %v", ErrCargoChanged, err)
+	}
+
+	// Rerouting it again routes it from where it is now, at its
+	// destination.
+	want := cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg("V100", location.SESTO, location.DEHAM, day(1), day(3)),
+		cargo.NewLeg("V300", location.DEHAM, location.NLRTM, day(4), day(7)),
+		cargo.NewLeg("0300A", location.NLRTM, location.CNHKG, day(8), day(14)),
+	}}
+	if have, err := s.RerouteCargo(c.TrackingID); err != nil || !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v (%v)", want, have, err)
+	}
+}
+
+func TestHTTPRerouteCargo(t *testing.T) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	rs := routingService{
+		location.NLRTM: {
+			{Legs: []cargo.Leg{cargo.NewLeg(voyage.V0300A.Number, location.NLRTM, location.CNHKG, day(9), day(15))}},
+		},
+	}
+	srv := httptest.NewServer(MakeHandler(NewService(cargos, inmem.NewLocationRepository(), inmem.NewUnitOfWork(cargos, events), rs, NewProjection()), log.NewNopLogger()))
+	defer srv.Close()
+	c := newMisdirectedCargo(t, cargos, events)
+
+	resp, err := http.Post(srv.URL+"/booking/v1/cargos/"+string(c.TrackingID)+"/reroute", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Itinerary cargo.Itinerary `json:"itinerary"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body.Itinerary.Legs) != 3 {
+		t.Errorf("want %d and 3 legs, have %d and %+v", http.StatusOK, resp.StatusCode, body.Itinerary)
+	}
+
+	// Without a route, it's a conflict with the state of the cargo.
+	rs[location.NLRTM] = nil
+	for id, want := range map[string]int{
+		string(c.TrackingID): http.StatusConflict,
+		"XYZ789":             http.StatusNotFound,
+	} {
+		resp, err := http.Post(srv.URL+"/booking/v1/cargos/"+id+"/reroute", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("POST /booking/v1/cargos/%s/reroute: want %d, have %d", id, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestHTTPListCargos(t *testing.T) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	views := NewProjection()
+	p := projection.New(cargos, events, views)
+	s := NewService(p.Cargos(), inmem.NewLocationRepository(), p.UnitOfWork(inmem.NewUnitOfWork(cargos, events)), nil, views)
+	srv := httptest.NewServer(MakeHandler(s, log.NewNopLogger()))
+	defer srv.Close()
+
+	// A routed cargo, one that isn't routed yet, and one that's misrouted
+	// after a change of destination.
+	for _, c := range []struct {
+		destination location.UNLocode
+		deadline    time.Time
+		route       []cargo.Leg
+	}{
+		{location.CNHKG, day(10), []cargo.Leg{cargo.NewLeg("V100", location.SESTO, location.CNHKG, day(1), day(8))}},
+		{location.CNHKG, day(20), nil},
+		{location.DEHAM, day(20), []cargo.Leg{cargo.NewLeg("V200", location.SESTO, location.USNYC, day(1), day(8))}},
+	} {
+		id, err := s.BookNewCargo(location.SESTO, c.destination, c.deadline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.route != nil {
+			if err := s.AssignCargoToRoute(id, cargo.Itinerary{Legs: c.route}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for query, want := range map[string][2]int{
+		"":                  {3, 3},
+		"routed=true":       {2, 2},
+		"routed=false":      {1, 1},
+		"misrouted=true":    {1, 1},
+		"destination=CNHKG": {2, 2},
+		"deadline_from=" + day(15).Format(time.RFC3339): {2, 2},
+		"deadline_to=" + day(10).Format(time.RFC3339):   {1, 1},
+		"routed=true&destination=CNHKG":                 {1, 1},
+		"limit=2":                                       {2, 3},
+		"offset=2&limit=2":                              {1, 3},
+		"offset=3":                                      {0, 3},
+	} {
+		resp, err := http.Get(srv.URL + "/booking/v1/cargos?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Cargos []Cargo `json:"cargos"`
+			Total  int     `json:"total"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := [2]int{len(body.Cargos), body.Total}; have != want {
+			t.Errorf("GET /booking/v1/cargos?%s: want %v cargos and total, have %v", query, want, have)
+		}
+	}
+
+	for _, query := range []string{"routed=maybe", "limit=-1", "deadline_to=tomorrow"} {
+		resp, err := http.Get(srv.URL + "/booking/v1/cargos?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /booking/v1/cargos?%s: want %d, have %d", query, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+}
+
+func TestProjectionRebuild(t *testing.T) {
+	p := NewProjection()
+	a := cargo.New("ABC123", cargo.RouteSpecification{Origin: location.SESTO, Destination: location.CNHKG})
+	b := cargo.New("XYZ789", cargo.RouteSpecification{Origin: location.SESTO, Destination: location.DEHAM})
+	p.Project(a, cargo.HandlingHistory{})
+
+	// The read models being rebuilt replace the current ones only once
+	// they're complete.
+	p.Rebuild(func(project func(*cargo.Cargo, cargo.HandlingHistory)) {
+		project(b, cargo.HandlingHistory{})
+		if cargos, total := p.Cargos(CargoFilter{}); total != 1 || cargos[0].TrackingID != string(a.TrackingID) {
+			t.Errorf("Cargos while rebuilding: want %s, have %+v", a.TrackingID, cargos)
+		}
+	})
+	if cargos, total := p.Cargos(CargoFilter{}); total != 1 || cargos[0].TrackingID != string(b.TrackingID) {
+		t.Errorf("Cargos after rebuilding: want %s, have %+v", b.TrackingID, cargos)
+	}
+	if _, err := p.Find(a.TrackingID); err != cargo.ErrUnknown {
+		t.Errorf("Find(%s) after rebuilding: want %v, have %v", a.TrackingID, cargo.ErrUnknown, err)
+	}
+}
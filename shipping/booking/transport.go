@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -54,6 +55,12 @@ func MakeHandler(bs Service, logger kitlog.Logger) http.Handler {
 		encodeResponse,
 		opts...,
 	)
+	rerouteHandler := kithttp.NewServer(
+		makeRerouteEndpoint(bs),
+		decodeRerouteRequest,
+		encodeResponse,
+		opts...,
+	)
 	listCargosHandler := kithttp.NewServer(
 		makeListCargosEndpoint(bs),
 		decodeListCargosRequest,
@@ -75,6 +82,7 @@ func MakeHandler(bs Service, logger kitlog.Logger) http.Handler {
 	r.Handle("/booking/v1/cargos/{id}/request_routes", requestRoutesHandler).Methods("GET")
 	r.Handle("/booking/v1/cargos/{id}/assign_to_route", assignToRouteHandler).Methods("POST")
 	r.Handle("/booking/v1/cargos/{id}/change_destination", changeDestinationHandler).Methods("POST")
+	r.Handle("/booking/v1/cargos/{id}/reroute", rerouteHandler).Methods("POST")
 	r.Handle("/booking/v1/locations", listLocationsHandler).Methods("GET")
 
 	return r
@@ -157,8 +165,75 @@ func decodeChangeDestinationRequest(_ context.Context, r *http.Request) (interfa
 	}, nil
 }
 
+func decodeRerouteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	return rerouteRequest{ID: cargo.TrackingID(id)}, nil
+}
+
 func decodeListCargosRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	return listCargosRequest{}, nil
+	q := r.URL.Query()
+
+	var (
+		f   CargoFilter
+		err error
+	)
+	if f.Routed, err = parseBool(q.Get("routed")); err != nil {
+		return nil, ErrInvalidArgument
+	}
+	if f.Misrouted, err = parseBool(q.Get("misrouted")); err != nil {
+		return nil, ErrInvalidArgument
+	}
+	f.Destination = location.UNLocode(q.Get("destination"))
+	if f.DeadlineFrom, err = parseTime(q.Get("deadline_from")); err != nil {
+		return nil, ErrInvalidArgument
+	}
+	if f.DeadlineTo, err = parseTime(q.Get("deadline_to")); err != nil {
+		return nil, ErrInvalidArgument
+	}
+	if f.Offset, err = parseCount(q.Get("offset")); err != nil {
+		return nil, ErrInvalidArgument
+	}
+	if f.Limit, err = parseCount(q.Get("limit")); err != nil {
+		return nil, ErrInvalidArgument
+	}
+
+	return listCargosRequest{Filter: f}, nil
+}
+
+func parseBool(s string) (*bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func parseCount(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, ErrInvalidArgument
+	}
+	return n, nil
 }
 
 func decodeListLocationsRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -186,6 +261,8 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 		w.WriteHeader(http.StatusNotFound)
 	case ErrInvalidArgument:
 		w.WriteHeader(http.StatusBadRequest)
+	case ErrCannotReroute, ErrNoRoute, ErrCargoChanged:
+		w.WriteHeader(http.StatusConflict)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
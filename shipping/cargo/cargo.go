@@ -21,6 +21,22 @@ type Cargo struct {
 	RouteSpecification RouteSpecification
 	Itinerary          Itinerary
 	Delivery           Delivery
+
+	// NeedsRerouting is set for cargos that need a new route, for example
+	// because they've been misdirected, until they're assigned to one.
+	NeedsRerouting bool
+
+	// Reroutings are the times this cargo was assigned to a new route after
+	// it had one, oldest first.
+	Reroutings []Rerouting
+}
+
+// Rerouting records a cargo being assigned to a new route, and how that
+// recalculated its estimated time of arrival.
+type Rerouting struct {
+	Time        time.Time
+	PreviousETA time.Time
+	ETA         time.Time
 }
 
 // SpecifyNewRoute specifies a new route for this cargo.
@@ -29,10 +45,29 @@ func (c *Cargo) SpecifyNewRoute(rs RouteSpecification) {
 	c.Delivery = c.Delivery.UpdateOnRouting(c.RouteSpecification, c.Itinerary)
 }
 
-// AssignToRoute attaches a new itinerary to this cargo.
+// AssignToRoute attaches a new itinerary to this cargo, and records it as a
+// rerouting if it replaces another one.
 func (c *Cargo) AssignToRoute(itinerary Itinerary) {
+	rerouted := !c.Itinerary.IsEmpty()
+	previousETA := c.Delivery.ETA
+
 	c.Itinerary = itinerary
+	c.NeedsRerouting = false
 	c.Delivery = c.Delivery.UpdateOnRouting(c.RouteSpecification, c.Itinerary)
+
+	if rerouted {
+		// Don't append in place, to the array of shallow copies of c.
+		c.Reroutings = append(c.Reroutings[:len(c.Reroutings):len(c.Reroutings)], Rerouting{
+			Time:        time.Now(),
+			PreviousETA: previousETA,
+			ETA:         c.Delivery.ETA,
+		})
+	}
+}
+
+// FlagForRerouting flags this cargo as one that needs a new route.
+func (c *Cargo) FlagForRerouting() {
+	c.NeedsRerouting = true
 }
 
 // DeriveDeliveryProgress updates all aspects of the cargo aggregate status
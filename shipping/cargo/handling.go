@@ -30,6 +30,11 @@ type HandlingActivity struct {
 type HandlingEvent struct {
 	TrackingID TrackingID
 	Activity   HandlingActivity
+
+	// CompletionTime is when the cargo was handled, and RegistrationTime
+	// when that was registered.
+	CompletionTime   time.Time
+	RegistrationTime time.Time
 }
 
 // HandlingEventType describes type of a handling event.
@@ -80,10 +85,19 @@ func (h HandlingHistory) MostRecentlyCompletedEvent() (HandlingEvent, error) {
 
 // HandlingEventRepository provides access a handling event store.
 type HandlingEventRepository interface {
-	Store(e HandlingEvent)
+	Store(e HandlingEvent) error
 	QueryHandlingHistory(TrackingID) HandlingHistory
 }
 
+// UnitOfWork runs work against the cargo and handling event repositories as a
+// transaction: the changes work makes through the repositories it's given are
+// committed together if it returns nil, and rolled back if it returns an
+// error, which Do then returns. Concurrent units of work don't see each
+// other's changes before they're committed.
+type UnitOfWork interface {
+	Do(work func(cargos Repository, events HandlingEventRepository) error) error
+}
+
 // HandlingEventFactory creates handling events.
 type HandlingEventFactory struct {
 	CargoRepository    Repository
@@ -117,5 +131,7 @@ func (f *HandlingEventFactory) CreateHandlingEvent(registered time.Time, complet
 			Location:     unLocode,
 			VoyageNumber: voyageNumber,
 		},
+		CompletionTime:   completed,
+		RegistrationTime: registered,
 	}, nil
 }
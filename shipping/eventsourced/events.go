@@ -0,0 +1,157 @@
+// Package eventsourced provides implementations of the cargo and handling
+// event repositories that store what happened to cargos as a log of events,
+// rather than their current state, which they derive from the events.
+package eventsourced
+
+import (
+	"time"
+
+	"github.com/go-kit/examples/shipping/cargo"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+// The types of events that happen to cargos.
+const (
+	CargoBooked        EventType = "CargoBooked"
+	RouteAssigned      EventType = "RouteAssigned"
+	DestinationChanged EventType = "DestinationChanged"
+	ReroutingRequested EventType = "ReroutingRequested"
+	CargoHandled       EventType = "CargoHandled"
+)
+
+// Event is something that happened to a cargo. Which of the optional fields
+// it has depends on its type.
+type Event struct {
+	TrackingID cargo.TrackingID `json:"tracking_id"`
+	Version    int              `json:"version"` // of the cargo after the event, from 1
+	Type       EventType        `json:"type"`
+	Time       time.Time        `json:"time"`
+
+	// CargoBooked and DestinationChanged events have the route specification
+	// of the cargo, and RouteAssigned events its itinerary, and the rerouting
+	// if it replaced another one.
+	RouteSpecification *cargo.RouteSpecification `json:"route_specification,omitempty"`
+	Itinerary          *cargo.Itinerary          `json:"itinerary,omitempty"`
+	Rerouting          *cargo.Rerouting          `json:"rerouting,omitempty"`
+
+	// CargoHandled events have the handling event.
+	HandlingEvent *cargo.HandlingEvent `json:"handling_event,omitempty"`
+}
+
+// state is a cargo, and its handling history, as of a version.
+type state struct {
+	version int
+	cargo   *cargo.Cargo // nil until it's booked
+	history []cargo.HandlingEvent
+}
+
+// apply returns the state after e. It leaves s unchanged, so that states can
+// be kept as snapshots.
+func (s state) apply(e Event) state {
+	next := state{version: e.Version, history: s.history}
+	if s.cargo != nil {
+		c := *s.cargo
+		next.cargo = &c
+	}
+	switch e.Type {
+	case CargoBooked:
+		next.cargo = cargo.New(e.TrackingID, *e.RouteSpecification)
+	case DestinationChanged:
+		if next.cargo != nil {
+			next.cargo.RouteSpecification = *e.RouteSpecification
+		}
+	case RouteAssigned:
+		if next.cargo != nil {
+			next.cargo.Itinerary = *e.Itinerary
+			next.cargo.NeedsRerouting = false
+			if e.Rerouting != nil {
+				rs := next.cargo.Reroutings
+				next.cargo.Reroutings = append(rs[:len(rs):len(rs)], *e.Rerouting)
+			}
+		}
+	case ReroutingRequested:
+		if next.cargo != nil {
+			next.cargo.NeedsRerouting = true
+		}
+	case CargoHandled:
+		next.history = append(append([]cargo.HandlingEvent(nil), s.history...), *e.HandlingEvent)
+	}
+	return next
+}
+
+// current returns the cargo of s, with its delivery derived from its route
+// and handling history, or ErrUnknown if it hasn't been booked.
+func (s state) current() (*cargo.Cargo, error) {
+	if s.cargo == nil {
+		return nil, cargo.ErrUnknown
+	}
+	c := *s.cargo
+	c.Delivery = cargo.DeriveDeliveryFrom(c.RouteSpecification, c.Itinerary, s.handlingHistory())
+	return &c, nil
+}
+
+func (s state) handlingHistory() cargo.HandlingHistory {
+	return cargo.HandlingHistory{HandlingEvents: append([]cargo.HandlingEvent(nil), s.history...)}
+}
+
+// changes returns the events that change the cargo of s into c.
+func (s state) changes(c *cargo.Cargo) []Event {
+	var events []Event
+	if s.cargo == nil {
+		rs := c.RouteSpecification
+		events = append(events, Event{Type: CargoBooked, RouteSpecification: &rs})
+		if !c.Itinerary.IsEmpty() {
+			it := c.Itinerary
+			events = append(events, Event{Type: RouteAssigned, Itinerary: &it, Rerouting: lastRerouting(c, 0)})
+		}
+		if c.NeedsRerouting {
+			events = append(events, Event{Type: ReroutingRequested})
+		}
+		return events
+	}
+	if !sameRouteSpecification(c.RouteSpecification, s.cargo.RouteSpecification) {
+		rs := c.RouteSpecification
+		events = append(events, Event{Type: DestinationChanged, RouteSpecification: &rs})
+	}
+	rerouted := false
+	if !sameItinerary(c.Itinerary, s.cargo.Itinerary) {
+		it := c.Itinerary
+		events = append(events, Event{Type: RouteAssigned, Itinerary: &it, Rerouting: lastRerouting(c, len(s.cargo.Reroutings))})
+		rerouted = true
+	}
+	if c.NeedsRerouting && (rerouted || !s.cargo.NeedsRerouting) {
+		events = append(events, Event{Type: ReroutingRequested})
+	}
+	return events
+}
+
+// lastRerouting returns the last rerouting of c, if it has more than n.
+func lastRerouting(c *cargo.Cargo, n int) *cargo.Rerouting {
+	if len(c.Reroutings) <= n {
+		return nil
+	}
+	r := c.Reroutings[len(c.Reroutings)-1]
+	return &r
+}
+
+// sameRouteSpecification and sameItinerary compare times with Equal, since
+// the ones decoded from events may have other locations.
+func sameRouteSpecification(a, b cargo.RouteSpecification) bool {
+	return a.Origin == b.Origin && a.Destination == b.Destination && a.ArrivalDeadline.Equal(b.ArrivalDeadline)
+}
+
+func sameItinerary(a, b cargo.Itinerary) bool {
+	if len(a.Legs) != len(b.Legs) {
+		return false
+	}
+	for i := range a.Legs {
+		x, y := a.Legs[i], b.Legs[i]
+		if x.VoyageNumber != y.VoyageNumber || x.LoadLocation != y.LoadLocation || x.UnloadLocation != y.UnloadLocation ||
+			!x.LoadTime.Equal(y.LoadTime) || !x.UnloadTime.Equal(y.UnloadTime) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package eventsourced
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/inmem"
+	"github.com/go-kit/examples/shipping/internal/repotest"
+	"github.com/go-kit/examples/shipping/location"
+)
+
+func TestRepositories(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		r := NewRepository(NewLog(), 2)
+		return repotest.Repositories{
+			Cargos:         r.Cargos(),
+			Locations:      inmem.NewLocationRepository(),
+			Voyages:        inmem.NewVoyageRepository(),
+			HandlingEvents: r.HandlingEvents(),
+			UnitOfWork:     r.UnitOfWork(),
+		}
+	})
+}
+
+var deadline = time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+
+// book stores a cargo in r that's routed, rerouted to another destination,
+// and handled along the way.
+func book(t *testing.T, r *Repository) *cargo.Cargo {
+	cargos, events := r.Cargos(), r.HandlingEvents()
+	c := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: deadline,
+	})
+	store := func() {
+		if err := cargos.Store(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handle := func(typ cargo.HandlingEventType, loc location.UNLocode) {
+		e := cargo.HandlingEvent{TrackingID: c.TrackingID, Activity: cargo.HandlingActivity{Type: typ, Location: loc, VoyageNumber: "V100"}}
+		if err := events.Store(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store()
+	c.AssignToRoute(cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg("V100", location.SESTO, location.DEHAM, deadline.AddDate(0, 0, -10), deadline.AddDate(0, 0, -8)),
+		cargo.NewLeg("V100", location.DEHAM, location.CNHKG, deadline.AddDate(0, 0, -7), deadline.AddDate(0, 0, -1)),
+	}})
+	store()
+	handle(cargo.Receive, location.SESTO)
+	handle(cargo.Load, location.SESTO)
+	handle(cargo.Unload, location.DEHAM)
+	c.SpecifyNewRoute(cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.NLRTM,
+		ArrivalDeadline: deadline,
+	})
+	c.FlagForRerouting()
+	store()
+	return c
+}
+
+func TestRepository(t *testing.T) {
+	log := NewLog()
+	r := NewRepository(log, 3)
+	book(t, r)
+
+	var types []EventType
+	for _, e := range log.Events("ABC123", 0) {
+		types = append(types, e.Type)
+	}
+	want := []EventType{CargoBooked, RouteAssigned, CargoHandled, CargoHandled, CargoHandled, DestinationChanged, ReroutingRequested}
+	if !reflect.DeepEqual(want, types) {
+		t.Errorf("want events %v, have %v", want, types)
+	}
+
+	// The delivery is derived from the handling history.
+	c, err := r.Cargos().Find("ABC123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Delivery.LastKnownLocation != location.DEHAM || c.Delivery.RoutingStatus != cargo.Misrouted || !c.NeedsRerouting {
+		t.Errorf("want the cargo in DEHAM, misrouted and flagged for rerouting, have %+v", c)
+	}
+
+	// Storing a cargo without changes appends no events.
+	if err := r.Cargos().Store(c); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(log.Events("ABC123", 0)); n != len(want) {
+		t.Errorf("want %d events after storing the same cargo, have %d", len(want), n)
+	}
+
+	// A snapshot was taken, and cargos are the same with or without it.
+	if v := r.snapshots["ABC123"].version; v == 0 {
+		t.Error("want a snapshot, have none")
+	}
+	have, err := NewRepository(log, 0).Cargos().Find("ABC123")
+	if err != nil || !reflect.DeepEqual(c, have) {
+		t.Errorf("without snapshots: want %+v, have %+v (%v)", c, have, err)
+	}
+
+	// Reroutings are recorded with the route assigned.
+	c.AssignToRoute(cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg("V100", location.SESTO, location.DEHAM, deadline.AddDate(0, 0, -10), deadline.AddDate(0, 0, -8)),
+		cargo.NewLeg("V200", location.DEHAM, location.NLRTM, deadline.AddDate(0, 0, -6), deadline.AddDate(0, 0, -5)),
+	}})
+	if err := r.Cargos().Store(c); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*Repository{r, NewRepository(log, 0)} {
+		have, err := r.Cargos().Find("ABC123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(have.Reroutings) != 1 || !have.Reroutings[0].ETA.Equal(deadline.AddDate(0, 0, -5)) {
+			t.Errorf("want the cargo rerouted to arrive %v, have %+v", deadline.AddDate(0, 0, -5), have.Reroutings)
+		}
+	}
+}
+
+func TestOpenLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shipping.events")
+	log, err := OpenLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := book(t, NewRepository(log, 0))
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash while appending.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"tracking_id":"ABC123","vers`)
+	f.Close()
+
+	log, err = OpenLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	r := NewRepository(log, 0)
+	have, err := r.Cargos().Find("ABC123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have.RouteSpecification.Destination != c.RouteSpecification.Destination || len(have.Itinerary.Legs) != 2 || have.Delivery.LastKnownLocation != location.DEHAM {
+		t.Errorf("want %+v, have %+v", c, have)
+	}
+
+	// The partial line is gone, and appending continues after the events.
+	if err := r.HandlingEvents().Store(cargo.HandlingEvent{TrackingID: "ABC123", Activity: cargo.HandlingActivity{Type: cargo.Claim, Location: location.DEHAM}}); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	if log, err = OpenLog(path); err != nil {
+		t.Fatal(err)
+	}
+	if h := NewRepository(log, 0).HandlingEvents().QueryHandlingHistory("ABC123"); len(h.HandlingEvents) != 4 {
+		t.Errorf("want 4 handling events, have %+v", h.HandlingEvents)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	log := NewLog()
+	r := NewRepository(log, 2)
+	book(t, r)
+	r.HandlingEvents().Store(cargo.HandlingEvent{TrackingID: "XYZ789", Activity: cargo.HandlingActivity{Type: cargo.Receive, Location: location.SESTO}})
+
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	if err := Replay(log, cargos, events); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []cargo.TrackingID{"ABC123", "XYZ789"} {
+		want, wantErr := r.Cargos().Find(id)
+		have, haveErr := cargos.Find(id)
+		if !reflect.DeepEqual(want, have) || wantErr != haveErr {
+			t.Errorf("Find(%s): want %+v (%v), have %+v (%v)", id, want, wantErr, have, haveErr)
+		}
+		if want, have := r.HandlingEvents().QueryHandlingHistory(id), events.QueryHandlingHistory(id); !reflect.DeepEqual(want, have) {
+			t.Errorf("QueryHandlingHistory(%s): want %+v, have %+v", id, want, have)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package eventsourced
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-kit/examples/shipping/cargo"
+)
+
+// Log is an append-only log of events. It keeps all of them in memory, and,
+// if it was opened from a file, in that file too, one JSON event per line.
+type Log struct {
+	mtx    sync.RWMutex
+	events []Event
+	byID   map[cargo.TrackingID][]int // indexes into events
+	ids    []cargo.TrackingID         // in the order of their first event
+	f      *os.File                   // nil if the log is only in memory
+}
+
+// NewLog returns an empty log, which is lost when the process stops.
+func NewLog() *Log {
+	return &Log{byID: make(map[cargo.TrackingID][]int)}
+}
+
+// OpenLog opens the log in the file at path, creating it if it doesn't
+// exist. A last line that was only partially written, if the process stopped
+// while appending, is dropped.
+func OpenLog(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := NewLog()
+	var (
+		rd     = bufio.NewReader(f)
+		offset int64
+	)
+	for n := 1; ; n++ {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		l.add(e)
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.f = f
+	return l, nil
+}
+
+// Append appends events to the log, all or none. They're in the file, if
+// there's one, when it returns.
+func (l *Log) Append(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.f != nil {
+		var buf bytes.Buffer
+		for _, e := range events {
+			line, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			buf.Write(append(line, '\n'))
+		}
+		offset, err := l.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if err := l.write(buf.Bytes()); err != nil {
+			// Some of the events may have been written, or written but not
+			// synced; cut them off, so the file doesn't have them when the
+			// log in memory doesn't.
+			if terr := l.f.Truncate(offset); terr != nil {
+				return fmt.Errorf("%w; rolling back: %v", err, terr)
+			}
+			if _, serr := l.f.Seek(offset, io.SeekStart); serr != nil {
+				return fmt.Errorf("%w; rolling back: %v", err, serr)
+			}
+			return err
+		}
+	}
+	for _, e := range events {
+		l.add(e)
+	}
+	return nil
+}
+
+// write writes p to the file, and syncs it.
+func (l *Log) write(p []byte) error {
+	if _, err := l.f.Write(p); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+func (l *Log) add(e Event) {
+	if _, ok := l.byID[e.TrackingID]; !ok {
+		l.ids = append(l.ids, e.TrackingID)
+	}
+	l.byID[e.TrackingID] = append(l.byID[e.TrackingID], len(l.events))
+	l.events = append(l.events, e)
+}
+
+// Events returns the events of the cargo with id after version, oldest
+// first.
+func (l *Log) Events(id cargo.TrackingID, version int) []Event {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	var events []Event
+	for _, i := range l.byID[id] {
+		if l.events[i].Version > version {
+			events = append(events, l.events[i])
+		}
+	}
+	return events
+}
+
+// All returns all events, in the order they were appended.
+func (l *Log) All() []Event {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return append([]Event(nil), l.events...)
+}
+
+// TrackingIDs returns the tracking IDs of the cargos that events happened
+// to, in the order of their first event.
+func (l *Log) TrackingIDs() []cargo.TrackingID {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return append([]cargo.TrackingID(nil), l.ids...)
+}
+
+// Close closes the file of the log, if there's one.
+func (l *Log) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,32 @@
+package eventsourced
+
+import (
+	"github.com/go-kit/examples/shipping/cargo"
+)
+
+// Replay rebuilds every cargo, and its handling history, from scratch from
+// the events in log, without any snapshots, and stores them in cargos and
+// events. Those are usually empty in-memory repositories, from which the read
+// models of the cargos are then assembled as usual.
+func Replay(log *Log, cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+	states := make(map[cargo.TrackingID]state)
+	for _, e := range log.All() {
+		states[e.TrackingID] = states[e.TrackingID].apply(e)
+	}
+	for _, id := range log.TrackingIDs() {
+		st := states[id]
+		for _, e := range st.history {
+			if err := events.Store(e); err != nil {
+				return err
+			}
+		}
+		c, err := st.current()
+		if err == cargo.ErrUnknown {
+			continue // handled, but never booked
+		}
+		if err := cargos.Store(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package eventsourced
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/examples/shipping/cargo"
+)
+
+// Repository derives cargos, and their handling histories, from the events in
+// a log, and appends the events of the changes stored through it. To save
+// replaying all the events of a cargo every time it's needed, it keeps
+// snapshots of cargos in memory.
+type Repository struct {
+	log           *Log
+	snapshotEvery int
+
+	mtx       sync.Mutex // serializes changes, and guards snapshots
+	snapshots map[cargo.TrackingID]state
+}
+
+// NewRepository returns a repository of the cargos in log, which takes a
+// snapshot of a cargo every snapshotEvery events, or never if it's 0.
+func NewRepository(log *Log, snapshotEvery int) *Repository {
+	return &Repository{
+		log:           log,
+		snapshotEvery: snapshotEvery,
+		snapshots:     make(map[cargo.TrackingID]state),
+	}
+}
+
+// Cargos returns the cargo repository of r.
+func (r *Repository) Cargos() cargo.Repository {
+	return &cargoRepository{r}
+}
+
+// HandlingEvents returns the handling event repository of r.
+func (r *Repository) HandlingEvents() cargo.HandlingEventRepository {
+	return &handlingEventRepository{r}
+}
+
+// UnitOfWork returns a unit of work over the cargo and handling event
+// repositories of r, which appends the events of all the changes it makes
+// at once, when it's committed.
+func (r *Repository) UnitOfWork() cargo.UnitOfWork {
+	return &unitOfWork{r}
+}
+
+// do runs fn in a session, and appends the events of its changes to the log
+// if it succeeds.
+func (r *Repository) do(fn func(s *session) error) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	s := &session{r: r}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return r.log.Append(s.pending)
+}
+
+// load returns the state of the cargo with id, from its latest snapshot and
+// the events after it, taking a new snapshot if enough events happened since.
+// It's called with r.mtx held.
+func (r *Repository) load(id cargo.TrackingID) state {
+	snapshot := r.snapshots[id]
+	st := snapshot
+	for _, e := range r.log.Events(id, st.version) {
+		st = st.apply(e)
+	}
+	if r.snapshotEvery > 0 && st.version-snapshot.version >= r.snapshotEvery {
+		r.snapshots[id] = st
+	}
+	return st
+}
+
+// session sees the events that are in the log, and the ones of the changes
+// made in it so far, which are pending until it's over.
+type session struct {
+	r       *Repository
+	pending []Event
+}
+
+func (s *session) load(id cargo.TrackingID) state {
+	st := s.r.load(id)
+	for _, e := range s.pending {
+		if e.TrackingID == id {
+			st = st.apply(e)
+		}
+	}
+	return st
+}
+
+// append adds events that happened to the cargo with id, which was in st.
+func (s *session) append(id cargo.TrackingID, st state, events ...Event) {
+	now := time.Now().UTC()
+	for _, e := range events {
+		st.version++
+		e.TrackingID, e.Version, e.Time = id, st.version, now
+		s.pending = append(s.pending, e)
+	}
+}
+
+type cargoRepository struct {
+	r *Repository
+}
+
+func (r *cargoRepository) Store(c *cargo.Cargo) error {
+	return r.r.do(func(s *session) error {
+		return (&txCargoRepository{s}).Store(c)
+	})
+}
+
+func (r *cargoRepository) Find(id cargo.TrackingID) (c *cargo.Cargo, err error) {
+	r.r.do(func(s *session) error {
+		c, err = (&txCargoRepository{s}).Find(id)
+		return nil
+	})
+	return c, err
+}
+
+func (r *cargoRepository) FindAll() (c []*cargo.Cargo) {
+	r.r.do(func(s *session) error {
+		c = (&txCargoRepository{s}).FindAll()
+		return nil
+	})
+	return c
+}
+
+type handlingEventRepository struct {
+	r *Repository
+}
+
+func (r *handlingEventRepository) Store(e cargo.HandlingEvent) error {
+	return r.r.do(func(s *session) error {
+		return (&txHandlingEventRepository{s}).Store(e)
+	})
+}
+
+func (r *handlingEventRepository) QueryHandlingHistory(id cargo.TrackingID) (h cargo.HandlingHistory) {
+	r.r.do(func(s *session) error {
+		h = (&txHandlingEventRepository{s}).QueryHandlingHistory(id)
+		return nil
+	})
+	return h
+}
+
+type unitOfWork struct {
+	r *Repository
+}
+
+func (u *unitOfWork) Do(work func(cargo.Repository, cargo.HandlingEventRepository) error) error {
+	return u.r.do(func(s *session) error {
+		return work(&txCargoRepository{s}, &txHandlingEventRepository{s})
+	})
+}
+
+// txCargoRepository is a cargo repository within a session, which the other
+// cargo repositories run in one of their own.
+type txCargoRepository struct {
+	s *session
+}
+
+func (r *txCargoRepository) Store(c *cargo.Cargo) error {
+	st := r.s.load(c.TrackingID)
+	r.s.append(c.TrackingID, st, st.changes(c)...)
+	return nil
+}
+
+func (r *txCargoRepository) Find(id cargo.TrackingID) (*cargo.Cargo, error) {
+	return r.s.load(id).current()
+}
+
+func (r *txCargoRepository) FindAll() []*cargo.Cargo {
+	ids := r.s.r.log.TrackingIDs()
+	for _, e := range r.s.pending {
+		ids = append(ids, e.TrackingID)
+	}
+	c := []*cargo.Cargo{}
+	seen := make(map[cargo.TrackingID]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if val, err := r.Find(id); err == nil {
+			c = append(c, val)
+		}
+	}
+	return c
+}
+
+// txHandlingEventRepository is a handling event repository within a
+// session, which the other handling event repositories run in one of their
+// own.
+type txHandlingEventRepository struct {
+	s *session
+}
+
+func (r *txHandlingEventRepository) Store(e cargo.HandlingEvent) error {
+	r.s.append(e.TrackingID, r.s.load(e.TrackingID), Event{Type: CargoHandled, HandlingEvent: &e})
+	return nil
+}
+
+func (r *txHandlingEventRepository) QueryHandlingHistory(id cargo.TrackingID) cargo.HandlingHistory {
+	return r.s.load(id).handlingHistory()
+}
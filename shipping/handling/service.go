@@ -17,7 +17,11 @@ var ErrInvalidArgument = errors.New("invalid argument")
 
 // EventHandler provides a means of subscribing to registered handling events.
 type EventHandler interface {
-	CargoWasHandled(cargo.HandlingEvent)
+	// CargoWasHandled is called within the unit of work that stores the
+	// event, with its repositories, so that the changes it makes through them
+	// are committed together with the event. If it returns an error, neither
+	// are.
+	CargoWasHandled(e cargo.HandlingEvent, cargos cargo.Repository, events cargo.HandlingEventRepository) error
 }
 
 // Service provides handling operations.
@@ -29,9 +33,9 @@ type Service interface {
 }
 
 type service struct {
-	handlingEventRepository cargo.HandlingEventRepository
-	handlingEventFactory    cargo.HandlingEventFactory
-	handlingEventHandler    EventHandler
+	unitOfWork           cargo.UnitOfWork
+	handlingEventFactory cargo.HandlingEventFactory
+	handlingEventHandler EventHandler
 }
 
 func (s *service) RegisterHandlingEvent(completed time.Time, id cargo.TrackingID, voyageNumber voyage.Number,
@@ -45,32 +49,36 @@ func (s *service) RegisterHandlingEvent(completed time.Time, id cargo.TrackingID
 		return err
 	}
 
-	s.handlingEventRepository.Store(e)
-	s.handlingEventHandler.CargoWasHandled(e)
-
-	return nil
+	return s.unitOfWork.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		if err := events.Store(e); err != nil {
+			return err
+		}
+		return s.handlingEventHandler.CargoWasHandled(e, cargos, events)
+	})
 }
 
 // NewService creates a handling event service with necessary dependencies.
-func NewService(r cargo.HandlingEventRepository, f cargo.HandlingEventFactory, h EventHandler) Service {
+// Events are stored, and handled, in units of work of u.
+func NewService(u cargo.UnitOfWork, f cargo.HandlingEventFactory, h EventHandler) Service {
 	return &service{
-		handlingEventRepository: r,
-		handlingEventFactory:    f,
-		handlingEventHandler:    h,
+		unitOfWork:           u,
+		handlingEventFactory: f,
+		handlingEventHandler: h,
 	}
 }
 
 type handlingEventHandler struct {
-	InspectionService inspection.Service
+	InspectionHandler inspection.EventHandler
 }
 
-func (h *handlingEventHandler) CargoWasHandled(event cargo.HandlingEvent) {
-	h.InspectionService.InspectCargo(event.TrackingID)
+func (h *handlingEventHandler) CargoWasHandled(event cargo.HandlingEvent, cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+	return inspection.NewService(cargos, events, h.InspectionHandler).InspectCargo(event.TrackingID)
 }
 
-// NewEventHandler returns a new instance of a EventHandler.
-func NewEventHandler(s inspection.Service) EventHandler {
+// NewEventHandler returns a new instance of a EventHandler, which inspects
+// the handled cargos, and notifies h of the results.
+func NewEventHandler(h inspection.EventHandler) EventHandler {
 	return &handlingEventHandler{
-		InspectionService: s,
+		InspectionHandler: h,
 	}
 }
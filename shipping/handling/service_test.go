@@ -0,0 +1,189 @@
+package handling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/booking"
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/inmem"
+	"github.com/go-kit/examples/shipping/inspection"
+	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+type failingEventHandler struct{ err error }
+
+func (h failingEventHandler) CargoWasHandled(cargo.HandlingEvent, cargo.Repository, cargo.HandlingEventRepository) error {
+	return h.err
+}
+
+func newTestService(t *testing.T, h EventHandler) (Service, cargo.Repository, cargo.HandlingEventRepository) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	c := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: time.Now().AddDate(0, 0, 14),
+	})
+	if err := cargos.Store(c); err != nil {
+		t.Fatal(err)
+	}
+	f := cargo.HandlingEventFactory{
+		CargoRepository:    cargos,
+		VoyageRepository:   inmem.NewVoyageRepository(),
+		LocationRepository: inmem.NewLocationRepository(),
+	}
+	return NewService(inmem.NewUnitOfWork(cargos, events), f, h), cargos, events
+}
+
+func TestRegisterHandlingEventRollsBack(t *testing.T) {
+	errFailed := errors.New("failed")
+	s, _, events := newTestService(t, failingEventHandler{errFailed})
+
+	if err := s.RegisterHandlingEvent(time.Now(), "ABC123", "", location.SESTO, cargo.Receive); err != errFailed {
+		t.Errorf("want %v, have %v", errFailed, err)
+	}
+	if h := events.QueryHandlingHistory("ABC123"); len(h.HandlingEvents) != 0 {
+		t.Errorf("want the event rolled back, have %+v", h.HandlingEvents)
+	}
+}
+
+func TestRegisterHandlingEventConcurrently(t *testing.T) {
+	s, cargos, events := newTestService(t, NewEventHandler(nil))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				err = s.RegisterHandlingEvent(time.Now(), "ABC123", voyage.V100.Number, location.CNHKG, cargo.Load)
+			} else {
+				err = s.RegisterHandlingEvent(time.Now(), "ABC123", voyage.V100.Number, location.JNTKO, cargo.Unload)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The delivery of the cargo is derived from all of its events, not from
+	// the history as some registration saw it before another one stored its
+	// event.
+	h := events.QueryHandlingHistory("ABC123")
+	if len(h.HandlingEvents) != 50 {
+		t.Fatalf("want 50 events, have %d", len(h.HandlingEvents))
+	}
+	c, err := cargos.Find("ABC123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := h.HandlingEvents[len(h.HandlingEvents)-1]; c.Delivery.LastEvent != want {
+		t.Errorf("want last event %+v, have %+v", want, c.Delivery.LastEvent)
+	}
+}
+
+func TestHandlingNotifies(t *testing.T) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	locations, voyages := inmem.NewLocationRepository(), inmem.NewVoyageRepository()
+	bs := booking.NewService(cargos, locations, inmem.NewUnitOfWork(cargos, events), nil, booking.NewProjection())
+	id, err := bs.BookNewCargo(location.SESTO, location.CNHKG, time.Now().AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg(voyage.V100.Number, location.SESTO, location.CNHKG, time.Now(), time.Now().AddDate(0, 0, 7)),
+	}}
+	if err := bs.AssignCargoToRoute(id, route); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parties are notified through a webhook, relayed from an outbox.
+	secret := []byte("s3cr3t")
+	notified := make(chan inspection.Notification, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(inspection.SignatureHeader) != inspection.Sign(secret, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var n inspection.Notification
+		json.Unmarshal(body, &n)
+		notified <- n
+	}))
+	defer webhook.Close()
+	outbox := inspection.NewOutbox(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outbox.Relay(ctx, inspection.NewWebhook(webhook.URL, secret), time.Millisecond, log.NewNopLogger())
+
+	f := cargo.HandlingEventFactory{
+		CargoRepository:    cargos,
+		VoyageRepository:   voyages,
+		LocationRepository: locations,
+	}
+	h := NewEventHandler(inspection.NewMultiEventHandler(booking.NewInspectionEventHandler(), outbox))
+	srv := httptest.NewServer(MakeHandler(NewService(outbox.UnitOfWork(inmem.NewUnitOfWork(cargos, events)), f, h), log.NewNopLogger()))
+	defer srv.Close()
+
+	register := func(voyage voyage.Number, loc location.UNLocode, eventType cargo.HandlingEventType) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"completion_time": time.Now(),
+			"tracking_id":     id,
+			"voyage":          voyage,
+			"location":        loc,
+			"event_type":      eventType.String(),
+		})
+		resp, err := http.Post(srv.URL+"/handling/v1/incidents", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("registering %s at %s: want %d, have %d", eventType, loc, http.StatusOK, resp.StatusCode)
+		}
+	}
+	expect := func(event string, loc location.UNLocode) {
+		select {
+		case n := <-notified:
+			if n.Event != event || n.TrackingID != id || n.Location != loc {
+				t.Errorf("want %s of %s at %s, have %+v", event, id, loc, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("want %s notified, have nothing", event)
+		}
+	}
+
+	// Unloading the cargo off its route misdirects it, which flags it for
+	// rerouting.
+	register("", location.SESTO, cargo.Receive)
+	register(voyage.V100.Number, location.JNTKO, cargo.Unload)
+	expect(inspection.CargoMisdirected, location.JNTKO)
+	if c, err := bs.LoadCargo(id); err != nil || !c.NeedsRerouting {
+		t.Errorf("want the misdirected cargo flagged for rerouting, have %+v (%v)", c, err)
+	}
+
+	// Unloading it at its destination is its arrival.
+	register(voyage.V100.Number, location.CNHKG, cargo.Unload)
+	expect(inspection.CargoArrived, location.CNHKG)
+
+	// The flag stays until the cargo is assigned to a new route.
+	if err := bs.AssignCargoToRoute(id, route); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := bs.LoadCargo(id); err != nil || c.NeedsRerouting {
+		t.Errorf("want the rerouted cargo no longer flagged, have %+v (%v)", c, err)
+	}
+}
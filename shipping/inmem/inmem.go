@@ -2,7 +2,9 @@
 package inmem
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/go-kit/examples/shipping/cargo"
 	"github.com/go-kit/examples/shipping/location"
@@ -14,18 +16,22 @@ type cargoRepository struct {
 	cargos map[cargo.TrackingID]*cargo.Cargo
 }
 
+// Store stores a copy of c, so that changing c afterwards changes nothing
+// until it's stored again, as with the other repositories.
 func (r *cargoRepository) Store(c *cargo.Cargo) error {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
-	r.cargos[c.TrackingID] = c
+	r.cargos[c.TrackingID] = copyCargo(c)
 	return nil
 }
 
+// Find returns a copy of the cargo, which the caller may change without
+// holding the lock of r.
 func (r *cargoRepository) Find(id cargo.TrackingID) (*cargo.Cargo, error) {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 	if val, ok := r.cargos[id]; ok {
-		return val, nil
+		return copyCargo(val), nil
 	}
 	return nil, cargo.ErrUnknown
 }
@@ -35,11 +41,18 @@ func (r *cargoRepository) FindAll() []*cargo.Cargo {
 	defer r.mtx.RUnlock()
 	c := make([]*cargo.Cargo, 0, len(r.cargos))
 	for _, val := range r.cargos {
-		c = append(c, val)
+		c = append(c, copyCargo(val))
 	}
 	return c
 }
 
+// copyCargo returns a shallow copy of c. Cargos replace their slices rather
+// than change them in place, so the copies may share those.
+func copyCargo(c *cargo.Cargo) *cargo.Cargo {
+	cc := *c
+	return &cc
+}
+
 // NewCargoRepository returns a new instance of a in-memory cargo repository.
 func NewCargoRepository() cargo.Repository {
 	return &cargoRepository{
@@ -83,10 +96,16 @@ func NewLocationRepository() location.Repository {
 }
 
 type voyageRepository struct {
+	mtx     sync.Mutex
 	voyages map[voyage.Number]*voyage.Voyage
+	until   time.Time // the sample voyages are scheduled until
+	now     func() time.Time
 }
 
 func (r *voyageRepository) Find(voyageNumber voyage.Number) (*voyage.Voyage, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.schedule()
 	if v, ok := r.voyages[voyageNumber]; ok {
 		return v, nil
 	}
@@ -94,23 +113,45 @@ func (r *voyageRepository) Find(voyageNumber voyage.Number) (*voyage.Voyage, err
 	return nil, voyage.ErrUnknown
 }
 
-// NewVoyageRepository returns a new instance of a in-memory voyage repository.
-func NewVoyageRepository() voyage.Repository {
-	r := &voyageRepository{
-		voyages: make(map[voyage.Number]*voyage.Voyage),
+func (r *voyageRepository) FindAll() []*voyage.Voyage {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.schedule()
+	v := make([]*voyage.Voyage, 0, len(r.voyages))
+	for _, val := range r.voyages {
+		v = append(v, val)
 	}
+	return v
+}
 
-	r.voyages[voyage.V100.Number] = voyage.V100
-	r.voyages[voyage.V300.Number] = voyage.V300
-	r.voyages[voyage.V400.Number] = voyage.V400
-
-	r.voyages[voyage.V0100S.Number] = voyage.V0100S
-	r.voyages[voyage.V0200T.Number] = voyage.V0200T
-	r.voyages[voyage.V0300A.Number] = voyage.V0300A
-	r.voyages[voyage.V0301S.Number] = voyage.V0301S
-	r.voyages[voyage.V0400S.Number] = voyage.V0400S
+// schedule extends the schedules of the sample voyages by another
+// voyage.SamplePeriod once they no longer reach voyage.SampleHorizon ahead.
+// The voyages are replaced rather than changed, since callers may hold them.
+func (r *voyageRepository) schedule() {
+	now := r.now()
+	if r.until.After(now.Add(voyage.SampleHorizon)) {
+		return
+	}
+	from, to := r.until, now.Add(voyage.SampleHorizon+voyage.SamplePeriod)
+	if from.Before(now) {
+		from = now
+	}
+	for _, v := range voyage.SampleSchedules(from, to) {
+		if stored, ok := r.voyages[v.Number]; ok {
+			v = stored.Extend(v.Schedule, now)
+		}
+		r.voyages[v.Number] = v
+	}
+	r.until = to
+}
 
-	return r
+// NewVoyageRepository returns a new instance of a in-memory voyage repository
+// of the sample voyages, scheduled from now on, see voyage.SampleSchedules.
+func NewVoyageRepository() voyage.Repository {
+	return &voyageRepository{
+		voyages: make(map[voyage.Number]*voyage.Voyage),
+		now:     time.Now,
+	}
 }
 
 type handlingEventRepository struct {
@@ -118,7 +159,7 @@ type handlingEventRepository struct {
 	events map[cargo.TrackingID][]cargo.HandlingEvent
 }
 
-func (r *handlingEventRepository) Store(e cargo.HandlingEvent) {
+func (r *handlingEventRepository) Store(e cargo.HandlingEvent) error {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 	// Make array if it's the first event with this tracking ID.
@@ -126,6 +167,7 @@ func (r *handlingEventRepository) Store(e cargo.HandlingEvent) {
 		r.events[e.TrackingID] = make([]cargo.HandlingEvent, 0)
 	}
 	r.events[e.TrackingID] = append(r.events[e.TrackingID], e)
+	return nil
 }
 
 func (r *handlingEventRepository) QueryHandlingHistory(id cargo.TrackingID) cargo.HandlingHistory {
@@ -140,3 +182,103 @@ func NewHandlingEventRepository() cargo.HandlingEventRepository {
 		events: make(map[cargo.TrackingID][]cargo.HandlingEvent),
 	}
 }
+
+type unitOfWork struct {
+	cargos *cargoRepository
+	events *handlingEventRepository
+}
+
+// Do runs work holding the locks of both repositories, in that order, so
+// units of work are serialized with each other and with the other changes.
+func (u *unitOfWork) Do(work func(cargo.Repository, cargo.HandlingEventRepository) error) error {
+	u.cargos.mtx.Lock()
+	defer u.cargos.mtx.Unlock()
+	u.events.mtx.Lock()
+	defer u.events.mtx.Unlock()
+
+	cargos := &txCargoRepository{r: u.cargos, stored: make(map[cargo.TrackingID]*cargo.Cargo)}
+	events := &txHandlingEventRepository{r: u.events, stored: make(map[cargo.TrackingID][]cargo.HandlingEvent)}
+	if err := work(cargos, events); err != nil {
+		return err
+	}
+
+	for id, c := range cargos.stored {
+		u.cargos.cargos[id] = c
+	}
+	for id, e := range events.stored {
+		u.events.events[id] = append(u.events.events[id], e...)
+	}
+	return nil
+}
+
+// NewUnitOfWork returns a new instance of a unit of work over in-memory
+// repositories, which cargos and events must be.
+func NewUnitOfWork(cargos cargo.Repository, events cargo.HandlingEventRepository) cargo.UnitOfWork {
+	c, ok := cargos.(*cargoRepository)
+	if !ok {
+		panic(fmt.Sprintf("inmem: unit of work over a %T, not an in-memory cargo repository", cargos))
+	}
+	e, ok := events.(*handlingEventRepository)
+	if !ok {
+		panic(fmt.Sprintf("inmem: unit of work over a %T, not an in-memory handling event repository", events))
+	}
+	return &unitOfWork{cargos: c, events: e}
+}
+
+// txCargoRepository keeps the cargos stored in a unit of work until it's
+// committed. The unit of work holds the lock of r.
+type txCargoRepository struct {
+	r      *cargoRepository
+	stored map[cargo.TrackingID]*cargo.Cargo
+}
+
+func (r *txCargoRepository) Store(c *cargo.Cargo) error {
+	r.stored[c.TrackingID] = copyCargo(c)
+	return nil
+}
+
+// Find returns a copy of the cargo, so that changing it changes nothing
+// outside of the unit of work until it's stored and committed.
+func (r *txCargoRepository) Find(id cargo.TrackingID) (*cargo.Cargo, error) {
+	if val, ok := r.stored[id]; ok {
+		return copyCargo(val), nil
+	}
+	if val, ok := r.r.cargos[id]; ok {
+		return copyCargo(val), nil
+	}
+	return nil, cargo.ErrUnknown
+}
+
+func (r *txCargoRepository) FindAll() []*cargo.Cargo {
+	c := make([]*cargo.Cargo, 0, len(r.r.cargos)+len(r.stored))
+	for id := range r.r.cargos {
+		if _, ok := r.stored[id]; !ok {
+			val, _ := r.Find(id)
+			c = append(c, val)
+		}
+	}
+	for _, val := range r.stored {
+		c = append(c, copyCargo(val))
+	}
+	return c
+}
+
+// txHandlingEventRepository keeps the handling events stored in a unit of
+// work until it's committed. The unit of work holds the lock of r.
+type txHandlingEventRepository struct {
+	r      *handlingEventRepository
+	stored map[cargo.TrackingID][]cargo.HandlingEvent
+}
+
+func (r *txHandlingEventRepository) Store(e cargo.HandlingEvent) error {
+	r.stored[e.TrackingID] = append(r.stored[e.TrackingID], e)
+	return nil
+}
+
+func (r *txHandlingEventRepository) QueryHandlingHistory(id cargo.TrackingID) cargo.HandlingHistory {
+	committed := r.r.events[id]
+	events := make([]cargo.HandlingEvent, 0, len(committed)+len(r.stored[id]))
+	events = append(events, committed...)
+	events = append(events, r.stored[id]...)
+	return cargo.HandlingHistory{HandlingEvents: events}
+}
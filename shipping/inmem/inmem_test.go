@@ -0,0 +1,51 @@
+package inmem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/examples/shipping/internal/repotest"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+func TestRepositories(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		cargos, events := NewCargoRepository(), NewHandlingEventRepository()
+		return repotest.Repositories{
+			Cargos:         cargos,
+			Locations:      NewLocationRepository(),
+			Voyages:        NewVoyageRepository(),
+			HandlingEvents: events,
+			UnitOfWork:     NewUnitOfWork(cargos, events),
+		}
+	})
+}
+
+func TestVoyageRepositorySchedules(t *testing.T) {
+	r := NewVoyageRepository().(*voyageRepository)
+	start := time.Date(2021, 3, 1, 15, 0, 0, 0, time.UTC)
+	now := start
+	r.now = func() time.Time { return now }
+	before, _ := r.Find(voyage.V300.Number)
+
+	// Once the schedules no longer reach over the horizon, they're extended,
+	// and the carrier movements that arrived are dropped.
+	now = start.Add(voyage.SamplePeriod + 24*time.Hour)
+	for _, v := range voyage.SampleSchedules(start, now.Add(voyage.SampleHorizon+voyage.SamplePeriod)) {
+		want := []voyage.CarrierMovement{}
+		for _, m := range v.Schedule.CarrierMovements {
+			if m.ArrivalTime.After(now) {
+				want = append(want, m)
+			}
+		}
+		if have, err := r.Find(v.Number); err != nil || !reflect.DeepEqual(want, have.Schedule.CarrierMovements) {
+			t.Errorf("Find(%s): want %+v, have %+v (%v)", v.Number, want, have, err)
+		}
+	}
+
+	// Voyages found before aren't changed.
+	if want := voyage.SampleSchedules(start, start.Add(voyage.SampleHorizon+voyage.SamplePeriod))[1]; !reflect.DeepEqual(want, before) {
+		t.Errorf("Find(%s) before: want %+v, have %+v", want.Number, want, before)
+	}
+}
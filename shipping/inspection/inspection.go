@@ -5,7 +5,9 @@ import (
 	"github.com/go-kit/examples/shipping/cargo"
 )
 
-// EventHandler provides means of subscribing to inspection events.
+// EventHandler provides means of subscribing to inspection events. It's called
+// before the inspected cargo is stored, so changes it makes to the cargo are
+// stored too, in the same unit of work if there's one.
 type EventHandler interface {
 	CargoWasMisdirected(*cargo.Cargo)
 	CargoHasArrived(*cargo.Cargo)
@@ -16,7 +18,7 @@ type Service interface {
 	// InspectCargo inspects cargo and send relevant notifications to
 	// interested parties, for example if a cargo has been misdirected, or
 	// unloaded at the final destination.
-	InspectCargo(id cargo.TrackingID)
+	InspectCargo(id cargo.TrackingID) error
 }
 
 type service struct {
@@ -25,29 +27,32 @@ type service struct {
 	handler EventHandler
 }
 
-// TODO: Should be transactional
-func (s *service) InspectCargo(id cargo.TrackingID) {
+func (s *service) InspectCargo(id cargo.TrackingID) error {
 	c, err := s.cargos.Find(id)
 	if err != nil {
-		return
+		return err
 	}
 
 	h := s.events.QueryHandlingHistory(id)
 
 	c.DeriveDeliveryProgress(h)
 
-	if c.Delivery.IsMisdirected {
-		s.handler.CargoWasMisdirected(c)
-	}
+	if s.handler != nil {
+		if c.Delivery.IsMisdirected {
+			s.handler.CargoWasMisdirected(c)
+		}
 
-	if c.Delivery.IsUnloadedAtDestination {
-		s.handler.CargoHasArrived(c)
+		if c.Delivery.IsUnloadedAtDestination {
+			s.handler.CargoHasArrived(c)
+		}
 	}
 
-	s.cargos.Store(c)
+	return s.cargos.Store(c)
 }
 
-// NewService creates a inspection service with necessary dependencies.
+// NewService creates a inspection service with necessary dependencies. To
+// inspect cargos transactionally, create one with the repositories of a
+// cargo.UnitOfWork. The handler may be nil.
 func NewService(cargos cargo.Repository, events cargo.HandlingEventRepository, handler EventHandler) Service {
 	return &service{cargos, events, handler}
 }
@@ -0,0 +1,79 @@
+package inspection
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
+)
+
+// The events parties are notified of.
+const (
+	CargoMisdirected = "cargo_misdirected"
+	CargoArrived     = "cargo_arrived"
+)
+
+// Notification tells parties about an inspection event of a cargo.
+type Notification struct {
+	Event      string            `json:"event"`
+	TrackingID cargo.TrackingID  `json:"tracking_id"`
+	Location   location.UNLocode `json:"location"` // where the cargo was last seen
+	Time       time.Time         `json:"time"`
+}
+
+func newNotification(event string, c *cargo.Cargo) Notification {
+	return Notification{
+		Event:      event,
+		TrackingID: c.TrackingID,
+		Location:   c.Delivery.LastKnownLocation,
+		Time:       time.Now().UTC(),
+	}
+}
+
+type multiEventHandler []EventHandler
+
+func (hs multiEventHandler) CargoWasMisdirected(c *cargo.Cargo) {
+	for _, h := range hs {
+		h.CargoWasMisdirected(c)
+	}
+}
+
+func (hs multiEventHandler) CargoHasArrived(c *cargo.Cargo) {
+	for _, h := range hs {
+		h.CargoHasArrived(c)
+	}
+}
+
+// NewMultiEventHandler returns an event handler that passes the events on to
+// each of hs, in order.
+func NewMultiEventHandler(hs ...EventHandler) EventHandler {
+	return multiEventHandler(hs)
+}
+
+type loggingEventHandler struct {
+	logger log.Logger
+}
+
+func (h *loggingEventHandler) CargoWasMisdirected(c *cargo.Cargo) {
+	h.log(newNotification(CargoMisdirected, c))
+}
+
+func (h *loggingEventHandler) CargoHasArrived(c *cargo.Cargo) {
+	h.log(newNotification(CargoArrived, c))
+}
+
+func (h *loggingEventHandler) log(n Notification) {
+	h.logger.Log(
+		"event", n.Event,
+		"tracking_id", n.TrackingID,
+		"location", n.Location,
+	)
+}
+
+// NewLoggingEventHandler returns an event handler that logs the events to
+// logger.
+func NewLoggingEventHandler(logger log.Logger) EventHandler {
+	return &loggingEventHandler{logger: logger}
+}
@@ -0,0 +1,203 @@
+package inspection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/cargo"
+)
+
+// Notifier delivers notifications to interested parties.
+type Notifier interface {
+	// Notify delivers n. It returns a *PermanentError if n can't ever be
+	// delivered, so there's no use trying again.
+	Notify(ctx context.Context, n Notification) error
+}
+
+// PermanentError is returned by a Notifier for a notification that trying
+// to deliver again wouldn't help, e.g. one the receiver rejects.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Outbox is an event handler that keeps notifications in memory until they're
+// relayed to a Notifier. Cargos are inspected within units of work, which
+// shouldn't wait for parties to be notified; the outbox decouples the two.
+// The notifications of the cargos found within its units of work, see
+// UnitOfWork, are only kept once the unit of work is committed; other ones
+// are kept right away. They're lost if the process stops before they're
+// relayed.
+type Outbox struct {
+	mtx      sync.Mutex
+	pending  []Notification
+	capacity int
+	dropped  int // since Relay last logged it
+	staged   map[*cargo.Cargo]*[]Notification
+	added    chan struct{}
+}
+
+// NewOutbox returns an empty outbox, which keeps up to capacity notifications;
+// further ones are dropped until some are relayed.
+func NewOutbox(capacity int) *Outbox {
+	return &Outbox{
+		capacity: capacity,
+		staged:   make(map[*cargo.Cargo]*[]Notification),
+		added:    make(chan struct{}, 1),
+	}
+}
+
+// CargoWasMisdirected implements EventHandler.
+func (o *Outbox) CargoWasMisdirected(c *cargo.Cargo) {
+	o.add(c, newNotification(CargoMisdirected, c))
+}
+
+// CargoHasArrived implements EventHandler.
+func (o *Outbox) CargoHasArrived(c *cargo.Cargo) {
+	o.add(c, newNotification(CargoArrived, c))
+}
+
+func (o *Outbox) add(c *cargo.Cargo, n Notification) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if staged, ok := o.staged[c]; ok {
+		*staged = append(*staged, n)
+		return
+	}
+	o.enqueue(n)
+}
+
+// enqueue queues ns, dropping the ones that don't fit. o.mtx must be held.
+func (o *Outbox) enqueue(ns ...Notification) {
+	for _, n := range ns {
+		if len(o.pending) >= o.capacity {
+			o.dropped++
+		} else {
+			o.pending = append(o.pending, n)
+		}
+	}
+	select {
+	case o.added <- struct{}{}:
+	default:
+	}
+}
+
+// Pending returns the notifications that haven't been relayed yet, oldest
+// first.
+func (o *Outbox) Pending() []Notification {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return append([]Notification(nil), o.pending...)
+}
+
+// UnitOfWork returns a unit of work that keeps the notifications of the
+// cargos the work of u finds once it's committed, and drops them if it's
+// rolled back.
+func (o *Outbox) UnitOfWork(u cargo.UnitOfWork) cargo.UnitOfWork {
+	return &unitOfWork{u: u, o: o}
+}
+
+type unitOfWork struct {
+	u cargo.UnitOfWork
+	o *Outbox
+}
+
+func (u *unitOfWork) Do(work func(cargos cargo.Repository, events cargo.HandlingEventRepository) error) error {
+	var (
+		found  []*cargo.Cargo
+		staged []Notification
+	)
+	defer func() {
+		u.o.mtx.Lock()
+		defer u.o.mtx.Unlock()
+		for _, c := range found {
+			delete(u.o.staged, c)
+		}
+	}()
+	err := u.u.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		return work(&txCargoRepository{Repository: cargos, found: &found, staged: &staged, o: u.o}, events)
+	})
+	if err != nil {
+		return err
+	}
+	u.o.mtx.Lock()
+	u.o.enqueue(staged...)
+	u.o.mtx.Unlock()
+	return nil
+}
+
+// txCargoRepository records the cargos found within a unit of work, whose
+// notifications are staged until it's committed.
+type txCargoRepository struct {
+	cargo.Repository
+	found  *[]*cargo.Cargo
+	staged *[]Notification
+	o      *Outbox
+}
+
+func (r *txCargoRepository) Find(id cargo.TrackingID) (*cargo.Cargo, error) {
+	c, err := r.Repository.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	r.o.mtx.Lock()
+	r.o.staged[c] = r.staged
+	r.o.mtx.Unlock()
+	*r.found = append(*r.found, c)
+	return c, nil
+}
+
+// Relay relays the notifications to n, in order, as they're added, until ctx
+// is done. A notification that n fails to deliver is logged to logger, and
+// tried again after retryInterval, before the ones after it, unless the
+// failure is permanent, in which case it's dropped. So are the notifications
+// added while the outbox was full, which are counted in the logs.
+func (o *Outbox) Relay(ctx context.Context, n Notifier, retryInterval time.Duration, logger log.Logger) {
+	for {
+		o.mtx.Lock()
+		var next Notification
+		ok := len(o.pending) > 0
+		if ok {
+			next = o.pending[0]
+		}
+		dropped := o.dropped
+		o.dropped = 0
+		o.mtx.Unlock()
+
+		if dropped > 0 {
+			logger.Log("dropped", dropped, "err", "outbox full")
+		}
+		if !ok {
+			select {
+			case <-o.added:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := n.Notify(ctx, next); err != nil {
+			logger.Log("event", next.Event, "tracking_id", next.TrackingID, "err", err)
+			var perr *PermanentError
+			if !errors.As(err, &perr) {
+				select {
+				case <-time.After(retryInterval):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		o.mtx.Lock()
+		o.pending = o.pending[1:]
+		o.mtx.Unlock()
+	}
+}
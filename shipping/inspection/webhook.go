@@ -0,0 +1,96 @@
+package inspection
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader is the header of webhook requests that carries the
+// signature of their body, as computed by Sign.
+const SignatureHeader = "X-Shipping-Signature"
+
+// Sign returns the signature of body with secret: "sha256=" followed by the
+// hex encoded HMAC-SHA256. Receivers of webhook requests compute it too, and
+// compare it to the one in SignatureHeader with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Webhook is a Notifier that POSTs notifications as JSON to a URL, signed
+// with a shared secret.
+type Webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+
+	attempts int
+	backoff  time.Duration // before the second attempt, doubling after that
+}
+
+// NewWebhook returns a webhook that notifies url, signing requests with
+// secret. A delivery is attempted up to 5 times, backing off exponentially,
+// until the receiver responds with a 2xx status code; 4xx status codes other
+// than 429 fail it right away, with a *PermanentError.
+func NewWebhook(url string, secret []byte) *Webhook {
+	return &Webhook{
+		url:      url,
+		secret:   secret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		attempts: 5,
+		backoff:  500 * time.Millisecond,
+	}
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return &PermanentError{err}
+	}
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err != nil && !retry {
+			return &PermanentError{err}
+		}
+		if err == nil || attempt == w.attempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post makes a single attempt to deliver body, and tells if it's worth
+// trying again if it fails.
+func (w *Webhook) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook responded with %s", resp.Status)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
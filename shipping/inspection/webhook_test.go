@@ -0,0 +1,203 @@
+package inspection
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/inmem"
+	"github.com/go-kit/examples/shipping/location"
+)
+
+func TestWebhook(t *testing.T) {
+	secret := []byte("s3cr3t")
+	var (
+		mtx      sync.Mutex
+		statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+		received []Notification
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !hmac.Equal([]byte(r.Header.Get(SignatureHeader)), []byte(Sign(secret, body))) {
+			t.Errorf("want the body signed, have signature %q", r.Header.Get(SignatureHeader))
+		}
+		var n Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Error(err)
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		received = append(received, n)
+		w.WriteHeader(statuses[0])
+		statuses = statuses[1:]
+	}))
+	defer srv.Close()
+
+	w := NewWebhook(srv.URL, secret)
+	w.backoff = time.Millisecond
+	n := Notification{Event: CargoArrived, TrackingID: "ABC123", Location: "CNHKG"}
+
+	// Server errors and 429s are retried.
+	if err := w.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 3 || received[2] != n {
+		t.Errorf("want %+v delivered on the third attempt, have %+v", n, received)
+	}
+
+	// Other client errors aren't, ever.
+	received, statuses = nil, []int{http.StatusBadRequest}
+	var perr *PermanentError
+	if err := w.Notify(context.Background(), n); !errors.As(err, &perr) {
+		t.Errorf("want a permanent error, have %v", err)
+	}
+	if len(received) != 1 {
+		t.Errorf("want a single attempt, have %d", len(received))
+	}
+
+	// Neither are they after the last attempt, though later ones may be.
+	received, statuses = nil, []int{500, 500, 500, 500, 500, 500}
+	if err := w.Notify(context.Background(), n); err == nil || errors.As(err, &perr) {
+		t.Errorf("want a temporary error, have %v", err)
+	}
+	if len(received) != w.attempts {
+		t.Errorf("want %d attempts, have %d", w.attempts, len(received))
+	}
+}
+
+type notifierFunc func(context.Context, Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+func TestOutboxRelay(t *testing.T) {
+	o := NewOutbox(10)
+	first := Notification{Event: CargoMisdirected, TrackingID: "ABC123"}
+	second := Notification{Event: CargoArrived, TrackingID: "FTL456"}
+	o.add(nil, first)
+
+	var (
+		delivered = make(chan Notification)
+		failed    bool
+	)
+	notifier := notifierFunc(func(ctx context.Context, n Notification) error {
+		// The first attempt fails, and is retried.
+		if !failed {
+			failed = true
+			return errors.New("unavailable")
+		}
+		delivered <- n
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Relay(ctx, notifier, time.Millisecond, log.NewNopLogger())
+		close(done)
+	}()
+
+	if n := <-delivered; n != first {
+		t.Errorf("want %+v, have %+v", first, n)
+	}
+	o.add(nil, second)
+	if n := <-delivered; n != second {
+		t.Errorf("want %+v, have %+v", second, n)
+	}
+	cancel()
+	<-done
+	if p := o.Pending(); len(p) != 0 {
+		t.Errorf("want no pending notifications, have %+v", p)
+	}
+}
+
+func TestOutboxRelayDropsPermanentFailures(t *testing.T) {
+	o := NewOutbox(10)
+	rejected := Notification{Event: CargoMisdirected, TrackingID: "ABC123"}
+	next := Notification{Event: CargoArrived, TrackingID: "FTL456"}
+	o.add(nil, rejected)
+	o.add(nil, next)
+
+	delivered := make(chan Notification)
+	notifier := notifierFunc(func(ctx context.Context, n Notification) error {
+		if n == rejected {
+			return &PermanentError{errors.New("bad request")}
+		}
+		delivered <- n
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Relay(ctx, notifier, time.Hour, log.NewNopLogger())
+
+	select {
+	case n := <-delivered:
+		if n != next {
+			t.Errorf("want %+v, have %+v", next, n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want the rejected notification dropped, have it blocking the next one")
+	}
+}
+
+func TestOutboxCapacity(t *testing.T) {
+	o := NewOutbox(2)
+	for _, id := range []cargo.TrackingID{"A", "B", "C"} {
+		o.add(nil, Notification{Event: CargoArrived, TrackingID: id})
+	}
+	if p := o.Pending(); len(p) != 2 || p[1].TrackingID != "B" {
+		t.Errorf("want the first 2 notifications, have %+v", p)
+	}
+}
+
+func TestOutboxUnitOfWork(t *testing.T) {
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	c := cargo.New("ABC123", cargo.RouteSpecification{Origin: location.SESTO, Destination: location.CNHKG})
+	if err := cargos.Store(c); err != nil {
+		t.Fatal(err)
+	}
+	o := NewOutbox(10)
+	u := o.UnitOfWork(inmem.NewUnitOfWork(cargos, events))
+	inspect := func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		c, err := cargos.Find("ABC123")
+		if err != nil {
+			return err
+		}
+		o.CargoHasArrived(c)
+		return nil
+	}
+
+	// Nothing is kept of a unit of work that's rolled back.
+	errRollback := errors.New("rollback")
+	if err := u.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		if err := inspect(cargos, events); err != nil {
+			return err
+		}
+		if p := o.Pending(); len(p) != 0 {
+			t.Errorf("want no notifications before the commit, have %+v", p)
+		}
+		return errRollback
+	}); err != errRollback {
+		t.Fatalf("want %v, have %v", errRollback, err)
+	}
+	if p := o.Pending(); len(p) != 0 {
+		t.Errorf("want no notifications after a rollback, have %+v", p)
+	}
+
+	if err := u.Do(inspect); err != nil {
+		t.Fatal(err)
+	}
+	if p := o.Pending(); len(p) != 1 || p[0].Event != CargoArrived || p[0].TrackingID != "ABC123" {
+		t.Errorf("want the notification of the commit, have %+v", p)
+	}
+}
@@ -0,0 +1,329 @@
+// Package repotest is a conformance test suite for the implementations of the
+// domain repositories, so they all keep the semantics of the in-memory ones.
+package repotest
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+// Repositories is an implementation of all the domain repositories.
+type Repositories struct {
+	Cargos         cargo.Repository
+	Locations      location.Repository
+	Voyages        voyage.Repository
+	HandlingEvents cargo.HandlingEventRepository
+
+	// UnitOfWork is over Cargos and HandlingEvents.
+	UnitOfWork cargo.UnitOfWork
+}
+
+// Run runs the suite against the repositories returned by newRepositories,
+// which is called once per test with new, empty ones.
+func Run(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	t.Run("Cargos", func(t *testing.T) {
+		testCargos(t, newRepositories(t).Cargos)
+	})
+	t.Run("Locations", func(t *testing.T) {
+		testLocations(t, newRepositories(t).Locations)
+	})
+	t.Run("Voyages", func(t *testing.T) {
+		testVoyages(t, newRepositories(t).Voyages)
+	})
+	t.Run("HandlingEvents", func(t *testing.T) {
+		testHandlingEvents(t, newRepositories(t).HandlingEvents)
+	})
+	t.Run("UnitOfWork", func(t *testing.T) {
+		testUnitOfWork(t, newRepositories(t))
+	})
+	t.Run("ConcurrentBookingAndHandling", func(t *testing.T) {
+		testConcurrentBookingAndHandling(t, newRepositories(t))
+	})
+}
+
+// Times without a monotonic clock reading, in UTC, compare equal after a round
+// trip through any encoding.
+var deadline = time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+
+func testCargos(t *testing.T, r cargo.Repository) {
+	if _, err := r.Find("ABC123"); err != cargo.ErrUnknown {
+		t.Errorf("Find(unknown): want %v, have %v", cargo.ErrUnknown, err)
+	}
+	if all := r.FindAll(); len(all) != 0 {
+		t.Errorf("FindAll: want no cargos, have %d", len(all))
+	}
+
+	c1 := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: deadline,
+	})
+	c2 := cargo.New("FTL456", cargo.RouteSpecification{
+		Origin:          location.AUMEL,
+		Destination:     location.SESTO,
+		ArrivalDeadline: deadline,
+	})
+	for _, c := range []*cargo.Cargo{c1, c2} {
+		if err := r.Store(c); err != nil {
+			t.Fatalf("Store(%s): %v", c.TrackingID, err)
+		}
+	}
+	if have, err := r.Find(c1.TrackingID); err != nil || !reflect.DeepEqual(c1, have) {
+		t.Errorf("Find: want %+v, have %+v (%v)", c1, have, err)
+	}
+
+	// Storing a cargo again replaces it.
+	c1.AssignToRoute(cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg(voyage.V100.Number, location.SESTO, location.CNHKG, deadline.AddDate(0, 0, -7), deadline.AddDate(0, 0, -1)),
+	}})
+	if err := r.Store(c1); err != nil {
+		t.Fatalf("Store again: %v", err)
+	}
+	have, err := r.Find(c1.TrackingID)
+	if err != nil || !reflect.DeepEqual(c1, have) {
+		t.Errorf("Find after Store again: want %+v, have %+v (%v)", c1, have, err)
+	}
+	if have.Delivery.RoutingStatus != cargo.Routed {
+		t.Errorf("Find after Store again: want routing status %v, have %v", cargo.Routed, have.Delivery.RoutingStatus)
+	}
+
+	var ids []string
+	for _, c := range r.FindAll() {
+		ids = append(ids, string(c.TrackingID))
+	}
+	sort.Strings(ids)
+	if want := []string{"ABC123", "FTL456"}; !reflect.DeepEqual(want, ids) {
+		t.Errorf("FindAll: want %v, have %v", want, ids)
+	}
+}
+
+func testLocations(t *testing.T, r location.Repository) {
+	// The sample locations are always there.
+	samples := []*location.Location{
+		location.Stockholm, location.Melbourne, location.Hongkong,
+		location.Tokyo, location.Rotterdam, location.Hamburg,
+	}
+	for _, want := range samples {
+		if have, err := r.Find(want.UNLocode); err != nil || !reflect.DeepEqual(want, have) {
+			t.Errorf("Find(%s): want %+v, have %+v (%v)", want.UNLocode, want, have, err)
+		}
+	}
+	if _, err := r.Find("XXXXX"); err != location.ErrUnknown {
+		t.Errorf("Find(unknown): want %v, have %v", location.ErrUnknown, err)
+	}
+	if all := r.FindAll(); len(all) != len(samples) {
+		t.Errorf("FindAll: want %d locations, have %d", len(samples), len(all))
+	}
+}
+
+func testVoyages(t *testing.T, r voyage.Repository) {
+	// The sample voyages are scheduled over the horizon, from now on.
+	now := time.Now()
+	for _, n := range []voyage.Number{
+		voyage.V100.Number, voyage.V300.Number, voyage.V400.Number,
+		voyage.V0100S.Number, voyage.V0200T.Number, voyage.V0300A.Number, voyage.V0301S.Number, voyage.V0400S.Number,
+	} {
+		v, err := r.Find(n)
+		if err != nil {
+			t.Errorf("Find(%s): %v", n, err)
+			continue
+		}
+		ms := v.Schedule.CarrierMovements
+		if len(ms) == 0 || ms[len(ms)-1].DepartureTime.Before(now.Add(voyage.SampleHorizon-voyage.SamplePeriod)) {
+			t.Errorf("Find(%s): want a schedule over %s, have %+v", n, voyage.SampleHorizon, ms)
+		}
+		for _, m := range ms {
+			if !m.ArrivalTime.After(now) {
+				t.Errorf("Find(%s): want no carrier movements that arrived, have %+v", n, m)
+			}
+		}
+	}
+	if _, err := r.Find("V999"); err != voyage.ErrUnknown {
+		t.Errorf("Find(unknown): want %v, have %v", voyage.ErrUnknown, err)
+	}
+	if all := r.FindAll(); len(all) != 8 {
+		t.Errorf("FindAll: want %d voyages, have %d", 8, len(all))
+	}
+}
+
+func testHandlingEvents(t *testing.T, r cargo.HandlingEventRepository) {
+	if h := r.QueryHandlingHistory("ABC123"); len(h.HandlingEvents) != 0 {
+		t.Errorf("QueryHandlingHistory(unknown): want no events, have %+v", h.HandlingEvents)
+	}
+
+	events := []cargo.HandlingEvent{
+		{TrackingID: "ABC123", Activity: cargo.HandlingActivity{Type: cargo.Receive, Location: location.SESTO}},
+		{TrackingID: "FTL456", Activity: cargo.HandlingActivity{Type: cargo.Receive, Location: location.AUMEL}},
+		{TrackingID: "ABC123", Activity: cargo.HandlingActivity{Type: cargo.Load, Location: location.SESTO, VoyageNumber: voyage.V100.Number}},
+		{TrackingID: "ABC123", Activity: cargo.HandlingActivity{Type: cargo.Unload, Location: location.CNHKG, VoyageNumber: voyage.V100.Number}},
+	}
+	for _, e := range events {
+		if err := r.Store(e); err != nil {
+			t.Fatalf("Store(%+v): %v", e, err)
+		}
+	}
+
+	// The history of a cargo has its events, in the order they were stored.
+	want := []cargo.HandlingEvent{events[0], events[2], events[3]}
+	if have := r.QueryHandlingHistory("ABC123").HandlingEvents; !reflect.DeepEqual(want, have) {
+		t.Errorf("QueryHandlingHistory: want %+v, have %+v", want, have)
+	}
+	h := r.QueryHandlingHistory("FTL456")
+	if e, err := h.MostRecentlyCompletedEvent(); err != nil || e != events[1] {
+		t.Errorf("QueryHandlingHistory of another cargo: want most recent %+v, have %+v (%v)", events[1], e, err)
+	}
+}
+
+func testUnitOfWork(t *testing.T, r Repositories) {
+	c := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: deadline,
+	})
+	if err := r.Cargos.Store(c); err != nil {
+		t.Fatal(err)
+	}
+	e := cargo.HandlingEvent{TrackingID: "ABC123", Activity: cargo.HandlingActivity{Type: cargo.Receive, Location: location.SESTO}}
+
+	// handle stores e, and the delivery of the cargo derived from the history
+	// that includes it, which it sees within the unit of work.
+	handle := func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		if err := events.Store(e); err != nil {
+			return err
+		}
+		c, err := cargos.Find("ABC123")
+		if err != nil {
+			return err
+		}
+		c.DeriveDeliveryProgress(events.QueryHandlingHistory("ABC123"))
+		if c.Delivery.LastEvent != e {
+			t.Errorf("within the unit of work: want last event %+v, have %+v", e, c.Delivery.LastEvent)
+		}
+		return cargos.Store(c)
+	}
+
+	// Errors roll back all changes.
+	errFailed := errors.New("failed")
+	err := r.UnitOfWork.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		if err := handle(cargos, events); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Errorf("Do: want %v, have %v", errFailed, err)
+	}
+	if h := r.HandlingEvents.QueryHandlingHistory("ABC123"); len(h.HandlingEvents) != 0 {
+		t.Errorf("after rollback: want no events, have %+v", h.HandlingEvents)
+	}
+	if have, err := r.Cargos.Find("ABC123"); err != nil || have.Delivery.TransportStatus != cargo.NotReceived {
+		t.Errorf("after rollback: want transport status %v, have %+v (%v)", cargo.NotReceived, have, err)
+	}
+
+	// Otherwise they're committed together.
+	if err := r.UnitOfWork.Do(handle); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if h := r.HandlingEvents.QueryHandlingHistory("ABC123"); !reflect.DeepEqual([]cargo.HandlingEvent{e}, h.HandlingEvents) {
+		t.Errorf("after commit: want events %+v, have %+v", []cargo.HandlingEvent{e}, h.HandlingEvents)
+	}
+	if have, err := r.Cargos.Find("ABC123"); err != nil || have.Delivery.TransportStatus != cargo.InPort {
+		t.Errorf("after commit: want transport status %v, have %+v (%v)", cargo.InPort, have, err)
+	}
+}
+
+// testConcurrentBookingAndHandling routes and handles a cargo concurrently in
+// units of work, the way the booking and handling services do, while others
+// read it and change what they read without storing it. No change is lost,
+// and none leaks from the readers.
+func testConcurrentBookingAndHandling(t *testing.T, r Repositories) {
+	c := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: deadline,
+	})
+	if err := r.Cargos.Store(c); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			err := r.UnitOfWork.Do(func(cargos cargo.Repository, _ cargo.HandlingEventRepository) error {
+				c, err := cargos.Find("ABC123")
+				if err != nil {
+					return err
+				}
+				c.AssignToRoute(cargo.Itinerary{Legs: []cargo.Leg{
+					cargo.NewLeg("V100", location.SESTO, location.CNHKG, deadline.AddDate(0, 0, -10), deadline.AddDate(0, 0, -i)),
+				}})
+				return cargos.Store(c)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			err := r.UnitOfWork.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+				e := cargo.HandlingEvent{
+					TrackingID:     "ABC123",
+					Activity:       cargo.HandlingActivity{Type: cargo.Receive, Location: location.SESTO},
+					CompletionTime: deadline.Add(time.Duration(i) * time.Minute),
+				}
+				if err := events.Store(e); err != nil {
+					return err
+				}
+				c, err := cargos.Find("ABC123")
+				if err != nil {
+					return err
+				}
+				c.DeriveDeliveryProgress(events.QueryHandlingHistory("ABC123"))
+				return cargos.Store(c)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			c, err := r.Cargos.Find("ABC123")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.FlagForRerouting()
+			c.Itinerary = cargo.Itinerary{}
+		}()
+	}
+	wg.Wait()
+
+	h := r.HandlingEvents.QueryHandlingHistory("ABC123")
+	if len(h.HandlingEvents) != n {
+		t.Fatalf("want %d events, have %d", n, len(h.HandlingEvents))
+	}
+	have, err := r.Cargos.Find("ABC123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := h.HandlingEvents[n-1]; have.Delivery.LastEvent != want {
+		t.Errorf("want last event %+v, have %+v", want, have.Delivery.LastEvent)
+	}
+	if len(have.Itinerary.Legs) != 1 || len(have.Reroutings) != n-1 {
+		t.Errorf("want the cargo routed %d times, have %+v after %d reroutings", n, have.Itinerary, len(have.Reroutings))
+	}
+	if have.NeedsRerouting {
+		t.Errorf("want the changes of readers not stored, have the cargo flagged for rerouting")
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,28 +18,38 @@ import (
 	"github.com/go-kit/kit/log"
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 
+	"github.com/go-kit/examples/shipping/boltdb"
 	"github.com/go-kit/examples/shipping/booking"
 	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/eventsourced"
 	"github.com/go-kit/examples/shipping/handling"
 	"github.com/go-kit/examples/shipping/inmem"
 	"github.com/go-kit/examples/shipping/inspection"
 	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/projection"
 	"github.com/go-kit/examples/shipping/routing"
 	"github.com/go-kit/examples/shipping/tracking"
+	"github.com/go-kit/examples/shipping/voyage"
 )
 
 const (
-	defaultPort              = "8080"
-	defaultRoutingServiceURL = "http://localhost:7878"
+	defaultPort = "8080"
 )
 
 func main() {
 	var (
 		addr  = envString("PORT", defaultPort)
-		rsurl = envString("ROUTINGSERVICE_URL", defaultRoutingServiceURL)
+		rsurl = envString("ROUTINGSERVICE_URL", "")
 
 		httpAddr          = flag.String("http.addr", ":"+addr, "HTTP listen address")
-		routingServiceURL = flag.String("service.routing", rsurl, "routing service URL")
+		routingServiceURL = flag.String("service.routing", rsurl, "routing service URL; routes cargos in-process if empty")
+		minTransferTime   = flag.Duration("routing.min-transfer-time", routing.DefaultMinTransferTime, "time it takes to transfer a cargo between voyages, when routing in-process")
+		storage           = flag.String("storage", "inmem", "where to store the domain objects: inmem, lost on exit, bolt, or events")
+		boltPath          = flag.String("bolt.path", "shipping.db", "BoltDB file to store the domain objects in, with -storage bolt")
+		eventsPath        = flag.String("events.path", "shipping.events", "file to log the events of cargos in, with -storage events")
+		replay            = flag.Bool("replay", false, "rebuild the read models of the cargos in -events.path from scratch, print them as JSON, and exit")
+		webhookURL        = flag.String("notify.webhook", "", "URL to POST notifications of misdirected and arrived cargos to, if any")
+		webhookSecret     = flag.String("notify.secret", "", "secret to sign the notifications to -notify.webhook with")
 
 		ctx = context.Background()
 	)
@@ -48,12 +60,83 @@ func main() {
 	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
 	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
 
+	if *replay {
+		if err := replayReadModels(*eventsPath, os.Stdout); err != nil {
+			logger.Log("replay", *eventsPath, "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
-		cargos         = inmem.NewCargoRepository()
-		locations      = inmem.NewLocationRepository()
-		voyages        = inmem.NewVoyageRepository()
+		cargos         cargo.Repository
+		locations      location.Repository
+		voyages        voyage.Repository
+		handlingEvents cargo.HandlingEventRepository
+		unitOfWork     cargo.UnitOfWork
+	)
+	switch *storage {
+	case "inmem":
+		cargos = inmem.NewCargoRepository()
+		locations = inmem.NewLocationRepository()
+		voyages = inmem.NewVoyageRepository()
 		handlingEvents = inmem.NewHandlingEventRepository()
+		unitOfWork = inmem.NewUnitOfWork(cargos, handlingEvents)
+	case "bolt":
+		db, err := boltdb.Open(*boltPath, log.With(logger, "component", "boltdb"))
+		if err != nil {
+			logger.Log("storage", *storage, "path", *boltPath, "err", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		cargos = boltdb.NewCargoRepository(db)
+		locations = boltdb.NewLocationRepository(db)
+		voyages = boltdb.NewVoyageRepository(db)
+		handlingEvents = boltdb.NewHandlingEventRepository(db)
+		unitOfWork = boltdb.NewUnitOfWork(db)
+	case "events":
+		l, err := eventsourced.OpenLog(*eventsPath)
+		if err != nil {
+			logger.Log("storage", *storage, "path", *eventsPath, "err", err)
+			os.Exit(1)
+		}
+		defer l.Close()
+		r := eventsourced.NewRepository(l, 100)
+		cargos = r.Cargos()
+		locations = inmem.NewLocationRepository()
+		voyages = inmem.NewVoyageRepository()
+		handlingEvents = r.HandlingEvents()
+		unitOfWork = r.UnitOfWork()
+	default:
+		logger.Log("storage", *storage, "err", "unknown storage")
+		os.Exit(1)
+	}
+
+	// Booking and tracking views read cargos from projections, which are
+	// rebuilt on start, and kept up to date as cargos are stored and handled.
+	var (
+		bookingViews  = booking.NewProjection()
+		trackingViews = tracking.NewProjection(locations)
+		projections   = projection.New(cargos, handlingEvents, bookingViews, trackingViews)
 	)
+	cargos = projections.Cargos()
+	handlingEvents = projections.HandlingEvents()
+	unitOfWork = projections.UnitOfWork(unitOfWork)
+	projections.Rebuild()
+
+	// Misdirected cargos are flagged for rerouting, and the parties notified
+	// of them, and of arrived ones.
+	inspectionHandlers := []inspection.EventHandler{
+		inspection.NewLoggingEventHandler(log.With(logger, "component", "inspection")),
+		booking.NewInspectionEventHandler(),
+	}
+	if *webhookURL != "" {
+		outbox := inspection.NewOutbox(1000)
+		inspectionHandlers = append(inspectionHandlers, outbox)
+		unitOfWork = outbox.UnitOfWork(unitOfWork)
+		webhook := inspection.NewWebhook(*webhookURL, []byte(*webhookSecret))
+		go outbox.Relay(ctx, webhook, time.Minute, log.With(logger, "component", "webhook"))
+	}
 
 	// Configure some questionable dependencies.
 	var (
@@ -63,20 +146,27 @@ func main() {
 			LocationRepository: locations,
 		}
 		handlingEventHandler = handling.NewEventHandler(
-			inspection.NewService(cargos, handlingEvents, nil),
+			inspection.NewMultiEventHandler(inspectionHandlers...),
 		)
 	)
 
-	// Facilitate testing by adding some cargos.
-	storeTestData(cargos)
+	// Facilitate testing by adding some cargos, unless there are some from
+	// a previous run.
+	if len(cargos.FindAll()) == 0 {
+		storeTestData(cargos)
+	}
 
 	fieldKeys := []string{"method"}
 
 	var rs routing.Service
-	rs = routing.NewProxyingMiddleware(ctx, *routingServiceURL)(rs)
+	if *routingServiceURL == "" {
+		rs = routing.NewService(voyages, *minTransferTime)
+	} else {
+		rs = routing.NewProxyingMiddleware(ctx, *routingServiceURL)(rs)
+	}
 
 	var bs booking.Service
-	bs = booking.NewService(cargos, locations, handlingEvents, rs)
+	bs = booking.NewService(cargos, locations, unitOfWork, rs, bookingViews)
 	bs = booking.NewLoggingService(log.With(logger, "component", "booking"), bs)
 	bs = booking.NewInstrumentingService(
 		kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
@@ -95,7 +185,7 @@ func main() {
 	)
 
 	var ts tracking.Service
-	ts = tracking.NewService(cargos, handlingEvents)
+	ts = tracking.NewService(trackingViews)
 	ts = tracking.NewLoggingService(log.With(logger, "component", "tracking"), ts)
 	ts = tracking.NewInstrumentingService(
 		kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
@@ -114,7 +204,7 @@ func main() {
 	)
 
 	var hs handling.Service
-	hs = handling.NewService(handlingEvents, handlingEventFactory, handlingEventHandler)
+	hs = handling.NewService(unitOfWork, handlingEventFactory, handlingEventHandler)
 	hs = handling.NewLoggingService(log.With(logger, "component", "handling"), hs)
 	hs = handling.NewInstrumentingService(
 		kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
@@ -139,6 +229,7 @@ func main() {
 	mux.Handle("/booking/v1/", booking.MakeHandler(bs, httpLogger))
 	mux.Handle("/tracking/v1/", tracking.MakeHandler(ts, httpLogger))
 	mux.Handle("/handling/v1/", handling.MakeHandler(hs, httpLogger))
+	mux.Handle("/projections/v1/", projection.MakeHandler(projections, httpLogger))
 
 	http.Handle("/", accessControl(mux))
 	http.Handle("/metrics", promhttp.Handler())
@@ -149,7 +240,7 @@ func main() {
 		errs <- http.ListenAndServe(*httpAddr, nil)
 	}()
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT)
 		errs <- fmt.Errorf("%s", <-c)
 	}()
@@ -179,11 +270,49 @@ func envString(env, fallback string) string {
 	return e
 }
 
+// replayReadModels rebuilds the cargos in the event log at path from scratch,
+// and writes their booking and tracking read models to w, as JSON, one cargo
+// per line.
+func replayReadModels(path string, w io.Writer) error {
+	l, err := eventsourced.OpenLog(path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+	if err := eventsourced.Replay(l, cargos, events); err != nil {
+		return err
+	}
+
+	var (
+		bookingViews  = booking.NewProjection()
+		trackingViews = tracking.NewProjection(inmem.NewLocationRepository())
+		enc           = json.NewEncoder(w)
+	)
+	projection.New(cargos, events, bookingViews, trackingViews).Rebuild()
+
+	cs, _ := bookingViews.Cargos(booking.CargoFilter{})
+	for _, c := range cs {
+		t, err := trackingViews.Find(cargo.TrackingID(c.TrackingID))
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(struct {
+			Booking  booking.Cargo  `json:"booking"`
+			Tracking tracking.Cargo `json:"tracking"`
+		}{c, t}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func storeTestData(r cargo.Repository) {
 	test1 := cargo.New("FTL456", cargo.RouteSpecification{
 		Origin:          location.AUMEL,
 		Destination:     location.SESTO,
-		ArrivalDeadline: time.Now().AddDate(0, 0, 7),
+		ArrivalDeadline: time.Now().AddDate(0, 0, 35),
 	})
 	if err := r.Store(test1); err != nil {
 		panic(err)
@@ -192,7 +321,7 @@ func storeTestData(r cargo.Repository) {
 	test2 := cargo.New("ABC123", cargo.RouteSpecification{
 		Origin:          location.SESTO,
 		Destination:     location.CNHKG,
-		ArrivalDeadline: time.Now().AddDate(0, 0, 14),
+		ArrivalDeadline: time.Now().AddDate(0, 0, 42),
 	})
 	if err := r.Store(test2); err != nil {
 		panic(err)
@@ -0,0 +1,20 @@
+package projection
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type rebuildRequest struct{}
+
+type rebuildResponse struct {
+	Cargos int `json:"cargos"`
+}
+
+func makeRebuildEndpoint(p *Projections) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		_ = request.(rebuildRequest)
+		return rebuildResponse{Cargos: p.Rebuild()}, nil
+	}
+}
@@ -0,0 +1,188 @@
+// Package projection keeps the read models of cargos up to date as their
+// cargos are stored and handled, so that views don't assemble them on every
+// request.
+package projection
+
+import (
+	"sync"
+
+	"github.com/go-kit/examples/shipping/cargo"
+)
+
+// Projector maintains a read model of cargos.
+type Projector interface {
+	// Project updates the read model of c, whose handling history is h.
+	Project(c *cargo.Cargo, h cargo.HandlingHistory)
+
+	// Rebuild builds a new read model off to the side, by calling build with
+	// the Project of an empty one, and then replaces the read model with it
+	// at once, so that readers never see it partly built.
+	Rebuild(build func(project func(c *cargo.Cargo, h cargo.HandlingHistory)))
+}
+
+// Projections feeds projectors the changes made through its repositories
+// and units of work, once they're stored.
+type Projections struct {
+	cargos     cargo.Repository
+	events     cargo.HandlingEventRepository
+	projectors []Projector
+
+	// mtx serializes updates, which read the latest state of a cargo, so
+	// that projectors never see it go back in time.
+	mtx sync.Mutex
+}
+
+// New returns projections of the cargos and handling events in the given
+// repositories. Changes must go through the repositories and units of work
+// it returns to reach the projectors, which start empty until Rebuild.
+func New(cargos cargo.Repository, events cargo.HandlingEventRepository, ps ...Projector) *Projections {
+	return &Projections{
+		cargos:     cargos,
+		events:     events,
+		projectors: ps,
+	}
+}
+
+// Cargos returns a repository that projects the cargos it stores.
+func (p *Projections) Cargos() cargo.Repository {
+	return &cargoRepository{Repository: p.cargos, p: p}
+}
+
+// HandlingEvents returns a repository that projects the cargos of the
+// handling events it stores.
+func (p *Projections) HandlingEvents() cargo.HandlingEventRepository {
+	return &handlingEventRepository{HandlingEventRepository: p.events, p: p}
+}
+
+// UnitOfWork returns a unit of work that projects the cargos the work of u
+// changed, once it's committed. u must work on the repositories of p.
+func (p *Projections) UnitOfWork(u cargo.UnitOfWork) cargo.UnitOfWork {
+	return &unitOfWork{u: u, p: p}
+}
+
+// Rebuild projects all cargos again, into new read models that replace the
+// current ones once they're complete, which serve reads until then. It
+// returns the number of cargos projected.
+func (p *Projections) Rebuild() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	cargos := p.cargos.FindAll()
+	histories := make([]cargo.HandlingHistory, len(cargos))
+	for i, c := range cargos {
+		histories[i] = p.events.QueryHandlingHistory(c.TrackingID)
+	}
+	for _, pr := range p.projectors {
+		pr.Rebuild(func(project func(*cargo.Cargo, cargo.HandlingHistory)) {
+			for i, c := range cargos {
+				project(c, histories[i])
+			}
+		})
+	}
+	return len(cargos)
+}
+
+func (p *Projections) update(ids ...cargo.TrackingID) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for _, id := range ids {
+		c, err := p.cargos.Find(id)
+		if err != nil {
+			// Handling events of unknown cargos have nothing to project.
+			continue
+		}
+		p.project(c)
+	}
+}
+
+func (p *Projections) project(c *cargo.Cargo) {
+	h := p.events.QueryHandlingHistory(c.TrackingID)
+	for _, pr := range p.projectors {
+		pr.Project(c, h)
+	}
+}
+
+type cargoRepository struct {
+	cargo.Repository
+	p *Projections
+}
+
+func (r *cargoRepository) Store(c *cargo.Cargo) error {
+	if err := r.Repository.Store(c); err != nil {
+		return err
+	}
+	r.p.update(c.TrackingID)
+	return nil
+}
+
+type handlingEventRepository struct {
+	cargo.HandlingEventRepository
+	p *Projections
+}
+
+func (r *handlingEventRepository) Store(e cargo.HandlingEvent) error {
+	if err := r.HandlingEventRepository.Store(e); err != nil {
+		return err
+	}
+	r.p.update(e.TrackingID)
+	return nil
+}
+
+type unitOfWork struct {
+	u cargo.UnitOfWork
+	p *Projections
+}
+
+func (u *unitOfWork) Do(work func(cargos cargo.Repository, events cargo.HandlingEventRepository) error) error {
+	var changed changes
+	err := u.u.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		return work(
+			&txCargoRepository{Repository: cargos, changed: &changed},
+			&txHandlingEventRepository{HandlingEventRepository: events, changed: &changed},
+		)
+	})
+	if err != nil {
+		return err
+	}
+	u.p.update(changed...)
+	return nil
+}
+
+// changes records the cargos changed in a unit of work.
+type changes []cargo.TrackingID
+
+func (c *changes) add(id cargo.TrackingID) {
+	for _, v := range *c {
+		if v == id {
+			return
+		}
+	}
+	*c = append(*c, id)
+}
+
+type txCargoRepository struct {
+	cargo.Repository
+	changed *changes
+}
+
+func (r *txCargoRepository) Store(c *cargo.Cargo) error {
+	if err := r.Repository.Store(c); err != nil {
+		return err
+	}
+	r.changed.add(c.TrackingID)
+	return nil
+}
+
+type txHandlingEventRepository struct {
+	cargo.HandlingEventRepository
+	changed *changes
+}
+
+func (r *txHandlingEventRepository) Store(e cargo.HandlingEvent) error {
+	if err := r.HandlingEventRepository.Store(e); err != nil {
+		return err
+	}
+	r.changed.add(e.TrackingID)
+	return nil
+}
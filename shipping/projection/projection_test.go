@@ -0,0 +1,140 @@
+package projection
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/inmem"
+	"github.com/go-kit/examples/shipping/internal/repotest"
+	"github.com/go-kit/examples/shipping/location"
+)
+
+func TestRepositories(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		cargos, events := inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+		p := New(cargos, events, &readModel{})
+		return repotest.Repositories{
+			Cargos:         p.Cargos(),
+			Locations:      inmem.NewLocationRepository(),
+			Voyages:        inmem.NewVoyageRepository(),
+			HandlingEvents: p.HandlingEvents(),
+			UnitOfWork:     p.UnitOfWork(inmem.NewUnitOfWork(cargos, events)),
+		}
+	})
+}
+
+// readModel counts the handling events of the cargos it's projected. It
+// calls rebuilding, if set, once it's rebuilt, before it replaces the counts.
+type readModel struct {
+	mtx        sync.Mutex
+	cargos     map[cargo.TrackingID]int
+	rebuilding func()
+}
+
+func (m *readModel) Project(c *cargo.Cargo, h cargo.HandlingHistory) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.cargos == nil {
+		m.cargos = make(map[cargo.TrackingID]int)
+	}
+	m.cargos[c.TrackingID] = len(h.HandlingEvents)
+}
+
+func (m *readModel) Rebuild(build func(project func(*cargo.Cargo, cargo.HandlingHistory))) {
+	next := &readModel{}
+	build(next.Project)
+	if m.rebuilding != nil {
+		m.rebuilding()
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.cargos = next.cargos
+}
+
+func (m *readModel) events(id cargo.TrackingID) (int, bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	n, ok := m.cargos[id]
+	return n, ok
+}
+
+func TestProjections(t *testing.T) {
+	var (
+		cargos, events = inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+		m              = &readModel{}
+		p              = New(cargos, events, m)
+		uow            = p.UnitOfWork(inmem.NewUnitOfWork(cargos, events))
+		c              = cargo.New("ABC123", cargo.RouteSpecification{Origin: location.SESTO, Destination: location.CNHKG})
+		received       = cargo.HandlingEvent{TrackingID: c.TrackingID, Activity: cargo.HandlingActivity{Type: cargo.Receive, Location: location.SESTO}}
+	)
+
+	// Cargos are projected as they're stored, and handled.
+	if err := p.Cargos().Store(c); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := m.events(c.TrackingID); !ok || n != 0 {
+		t.Errorf("want the cargo projected without events, have %d, %v", n, ok)
+	}
+	if err := p.HandlingEvents().Store(received); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := m.events(c.TrackingID); n != 1 {
+		t.Errorf("want the cargo projected with 1 event, have %d", n)
+	}
+
+	// Units of work are projected once committed, and not if rolled back.
+	errRollback := errors.New("rollback")
+	if err := uow.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		if err := events.Store(received); err != nil {
+			return err
+		}
+		return errRollback
+	}); err != errRollback {
+		t.Fatalf("want %v, have %v", errRollback, err)
+	}
+	if n, _ := m.events(c.TrackingID); n != 1 {
+		t.Errorf("want the rolled back event not projected, have %d events", n)
+	}
+	if err := uow.Do(func(cargos cargo.Repository, events cargo.HandlingEventRepository) error {
+		if err := events.Store(received); err != nil {
+			return err
+		}
+		if n, _ := m.events(c.TrackingID); n != 1 {
+			t.Errorf("want the event not projected before it's committed, have %d events", n)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := m.events(c.TrackingID); n != 2 {
+		t.Errorf("want the cargo projected with 2 events, have %d", n)
+	}
+
+	// Changes that bypass the projections are picked up by a rebuild.
+	d := cargo.New("XYZ789", cargo.RouteSpecification{Origin: location.SESTO, Destination: location.DEHAM})
+	if err := cargos.Store(d); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.events(d.TrackingID); ok {
+		t.Fatal("want the cargo not projected before a rebuild")
+	}
+	m.rebuilding = func() {
+		if _, ok := m.events(c.TrackingID); !ok {
+			t.Error("want the cargo projected while rebuilding")
+		}
+		if _, ok := m.events(d.TrackingID); ok {
+			t.Error("want the cargo not projected until rebuilt")
+		}
+	}
+	if n := p.Rebuild(); n != 2 {
+		t.Errorf("want 2 cargos rebuilt, have %d", n)
+	}
+	if _, ok := m.events(d.TrackingID); !ok {
+		t.Error("want the cargo projected after a rebuild")
+	}
+	if n, _ := m.events(c.TrackingID); n != 2 {
+		t.Errorf("want the cargo projected with 2 events, have %d", n)
+	}
+}
@@ -0,0 +1,52 @@
+package projection
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	kitlog "github.com/go-kit/kit/log"
+	kittransport "github.com/go-kit/kit/transport"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// MakeHandler returns a handler for rebuilding the projections.
+func MakeHandler(p *Projections, logger kitlog.Logger) http.Handler {
+	r := mux.NewRouter()
+
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorHandler(kittransport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encodeError),
+	}
+
+	rebuildHandler := kithttp.NewServer(
+		makeRebuildEndpoint(p),
+		decodeRebuildRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	r.Handle("/projections/v1/rebuild", rebuildHandler).Methods("POST")
+
+	return r
+}
+
+func decodeRebuildRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return rebuildRequest{}, nil
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// encode errors from business-logic
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,111 @@
+package routing
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+// DefaultMinTransferTime is the time it takes to move a cargo from one voyage
+// to another in the same location, unless told otherwise.
+const DefaultMinTransferTime = 6 * time.Hour
+
+// maxLegs bounds the number of legs of the itineraries the service considers,
+// which keeps the search short on large networks.
+const maxLegs = 5
+
+type graphService struct {
+	voyages         voyage.Repository
+	minTransferTime time.Duration
+	now             func() time.Time
+}
+
+// NewService returns a routing service that routes cargos on the carrier
+// movements of the voyages in the repository, without calling out to another
+// application. A cargo is loaded no earlier than the time of the request,
+// transferring it between voyages takes at least minTransferTime, and it
+// must arrive before the arrival deadline of its route specification.
+func NewService(voyages voyage.Repository, minTransferTime time.Duration) Service {
+	return &graphService{
+		voyages:         voyages,
+		minTransferTime: minTransferTime,
+		now:             time.Now,
+	}
+}
+
+// FetchRoutesForSpecification returns the itineraries that satisfy rs,
+// earliest arrival first, and the ones with fewer legs first among those
+// arriving at the same time.
+func (s *graphService) FetchRoutesForSpecification(rs cargo.RouteSpecification) []cargo.Itinerary {
+	if rs.Origin == rs.Destination {
+		return []cargo.Itinerary{}
+	}
+
+	// Each leg a cargo can take departs from a location on a voyage and stays
+	// aboard until any of the following stops of that voyage, up to where its
+	// schedule breaks off, as between sailings that don't connect.
+	departures := make(map[location.UNLocode][]cargo.Leg)
+	for _, v := range s.voyages.FindAll() {
+		ms := v.Schedule.CarrierMovements
+		for i := range ms {
+			for j := i; j < len(ms) && (j == i || ms[j].DepartureLocation == ms[j-1].ArrivalLocation); j++ {
+				l := cargo.NewLeg(v.Number, ms[i].DepartureLocation, ms[j].ArrivalLocation, ms[i].DepartureTime, ms[j].ArrivalTime)
+				departures[l.LoadLocation] = append(departures[l.LoadLocation], l)
+			}
+		}
+	}
+
+	var (
+		itineraries = []cargo.Itinerary{}
+		legs        []cargo.Leg
+		visited     = map[location.UNLocode]bool{rs.Origin: true}
+	)
+	var search func(from location.UNLocode, ready time.Time)
+	search = func(from location.UNLocode, ready time.Time) {
+		if from == rs.Destination {
+			itineraries = append(itineraries, cargo.Itinerary{Legs: append([]cargo.Leg(nil), legs...)})
+			return
+		}
+		if len(legs) == maxLegs {
+			return
+		}
+		for _, l := range departures[from] {
+			switch {
+			case l.LoadTime.Before(ready):
+			case !rs.ArrivalDeadline.IsZero() && l.UnloadTime.After(rs.ArrivalDeadline):
+			case visited[l.UnloadLocation]:
+			case len(legs) > 0 && legs[len(legs)-1].VoyageNumber == l.VoyageNumber:
+				// Staying aboard is a single, longer leg.
+			default:
+				visited[l.UnloadLocation] = true
+				legs = append(legs, l)
+				search(l.UnloadLocation, l.UnloadTime.Add(s.minTransferTime))
+				legs = legs[:len(legs)-1]
+				visited[l.UnloadLocation] = false
+			}
+		}
+	}
+	search(rs.Origin, s.now())
+
+	sort.Slice(itineraries, func(i, j int) bool {
+		a, b := itineraries[i], itineraries[j]
+		if !a.FinalArrivalTime().Equal(b.FinalArrivalTime()) {
+			return a.FinalArrivalTime().Before(b.FinalArrivalTime())
+		}
+		if len(a.Legs) != len(b.Legs) {
+			return len(a.Legs) < len(b.Legs)
+		}
+		// The voyages break ties, so the order doesn't depend on the one of
+		// the repository.
+		for k := range a.Legs {
+			if a.Legs[k].VoyageNumber != b.Legs[k].VoyageNumber {
+				return a.Legs[k].VoyageNumber < b.Legs[k].VoyageNumber
+			}
+		}
+		return false
+	})
+	return itineraries
+}
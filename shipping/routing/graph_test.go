@@ -0,0 +1,117 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+type voyageRepository []*voyage.Voyage
+
+func (r voyageRepository) Find(n voyage.Number) (*voyage.Voyage, error) {
+	for _, v := range r {
+		if v.Number == n {
+			return v, nil
+		}
+	}
+	return nil, voyage.ErrUnknown
+}
+
+func (r voyageRepository) FindAll() []*voyage.Voyage {
+	return r
+}
+
+func TestFetchRoutesForSpecification(t *testing.T) {
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time { return start.Add(time.Duration(hour) * time.Hour) }
+	move := func(from, to location.UNLocode, dep, arr int) voyage.CarrierMovement {
+		return voyage.CarrierMovement{DepartureLocation: from, ArrivalLocation: to, DepartureTime: at(dep), ArrivalTime: at(arr)}
+	}
+	voyages := voyageRepository{
+		voyage.New("A", voyage.Schedule{CarrierMovements: []voyage.CarrierMovement{
+			move(location.SESTO, location.DEHAM, 10, 20),
+			move(location.DEHAM, location.NLRTM, 22, 30),
+		}}),
+		voyage.New("B", voyage.Schedule{CarrierMovements: []voyage.CarrierMovement{
+			move(location.DEHAM, location.CNHKG, 24, 100), // too soon after A arrives
+		}}),
+		voyage.New("C", voyage.Schedule{CarrierMovements: []voyage.CarrierMovement{
+			move(location.NLRTM, location.CNHKG, 40, 90),
+		}}),
+		voyage.New("D", voyage.Schedule{CarrierMovements: []voyage.CarrierMovement{
+			move(location.SESTO, location.CNHKG, 5, 90), // departs before now
+			move(location.SESTO, location.CNHKG, 12, 95),
+			move(location.SESTO, location.CNHKG, 12, 200), // arrives after the deadline
+		}}),
+		voyage.New("E", voyage.Schedule{CarrierMovements: []voyage.CarrierMovement{
+			move(location.DEHAM, location.CNHKG, 30, 90),
+		}}),
+		voyage.New("F", voyage.Schedule{CarrierMovements: []voyage.CarrierMovement{
+			move(location.SESTO, location.JNTKO, 14, 60),
+			move(location.USNYC, location.CNHKG, 61, 70), // doesn't connect
+		}}),
+	}
+	s := NewService(voyages, 6*time.Hour).(*graphService)
+	s.now = func() time.Time { return at(8) }
+
+	have := s.FetchRoutesForSpecification(cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: at(150),
+	})
+	want := []cargo.Itinerary{
+		{Legs: []cargo.Leg{
+			// Staying aboard A through DEHAM is a single leg.
+			cargo.NewLeg("A", location.SESTO, location.NLRTM, at(10), at(30)),
+			cargo.NewLeg("C", location.NLRTM, location.CNHKG, at(40), at(90)),
+		}},
+		{Legs: []cargo.Leg{
+			cargo.NewLeg("A", location.SESTO, location.DEHAM, at(10), at(20)),
+			cargo.NewLeg("E", location.DEHAM, location.CNHKG, at(30), at(90)),
+		}},
+		{Legs: []cargo.Leg{
+			cargo.NewLeg("D", location.SESTO, location.CNHKG, at(12), at(95)),
+		}},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v", want, have)
+	}
+
+	// Nothing arrives before an earlier deadline.
+	if have := s.FetchRoutesForSpecification(cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: at(80),
+	}); len(have) != 0 {
+		t.Errorf("want no itineraries, have %+v", have)
+	}
+}
+
+func TestFetchRoutesForSampleCargos(t *testing.T) {
+	// The sample schedules route the cargos main stores for testing, whenever
+	// it does.
+	start := time.Date(2021, 3, 1, 15, 0, 0, 0, time.UTC)
+	for now := start; now.Before(start.Add(voyage.SamplePeriod)); now = now.Add(6 * time.Hour) {
+		s := NewService(voyageRepository(voyage.SampleSchedules(now, now.Add(voyage.SampleHorizon))), DefaultMinTransferTime).(*graphService)
+		s.now = func() time.Time { return now }
+
+		for _, rs := range []cargo.RouteSpecification{
+			{Origin: location.AUMEL, Destination: location.SESTO, ArrivalDeadline: now.AddDate(0, 0, 35)},
+			{Origin: location.SESTO, Destination: location.CNHKG, ArrivalDeadline: now.AddDate(0, 0, 42)},
+		} {
+			itineraries := s.FetchRoutesForSpecification(rs)
+			if len(itineraries) == 0 {
+				t.Errorf("%s to %s at %s: want itineraries, have none", rs.Origin, rs.Destination, now)
+			}
+			for _, i := range itineraries {
+				if !rs.IsSatisfiedBy(i) {
+					t.Errorf("%s to %s at %s: %+v doesn't satisfy the specification", rs.Origin, rs.Destination, now, i)
+				}
+			}
+		}
+	}
+}
@@ -1,13 +1,13 @@
-// Package routing provides the routing domain service. It does not actually
-// implement the routing service but merely acts as a proxy for a separate
-// bounded context.
+// Package routing provides the routing domain service. It either routes
+// cargos itself, on the schedules of the known voyages, or acts as a proxy for
+// a separate bounded context.
 package routing
 
 import (
 	"github.com/go-kit/examples/shipping/cargo"
 )
 
-// Service provides access to an external routing service.
+// Service provides access to a routing service.
 type Service interface {
 	// FetchRoutesForSpecification finds all possible routes that satisfy a
 	// given specification.
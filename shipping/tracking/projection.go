@@ -0,0 +1,54 @@
+package tracking
+
+import (
+	"sync"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
+)
+
+// Projection maintains the read models of cargos for tracking views.
+type Projection struct {
+	locations location.Repository
+
+	mtx    sync.RWMutex
+	cargos map[cargo.TrackingID]Cargo
+}
+
+// NewProjection returns an empty projection, which names the locations of
+// the cargos from locations.
+func NewProjection(locations location.Repository) *Projection {
+	return &Projection{
+		locations: locations,
+		cargos:    make(map[cargo.TrackingID]Cargo),
+	}
+}
+
+// Project updates the read model of c, whose handling history is h.
+func (p *Projection) Project(c *cargo.Cargo, h cargo.HandlingHistory) {
+	v := assemble(c, h, p.locations)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.cargos[c.TrackingID] = v
+}
+
+// Rebuild replaces the read models with the ones build projects into a new,
+// empty projection.
+func (p *Projection) Rebuild(build func(project func(*cargo.Cargo, cargo.HandlingHistory))) {
+	next := NewProjection(p.locations)
+	build(next.Project)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.cargos = next.cargos
+}
+
+// Find returns the read model of a cargo.
+func (p *Projection) Find(id cargo.TrackingID) (Cargo, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	c, ok := p.cargos[id]
+	if !ok {
+		return Cargo{}, cargo.ErrUnknown
+	}
+	return c, nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/location"
 )
 
 // ErrInvalidArgument is returned when one or more arguments are invalid.
@@ -21,26 +22,21 @@ type Service interface {
 }
 
 type service struct {
-	cargos         cargo.Repository
-	handlingEvents cargo.HandlingEventRepository
+	views *Projection
 }
 
 func (s *service) Track(id string) (Cargo, error) {
 	if id == "" {
 		return Cargo{}, ErrInvalidArgument
 	}
-	c, err := s.cargos.Find(cargo.TrackingID(id))
-	if err != nil {
-		return Cargo{}, err
-	}
-	return assemble(c, s.handlingEvents), nil
+	return s.views.Find(cargo.TrackingID(id))
 }
 
-// NewService returns a new instance of the default Service.
-func NewService(cargos cargo.Repository, events cargo.HandlingEventRepository) Service {
+// NewService returns a new instance of the default Service, which tracks
+// cargos in views, which must be kept up to date with the cargos.
+func NewService(views *Projection) Service {
 	return &service{
-		cargos:         cargos,
-		handlingEvents: events,
+		views: views,
 	}
 }
 
@@ -54,9 +50,20 @@ type Cargo struct {
 	NextExpectedActivity string    `json:"next_expected_activity"`
 	ArrivalDeadline      time.Time `json:"arrival_deadline"`
 	Events               []Event   `json:"events"`
+
+	// Itinerary is the planned route, Timeline what has happened to the
+	// cargo, oldest first, and NextActivities what's expected to happen
+	// next, if it's on track, in order.
+	Itinerary      []Leg               `json:"itinerary,omitempty"`
+	Timeline       []HandlingEvent     `json:"timeline"`
+	NextActivities []PredictedActivity `json:"next_activities"`
+
+	// ETAHistory has how the ETA was recalculated each time the cargo was
+	// rerouted, oldest first.
+	ETAHistory []ETARevision `json:"eta_history,omitempty"`
 }
 
-// Leg is a read model for booking views.
+// Leg is a read model for tracking views.
 type Leg struct {
 	VoyageNumber string    `json:"voyage_number"`
 	From         string    `json:"from"`
@@ -71,7 +78,42 @@ type Event struct {
 	Expected    bool   `json:"expected"`
 }
 
-func assemble(c *cargo.Cargo, events cargo.HandlingEventRepository) Cargo {
+// Activity is a read model of a handling activity for tracking views.
+type Activity struct {
+	Type         string `json:"type"`
+	Location     string `json:"location"`
+	LocationName string `json:"location_name"`
+	VoyageNumber string `json:"voyage_number,omitempty"`
+}
+
+// HandlingEvent is a read model of a registered handling event for tracking
+// views. Leg is the leg of the itinerary it was expected on, if any.
+type HandlingEvent struct {
+	Activity
+	CompletionTime   time.Time `json:"completion_time"`
+	RegistrationTime time.Time `json:"registration_time"`
+	Expected         bool      `json:"expected"`
+	Leg              *Leg      `json:"leg,omitempty"`
+}
+
+// PredictedActivity is a read model of a handling activity expected to
+// happen to a cargo, according to its itinerary, for tracking views. The
+// planned time is only known for loads and unloads.
+type PredictedActivity struct {
+	Activity
+	PlannedTime time.Time `json:"planned_time"`
+	Leg         *Leg      `json:"leg,omitempty"`
+}
+
+// ETARevision is a read model of a recalculation of the ETA of a cargo, as it
+// was rerouted, for tracking views.
+type ETARevision struct {
+	Time        time.Time `json:"time"`
+	PreviousETA time.Time `json:"previous_eta"`
+	ETA         time.Time `json:"eta"`
+}
+
+func assemble(c *cargo.Cargo, h cargo.HandlingHistory, locations location.Repository) Cargo {
 	return Cargo{
 		TrackingID:           string(c.TrackingID),
 		Origin:               string(c.Origin),
@@ -80,24 +122,126 @@ func assemble(c *cargo.Cargo, events cargo.HandlingEventRepository) Cargo {
 		NextExpectedActivity: nextExpectedActivity(c),
 		ArrivalDeadline:      c.RouteSpecification.ArrivalDeadline,
 		StatusText:           assembleStatusText(c),
-		Events:               assembleEvents(c, events),
+		Events:               assembleEvents(c, h),
+		Itinerary:            assembleLegs(*c),
+		Timeline:             assembleTimeline(c, h, locations),
+		NextActivities:       assembleNextActivities(c, locations),
+		ETAHistory:           assembleETAHistory(c),
 	}
 }
 
 func assembleLegs(c cargo.Cargo) []Leg {
 	var legs []Leg
 	for _, l := range c.Itinerary.Legs {
-		legs = append(legs, Leg{
-			VoyageNumber: string(l.VoyageNumber),
-			From:         string(l.LoadLocation),
-			To:           string(l.UnloadLocation),
-			LoadTime:     l.LoadTime,
-			UnloadTime:   l.UnloadTime,
-		})
+		legs = append(legs, assembleLeg(l))
 	}
 	return legs
 }
 
+func assembleLeg(l cargo.Leg) Leg {
+	return Leg{
+		VoyageNumber: string(l.VoyageNumber),
+		From:         string(l.LoadLocation),
+		To:           string(l.UnloadLocation),
+		LoadTime:     l.LoadTime,
+		UnloadTime:   l.UnloadTime,
+	}
+}
+
+func assembleActivity(a cargo.HandlingActivity, locations location.Repository) Activity {
+	var name string
+	if l, err := locations.Find(a.Location); err == nil {
+		name = l.Name
+	}
+	return Activity{
+		Type:         a.Type.String(),
+		Location:     string(a.Location),
+		LocationName: name,
+		VoyageNumber: string(a.VoyageNumber),
+	}
+}
+
+// expectedLeg returns the leg of the itinerary that a is expected on, if
+// it's a load or an unload.
+func expectedLeg(itinerary cargo.Itinerary, a cargo.HandlingActivity) *Leg {
+	for _, l := range itinerary.Legs {
+		if l.VoyageNumber != a.VoyageNumber {
+			continue
+		}
+		if (a.Type == cargo.Load && l.LoadLocation == a.Location) ||
+			(a.Type == cargo.Unload && l.UnloadLocation == a.Location) {
+			leg := assembleLeg(l)
+			return &leg
+		}
+	}
+	return nil
+}
+
+func assembleTimeline(c *cargo.Cargo, h cargo.HandlingHistory, locations location.Repository) []HandlingEvent {
+	var timeline []HandlingEvent
+	for _, e := range h.HandlingEvents {
+		timeline = append(timeline, HandlingEvent{
+			Activity:         assembleActivity(e.Activity, locations),
+			CompletionTime:   e.CompletionTime,
+			RegistrationTime: e.RegistrationTime,
+			Expected:         c.Itinerary.IsExpected(e),
+			Leg:              expectedLeg(c.Itinerary, e.Activity),
+		})
+	}
+	return timeline
+}
+
+// assembleNextActivities returns the activities of the itinerary of c from
+// its next expected one on: receiving it at the origin, loading and
+// unloading it on each leg, and claiming it at the end.
+func assembleNextActivities(c *cargo.Cargo, locations location.Repository) []PredictedActivity {
+	next := c.Delivery.NextExpectedActivity
+	if next.Type == cargo.NotHandled {
+		return nil
+	}
+
+	type planned struct {
+		activity cargo.HandlingActivity
+		time     time.Time
+	}
+	plan := []planned{{activity: cargo.HandlingActivity{Type: cargo.Receive, Location: c.RouteSpecification.Origin}}}
+	for _, l := range c.Itinerary.Legs {
+		plan = append(plan,
+			planned{cargo.HandlingActivity{Type: cargo.Load, Location: l.LoadLocation, VoyageNumber: l.VoyageNumber}, l.LoadTime},
+			planned{cargo.HandlingActivity{Type: cargo.Unload, Location: l.UnloadLocation, VoyageNumber: l.VoyageNumber}, l.UnloadTime},
+		)
+	}
+	plan = append(plan, planned{activity: cargo.HandlingActivity{Type: cargo.Claim, Location: c.Itinerary.FinalArrivalLocation()}})
+
+	for i, p := range plan {
+		if p.activity != next {
+			continue
+		}
+		var activities []PredictedActivity
+		for _, p := range plan[i:] {
+			activities = append(activities, PredictedActivity{
+				Activity:    assembleActivity(p.activity, locations),
+				PlannedTime: p.time,
+				Leg:         expectedLeg(c.Itinerary, p.activity),
+			})
+		}
+		return activities
+	}
+	return []PredictedActivity{{Activity: assembleActivity(next, locations)}}
+}
+
+func assembleETAHistory(c *cargo.Cargo) []ETARevision {
+	var history []ETARevision
+	for _, r := range c.Reroutings {
+		history = append(history, ETARevision{
+			Time:        r.Time,
+			PreviousETA: r.PreviousETA,
+			ETA:         r.ETA,
+		})
+	}
+	return history
+}
+
 func nextExpectedActivity(c *cargo.Cargo) string {
 	a := c.Delivery.NextExpectedActivity
 	prefix := "Next expected activity is to"
@@ -129,9 +273,7 @@ func assembleStatusText(c *cargo.Cargo) string {
 	}
 }
 
-func assembleEvents(c *cargo.Cargo, handlingEvents cargo.HandlingEventRepository) []Event {
-	h := handlingEvents.QueryHandlingHistory(c.TrackingID)
-
+func assembleEvents(c *cargo.Cargo, h cargo.HandlingHistory) []Event {
 	var events []Event
 	for _, e := range h.HandlingEvents {
 		var description string
@@ -140,15 +282,15 @@ func assembleEvents(c *cargo.Cargo, handlingEvents cargo.HandlingEventRepository
 		case cargo.NotHandled:
 			description = "Cargo has not yet been received."
 		case cargo.Receive:
-			description = fmt.Sprintf("Received in %s, at %s", e.Activity.Location, time.Now().Format(time.RFC3339))
+			description = fmt.Sprintf("Received in %s, at %s", e.Activity.Location, e.CompletionTime.Format(time.RFC3339))
 		case cargo.Load:
-			description = fmt.Sprintf("Loaded onto voyage %s in %s, at %s.", e.Activity.VoyageNumber, e.Activity.Location, time.Now().Format(time.RFC3339))
+			description = fmt.Sprintf("Loaded onto voyage %s in %s, at %s.", e.Activity.VoyageNumber, e.Activity.Location, e.CompletionTime.Format(time.RFC3339))
 		case cargo.Unload:
-			description = fmt.Sprintf("Unloaded off voyage %s in %s, at %s.", e.Activity.VoyageNumber, e.Activity.Location, time.Now().Format(time.RFC3339))
+			description = fmt.Sprintf("Unloaded off voyage %s in %s, at %s.", e.Activity.VoyageNumber, e.Activity.Location, e.CompletionTime.Format(time.RFC3339))
 		case cargo.Claim:
-			description = fmt.Sprintf("Claimed in %s, at %s.", e.Activity.Location, time.Now().Format(time.RFC3339))
+			description = fmt.Sprintf("Claimed in %s, at %s.", e.Activity.Location, e.CompletionTime.Format(time.RFC3339))
 		case cargo.Customs:
-			description = fmt.Sprintf("Cleared customs in %s, at %s.", e.Activity.Location, time.Now().Format(time.RFC3339))
+			description = fmt.Sprintf("Cleared customs in %s, at %s.", e.Activity.Location, e.CompletionTime.Format(time.RFC3339))
 		default:
 			description = "[Unknown status]"
 		}
@@ -0,0 +1,152 @@
+package tracking
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/go-kit/examples/shipping/cargo"
+	"github.com/go-kit/examples/shipping/inmem"
+	"github.com/go-kit/examples/shipping/location"
+	"github.com/go-kit/examples/shipping/projection"
+	"github.com/go-kit/examples/shipping/voyage"
+)
+
+var (
+	start = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	day   = func(n int) time.Time { return start.AddDate(0, 0, n) }
+)
+
+func TestHTTPTrackCargo(t *testing.T) {
+	var (
+		locations      = inmem.NewLocationRepository()
+		cargos, events = inmem.NewCargoRepository(), inmem.NewHandlingEventRepository()
+		views          = NewProjection(locations)
+		p              = projection.New(cargos, events, views)
+		factory        = cargo.HandlingEventFactory{
+			CargoRepository:    cargos,
+			VoyageRepository:   inmem.NewVoyageRepository(),
+			LocationRepository: locations,
+		}
+	)
+	cargos, events = p.Cargos(), p.HandlingEvents()
+	srv := httptest.NewServer(MakeHandler(NewService(views), log.NewNopLogger()))
+	defer srv.Close()
+
+	c := cargo.New("ABC123", cargo.RouteSpecification{
+		Origin:          location.SESTO,
+		Destination:     location.CNHKG,
+		ArrivalDeadline: day(20),
+	})
+	c.AssignToRoute(cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg(voyage.V100.Number, location.SESTO, location.DEHAM, day(1), day(3)),
+		cargo.NewLeg(voyage.V300.Number, location.DEHAM, location.CNHKG, day(4), day(12)),
+	}})
+	if err := cargos.Store(c); err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range []cargo.HandlingActivity{
+		{Type: cargo.Receive, Location: location.SESTO},
+		{Type: cargo.Load, Location: location.SESTO, VoyageNumber: voyage.V100.Number},
+	} {
+		e, err := factory.CreateHandlingEvent(day(i+1).Add(time.Hour), day(i+1), c.TrackingID, a.VoyageNumber, a.Location, a.Type)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := events.Store(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.DeriveDeliveryProgress(events.QueryHandlingHistory(c.TrackingID))
+	// Rerouted onboard, to arrive sooner on another voyage from DEHAM.
+	c.AssignToRoute(cargo.Itinerary{Legs: []cargo.Leg{
+		cargo.NewLeg(voyage.V100.Number, location.SESTO, location.DEHAM, day(1), day(3)),
+		cargo.NewLeg(voyage.V400.Number, location.DEHAM, location.CNHKG, day(5), day(10)),
+	}})
+	if err := cargos.Store(c); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(srv.URL + "/tracking/v1/cargos/ABC123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Cargo Cargo `json:"cargo"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	have := body.Cargo
+
+	// The existing fields are still there.
+	if have.StatusText != "Onboard voyage V100" || len(have.Events) != 2 || !have.ETA.Equal(day(10)) {
+		t.Errorf("want the cargo onboard V100 with 2 events and an ETA of %v, have %+v", day(10), have)
+	}
+
+	v100 := &Leg{VoyageNumber: "V100", From: "SESTO", To: "DEHAM", LoadTime: day(1), UnloadTime: day(3)}
+	v400 := &Leg{VoyageNumber: "V400", From: "DEHAM", To: "CNHKG", LoadTime: day(5), UnloadTime: day(10)}
+	normalize(&have)
+
+	wantTimeline := []HandlingEvent{
+		{
+			Activity:         Activity{Type: "Receive", Location: "SESTO", LocationName: "Stockholm"},
+			CompletionTime:   day(1),
+			RegistrationTime: day(1).Add(time.Hour),
+			Expected:         true,
+		},
+		{
+			Activity:         Activity{Type: "Load", Location: "SESTO", LocationName: "Stockholm", VoyageNumber: "V100"},
+			CompletionTime:   day(2),
+			RegistrationTime: day(2).Add(time.Hour),
+			Expected:         true,
+			Leg:              v100,
+		},
+	}
+	if !reflect.DeepEqual(wantTimeline, have.Timeline) {
+		t.Errorf("timeline: want %+v, have %+v", wantTimeline, have.Timeline)
+	}
+
+	wantNext := []PredictedActivity{
+		{Activity: Activity{Type: "Unload", Location: "DEHAM", LocationName: "Hamburg", VoyageNumber: "V100"}, PlannedTime: day(3), Leg: v100},
+		{Activity: Activity{Type: "Load", Location: "DEHAM", LocationName: "Hamburg", VoyageNumber: "V400"}, PlannedTime: day(5), Leg: v400},
+		{Activity: Activity{Type: "Unload", Location: "CNHKG", LocationName: "Hongkong", VoyageNumber: "V400"}, PlannedTime: day(10), Leg: v400},
+		{Activity: Activity{Type: "Claim", Location: "CNHKG", LocationName: "Hongkong"}, PlannedTime: time.Time{}},
+	}
+	if !reflect.DeepEqual(wantNext, have.NextActivities) {
+		t.Errorf("next activities: want %+v, have %+v", wantNext, have.NextActivities)
+	}
+
+	if len(have.ETAHistory) != 1 || !have.ETAHistory[0].PreviousETA.Equal(day(12)) || !have.ETAHistory[0].ETA.Equal(day(10)) {
+		t.Errorf("want the ETA recalculated from %v to %v, have %+v", day(12), day(10), have.ETAHistory)
+	}
+}
+
+// normalize sets the times of c decoded from JSON in UTC, so that they're
+// deeply equal to the ones they were encoded from.
+func normalize(c *Cargo) {
+	utc := func(t *time.Time) { *t = t.UTC() }
+	for i := range c.Timeline {
+		e := &c.Timeline[i]
+		utc(&e.CompletionTime)
+		utc(&e.RegistrationTime)
+		if e.Leg != nil {
+			utc(&e.Leg.LoadTime)
+			utc(&e.Leg.UnloadTime)
+		}
+	}
+	for i := range c.NextActivities {
+		a := &c.NextActivities[i]
+		utc(&a.PlannedTime)
+		if a.Leg != nil {
+			utc(&a.Leg.LoadTime)
+			utc(&a.Leg.UnloadTime)
+		}
+	}
+}
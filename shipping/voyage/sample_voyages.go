@@ -1,6 +1,10 @@
 package voyage
 
-import "github.com/go-kit/examples/shipping/location"
+import (
+	"time"
+
+	"github.com/go-kit/examples/shipping/location"
+)
 
 // A set of sample voyages.
 var (
@@ -38,3 +42,82 @@ var (
 	V0301S = New("0301S", Schedule{[]CarrierMovement{}})
 	V0400S = New("0400S", Schedule{[]CarrierMovement{}})
 )
+
+// SamplePeriod is how often the sample voyages sail their schedules, see
+// SampleSchedules.
+const SamplePeriod = 4 * 7 * 24 * time.Hour
+
+// SampleHorizon is how far ahead the repositories keep the sample voyages
+// scheduled, at least, so that there are always voyages yet to depart to
+// route cargos on.
+const SampleHorizon = 2 * SamplePeriod
+
+// sampleEpoch is when the sample voyages first sailed.
+var sampleEpoch = time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+
+// SampleSchedules returns the sample voyages, with the pathfinder ones calling
+// at a few ports too, with the carrier movements that depart from from until
+// to. The sample voyages themselves have no times; each sails its schedule
+// every SamplePeriod, so the schedules of adjacent ranges add up to the one of
+// both, and repositories can extend theirs as time goes by.
+func SampleSchedules(from, to time.Time) []*Voyage {
+	type movement struct {
+		from, to        location.UNLocode
+		depDay, depHour int
+		arrDay, arrHour int
+	}
+	sailings := []struct {
+		number    Number
+		movements []movement
+	}{
+		{V100.Number, []movement{
+			{location.CNHKG, location.JNTKO, 1, 0, 3, 0},
+			{location.JNTKO, location.USNYC, 4, 0, 12, 0},
+		}},
+		{V300.Number, []movement{
+			{location.JNTKO, location.NLRTM, 0, 0, 8, 0},
+			{location.NLRTM, location.DEHAM, 9, 0, 10, 0},
+			{location.DEHAM, location.AUMEL, 11, 0, 20, 0},
+			{location.AUMEL, location.JNTKO, 21, 0, 25, 0},
+		}},
+		{V400.Number, []movement{
+			{location.DEHAM, location.SESTO, 0, 0, 1, 0},
+			{location.SESTO, location.FIHEL, 2, 0, 3, 0},
+			{location.FIHEL, location.DEHAM, 3, 12, 4, 0},
+		}},
+		{V0100S.Number, []movement{{location.AUMEL, location.CNHKG, 0, 12, 2, 12}}},
+		{V0200T.Number, []movement{{location.CNHKG, location.DEHAM, 3, 0, 5, 0}}},
+		{V0300A.Number, []movement{{location.DEHAM, location.CNHKG, 6, 0, 11, 0}}},
+		{V0301S.Number, []movement{{location.DEHAM, location.SESTO, 5, 12, 5, 20}}},
+		{V0400S.Number, []movement{{location.SESTO, location.DEHAM, 0, 0, 1, 0}}},
+	}
+
+	if from.Before(sampleEpoch) {
+		from = sampleEpoch
+	}
+	// The sailing before the one from falls into may still have movements to
+	// depart.
+	first := sampleEpoch.Add(from.Sub(sampleEpoch)/SamplePeriod*SamplePeriod - SamplePeriod)
+
+	voyages := make([]*Voyage, 0, len(sailings))
+	for _, s := range sailings {
+		ms := []CarrierMovement{}
+		for start := first; start.Before(to); start = start.Add(SamplePeriod) {
+			at := func(day, hour int) time.Time {
+				return start.Add(time.Duration(day*24+hour) * time.Hour)
+			}
+			for _, m := range s.movements {
+				if dep := at(m.depDay, m.depHour); !dep.Before(from) && dep.Before(to) {
+					ms = append(ms, CarrierMovement{
+						DepartureLocation: m.from,
+						ArrivalLocation:   m.to,
+						DepartureTime:     dep,
+						ArrivalTime:       at(m.arrDay, m.arrHour),
+					})
+				}
+			}
+		}
+		voyages = append(voyages, New(s.number, Schedule{ms}))
+	}
+	return voyages
+}
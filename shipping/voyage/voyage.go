@@ -22,6 +22,18 @@ func New(n Number, s Schedule) *Voyage {
 	return &Voyage{Number: n, Schedule: s}
 }
 
+// Extend returns a voyage like v, whose schedule goes on with s, without the
+// carrier movements of v that arrived by now.
+func (v *Voyage) Extend(s Schedule, now time.Time) *Voyage {
+	ms := []CarrierMovement{}
+	for _, m := range v.Schedule.CarrierMovements {
+		if m.ArrivalTime.After(now) {
+			ms = append(ms, m)
+		}
+	}
+	return New(v.Number, Schedule{append(ms, s.CarrierMovements...)})
+}
+
 // Schedule describes a voyage schedule.
 type Schedule struct {
 	CarrierMovements []CarrierMovement
@@ -41,4 +53,5 @@ var ErrUnknown = errors.New("unknown voyage")
 // Repository provides access a voyage store.
 type Repository interface {
 	Find(Number) (*Voyage, error)
+	FindAll() []*Voyage
 }